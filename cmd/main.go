@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	log "github.com/sirupsen/logrus"
@@ -27,7 +28,7 @@ import (
 
 /* error message range: 100-249 */
 
-func getConfigOpt() (*common.DBOptions, *common.RedisOptions, *common.MailerOptions, *common.ServerOptions, *common.RateOptions, *common.JWTOptions, *common.OauthOptions, *common.UserOptions, *common.RoleOptions, *common.LogOptions) {
+func getConfigOpt() (*common.DBOptions, *common.RedisOptions, *common.MailerOptions, *common.ServerOptions, *common.RateOptions, *common.JWTOptions, *common.OauthOptions, *common.UserOptions, *common.RoleOptions, *common.LogOptions, *common.SearchOptions, *common.BlobOptions, *common.ClientCertOptions, *common.OutboundOptions) {
 
 	v, err := common.GetViper()
 	if err != nil {
@@ -117,7 +118,39 @@ func getConfigOpt() (*common.DBOptions, *common.RedisOptions, *common.MailerOpti
 		os.Exit(1)
 	}
 
-	return dbOpt, redisOpt, mailerOpt, serverOpt, rateOpt, jwtOpt, oauthOpt, userOpt, roleOpt, logOpt
+	searchOpt, err := common.GetSearchConfig(v)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 103,
+		}).Error(err)
+		os.Exit(1)
+	}
+
+	blobOpt, err := common.GetBlobConfig(v)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 103,
+		}).Error(err)
+		os.Exit(1)
+	}
+
+	clientCertOpt, err := common.GetClientCertConfig(v)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 103,
+		}).Error(err)
+		os.Exit(1)
+	}
+
+	outboundOpt, err := common.GetOutboundConfig(v)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 103,
+		}).Error(err)
+		os.Exit(1)
+	}
+
+	return dbOpt, redisOpt, mailerOpt, serverOpt, rateOpt, jwtOpt, oauthOpt, userOpt, roleOpt, logOpt, searchOpt, blobOpt, clientCertOpt, outboundOpt
 }
 
 func getKeys(caCertPath string, certPath string, keyPath string) *tls.Config {
@@ -153,10 +186,29 @@ func getKeys(caCertPath string, certPath string, keyPath string) *tls.Config {
 func main() {
 	var err error
 
-	dbOpt, redisOpt, mailerOpt, serverOpt, rateOpt, jwtOpt, _, userOpt, roleOpt, logOpt := getConfigOpt()
+	dbOpt, redisOpt, mailerOpt, serverOpt, rateOpt, jwtOpt, _, userOpt, roleOpt, logOpt, searchOpt, blobOpt, clientCertOpt, outboundOpt := getConfigOpt()
 
 	common.SetUpLogging(logOpt)
 	common.SetJWTOpt(jwtOpt)
+	if serverOpt.ServerTLS != "true" && clientCertOpt.Mode != common.ClientCertAuthOff {
+		// without TLS there is no client certificate to map
+		log.WithFields(log.Fields{
+			"msgnum": 114,
+		}).Warn("client_cert mode needs VILOM_SERVER_TLS, ignored")
+		clientCertOpt.Mode = common.ClientCertAuthOff
+	}
+	common.SetClientCertOpt(clientCertOpt)
+	err = common.SetOutboundOpt(outboundOpt)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 103,
+		}).Error(err)
+		os.Exit(1)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "search" {
+		os.Exit(runSearchCommand(os.Args[2:], dbOpt, searchOpt))
+	}
 
 	dbService, err := common.CreateDBService(dbOpt)
 	if err != nil {
@@ -182,6 +234,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	blobStore, err := common.CreateBlobStore(blobOpt)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 750,
+		}).Error(err)
+		os.Exit(1)
+	}
+
 	store, err := goredisstore.New(redisService.RedisClient, "throttled:")
 	if err != nil {
 		log.WithFields(log.Fields{
@@ -190,7 +250,12 @@ func main() {
 		os.Exit(1)
 	}
 
-	searchIndex := searchservices.InitSearch("", dbService.DB)
+	var searchBackend searchservices.SearchBackend
+	if searchOpt.Backend == searchservices.BackendMySQL {
+		searchBackend = searchservices.NewMySQLBackend(dbService.DB)
+	} else {
+		searchBackend = searchservices.NewBleveBackend(searchservices.InitSearch(searchOpt, dbService.DB))
+	}
 
 	/*authEnforcer, err := casbin.NewEnforcer("./auth_model.conf", "./policy.csv")
 		if err != nil {
@@ -202,19 +267,45 @@ func main() {
 	authEnforcer, err := common.LoadEnforcer(dbService, roleOpt)
 
 	userService := userservices.NewUserService(dbService, redisService, mailerService, jwtOpt, userOpt, authEnforcer)
-	ugroupService := userservices.NewUgroupService(dbService, redisService)
+	ugroupService := userservices.NewUgroupService(dbService, redisService, userOpt)
 	ubadgeService := userservices.NewUbadgeService(dbService, redisService)
+	botService := userservices.NewBotService(dbService, redisService)
+	notificationService := userservices.NewNotificationService(dbService, redisService)
+	digestService := userservices.NewDigestService(dbService, redisService, userOpt)
+	inviteService := userservices.NewInviteService(dbService, redisService, userOpt, authEnforcer)
+	sessionService := userservices.NewSessionService(dbService, redisService)
+	tokenService := userservices.NewTokenService(dbService, redisService)
+	scimService := userservices.NewSCIMService(dbService, redisService, userOpt)
+	ldapService := userservices.NewLDAPService(dbService, redisService, userOpt)
 
 	workspaceService := msgservices.NewWorkspaceService(dbService, redisService)
-	channelService := msgservices.NewChannelService(dbService, redisService)
-	msgService := msgservices.NewMessageService(dbService, redisService)
+	channelService := msgservices.NewChannelService(dbService, redisService, userOpt)
+	msgService := msgservices.NewMessageService(dbService, redisService, userOpt)
+	webhookService := msgservices.NewWebhookService(dbService, redisService, userOpt)
+	incomingWebhookService := msgservices.NewIncomingWebhookService(dbService, redisService, userOpt)
+	uploadService := msgservices.NewUploadService(dbService, redisService, userOpt, blobStore, blobOpt.MaxUploadSize)
+	mentionService := msgservices.NewMentionService(dbService, redisService)
+	grantService := msgservices.NewGrantService(dbService, redisService, userOpt)
+	attachmentService := msgservices.NewAttachmentService(dbService, redisService, blobStore)
+	go webhookService.RunDeliveryWorker(context.Background(), msgservices.WebhookDeliveryInterval)
+	go attachmentService.RunAttachmentWorker(context.Background(), msgservices.AttachmentWorkerInterval)
+	go digestService.RunDigestWorker(context.Background(), userservices.DigestWorkerInterval)
+	if userOpt.LDAP.Enabled {
+		ldapSyncInterval, err := time.ParseDuration(userOpt.LDAP.SyncInterval)
+		if err != nil {
+			ldapSyncInterval = userservices.LDAPSyncInterval
+		}
+		go ldapService.RunLDAPSyncWorker(context.Background(), ldapSyncInterval)
+	}
+	emailOutbox := common.NewEmailOutbox(dbService, mailerService)
+	go emailOutbox.RunOutboxWorker(context.Background(), common.EmailOutboxInterval)
 
-	searchService := searchservices.NewSearchService(dbService, redisService, searchIndex)
+	searchService := searchservices.NewSearchService(dbService, redisService, userOpt, searchBackend)
 
 	mux := http.NewServeMux()
 
-	usercontrollers.Init(userService, ugroupService, ubadgeService, rateOpt, jwtOpt, mux, store)
-	msgcontrollers.Init(workspaceService, channelService, msgService, userService, rateOpt, jwtOpt, mux, store)
+	usercontrollers.Init(userService, ugroupService, ubadgeService, botService, notificationService, digestService, inviteService, sessionService, tokenService, scimService, rateOpt, jwtOpt, userOpt, mux, store)
+	msgcontrollers.Init(workspaceService, channelService, msgService, webhookService, incomingWebhookService, msgService.CommandService, uploadService, mentionService, grantService, userService, rateOpt, jwtOpt, blobOpt, mux, store)
 	searchcontrollers.Init(searchService, userService, rateOpt, jwtOpt, mux, store)
 
 	if serverOpt.ServerTLS == "true" {
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/search/searchservices"
+)
+
+const searchUsage = `usage: vilom search <command>
+
+commands:
+  reindex   build a new index from MySQL next to the live one, verify it and swap it in
+  verify    compare the document counts of the live index against MySQL
+  stats     show the document counts and size of the live index
+  compact   rewrite the live index without deleted documents and swap it in
+`
+
+// runSearchCommand - run a vilom search subcommand, returns the exit code
+func runSearchCommand(args []string, dbOpt *common.DBOptions, searchOpt *common.SearchOptions) int {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, searchUsage)
+		return 2
+	}
+
+	var result interface{}
+	var err error
+	ok := true
+	switch args[0] {
+	case "reindex", "verify":
+		dbService, err := common.CreateDBService(dbOpt)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 110,
+			}).Error(err)
+			return 1
+		}
+		defer dbService.DB.Close()
+		var verification *searchservices.IndexVerification
+		if args[0] == "reindex" {
+			verification, err = searchservices.Reindex(searchOpt, dbService.DB)
+		} else {
+			verification, err = searchservices.VerifyIndex(searchOpt, dbService.DB)
+		}
+		if verification != nil {
+			result = verification
+			ok = verification.OK
+		}
+		if err != nil && verification == nil {
+			log.WithFields(log.Fields{
+				"msgnum": 111,
+			}).Error(err)
+			return 1
+		}
+	case "stats", "compact":
+		var stats *searchservices.IndexStats
+		if args[0] == "stats" {
+			stats, err = searchservices.GetIndexStats(searchOpt)
+		} else {
+			stats, err = searchservices.CompactIndex(searchOpt)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 112,
+			}).Error(err)
+			return 1
+		}
+		result = stats
+	default:
+		fmt.Fprint(os.Stderr, searchUsage)
+		return 2
+	}
+
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 113,
+		}).Error(err)
+		return 1
+	}
+	fmt.Println(string(out))
+	if !ok {
+		return 1
+	}
+	return 0
+}
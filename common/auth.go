@@ -3,11 +3,14 @@ package common
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/sha512"
 	"crypto/subtle"
 	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -16,14 +19,17 @@ import (
 	casbindb "github.com/Blank-Xu/sql-adapter"
 	"github.com/casbin/casbin/v2"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // ContextData - details of a user stored in the Redis cache
 type ContextData struct {
-	Email  string
-	UserID string
-	Roles  []string
+	Email     string
+	UserID    string
+	Roles     []string
+	SessionID string
+	Scopes    []string
 }
 
 // Key - type of the key used in the request context
@@ -37,6 +43,28 @@ const KeyEmailToken Key = "emailtoken"
 type ContextStruct struct {
 	Email       string
 	TokenString string
+	APIToken    bool
+	SessionID   string
+	// IssuedAt - the iat claim of a JWT, 0 when it has none
+	IssuedAt int64
+	// ClientCert - the email the client certificate maps to, set when the
+	// certificate authenticates the request or must match the token
+	ClientCert string
+}
+
+// SiteAdminRole - the role of the site admins, it has the permissions of
+// co_admin, the default role of the users, and the admin only ones
+const SiteAdminRole = "site_admin"
+
+// APITokenPrefix - prefix of the API tokens used by bots and of the
+// personal access tokens, bearer tokens with this prefix are looked up
+// in the api_tokens table instead of being parsed as a JWT
+const APITokenPrefix = "vat_"
+
+// HashAPIToken - only the sha256 of an API token is stored
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // User - details of the user from the database
@@ -76,9 +104,21 @@ func GetAuthBearerToken(r *http.Request) (string, error) {
 	return APIkey, nil
 }
 
-// HashPassword - Generate hash password
-func HashPassword(password string, requestID string) ([]byte, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// HashPassword - Generate hash password with the algorithm of the options
+func HashPassword(password string, opt *PasswordOptions, requestID string) ([]byte, error) {
+	o := passwordDefaults(opt)
+	if o.Algorithm == PasswordArgon2id {
+		salt := make([]byte, argon2SaltLen)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15000}).Error(err)
+			return []byte{}, err
+		}
+		key := argon2.IDKey([]byte(password), salt, o.Argon2Time, o.Argon2Memory, o.Argon2Threads, argon2KeyLen)
+		hash := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, o.Argon2Memory, o.Argon2Time, o.Argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+		return []byte(hash), nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), o.BcryptCost)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"reqid":  requestID,
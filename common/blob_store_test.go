@@ -0,0 +1,130 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	content := []byte("hello blob")
+	key := "workspaces/2/report 2020.txt"
+
+	err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "text/plain")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	got, err := ioutil.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("BlobStore.Get() = %q, %v, want %q", got, err, content)
+	}
+
+	err = store.Delete(ctx, key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = store.Get(ctx, key)
+	if err != ErrBlobNotFound {
+		t.Errorf("BlobStore.Get() of a deleted blob error = %v, want %v", err, ErrBlobNotFound)
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vilom-blobs")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	store, err := NewLocalBlobStore(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	testBlobStore(t, store)
+
+	for _, key := range []string{"", "../escape", "a/../../escape", "/abs"} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("LocalBlobStore.Put(%q), want error", key)
+		}
+	}
+}
+
+// fakeS3 - an S3 compatible stand-in that checks the request signatures
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	secret  string
+	region  string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	want := s3Signature(r.Method, r.URL.EscapedPath(), r.Host, r.Header.Get("X-Amz-Date"), f.secret, f.region)
+	if !strings.HasSuffix(auth, "Signature="+want) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := r.URL.EscapedPath()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		f.objects[path] = body
+	case http.MethodGet:
+		body, ok := f.objects[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3BlobStore(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string][]byte), secret: "minio-secret", region: "us-east-1"}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store := NewS3BlobStore(server.URL, "us-east-1", "vilom", "minio", "minio-secret")
+	testBlobStore(t, store)
+	if _, ok := fake.objects["/vilom/workspaces/2/report%202020.txt"]; ok {
+		t.Errorf("S3BlobStore.Delete() did not delete the object")
+	}
+
+	store.SecretKey = "wrong"
+	err := store.Put(context.Background(), "a.txt", strings.NewReader("x"), 1, "text/plain")
+	if err == nil {
+		t.Errorf("S3BlobStore.Put() with a wrong secret, want error")
+	}
+}
+
+func TestS3Signature(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:9000/vilom/a%20b.txt", nil)
+	signS3Request(req, "AKID", "secret", "us-east-1", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	if req.Header.Get("X-Amz-Date") != "20200102T030405Z" {
+		t.Errorf("X-Amz-Date = %v", req.Header.Get("X-Amz-Date"))
+	}
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20200102/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") {
+		t.Errorf("Authorization = %v", auth)
+	}
+}
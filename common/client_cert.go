@@ -0,0 +1,111 @@
+package common
+
+import (
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/* error message range: 760-799 */
+
+// The client certificate authentication modes, off ignores the
+// certificate; cert authenticates the requests without a bearer token
+// as the user the certificate maps to; both requires a mapped
+// certificate and a bearer token of the same user
+const (
+	ClientCertAuthOff  = "off"
+	ClientCertAuthCert = "cert"
+	ClientCertAuthBoth = "both"
+)
+
+// ClientCertMapping - maps the client certificates with the subject
+// common name CommonName, or with the subject alternative name SAN (a
+// DNS name, email address or URI), to the user or bot with Email
+type ClientCertMapping struct {
+	CommonName string `mapstructure:"common_name"`
+	SAN        string `mapstructure:"san"`
+	Email      string `mapstructure:"email"`
+}
+
+// ClientCertOptions - for authenticating with mTLS client certificates,
+// used when ServerTLS is true
+type ClientCertOptions struct {
+	Mode     string              `mapstructure:"mode"`
+	Mappings []ClientCertMapping `mapstructure:"mappings"`
+}
+
+var clientCertOpt = &ClientCertOptions{Mode: ClientCertAuthOff}
+
+// SetClientCertOpt set client certificate opt used in auth middleware
+func SetClientCertOpt(opt *ClientCertOptions) {
+	clientCertOpt = opt
+}
+
+// GetClientCertOpt get client certificate opt used in auth middleware
+func GetClientCertOpt() *ClientCertOptions {
+	return clientCertOpt
+}
+
+// certSANs - the subject alternative names of the certificate
+func certSANs(cert *x509.Certificate) []string {
+	sans := []string{}
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// MapClientCert - the email the certificate maps to, empty when no
+// mapping matches; a SAN mapping is preferred to a common name one
+func MapClientCert(cert *x509.Certificate, opt *ClientCertOptions) string {
+	for _, mapping := range opt.Mappings {
+		if mapping.SAN == "" {
+			continue
+		}
+		for _, san := range certSANs(cert) {
+			if strings.EqualFold(san, mapping.SAN) {
+				return mapping.Email
+			}
+		}
+	}
+	for _, mapping := range opt.Mappings {
+		if mapping.CommonName != "" && mapping.CommonName == cert.Subject.CommonName {
+			return mapping.Email
+		}
+	}
+	return ""
+}
+
+// GetClientCertIdentity - the email the verified client certificate of
+// the request maps to; every certificate identity is audit logged
+func GetClientCertIdentity(r *http.Request, opt *ClientCertOptions) string {
+	if opt.Mode == "" || opt.Mode == ClientCertAuthOff {
+		return ""
+	}
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	email := MapClientCert(cert, opt)
+	fields := log.Fields{
+		"cert_subject": cert.Subject.String(),
+		"cert_issuer":  cert.Issuer.String(),
+		"cert_serial":  cert.SerialNumber.String(),
+		"cert_sans":    strings.Join(certSANs(cert), ","),
+		"remote_addr":  r.RemoteAddr,
+		"path":         r.URL.Path,
+	}
+	if email == "" {
+		fields["msgnum"] = 760
+		log.WithFields(fields).Warn("client certificate not mapped")
+		return ""
+	}
+	fields["user"] = email
+	fields["msgnum"] = 761
+	log.WithFields(fields).Info("client certificate identity")
+	return email
+}
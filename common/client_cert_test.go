@@ -0,0 +1,81 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestMapClientCert(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://vilom/bots/deploy")
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "ci-runner"},
+		URIs:         []*url.URL{spiffe},
+	}
+	opt := &ClientCertOptions{
+		Mode: ClientCertAuthCert,
+		Mappings: []ClientCertMapping{
+			{CommonName: "ci-runner", Email: "ci@example.com"},
+			{SAN: "spiffe://vilom/bots/deploy", Email: "deploy@example.com"},
+		},
+	}
+	if got := MapClientCert(cert, opt); got != "deploy@example.com" {
+		t.Errorf("MapClientCert() = %v, want the SAN mapping deploy@example.com", got)
+	}
+	cert.URIs = nil
+	if got := MapClientCert(cert, opt); got != "ci@example.com" {
+		t.Errorf("MapClientCert() = %v, want the common name mapping ci@example.com", got)
+	}
+	cert.Subject.CommonName = "unknown"
+	if got := MapClientCert(cert, opt); got != "" {
+		t.Errorf("MapClientCert() = %v, want no mapping", got)
+	}
+}
+
+func TestAuthenticateMiddleware_ClientCert(t *testing.T) {
+	defer SetClientCertOpt(GetClientCertOpt())
+	cert := &x509.Certificate{
+		SerialNumber:   big.NewInt(8),
+		Subject:        pkix.Name{CommonName: "ci-runner"},
+		EmailAddresses: []string{"abcd145@gmail.com"},
+	}
+	var got ContextStruct
+	handler := AuthenticateMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Context().Value(KeyEmailToken).(ContextStruct)
+	}))
+	request := func(withCert bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v0.1/users/me/sessions", nil)
+		if withCert {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		w := httptest.NewRecorder()
+		got = ContextStruct{}
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	mappings := []ClientCertMapping{{SAN: "abcd145@gmail.com", Email: "abcd145@gmail.com"}}
+
+	SetClientCertOpt(&ClientCertOptions{Mode: ClientCertAuthCert, Mappings: mappings})
+	w := request(true)
+	if w.Code != http.StatusOK || got.ClientCert != "abcd145@gmail.com" || got.Email != "abcd145@gmail.com" {
+		t.Errorf("AuthenticateMiddleware() = %v %v, want the request made as the mapped user", w.Code, got)
+	}
+	if w = request(false); w.Code != http.StatusUnauthorized {
+		t.Errorf("AuthenticateMiddleware() = %v, want 401 without a token or certificate", w.Code)
+	}
+
+	SetClientCertOpt(&ClientCertOptions{Mode: ClientCertAuthBoth, Mappings: mappings})
+	if w = request(true); w.Code != http.StatusUnauthorized {
+		t.Errorf("AuthenticateMiddleware() = %v, want 401 without a token", w.Code)
+	}
+	cert.EmailAddresses = nil
+	if w = request(true); w.Code != http.StatusUnauthorized {
+		t.Errorf("AuthenticateMiddleware() = %v, want 401 with an unmapped certificate", w.Code)
+	}
+}
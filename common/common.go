@@ -5,10 +5,12 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"html/template"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	texttemplate "text/template"
 	"time"
 
 	"github.com/google/uuid"
@@ -91,6 +93,16 @@ func GetPathParts(url string) []string {
 	return pathParts
 }
 
+// ClientIP - the IP address of the client of the request, taken from
+// RemoteAddr as the rate limiter does
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // RenderJSON - send JSON response
 func RenderJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -108,6 +120,9 @@ func RenderJSON(w http.ResponseWriter, data interface{}) {
 func RenderErrorJSON(w http.ResponseWriter, errorCode string, errorMsg string, httpStatusCode int, requestID string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusBadRequest)
+	if lw, ok := w.(*localeResponseWriter); ok {
+		errorMsg = LocalizeError(lw.locale, errorCode, errorMsg)
+	}
 	e := Error{ErrorCode: errorCode, ErrorMsg: errorMsg, HTTPStatusCode: httpStatusCode, RequestID: requestID}
 	err := json.NewEncoder(w).Encode(e)
 	if err != nil {
@@ -180,6 +195,21 @@ func ParseTemplate(templateFileName string, data interface{}) (string, error) {
 	return body, nil
 }
 
+// ParseTextTemplate - used for parsing a plain-text template (for emails)
+func ParseTextTemplate(templateFileName string, data interface{}) (string, error) {
+	t, err := texttemplate.ParseFiles(templateFileName)
+	if err != nil {
+		log.WithFields(log.Fields{"msgnum": 276}).Error(err)
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err = t.Execute(buf, data); err != nil {
+		log.WithFields(log.Fields{"msgnum": 277}).Error(err)
+		return "", err
+	}
+	return buf.String(), nil
+}
+
 // EncodeCursor - encode cursor
 func EncodeCursor(cursor uint) string {
 	cursorStr := strconv.FormatUint(uint64(cursor), 10)
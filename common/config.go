@@ -1,6 +1,7 @@
 package common
 
 import (
+	"errors"
 	"os"
 	"strconv"
 
@@ -44,6 +45,8 @@ type MailerOptions struct {
 	Password string `mapstructure:"password"`
 	Port     int    `mapstructure:"port"`
 	Server   string `mapstructure:"server"`
+	Backend  string `mapstructure:"backend"`
+	FileDir  string `mapstructure:"file_dir"`
 }
 
 // ServerOptions - for server config
@@ -79,6 +82,13 @@ type RateOptions struct {
 type JWTOptions struct {
 	JWTKey      []byte
 	JWTDuration int
+
+	// Algorithm is HS256, RS256 or EdDSA; RS256 and EdDSA tokens are
+	// signed with the private key SigningKeyID of Keys, the other keys
+	// still verify the tokens signed before a key rotation
+	Algorithm    string
+	SigningKeyID string
+	Keys         map[string]*JWTKey
 }
 
 // OauthOptions - for oauth config
@@ -87,10 +97,74 @@ type OauthOptions struct {
 	ClientSecret string `mapstructure:"client_secret"`
 }
 
-// UserOptions - for user login
+// UserOptions - for user login, registration and the email digest
 type UserOptions struct {
 	ConfirmTokenDuration string `mapstructure:"confirm_token_duration"`
 	ResetTokenDuration   string `mapstructure:"reset_token_duration"`
+	DigestHour           int    `mapstructure:"digest_hour"`
+	DigestTokenDuration  string `mapstructure:"digest_token_duration"`
+	AppURL               string `mapstructure:"app_url"`
+
+	// Registration is open, invite or domains, domains admits signups
+	// from AllowedDomains only; invited users sign up under any policy
+	Registration   string   `mapstructure:"registration"`
+	AllowedDomains []string `mapstructure:"allowed_domains"`
+	DefaultRole    string   `mapstructure:"default_role"`
+	InviteDuration string   `mapstructure:"invite_duration"`
+
+	LDAP     LDAPOptions     `mapstructure:"ldap"`
+	Password PasswordOptions `mapstructure:"password"`
+
+	// UgroupInheritance is up when the members of a ugroup count as members
+	// of its ancestors or down when they count as members of its descendants
+	UgroupInheritance string `mapstructure:"ugroup_inheritance"`
+
+	// SCIMToken is the bearer token of the identity provider calling the
+	// SCIM endpoints, they are disabled when it is empty
+	SCIMToken string `mapstructure:"scim_token"`
+}
+
+// PasswordOptions - the password policy and how passwords are hashed;
+// History is how many earlier passwords cannot be reused, BreachPath the
+// directory of a breached password hash list in the k-anonymity range
+// format, Algorithm is bcrypt or argon2id; zero values take the defaults
+type PasswordOptions struct {
+	MinLength     int    `mapstructure:"min_length"`
+	MaxLength     int    `mapstructure:"max_length"`
+	RequireUpper  bool   `mapstructure:"require_upper"`
+	RequireLower  bool   `mapstructure:"require_lower"`
+	RequireDigit  bool   `mapstructure:"require_digit"`
+	RequireSymbol bool   `mapstructure:"require_symbol"`
+	History       int    `mapstructure:"history"`
+	BreachPath    string `mapstructure:"breach_path"`
+	Algorithm     string `mapstructure:"algorithm"`
+	BcryptCost    int    `mapstructure:"bcrypt_cost"`
+	Argon2Time    uint32 `mapstructure:"argon2_time"`
+	Argon2Memory  uint32 `mapstructure:"argon2_memory"`
+	Argon2Threads uint8  `mapstructure:"argon2_threads"`
+}
+
+// LDAPOptions - for signing in with an LDAP directory and mirroring its
+// groups; users are found by EmailAttr under UserBaseDN, groups by
+// GroupFilter under GroupBaseDN, SyncGroups names the groups mirrored
+// (all of them when empty) by their GroupNameAttr
+type LDAPOptions struct {
+	Enabled       bool     `mapstructure:"enabled"`
+	URL           string   `mapstructure:"url"`
+	BindDN        string   `mapstructure:"bind_dn"`
+	BindPassword  string   `mapstructure:"bind_password"`
+	Timeout       string   `mapstructure:"timeout"`
+	UserBaseDN    string   `mapstructure:"user_base_dn"`
+	UserFilter    string   `mapstructure:"user_filter"`
+	EmailAttr     string   `mapstructure:"email_attr"`
+	FirstNameAttr string   `mapstructure:"first_name_attr"`
+	LastNameAttr  string   `mapstructure:"last_name_attr"`
+	GroupBaseDN   string   `mapstructure:"group_base_dn"`
+	GroupFilter   string   `mapstructure:"group_filter"`
+	GroupNameAttr string   `mapstructure:"group_name_attr"`
+	MemberAttr    string   `mapstructure:"member_attr"`
+	SyncGroups    []string `mapstructure:"sync_groups"`
+	SyncInterval  string   `mapstructure:"sync_interval"`
 }
 
 // LogOptions - for logging
@@ -99,6 +173,27 @@ type LogOptions struct {
 	Level string `mapstructure:"log_level"`
 }
 
+// SearchOptions - for the search index
+type SearchOptions struct {
+	Backend        string `mapstructure:"backend"`
+	IndexPath      string `mapstructure:"index_path"`
+	MappingVersion int    `mapstructure:"mapping_version"`
+	ReloadInterval string `mapstructure:"reload_interval"`
+}
+
+// BlobOptions - for the storage of uploaded files, the S3 keys are
+// read from the environment
+type BlobOptions struct {
+	Backend       string `mapstructure:"backend"`
+	LocalPath     string `mapstructure:"local_path"`
+	S3Endpoint    string `mapstructure:"s3_endpoint"`
+	S3Region      string `mapstructure:"s3_region"`
+	S3Bucket      string `mapstructure:"s3_bucket"`
+	S3AccessKey   string
+	S3SecretKey   string
+	MaxUploadSize int64 `mapstructure:"max_upload_size"`
+}
+
 // RoleOptions - for Role
 type RoleOptions struct {
 	Roles                 []Role `mapstructure:"roles"`
@@ -155,6 +250,11 @@ func GetRedisConfig(v *viper.Viper) (*RedisOptions, error) {
 // GetMailerConfig -- read mailer config options
 func GetMailerConfig(v *viper.Viper) (*MailerOptions, error) {
 	mailerOpt := MailerOptions{}
+	mailerOpt.Backend = v.GetString("VILOM_MAILER_BACKEND")
+	mailerOpt.FileDir = v.GetString("VILOM_MAILER_FILE_DIR")
+	if mailerOpt.Backend == MailerBackendFile {
+		return &mailerOpt, nil
+	}
 	mailerOpt.Server = v.GetString("VILOM_MAILER_SERVER")
 	MailerPort, err := strconv.Atoi(v.GetString("VILOM_MAILER_PORT"))
 	if err != nil {
@@ -205,6 +305,40 @@ func GetJWTConfig(v *viper.Viper) (*JWTOptions, error) {
 		}).Error(err)
 		return nil, err
 	}
+	jwtOpt.Algorithm = v.GetString("VILOM_JWT_ALG")
+	if jwtOpt.Algorithm == "" {
+		jwtOpt.Algorithm = JWTAlgHS256
+	}
+	jwtOpt.SigningKeyID = v.GetString("VILOM_JWT_KID")
+	jwtOpt.Keys = map[string]*JWTKey{}
+	keysDir := v.GetString("VILOM_JWT_KEYS_DIR")
+	if keysDir != "" {
+		jwtOpt.Keys, err = LoadJWTKeys(keysDir)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 511,
+			}).Error(err)
+			return nil, err
+		}
+	}
+	switch jwtOpt.Algorithm {
+	case JWTAlgHS256:
+	case JWTAlgRS256, JWTAlgEdDSA:
+		key, ok := jwtOpt.Keys[jwtOpt.SigningKeyID]
+		if !ok || key.PrivateKey == nil || key.Algorithm != jwtOpt.Algorithm {
+			err = errors.New("VILOM_JWT_KID must name a private " + jwtOpt.Algorithm + " key in VILOM_JWT_KEYS_DIR")
+			log.WithFields(log.Fields{
+				"msgnum": 512,
+			}).Error(err)
+			return nil, err
+		}
+	default:
+		err = errors.New("Unsupported VILOM_JWT_ALG " + jwtOpt.Algorithm)
+		log.WithFields(log.Fields{
+			"msgnum": 513,
+		}).Error(err)
+		return nil, err
+	}
 	return &jwtOpt, nil
 }
 
@@ -225,6 +359,12 @@ func GetUserConfig(v *viper.Viper) (*UserOptions, error) {
 		}).Error(err)
 		return nil, err
 	}
+	if bindPassword := v.GetString("VILOM_LDAP_BIND_PASSWORD"); bindPassword != "" {
+		userOpt.LDAP.BindPassword = bindPassword
+	}
+	if scimToken := v.GetString("VILOM_SCIM_TOKEN"); scimToken != "" {
+		userOpt.SCIMToken = scimToken
+	}
 	return &userOpt, nil
 }
 
@@ -236,6 +376,95 @@ func GetLogConfig(v *viper.Viper) (*LogOptions, error) {
 	return &logOpt, nil
 }
 
+// GetSearchConfig -- read search config options
+func GetSearchConfig(v *viper.Viper) (*SearchOptions, error) {
+	searchOpt := SearchOptions{}
+	if err := v.UnmarshalKey("search_options", &searchOpt); err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 509,
+		}).Error(err)
+		return nil, err
+	}
+	if indexPath := v.GetString("VILOM_SEARCH_INDEX_PATH"); indexPath != "" {
+		searchOpt.IndexPath = indexPath
+	}
+	return &searchOpt, nil
+}
+
+// GetBlobConfig -- read blob store config options
+func GetBlobConfig(v *viper.Viper) (*BlobOptions, error) {
+	blobOpt := BlobOptions{}
+	if err := v.UnmarshalKey("blob_options", &blobOpt); err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 510,
+		}).Error(err)
+		return nil, err
+	}
+	if localPath := v.GetString("VILOM_BLOB_LOCAL_PATH"); localPath != "" {
+		blobOpt.LocalPath = localPath
+	}
+	blobOpt.S3AccessKey = v.GetString("VILOM_BLOB_S3_ACCESS_KEY")
+	blobOpt.S3SecretKey = v.GetString("VILOM_BLOB_S3_SECRET_KEY")
+	return &blobOpt, nil
+}
+
+// GetClientCertConfig -- read client certificate config options
+func GetClientCertConfig(v *viper.Viper) (*ClientCertOptions, error) {
+	clientCertOpt := ClientCertOptions{}
+	if err := v.UnmarshalKey("client_cert", &clientCertOpt); err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 514,
+		}).Error(err)
+		return nil, err
+	}
+	if mode := v.GetString("VILOM_CLIENT_CERT_MODE"); mode != "" {
+		clientCertOpt.Mode = mode
+	}
+	switch clientCertOpt.Mode {
+	case "":
+		clientCertOpt.Mode = ClientCertAuthOff
+	case ClientCertAuthOff, ClientCertAuthCert, ClientCertAuthBoth:
+	default:
+		err := errors.New("Unsupported client_cert mode " + clientCertOpt.Mode)
+		log.WithFields(log.Fields{
+			"msgnum": 515,
+		}).Error(err)
+		return nil, err
+	}
+	for _, mapping := range clientCertOpt.Mappings {
+		if mapping.Email == "" || (mapping.CommonName == "" && mapping.SAN == "") {
+			err := errors.New("A client_cert mapping needs an email and a common_name or san")
+			log.WithFields(log.Fields{
+				"msgnum": 516,
+			}).Error(err)
+			return nil, err
+		}
+	}
+	return &clientCertOpt, nil
+}
+
+// GetOutboundConfig -- read the options of the requests to user supplied
+// urls, the default denied networks are used when none are configured
+func GetOutboundConfig(v *viper.Viper) (*OutboundOptions, error) {
+	outboundOpt := OutboundOptions{}
+	if err := v.UnmarshalKey("outbound_options", &outboundOpt); err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 517,
+		}).Error(err)
+		return nil, err
+	}
+	if !v.IsSet("outbound_options.denied_nets") {
+		outboundOpt.DeniedNets = DefaultDeniedNets
+	}
+	if _, err := parseNets(outboundOpt.DeniedNets); err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 518,
+		}).Error(err)
+		return nil, err
+	}
+	return &outboundOpt, nil
+}
+
 // GetRoleConfig -- read Roles config options
 func GetRoleConfig(v *viper.Viper) (*RoleOptions, error) {
 	roleOpt := RoleOptions{}
@@ -335,8 +564,19 @@ func CreateRedisService(redisOpt *RedisOptions) (*RedisService, error) {
 	return redisService, nil
 }
 
-// CreateMailerService -- init mailer
-func CreateMailerService(mailerOpt *MailerOptions) (*MailerService, error) {
+// CreateMailerService -- init mailer, the file backend writes the emails
+// to FileDir instead of sending them
+func CreateMailerService(mailerOpt *MailerOptions) (MailerIntf, error) {
+	if mailerOpt.Backend == MailerBackendFile {
+		fileMailer, err := NewFileMailer(mailerOpt.FileDir)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 750,
+			}).Error(err)
+			return nil, err
+		}
+		return fileMailer, nil
+	}
 	mailerService, err := NewMailerService(mailerOpt)
 	if err != nil {
 		log.WithFields(log.Fields{
@@ -346,3 +586,18 @@ func CreateMailerService(mailerOpt *MailerOptions) (*MailerService, error) {
 	}
 	return mailerService, nil
 }
+
+// CreateBlobStore -- init blob store
+func CreateBlobStore(blobOpt *BlobOptions) (BlobStore, error) {
+	if blobOpt.Backend == BlobBackendS3 {
+		return NewS3BlobStore(blobOpt.S3Endpoint, blobOpt.S3Region, blobOpt.S3Bucket, blobOpt.S3AccessKey, blobOpt.S3SecretKey), nil
+	}
+	blobStore, err := NewLocalBlobStore(blobOpt.LocalPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 750,
+		}).Error(err)
+		return nil, err
+	}
+	return blobStore, nil
+}
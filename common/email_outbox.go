@@ -0,0 +1,269 @@
+package common
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/* error message range: 800-899 */
+
+// Email outbox states, an email that failed EmailRetryMax times is dead
+// and left for an operator to look at
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailDead    = "dead"
+)
+
+// The outbox worker delivers up to EmailOutboxBatch emails every
+// EmailOutboxInterval, a failed email is retried after EmailBackoffBase,
+// doubling on each failure up to EmailBackoffMax; an email claimed by a
+// worker that died is picked up again after EmailClaimTimeout
+const (
+	EmailOutboxInterval = 30 * time.Second
+	EmailOutboxBatch    = 20
+	EmailRetryMax       = 8
+	EmailBackoffBase    = time.Minute
+	EmailBackoffMax     = 6 * time.Hour
+	EmailClaimTimeout   = 5 * time.Minute
+)
+
+// EmailOutbox - delivers the emails queued with QueueEmail
+type EmailOutbox struct {
+	DBService *DBService
+	Mailer    MailerIntf
+}
+
+// NewEmailOutbox - Create the email outbox
+func NewEmailOutbox(dbOpt *DBService, mailer MailerIntf) *EmailOutbox {
+	return &EmailOutbox{
+		DBService: dbOpt,
+		Mailer:    mailer,
+	}
+}
+
+// QueueEmail - store the email in the outbox as part of tx, it is sent
+// after tx commits and is dropped when tx rolls back
+func QueueEmail(ctx context.Context, tx *sql.Tx, msg Email, requestID string) error {
+	uuid4, err := GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 810}).Error(err)
+		return err
+	}
+	tn, tnday, tnweek, tnmonth, tnyear := GetTimeDetails()
+	_, err = tx.ExecContext(ctx, `insert into email_outbox
+	  (
+      uuid4,
+			from_addr,
+			to_addr,
+			cc_addr,
+			subject,
+			body,
+			text_body,
+			status,
+			attempts,
+			next_attempt_at,
+			last_error,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?,?,?,?,?,?);`,
+		uuid4,
+		msg.From,
+		msg.To,
+		msg.Cc,
+		msg.Subject,
+		msg.Body,
+		msg.TextBody,
+		EmailPending,
+		0,
+		tn,
+		"",
+		/*  StatusDates  */
+		Active,
+		tn,
+		tn,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 811}).Error(err)
+		return err
+	}
+	return nil
+}
+
+// emailBackoff - how long to wait before the next attempt, after the
+// email failed attempts times
+func emailBackoff(attempts int) time.Duration {
+	backoff := EmailBackoffBase
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= EmailBackoffMax {
+			return EmailBackoffMax
+		}
+	}
+	return backoff
+}
+
+// RunOutboxWorker - deliver the pending emails every interval until ctx is done
+func (eo *EmailOutbox) RunOutboxWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := eo.DeliverPending(ctx, GetRequestID())
+			if err != nil {
+				log.WithFields(log.Fields{"msgnum": 812}).Error(err)
+			}
+		}
+	}
+}
+
+// DeliverPending - send the emails that are due and return how many
+// were sent
+func (eo *EmailOutbox) DeliverPending(ctx context.Context, requestID string) (int, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 813}).Error(err)
+		return 0, err
+	default:
+		tn, _, _, _, _ := GetTimeDetails()
+		db := eo.DBService.DB
+		rows, err := db.QueryContext(ctx, `select id from email_outbox where status = ? and next_attempt_at <= ? and statusc = ? order by id limit ?;`, EmailPending, tn, Active, EmailOutboxBatch)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 814}).Error(err)
+			return 0, err
+		}
+		ids := []uint{}
+		for rows.Next() {
+			var id uint
+			err = rows.Scan(&id)
+			if err != nil {
+				log.WithFields(log.Fields{"reqid": requestID, "msgnum": 815}).Error(err)
+				err = rows.Close()
+				return 0, err
+			}
+			ids = append(ids, id)
+		}
+		err = rows.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 816}).Error(err)
+			return 0, err
+		}
+		err = rows.Err()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 817}).Error(err)
+			return 0, err
+		}
+
+		sent := 0
+		for _, id := range ids {
+			ok, err := eo.deliver(ctx, id, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"reqid": requestID, "msgnum": 818}).Error(err)
+				continue
+			}
+			if ok {
+				sent++
+			}
+		}
+		return sent, nil
+	}
+}
+
+// deliver - claim the email and send it, ok is false when the email was
+// claimed by another worker or could not be sent
+func (eo *EmailOutbox) deliver(ctx context.Context, id uint, requestID string) (bool, error) {
+	db := eo.DBService.DB
+	tn, tnday, tnweek, tnmonth, tnyear := GetTimeDetails()
+	res, err := db.ExecContext(ctx, `update email_outbox set next_attempt_at = ? where id = ? and status = ? and next_attempt_at <= ?;`, tn.Add(EmailClaimTimeout), id, EmailPending, tn)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 819}).Error(err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 820}).Error(err)
+		return false, err
+	}
+	if n != 1 {
+		return false, nil
+	}
+
+	msg := Email{}
+	var attempts int
+	row := db.QueryRowContext(ctx, `select from_addr, to_addr, cc_addr, subject, body, text_body, attempts from email_outbox where id = ?;`, id)
+	err = row.Scan(&msg.From, &msg.To, &msg.Cc, &msg.Subject, &msg.Body, &msg.TextBody, &attempts)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 821}).Error(err)
+		return false, err
+	}
+
+	senderr := eo.Mailer.SendMail(msg)
+	if senderr == nil {
+		_, err = db.ExecContext(ctx, `update email_outbox set
+		  status = ?,
+		  sent_at = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where id = ?;`,
+			EmailSent, tn, tn, tnday, tnweek, tnmonth, tnyear, id)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 822}).Error(err)
+			return true, err
+		}
+		return true, nil
+	}
+
+	log.WithFields(log.Fields{"reqid": requestID, "msgnum": 823}).Error(senderr)
+	attempts++
+	status := EmailPending
+	if attempts >= EmailRetryMax {
+		status = EmailDead
+	}
+	lastError := senderr.Error()
+	if len(lastError) > 255 {
+		lastError = lastError[:255]
+	}
+	_, err = db.ExecContext(ctx, `update email_outbox set
+		  status = ?,
+		  attempts = ?,
+		  next_attempt_at = ?,
+		  last_error = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where id = ?;`,
+		status, attempts, tn.Add(emailBackoff(attempts)), lastError, tn, tnday, tnweek, tnmonth, tnyear, id)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 824}).Error(err)
+		return false, err
+	}
+	return false, nil
+}
@@ -0,0 +1,156 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/* error message range: 900-949 */
+
+// DefaultLocale - the locale used when the user has none, or the
+// requested locale has no translation
+const DefaultLocale = "en"
+
+// Locales - the supported locales
+var Locales = []string{"en", "fr"}
+
+// messages - the translated strings by locale and key; email subjects
+// are keyed "email.<template>.subject" and API error messages
+// "error.<error code>"
+var messages = map[string]map[string]string{
+	"en": {
+		"email.confirmation.subject":   "Confirmation",
+		"email.reset_password.subject": "Reset Password",
+		"email.change_email.subject":   "Change Email",
+		"email.digest.daily.subject":   "Your daily digest",
+		"email.digest.weekly.subject":  "Your weekly digest",
+		"email.account_locked.subject": "Your account has been locked",
+		"error.1000":                   "Invalid Request",
+		"error.1002":                   "Client closed connection",
+		"error.8003":                   "Invalid workspace_id",
+		"error.9103":                   "Invalid channel_id",
+		"error.10003":                  "Invalid workspace_id",
+		"error.11001":                  "Missing file",
+		"error.12901":                  "Streaming not supported",
+	},
+	"fr": {
+		"email.confirmation.subject":   "Confirmation de votre compte",
+		"email.reset_password.subject": "Réinitialisation du mot de passe",
+		"email.change_email.subject":   "Changement d'adresse e-mail",
+		"email.digest.daily.subject":   "Votre résumé quotidien",
+		"email.digest.weekly.subject":  "Votre résumé hebdomadaire",
+		"email.account_locked.subject": "Votre compte a été verrouillé",
+		"error.1000":                   "Requête invalide",
+		"error.1002":                   "Le client a fermé la connexion",
+		"error.8003":                   "workspace_id invalide",
+		"error.9103":                   "channel_id invalide",
+		"error.10003":                  "workspace_id invalide",
+		"error.11001":                  "Fichier manquant",
+		"error.12901":                  "Streaming non pris en charge",
+	},
+}
+
+// MatchLocale - the supported locale for the language tag, "fr-CA" and
+// "fr_CA" match "fr"; empty when the language is not supported
+func MatchLocale(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	for _, locale := range Locales {
+		if tag == locale {
+			return locale
+		}
+	}
+	return ""
+}
+
+// ParseAcceptLanguage - the supported locale the Accept-Language header
+// prefers, DefaultLocale when it names none
+func ParseAcceptLanguage(header string) string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	candidates := []weighted{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		locale := MatchLocale(fields[0])
+		if locale == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, weighted{locale, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return DefaultLocale
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].locale
+}
+
+// T - the string for key in the locale, falling back to DefaultLocale
+// and then to the key itself
+func T(locale string, key string) string {
+	if msg, ok := messages[locale][key]; ok {
+		return msg
+	}
+	if msg, ok := messages[DefaultLocale][key]; ok {
+		return msg
+	}
+	return key
+}
+
+// LocalizeError - the message of the API error errorCode in the locale;
+// msg is kept for the default locale and for errors without a
+// translation, as it often carries the details of the error
+func LocalizeError(locale string, errorCode string, msg string) string {
+	if locale == "" || locale == DefaultLocale {
+		return msg
+	}
+	if translated, ok := messages[locale]["error."+errorCode]; ok {
+		return translated
+	}
+	return msg
+}
+
+// RenderEmail - render the email template name under viewsDir in the
+// locale, falling back to DefaultLocale when the locale has no such
+// template; it returns the HTML body from <locale>/<name>.html and the
+// plain-text alternative from <locale>/<name>.txt
+func RenderEmail(viewsDir string, locale string, name string, data interface{}) (string, string, error) {
+	dir := filepath.Join(viewsDir, DefaultLocale)
+	if locale != "" && locale != DefaultLocale {
+		localeDir := filepath.Join(viewsDir, locale)
+		if _, err := os.Stat(filepath.Join(localeDir, name+".html")); err == nil {
+			dir = localeDir
+		}
+	}
+	body, err := ParseTemplate(filepath.Join(dir, name+".html"), data)
+	if err != nil {
+		log.WithFields(log.Fields{"msgnum": 900}).Error(err)
+		return "", "", err
+	}
+	textBody, err := ParseTextTemplate(filepath.Join(dir, name+".txt"), data)
+	if err != nil {
+		log.WithFields(log.Fields{"msgnum": 901}).Error(err)
+		return "", "", err
+	}
+	return body, textBody, nil
+}
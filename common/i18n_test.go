@@ -0,0 +1,95 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", DefaultLocale},
+		{"de-DE", DefaultLocale},
+		{"fr-CA", "fr"},
+		{"FR_fr", "fr"},
+		{"de;q=0.9, fr;q=0.5, en;q=0.4", "fr"},
+		{"en;q=0.3, fr;q=0.7", "fr"},
+		{"fr;q=0, en", "en"},
+	}
+	for _, tt := range tests {
+		if got := ParseAcceptLanguage(tt.header); got != tt.want {
+			t.Errorf("ParseAcceptLanguage(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("fr", "email.digest.daily.subject"); got != "Votre résumé quotidien" {
+		t.Errorf("T() = %v, want the French subject", got)
+	}
+	if got := T("de", "email.digest.daily.subject"); got != "Your daily digest" {
+		t.Errorf("T() = %v, want the English fallback", got)
+	}
+	if got := T("fr", "no.such.key"); got != "no.such.key" {
+		t.Errorf("T() = %v, want the key", got)
+	}
+}
+
+func TestRenderEmail(t *testing.T) {
+	data := struct {
+		Title string
+		URL   string
+	}{
+		Title: "Confirmation",
+		URL:   "http://localhost/u/confirmation/a&b",
+	}
+	body, textBody, err := RenderEmail("views", "fr", "confirmation", data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !strings.Contains(body, "Merci") || !strings.Contains(body, "a&amp;b") {
+		t.Errorf("RenderEmail() body = %v, want the French escaped body", body)
+	}
+	if !strings.Contains(textBody, "Merci") || !strings.Contains(textBody, "a&b") {
+		t.Errorf("RenderEmail() textBody = %v, want the French plain text", textBody)
+	}
+
+	body, _, err = RenderEmail("views", "de", "confirmation", data)
+	if err != nil || !strings.Contains(body, "Thank you") {
+		t.Errorf("RenderEmail() = %v, %v, want the English fallback", body, err)
+	}
+}
+
+func TestLocaleMiddleware(t *testing.T) {
+	h := LocaleMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RenderErrorJSON(w, r.URL.Query().Get("code"), r.URL.Query().Get("msg"), 402, "req")
+	}))
+	tests := []struct {
+		code     string
+		msg      string
+		language string
+		want     string
+	}{
+		{"1000", "Invalid Request", "fr", "Requête invalide"},
+		{"1000", "Invalid Request", "en", "Invalid Request"},
+		{"1000", "Invalid Request", "", "Invalid Request"},
+		{"4001", "sql: no rows in result set", "fr", "sql: no rows in result set"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/?code="+tt.code+"&msg="+strings.Replace(tt.msg, " ", "+", -1), nil)
+		r.Header.Set("Accept-Language", tt.language)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		e := Error{}
+		err := json.NewDecoder(w.Body).Decode(&e)
+		if err != nil || e.ErrorMsg != tt.want {
+			t.Errorf("RenderErrorJSON() error_msg = %v, %v, want %v", e.ErrorMsg, err, tt.want)
+		}
+	}
+}
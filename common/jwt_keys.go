@@ -0,0 +1,253 @@
+package common
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
+)
+
+/* error message range: 950-999 */
+
+// The JWT signing algorithms, HS256 signs with the shared VILOM_JWT_KEY,
+// RS256 and EdDSA sign with a private key and are verified with its
+// public key
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+	JWTAlgEdDSA = "EdDSA"
+)
+
+// JWTKey - a key tokens are signed or verified with, ID is the kid
+// header of the tokens; keys without PrivateKey only verify the tokens
+// signed before a rotation
+type JWTKey struct {
+	ID         string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// JWK - a public key in a JSON Web Key Set
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS - the JSON Web Key Set served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// SigningMethodEdDSA - the EdDSA (Ed25519) JWT signing method, which
+// jwt-go does not provide
+type SigningMethodEdDSA struct{}
+
+func init() {
+	jwt.RegisterSigningMethod(JWTAlgEdDSA, func() jwt.SigningMethod {
+		return &SigningMethodEdDSA{}
+	})
+}
+
+// Alg - the alg header of the method
+func (m *SigningMethodEdDSA) Alg() string {
+	return JWTAlgEdDSA
+}
+
+// Verify - verify the signature with an ed25519.PublicKey
+func (m *SigningMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Sign - sign with an ed25519.PrivateKey
+func (m *SigningMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+// keyAlgorithm - the JWT algorithm of a public key
+func keyAlgorithm(key crypto.PublicKey) (string, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return JWTAlgRS256, nil
+	case ed25519.PublicKey:
+		return JWTAlgEdDSA, nil
+	}
+	return "", fmt.Errorf("Unsupported key type %T", key)
+}
+
+// parseJWTKeyPEM - the private or public key in the PEM data
+func parseJWTKeyPEM(data []byte) (crypto.Signer, crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("No PEM data found")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, nil, fmt.Errorf("Unsupported key type %T", key)
+		}
+		return signer, signer.Public(), nil
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, key.Public(), nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, key, nil
+	}
+	return nil, nil, errors.New("Unsupported PEM block " + block.Type)
+}
+
+// LoadJWTKeys - load the keys in the .pem files of dir, the kid of a key
+// is its file name without the .pem or .pub.pem extension; a private key
+// signs and verifies, a public key only verifies
+func LoadJWTKeys(dir string) (map[string]*JWTKey, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		log.WithFields(log.Fields{"msgnum": 950}).Error(err)
+		return nil, err
+	}
+	keys := map[string]*JWTKey{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.WithFields(log.Fields{"msgnum": 951}).Error(err)
+			return nil, err
+		}
+		privateKey, publicKey, err := parseJWTKeyPEM(data)
+		if err != nil {
+			err = fmt.Errorf("%s: %v", file, err)
+			log.WithFields(log.Fields{"msgnum": 952}).Error(err)
+			return nil, err
+		}
+		alg, err := keyAlgorithm(publicKey)
+		if err != nil {
+			err = fmt.Errorf("%s: %v", file, err)
+			log.WithFields(log.Fields{"msgnum": 953}).Error(err)
+			return nil, err
+		}
+		kid := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), ".pem"), ".pub")
+		if key, ok := keys[kid]; ok && key.PrivateKey != nil {
+			continue
+		}
+		keys[kid] = &JWTKey{ID: kid, Algorithm: alg, PrivateKey: privateKey, PublicKey: publicKey}
+	}
+	return keys, nil
+}
+
+// SignJWT - sign the claims with the signing key of jwtOpt, the kid
+// header names the key of RS256 and EdDSA tokens
+func SignJWT(jwtOpt *JWTOptions, claims jwt.Claims) (string, error) {
+	if jwtOpt.Algorithm == "" || jwtOpt.Algorithm == JWTAlgHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtOpt.JWTKey)
+	}
+	key, ok := jwtOpt.Keys[jwtOpt.SigningKeyID]
+	if !ok || key.PrivateKey == nil || key.Algorithm != jwtOpt.Algorithm {
+		err := errors.New("No private " + jwtOpt.Algorithm + " key " + jwtOpt.SigningKeyID)
+		log.WithFields(log.Fields{"msgnum": 954}).Error(err)
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// JWTKeyFunc - the jwt.Keyfunc verifying tokens signed with the keys of
+// jwtOpt; HS256 tokens are accepted while VILOM_JWT_KEY is set, so the
+// switch to an asymmetric key does not sign everyone out
+func JWTKeyFunc(jwtOpt *JWTOptions) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			if token.Method.Alg() != JWTAlgHS256 || len(jwtOpt.JWTKey) == 0 {
+				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+			}
+			return jwtOpt.JWTKey, nil
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, ok := jwtOpt.Keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("Unknown key: %v", token.Header["kid"])
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.PublicKey, nil
+	}
+}
+
+// GetJWKS - the public keys of jwtOpt as a JSON Web Key Set, the HS256
+// key is a shared secret and never published
+func GetJWKS(jwtOpt *JWTOptions) *JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	kids := []string{}
+	for kid := range jwtOpt.Keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	for _, kid := range kids {
+		key := jwtOpt.Keys[kid]
+		switch publicKey := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: key.Algorithm,
+				N:   jwt.EncodeSegment(publicKey.N.Bytes()),
+				E:   jwt.EncodeSegment(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "OKP",
+				Kid: kid,
+				Use: "sig",
+				Alg: key.Algorithm,
+				Crv: "Ed25519",
+				X:   jwt.EncodeSegment(publicKey),
+			})
+		}
+	}
+	return &jwks
+}
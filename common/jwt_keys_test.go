@@ -0,0 +1,91 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func writeJWTKeyPEM(t *testing.T, file string, blockType string, der []byte) {
+	err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwtkeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeJWTKeyPEM(t, filepath.Join(dir, "2025-01.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeJWTKeyPEM(t, filepath.Join(dir, "2025-06.pem"), "PRIVATE KEY", der)
+
+	keys, err := LoadJWTKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys["2025-01"].Algorithm != JWTAlgRS256 || keys["2025-06"].Algorithm != JWTAlgEdDSA {
+		t.Fatalf("LoadJWTKeys() = %v, want an RS256 and an EdDSA key", keys)
+	}
+
+	claims := jwt.MapClaims{"EmailAddr": "abcd145@gmail.com"}
+	oldOpt := &JWTOptions{Algorithm: JWTAlgRS256, SigningKeyID: "2025-01", Keys: keys}
+	oldToken, err := SignJWT(oldOpt, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rotate to the EdDSA key, the RS256 key is kept to verify only
+	keys["2025-01"].PrivateKey = nil
+	newOpt := &JWTOptions{Algorithm: JWTAlgEdDSA, SigningKeyID: "2025-06", Keys: keys}
+	newToken, err := SignJWT(newOpt, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tokenString := range []string{oldToken, newToken} {
+		token, err := jwt.Parse(tokenString, JWTKeyFunc(newOpt))
+		if err != nil || !token.Valid {
+			t.Errorf("jwt.Parse() error = %v, want a valid token", err)
+		}
+	}
+	_, err = SignJWT(oldOpt, claims)
+	if err == nil {
+		t.Errorf("SignJWT() error = nil, want no private key error")
+	}
+
+	hsToken, err := SignJWT(&JWTOptions{JWTKey: []byte("secret")}, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = jwt.Parse(hsToken, JWTKeyFunc(newOpt))
+	if err == nil {
+		t.Errorf("jwt.Parse() error = nil, want HS256 refused without VILOM_JWT_KEY")
+	}
+
+	jwks := GetJWKS(newOpt)
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kty != "RSA" || jwks.Keys[0].E != "AQAB" || jwks.Keys[1].Crv != "Ed25519" {
+		t.Errorf("GetJWKS() = %v, want the RSA and Ed25519 public keys", jwks)
+	}
+}
@@ -0,0 +1,577 @@
+package common
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// BER classes of the LDAP protocol elements
+const (
+	BerClassUniversal   = 0x00
+	BerClassApplication = 0x40
+	BerClassContext     = 0x80
+)
+
+// BER universal tags used by LDAP
+const (
+	BerTagBoolean     = 1
+	BerTagInteger     = 2
+	BerTagOctetString = 4
+	BerTagEnumerated  = 10
+	BerTagSequence    = 16
+	BerTagSet         = 17
+)
+
+// LDAP protocol operations, the application tags of the messages
+const (
+	LDAPOpBindRequest       = 0
+	LDAPOpBindResponse      = 1
+	LDAPOpUnbindRequest     = 2
+	LDAPOpSearchRequest     = 3
+	LDAPOpSearchResultEntry = 4
+	LDAPOpSearchResultDone  = 5
+	LDAPOpSearchResultRef   = 19
+)
+
+// LDAP search scopes
+const (
+	LDAPScopeBase    = 0
+	LDAPScopeOne     = 1
+	LDAPScopeSubtree = 2
+)
+
+// LDAP filter choices, the context tags of the filter elements
+const (
+	LDAPFilterAnd        = 0
+	LDAPFilterOr         = 1
+	LDAPFilterNot        = 2
+	LDAPFilterEquality   = 3
+	LDAPFilterSubstrings = 4
+	LDAPFilterPresent    = 7
+)
+
+// LDAP result codes
+const (
+	LDAPResultSuccess            = 0
+	LDAPResultNoSuchObject       = 32
+	LDAPResultInvalidCredentials = 49
+)
+
+// ErrLDAPInvalidCredentials - the bind DN or password is wrong
+var ErrLDAPInvalidCredentials = errors.New("Invalid LDAP credentials")
+
+// BerPacket - a BER element, constructed elements have Children and
+// primitive ones a Value
+type BerPacket struct {
+	Class       byte
+	Constructed bool
+	Tag         byte
+	Value       []byte
+	Children    []*BerPacket
+}
+
+// NewBerConstructed - a constructed element of the children
+func NewBerConstructed(class byte, tag byte, children ...*BerPacket) *BerPacket {
+	return &BerPacket{Class: class, Constructed: true, Tag: tag, Children: children}
+}
+
+// NewBerString - a primitive element holding s
+func NewBerString(class byte, tag byte, s string) *BerPacket {
+	return &BerPacket{Class: class, Tag: tag, Value: []byte(s)}
+}
+
+// NewBerInt - an integer or enumerated element
+func NewBerInt(class byte, tag byte, n int64) *BerPacket {
+	b := []byte{}
+	for {
+		b = append([]byte{byte(n)}, b...)
+		n >>= 8
+		// stop once the sign bit of the first byte is right
+		if (n == 0 && b[0]&0x80 == 0) || (n == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return &BerPacket{Class: class, Tag: tag, Value: b}
+}
+
+// NewBerBool - a boolean element
+func NewBerBool(b bool) *BerPacket {
+	if b {
+		return &BerPacket{Class: BerClassUniversal, Tag: BerTagBoolean, Value: []byte{0xff}}
+	}
+	return &BerPacket{Class: BerClassUniversal, Tag: BerTagBoolean, Value: []byte{0}}
+}
+
+// Int - the value of an integer or enumerated element
+func (p *BerPacket) Int() int64 {
+	var n int64
+	for i, b := range p.Value {
+		if i == 0 && b&0x80 != 0 {
+			n = -1
+		}
+		n = n<<8 | int64(b)
+	}
+	return n
+}
+
+// Str - the value of an octet string element
+func (p *BerPacket) Str() string {
+	return string(p.Value)
+}
+
+// Child - the i'th child, nil when there is none
+func (p *BerPacket) Child(i int) *BerPacket {
+	if i < 0 || i >= len(p.Children) {
+		return nil
+	}
+	return p.Children[i]
+}
+
+// Bytes - the BER encoding of the element
+func (p *BerPacket) Bytes() []byte {
+	content := p.Value
+	if p.Constructed {
+		content = []byte{}
+		for _, c := range p.Children {
+			content = append(content, c.Bytes()...)
+		}
+	}
+	id := p.Class | p.Tag
+	if p.Constructed {
+		id |= 0x20
+	}
+	b := []byte{id}
+	l := len(content)
+	if l < 0x80 {
+		b = append(b, byte(l))
+	} else {
+		lb := []byte{}
+		for ; l > 0; l >>= 8 {
+			lb = append([]byte{byte(l)}, lb...)
+		}
+		b = append(b, 0x80|byte(len(lb)))
+		b = append(b, lb...)
+	}
+	return append(b, content...)
+}
+
+// maxBerLength - larger elements are refused rather than allocated
+const maxBerLength = 16 << 20
+
+// ReadBerPacket - read one BER element from r
+func ReadBerPacket(r io.Reader) (*BerPacket, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0]&0x1f == 0x1f {
+		return nil, errors.New("BER high tag numbers are not supported")
+	}
+	l := int(hdr[1])
+	if l&0x80 != 0 {
+		n := l & 0x7f
+		if n == 0 || n > 4 {
+			return nil, errors.New("Unsupported BER length")
+		}
+		lb := make([]byte, n)
+		if _, err := io.ReadFull(r, lb); err != nil {
+			return nil, err
+		}
+		l = 0
+		for _, b := range lb {
+			l = l<<8 | int(b)
+		}
+	}
+	if l > maxBerLength {
+		return nil, errors.New("BER element too large")
+	}
+	content := make([]byte, l)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return parseBer(hdr[0], content)
+}
+
+func parseBer(id byte, content []byte) (*BerPacket, error) {
+	p := &BerPacket{Class: id & 0xc0, Constructed: id&0x20 != 0, Tag: id & 0x1f}
+	if !p.Constructed {
+		p.Value = content
+		return p, nil
+	}
+	r := strings.NewReader(string(content))
+	for r.Len() > 0 {
+		c, err := ReadBerPacket(r)
+		if err != nil {
+			return nil, err
+		}
+		p.Children = append(p.Children, c)
+	}
+	return p, nil
+}
+
+// LDAPEntry - an entry returned by a search
+type LDAPEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// GetAttr - the first value of the attribute, attribute names are case
+// insensitive
+func (e *LDAPEntry) GetAttr(name string) string {
+	vals := e.GetAttrs(name)
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[0]
+}
+
+// GetAttrs - the values of the attribute
+func (e *LDAPEntry) GetAttrs(name string) []string {
+	for attr, vals := range e.Attributes {
+		if strings.EqualFold(attr, name) {
+			return vals
+		}
+	}
+	return nil
+}
+
+// LDAPError - an LDAP operation did not succeed
+type LDAPError struct {
+	ResultCode int64
+	Message    string
+}
+
+func (e *LDAPError) Error() string {
+	return fmt.Sprintf("LDAP result code %d: %s", e.ResultCode, e.Message)
+}
+
+// LDAPConn - a connection to an LDAP server, operations are sent one at
+// a time
+type LDAPConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	msgID   int64
+	timeout time.Duration
+}
+
+// DialLDAP - connect to an ldap:// or ldaps:// URL
+func DialLDAP(rawurl string, timeout time.Duration) (*LDAPConn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+		conn, err = dialer.Dial("tcp", host)
+	case "ldaps":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, errors.New("Unsupported LDAP URL " + rawurl)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &LDAPConn{conn: conn, r: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// send - send the operation and return its message ID
+func (l *LDAPConn) send(op *BerPacket) (int64, error) {
+	l.msgID++
+	msg := NewBerConstructed(BerClassUniversal, BerTagSequence, NewBerInt(BerClassUniversal, BerTagInteger, l.msgID), op)
+	if l.timeout > 0 {
+		if err := l.conn.SetDeadline(time.Now().Add(l.timeout)); err != nil {
+			return 0, err
+		}
+	}
+	_, err := l.conn.Write(msg.Bytes())
+	return l.msgID, err
+}
+
+// receive - the protocol operation of the next message for msgID
+func (l *LDAPConn) receive(msgID int64) (*BerPacket, error) {
+	for {
+		msg, err := ReadBerPacket(l.r)
+		if err != nil {
+			return nil, err
+		}
+		if len(msg.Children) < 2 || msg.Children[1].Class != BerClassApplication {
+			return nil, errors.New("Malformed LDAP message")
+		}
+		if msg.Children[0].Int() == msgID {
+			return msg.Children[1], nil
+		}
+	}
+}
+
+// ldapResult - the error of an LDAPResult, nil on success
+func ldapResult(op *BerPacket) error {
+	if len(op.Children) < 3 {
+		return errors.New("Malformed LDAP result")
+	}
+	code := op.Children[0].Int()
+	if code == LDAPResultSuccess {
+		return nil
+	}
+	if code == LDAPResultInvalidCredentials {
+		return ErrLDAPInvalidCredentials
+	}
+	return &LDAPError{ResultCode: code, Message: op.Children[2].Str()}
+}
+
+// Bind - simple bind as dn, an empty password is refused since servers
+// treat it as an unauthenticated bind that always succeeds
+func (l *LDAPConn) Bind(dn string, password string) error {
+	if password == "" {
+		return ErrLDAPInvalidCredentials
+	}
+	req := NewBerConstructed(BerClassApplication, LDAPOpBindRequest,
+		NewBerInt(BerClassUniversal, BerTagInteger, 3),
+		NewBerString(BerClassUniversal, BerTagOctetString, dn),
+		NewBerString(BerClassContext, 0, password))
+	msgID, err := l.send(req)
+	if err != nil {
+		return err
+	}
+	resp, err := l.receive(msgID)
+	if err != nil {
+		return err
+	}
+	if resp.Tag != LDAPOpBindResponse {
+		return errors.New("Unexpected LDAP response to bind")
+	}
+	return ldapResult(resp)
+}
+
+// Search - the entries under baseDN matching the filter, with the attrs
+func (l *LDAPConn) Search(baseDN string, scope int, filter string, attrs []string) ([]*LDAPEntry, error) {
+	f, err := CompileLDAPFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	attrList := NewBerConstructed(BerClassUniversal, BerTagSequence)
+	for _, attr := range attrs {
+		attrList.Children = append(attrList.Children, NewBerString(BerClassUniversal, BerTagOctetString, attr))
+	}
+	req := NewBerConstructed(BerClassApplication, LDAPOpSearchRequest,
+		NewBerString(BerClassUniversal, BerTagOctetString, baseDN),
+		NewBerInt(BerClassUniversal, BerTagEnumerated, int64(scope)),
+		NewBerInt(BerClassUniversal, BerTagEnumerated, 0),
+		NewBerInt(BerClassUniversal, BerTagInteger, 0),
+		NewBerInt(BerClassUniversal, BerTagInteger, 0),
+		NewBerBool(false),
+		f,
+		attrList)
+	msgID, err := l.send(req)
+	if err != nil {
+		return nil, err
+	}
+	entries := []*LDAPEntry{}
+	for {
+		resp, err := l.receive(msgID)
+		if err != nil {
+			return nil, err
+		}
+		switch resp.Tag {
+		case LDAPOpSearchResultEntry:
+			entry, err := parseLDAPEntry(resp)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case LDAPOpSearchResultRef:
+			// referrals to other servers are not followed
+		case LDAPOpSearchResultDone:
+			if err := ldapResult(resp); err != nil {
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, errors.New("Unexpected LDAP response to search")
+		}
+	}
+}
+
+func parseLDAPEntry(p *BerPacket) (*LDAPEntry, error) {
+	if len(p.Children) < 2 {
+		return nil, errors.New("Malformed LDAP entry")
+	}
+	entry := LDAPEntry{DN: p.Children[0].Str(), Attributes: map[string][]string{}}
+	for _, attr := range p.Children[1].Children {
+		if len(attr.Children) < 2 {
+			return nil, errors.New("Malformed LDAP attribute")
+		}
+		vals := []string{}
+		for _, v := range attr.Children[1].Children {
+			vals = append(vals, v.Str())
+		}
+		entry.Attributes[attr.Children[0].Str()] = vals
+	}
+	return &entry, nil
+}
+
+// Close - unbind and close the connection
+func (l *LDAPConn) Close() error {
+	_, _ = l.send(&BerPacket{Class: BerClassApplication, Tag: LDAPOpUnbindRequest})
+	return l.conn.Close()
+}
+
+// NormalizeLDAPDN - the DN in lower case without the spaces around its
+// RDNs, for comparing the DNs of members with those of entries
+func NormalizeLDAPDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ",")
+}
+
+// LDAPEscapeFilter - escape a value for use in a search filter
+func LDAPEscapeFilter(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// ldapUnescape - the value of an escaped filter assertion
+func ldapUnescape(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", errors.New("Invalid LDAP filter escape")
+		}
+		c, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", errors.New("Invalid LDAP filter escape")
+		}
+		b.Write(c)
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// CompileLDAPFilter - the BER encoding of a search filter such as
+// (&(objectClass=person)(mail=*)); and, or, not, equality, presence and
+// substring assertions are supported
+func CompileLDAPFilter(filter string) (*BerPacket, error) {
+	f, rest, err := compileLDAPFilter(strings.TrimSpace(filter))
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, errors.New("Invalid LDAP filter " + filter)
+	}
+	return f, nil
+}
+
+func compileLDAPFilter(s string) (*BerPacket, string, error) {
+	if len(s) < 3 || s[0] != '(' {
+		return nil, "", errors.New("Invalid LDAP filter " + s)
+	}
+	switch s[1] {
+	case '&', '|':
+		tag := byte(LDAPFilterAnd)
+		if s[1] == '|' {
+			tag = LDAPFilterOr
+		}
+		p := NewBerConstructed(BerClassContext, tag)
+		rest := s[2:]
+		for len(rest) > 0 && rest[0] == '(' {
+			c, r, err := compileLDAPFilter(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			p.Children = append(p.Children, c)
+			rest = r
+		}
+		if len(rest) == 0 || rest[0] != ')' {
+			return nil, "", errors.New("Invalid LDAP filter " + s)
+		}
+		return p, rest[1:], nil
+	case '!':
+		c, rest, err := compileLDAPFilter(s[2:])
+		if err != nil {
+			return nil, "", err
+		}
+		if len(rest) == 0 || rest[0] != ')' {
+			return nil, "", errors.New("Invalid LDAP filter " + s)
+		}
+		return NewBerConstructed(BerClassContext, LDAPFilterNot, c), rest[1:], nil
+	}
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", errors.New("Invalid LDAP filter " + s)
+	}
+	item := s[1:end]
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, "", errors.New("Invalid LDAP filter " + s)
+	}
+	attr, value := item[:eq], item[eq+1:]
+	if value == "*" {
+		return NewBerString(BerClassContext, LDAPFilterPresent, attr), s[end+1:], nil
+	}
+	if !strings.Contains(value, "*") {
+		v, err := ldapUnescape(value)
+		if err != nil {
+			return nil, "", err
+		}
+		p := NewBerConstructed(BerClassContext, LDAPFilterEquality,
+			NewBerString(BerClassUniversal, BerTagOctetString, attr),
+			NewBerString(BerClassUniversal, BerTagOctetString, v))
+		return p, s[end+1:], nil
+	}
+	subs := NewBerConstructed(BerClassUniversal, BerTagSequence)
+	parts := strings.Split(value, "*")
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		v, err := ldapUnescape(part)
+		if err != nil {
+			return nil, "", err
+		}
+		// initial, any and final substrings
+		tag := byte(1)
+		if i == 0 {
+			tag = 0
+		} else if i == len(parts)-1 {
+			tag = 2
+		}
+		subs.Children = append(subs.Children, NewBerString(BerClassContext, tag, v))
+	}
+	p := NewBerConstructed(BerClassContext, LDAPFilterSubstrings,
+		NewBerString(BerClassUniversal, BerTagOctetString, attr), subs)
+	return p, s[end+1:], nil
+}
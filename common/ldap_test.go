@@ -0,0 +1,64 @@
+package common_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+)
+
+func TestCompileLDAPFilter(t *testing.T) {
+	for _, filter := range []string{
+		"(objectClass=person)",
+		"(&(objectClass=inetOrgPerson)(mail=*))",
+		"(|(cn=ad*min)(!(uid=a\\2ab)))",
+	} {
+		if _, err := common.CompileLDAPFilter(filter); err != nil {
+			t.Errorf("CompileLDAPFilter(%q) error = %v", filter, err)
+		}
+	}
+	for _, filter := range []string{"", "objectClass=person", "(&(cn=a)", "(cn=a\\2)"} {
+		if _, err := common.CompileLDAPFilter(filter); err == nil {
+			t.Errorf("CompileLDAPFilter(%q) error = nil, want an invalid filter error", filter)
+		}
+	}
+	if got := common.LDAPEscapeFilter("a*b(c)"); got != "a\\2ab\\28c\\29" {
+		t.Errorf("LDAPEscapeFilter() = %v", got)
+	}
+}
+
+func TestLDAPConn(t *testing.T) {
+	server, err := testhelpers.NewLDAPServer([]*common.LDAPEntry{
+		{DN: "uid=ann,ou=people,dc=example,dc=com", Attributes: map[string][]string{
+			"objectClass": {"inetOrgPerson"}, "mail": {"ann@example.com"}, "givenName": {"Ann"}, "userPassword": {"secret"}}},
+		{DN: "uid=bob,ou=people,dc=example,dc=com", Attributes: map[string][]string{
+			"objectClass": {"inetOrgPerson"}, "givenName": {"Bob"}, "userPassword": {"secret2"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	conn, err := common.DialLDAP(server.URL, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.Bind("uid=ann,ou=people,dc=example,dc=com", "wrong"); err != common.ErrLDAPInvalidCredentials {
+		t.Errorf("LDAPConn.Bind() error = %v, want invalid credentials", err)
+	}
+	if err = conn.Bind("uid=ann,ou=people,dc=example,dc=com", ""); err != common.ErrLDAPInvalidCredentials {
+		t.Errorf("LDAPConn.Bind() error = %v, want an empty password refused", err)
+	}
+	if err = conn.Bind("uid=ann, ou=people, dc=example, dc=com", "secret"); err != nil {
+		t.Errorf("LDAPConn.Bind() error = %v", err)
+	}
+	entries, err := conn.Search("ou=people,dc=example,dc=com", common.LDAPScopeSubtree, "(&(objectClass=inetOrgPerson)(mail=*))", []string{"mail", "givenName"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].GetAttr("MAIL") != "ann@example.com" || entries[0].GetAttr("userPassword") != "" {
+		t.Errorf("LDAPConn.Search() = %v, want ann without the password", entries)
+	}
+}
@@ -1,10 +1,31 @@
 package common
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
 	log "github.com/sirupsen/logrus"
 	gomail "gopkg.in/gomail.v2"
 )
 
+// Mailer backends
+const (
+	MailerBackendSMTP = "smtp"
+	MailerBackendFile = "file"
+)
+
+// FileMailerFrom - the sender of the emails of the file mailer
+const FileMailerFrom = "vilom@localhost"
+
 // MailerIntf interface to the Mailer
 type MailerIntf interface {
 	SendMail(msg Email) error
@@ -15,13 +36,15 @@ type MailerService struct {
 	Mailer *gomail.Dialer
 }
 
-// Email - for sending email notifications
+// Email - for sending email notifications, Body is HTML and TextBody
+// its plain-text alternative
 type Email struct {
-	From    string
-	To      string
-	Subject string
-	Body    string
-	Cc      string
+	From     string
+	To       string
+	Subject  string
+	Body     string
+	TextBody string
+	Cc       string
 }
 
 // NewMailerService get connection to mailer and create a MailerService struct
@@ -41,7 +64,12 @@ func (mailerService *MailerService) SendMail(msg Email) error {
 	m.SetHeader("From", mailerService.Mailer.Username)
 	m.SetHeader("To", msg.To)
 	m.SetHeader("Subject", msg.Subject)
-	m.SetBody("text/html", msg.Body)
+	if msg.TextBody != "" {
+		m.SetBody("text/plain", msg.TextBody)
+		m.AddAlternative("text/html", msg.Body)
+	} else {
+		m.SetBody("text/html", msg.Body)
+	}
 
 	err := mailerService.Mailer.DialAndSend(m)
 	if err != nil {
@@ -50,3 +78,106 @@ func (mailerService *MailerService) SendMail(msg Email) error {
 	}
 	return nil
 }
+
+// FileMailer - writes each email as an .eml file to Dir instead of
+// sending it, for development and tests
+type FileMailer struct {
+	Dir string
+}
+
+// NewFileMailer - Create a file mailer writing to the directory dir
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &FileMailer{Dir: dir}, nil
+}
+
+// SendMail - write the email to a temporary file and rename it into
+// place, so a reader of Dir never sees a partial email
+func (fm *FileMailer) SendMail(msg Email) error {
+	suffix := make([]byte, 4)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		log.WithFields(log.Fields{"msgnum": 800}).Error(err)
+		return err
+	}
+	tn := time.Now().UTC()
+	name := tn.Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(suffix) + ".eml"
+
+	tmp, err := ioutil.TempFile(fm.Dir, ".eml-")
+	if err != nil {
+		log.WithFields(log.Fields{"msgnum": 801}).Error(err)
+		return err
+	}
+	_, err = tmp.Write(EmailMessage(msg, tn))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"msgnum": 802}).Error(err)
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	err = os.Rename(tmp.Name(), filepath.Join(fm.Dir, name))
+	if err != nil {
+		log.WithFields(log.Fields{"msgnum": 803}).Error(err)
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// EmailMessage - the email in RFC 5322 format, as an .eml file holds it
+func EmailMessage(msg Email, date time.Time) []byte {
+	from := msg.From
+	if from == "" {
+		from = FileMailerFrom
+	}
+	var buf bytes.Buffer
+	header := func(name string, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from)
+	header("To", msg.To)
+	if msg.Cc != "" {
+		header("Cc", msg.Cc)
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	if msg.TextBody == "" {
+		header("Content-Type", "text/html; charset=UTF-8")
+		header("Content-Transfer-Encoding", "8bit")
+		buf.WriteString("\r\n")
+		buf.WriteString(crlf(msg.Body))
+		return buf.Bytes()
+	}
+
+	var parts bytes.Buffer
+	mw := multipart.NewWriter(&parts)
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", msg.TextBody},
+		{"text/html; charset=UTF-8", msg.Body},
+	} {
+		pw, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		_, _ = pw.Write([]byte(crlf(part.body)))
+	}
+	_ = mw.Close()
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+	buf.Write(parts.Bytes())
+	return buf.Bytes()
+}
+
+// crlf - s with CRLF line endings
+func crlf(s string) string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	return strings.Replace(s, "\n", "\r\n", -1)
+}
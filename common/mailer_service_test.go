@@ -0,0 +1,86 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileMailer_SendMail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vilom-mail")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	mailer, err := NewFileMailer(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = mailer.SendMail(Email{To: "abcd145@gmail.com", Subject: "Réinitialiser", Body: "<p>hi</p>\nthere"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil || len(files) != 1 || !strings.HasSuffix(files[0], ".eml") {
+		t.Errorf("FileMailer.SendMail() files = %v, %v, want one .eml file", files, err)
+		return
+	}
+	got, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, want := range []string{
+		"From: " + FileMailerFrom + "\r\n",
+		"To: abcd145@gmail.com\r\n",
+		"Subject: =?utf-8?q?R=C3=A9initialiser?=\r\n",
+		"Content-Type: text/html; charset=UTF-8\r\n",
+		"\r\n\r\n<p>hi</p>\r\nthere",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("FileMailer.SendMail() = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestEmailMessage_TextBody(t *testing.T) {
+	got := string(EmailMessage(Email{To: "abcd145@gmail.com", Subject: "Hi", Body: "<p>hi</p>", TextBody: "hi"}, time.Now()))
+	for _, want := range []string{
+		"Content-Type: multipart/alternative; boundary=",
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\nhi\r\n",
+		"Content-Type: text/html; charset=UTF-8\r\n\r\n<p>hi</p>\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("EmailMessage() = %q, want it to contain %q", got, want)
+		}
+	}
+	if strings.Index(got, "text/plain") > strings.Index(got, "text/html") {
+		t.Errorf("EmailMessage() = %q, want the plain text first", got)
+	}
+}
+
+func TestEmailBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, EmailBackoffBase},
+		{2, 2 * EmailBackoffBase},
+		{4, 8 * EmailBackoffBase},
+		{8, 128 * EmailBackoffBase},
+		{10, EmailBackoffMax},
+		{100, EmailBackoffMax},
+	}
+	for _, tt := range tests {
+		if got := emailBackoff(tt.attempts); got != tt.want {
+			t.Errorf("emailBackoff(%v) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package common
+
+import (
+	"html"
+	"strings"
+)
+
+/*
+Markdown subset of message texts
+
+  **bold**               <strong>
+  *italics* or _italics_ <em>
+  `code`                 <code>
+  ```go                  <pre><code class="language-go">, the language tag
+  ...                    is optional
+  ```
+  [text](url)            <a>, only http, https and mailto urls are links
+  - item, * item         <ul>, one level
+  1. item                <ol>, one level
+  > quote                <blockquote>, may contain the other blocks
+  @name                  <span class="mention">
+
+Everything else is text. The rendering is safe by construction, all text
+is html escaped and only the tags above are produced, so raw html in a
+message is shown as text.
+*/
+
+// markdownQuoteDepthMax - quotes nested deeper are rendered as text
+const markdownQuoteDepthMax = 8
+
+// RenderMarkdown - the sanitized html rendering of the markdown src
+func RenderMarkdown(src string) string {
+	r := renderMarkdown(src)
+	return strings.TrimSuffix(r.html.String(), "\n")
+}
+
+// MarkdownText - the plain text of the markdown src, used for indexing
+func MarkdownText(src string) string {
+	r := renderMarkdown(src)
+	return strings.TrimSpace(r.text.String())
+}
+
+// MarkdownMentions - the names mentioned in the markdown src, once each
+// in the order of their first mention, mentions in code are not counted
+func MarkdownMentions(src string) []string {
+	r := renderMarkdown(src)
+	return r.mentions
+}
+
+// renderMarkdown - render src to html and plain text
+func renderMarkdown(src string) *mdRenderer {
+	r := mdRenderer{}
+	src = strings.Replace(src, "\r\n", "\n", -1)
+	r.blocks(strings.Split(src, "\n"), 0)
+	return &r
+}
+
+type mdRenderer struct {
+	html     strings.Builder
+	text     strings.Builder
+	mentions []string
+}
+
+// blocks - render the lines as code blocks, quotes, lists and paragraphs
+func (r *mdRenderer) blocks(lines []string, depth int) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			i++
+		case strings.HasPrefix(trimmed, "```"):
+			i = r.codeBlock(lines, i)
+		case strings.HasPrefix(trimmed, ">") && depth < markdownQuoteDepthMax:
+			quoted := []string{}
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				q := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(q, " "))
+			}
+			r.html.WriteString("<blockquote>\n")
+			r.blocks(quoted, depth+1)
+			r.html.WriteString("</blockquote>\n")
+		case mdListItem(trimmed) != "":
+			i = r.list(lines, i)
+		default:
+			start := i
+			for i < len(lines) && strings.TrimSpace(lines[i]) != "" && (i == start || !mdBlockStart(strings.TrimSpace(lines[i]))) {
+				i++
+			}
+			r.html.WriteString("<p>")
+			for j, l := range lines[start:i] {
+				if j > 0 {
+					r.html.WriteString("<br>\n")
+					r.text.WriteString("\n")
+				}
+				r.inline(strings.TrimSpace(l))
+			}
+			r.html.WriteString("</p>\n")
+			r.text.WriteString("\n")
+		}
+	}
+}
+
+// codeBlock - render the fenced code block starting at lines[i], returns
+// the index of the line after it
+func (r *mdRenderer) codeBlock(lines []string, i int) int {
+	lang := mdLanguage(strings.TrimSpace(strings.TrimSpace(lines[i])[3:]))
+	code := []string{}
+	for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+		code = append(code, lines[i])
+	}
+	if lang != "" {
+		r.html.WriteString(`<pre><code class="language-` + lang + `">`)
+	} else {
+		r.html.WriteString("<pre><code>")
+	}
+	r.html.WriteString(html.EscapeString(strings.Join(code, "\n")))
+	r.html.WriteString("</code></pre>\n")
+	r.text.WriteString(strings.Join(code, "\n") + "\n")
+	return i + 1
+}
+
+// list - render the list starting at lines[i], returns the index of the
+// line after it
+func (r *mdRenderer) list(lines []string, i int) int {
+	tag := "ul"
+	if mdListItem(strings.TrimSpace(lines[i])) == "ol" {
+		tag = "ol"
+	}
+	r.html.WriteString("<" + tag + ">\n")
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		kind := mdListItem(trimmed)
+		if kind != tag {
+			break
+		}
+		item := trimmed[strings.IndexByte(trimmed, ' ')+1:]
+		r.html.WriteString("<li>")
+		r.inline(strings.TrimSpace(item))
+		r.html.WriteString("</li>\n")
+		r.text.WriteString("\n")
+	}
+	r.html.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// inline - render emphasis, code spans, links and mentions of s
+func (r *mdRenderer) inline(s string) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_[]()@>#+-.!", s[i+1]) >= 0:
+			r.write(s[i+1 : i+2])
+			i += 2
+			continue
+		case c == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				code := s[i+1 : i+1+end]
+				r.html.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				r.text.WriteString(code)
+				i += end + 2
+				continue
+			}
+		case c == '*' && strings.HasPrefix(s[i:], "**"):
+			if end := strings.Index(s[i+2:], "**"); end > 0 {
+				r.html.WriteString("<strong>")
+				r.inline(s[i+2 : i+2+end])
+				r.html.WriteString("</strong>")
+				i += end + 4
+				continue
+			}
+		case (c == '*' || c == '_') && (i == 0 || !mdWordByte(s[i-1])):
+			if end := mdEmphasisEnd(s[i+1:], c); end > 0 {
+				r.html.WriteString("<em>")
+				r.inline(s[i+1 : i+1+end])
+				r.html.WriteString("</em>")
+				i += end + 2
+				continue
+			}
+		case c == '[':
+			if text, url, n := mdLink(s[i:]); n > 0 {
+				r.html.WriteString(`<a href="` + html.EscapeString(url) + `" rel="nofollow noopener noreferrer" target="_blank">`)
+				r.inline(text)
+				r.html.WriteString("</a>")
+				i += n
+				continue
+			}
+		case c == '@' && (i == 0 || !mdWordByte(s[i-1])):
+			if name := MentionName(s[i+1:]); name != "" {
+				r.html.WriteString(`<span class="mention" data-mention="` + html.EscapeString(name) + `">@` + html.EscapeString(name) + "</span>")
+				r.text.WriteString("@" + name)
+				r.mention(name)
+				i += len(name) + 1
+				continue
+			}
+		}
+		r.write(s[i : i+1])
+		i++
+	}
+}
+
+// mention - record the mentioned name
+func (r *mdRenderer) mention(name string) {
+	for _, m := range r.mentions {
+		if m == name {
+			return
+		}
+	}
+	r.mentions = append(r.mentions, name)
+}
+
+// write - write text to both renderings
+func (r *mdRenderer) write(s string) {
+	r.html.WriteString(html.EscapeString(s))
+	r.text.WriteString(s)
+}
+
+// MentionName - the name mentioned at the start of s, the text after an
+// @, names may be email addresses
+func MentionName(s string) string {
+	n := 0
+	for n < len(s) && (mdWordByte(s[n]) || strings.IndexByte(".-+@", s[n]) >= 0) {
+		n++
+	}
+	return strings.TrimRight(s[:n], ".-+@")
+}
+
+// mdEmphasisEnd - index of the delimiter c closing the emphasis at the
+// start of s, -1 if there is none
+func mdEmphasisEnd(s string, c byte) int {
+	if s == "" || s[0] == ' ' || s[0] == c {
+		return -1
+	}
+	for i := 1; i < len(s); i++ {
+		if s[i] == c && s[i-1] != ' ' && (i+1 == len(s) || !mdWordByte(s[i+1])) {
+			return i
+		}
+	}
+	return -1
+}
+
+// mdLink - the text and url of the link at the start of s and its
+// length, n is 0 if s does not start with a link to an allowed url
+func mdLink(s string) (string, string, int) {
+	mid := strings.Index(s, "](")
+	if mid < 2 {
+		return "", "", 0
+	}
+	end := strings.IndexByte(s[mid+2:], ')')
+	if end < 0 {
+		return "", "", 0
+	}
+	url := strings.TrimSpace(s[mid+2 : mid+2+end])
+	lower := strings.ToLower(url)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") && !strings.HasPrefix(lower, "mailto:") {
+		return "", "", 0
+	}
+	if strings.ContainsAny(url, " \t\"'<>") {
+		return "", "", 0
+	}
+	return s[1:mid], url, mid + 3 + end
+}
+
+// mdListItem - "ul" or "ol" if line is an item of that list
+func mdListItem(line string) string {
+	if len(line) > 1 && strings.IndexByte("-*+", line[0]) >= 0 && line[1] == ' ' {
+		return "ul"
+	}
+	n := 0
+	for n < len(line) && line[n] >= '0' && line[n] <= '9' {
+		n++
+	}
+	if n > 0 && n < 10 && n+1 < len(line) && (line[n] == '.' || line[n] == ')') && line[n+1] == ' ' {
+		return "ol"
+	}
+	return ""
+}
+
+// mdBlockStart - line starts a block other than a paragraph
+func mdBlockStart(line string) bool {
+	return strings.HasPrefix(line, "```") || strings.HasPrefix(line, ">") || mdListItem(line) != ""
+}
+
+// mdLanguage - the language tag of a code block, limited to characters
+// that are safe in a class name
+func mdLanguage(s string) string {
+	n := 0
+	for n < len(s) && n < 20 && (mdWordByte(s[n]) || s[n] == '+' || s[n] == '-' || s[n] == '#') {
+		n++
+	}
+	return s[:n]
+}
+
+// mdWordByte - ascii letter, digit or underscore
+func mdWordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
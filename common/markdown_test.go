@@ -0,0 +1,66 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"**bold** and *it* and _it_", "<p><strong>bold</strong> and <em>it</em> and <em>it</em></p>"},
+		{"snake_case_name and 2*3*4", "<p>snake_case_name and 2*3*4</p>"},
+		{"use `a<b`", "<p>use <code>a&lt;b</code></p>"},
+		{"```go\nif a < b {\n}\n```", "<pre><code class=\"language-go\">if a &lt; b {\n}</code></pre>"},
+		{"```\"><script>\nx\n```", "<pre><code>x</code></pre>"},
+		{"[site](https://example.com/a?b=1&c=2)", `<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener noreferrer" target="_blank">site</a></p>`},
+		{"[x](javascript:alert(1))", "<p>[x](javascript:alert(1))</p>"},
+		{"- one\n- **two**\n\n1. first\n2) second", "<ul>\n<li>one</li>\n<li><strong>two</strong></li>\n</ul>\n<ol>\n<li>first</li>\n<li>second</li>\n</ol>"},
+		{"> quoted\n> - item\n\nafter", "<blockquote>\n<p>quoted</p>\n<ul>\n<li>item</li>\n</ul>\n</blockquote>\n<p>after</p>"},
+		{"hi @john.doe. and a@b.com", `<p>hi <span class="mention" data-mention="john.doe">@john.doe</span>. and a@b.com</p>`},
+		{"<img src=x onerror=alert(1)>", "<p>&lt;img src=x onerror=alert(1)&gt;</p>"},
+		{"line one\nline two", "<p>line one<br>\nline two</p>"},
+		{`\*not italic\*`, "<p>*not italic*</p>"},
+	}
+	for _, tt := range tests {
+		if got := RenderMarkdown(tt.src); got != tt.want {
+			t.Errorf("RenderMarkdown(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestMarkdownText(t *testing.T) {
+	src := "**Release** notes for [v2](https://example.com)\n\n- fixes `nil` panic\n\n```sh\nmake test\n```\n> thanks @ann"
+	want := "Release notes for v2\nfixes nil panic\nmake test\nthanks @ann"
+	if got := MarkdownText(src); got != want {
+		t.Errorf("MarkdownText() = %q, want %q", got, want)
+	}
+}
+
+func TestMarkdownMentions(t *testing.T) {
+	got := MarkdownMentions("@ann and **@bob**, `@code` and @ann again\n```\n@block\n```\n> @channel")
+	want := []string{"ann", "bob", "channel"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MarkdownMentions() = %v, want %v", got, want)
+	}
+}
+
+func TestMentionName(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"john, hi", "john"},
+		{"john.doe.", "john.doe"},
+		{"channel!", "channel"},
+		{" x", ""},
+		{"abcd145@gmail.com: hi", "abcd145@gmail.com"},
+	}
+	for _, tt := range tests {
+		if got := MentionName(tt.s); got != tt.want {
+			t.Errorf("MentionName(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
@@ -2,9 +2,9 @@ package common
 
 import (
 	"context"
-	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"net/http"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -17,6 +17,28 @@ func AddMiddleware(h http.Handler, middleware ...func(http.Handler) http.Handler
 	return h
 }
 
+// LocaleMiddleware - API error messages in the locale the
+// Accept-Language header of the request prefers
+func LocaleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lw := &localeResponseWriter{ResponseWriter: w, locale: ParseAcceptLanguage(r.Header.Get("Accept-Language"))}
+		next.ServeHTTP(lw, r)
+	})
+}
+
+// localeResponseWriter - carries the locale of the request to RenderErrorJSON
+type localeResponseWriter struct {
+	http.ResponseWriter
+	locale string
+}
+
+// Flush - keep streaming responses working through the wrapper
+func (lw *localeResponseWriter) Flush() {
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // CorsMiddleware - Enable CORS with various options
 func CorsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -40,6 +62,20 @@ func CorsMiddleware(next http.Handler) http.Handler {
 // AuthenticateMiddleware - Authenticate Token from request
 func AuthenticateMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientCertOpt := GetClientCertOpt()
+		certEmail := GetClientCertIdentity(r, clientCertOpt)
+		if clientCertOpt.Mode == ClientCertAuthBoth && certEmail == "" {
+			http.Error(w, "Client certificate not mapped", http.StatusUnauthorized)
+			return
+		}
+		bearer := r.Header.Get("Authorization")
+		if bearer == "" && clientCertOpt.Mode == ClientCertAuthCert && certEmail != "" {
+			// the mapped certificate authenticates, a bearer token takes precedence
+			v := ContextStruct{Email: certEmail, ClientCert: certEmail}
+			ctx := context.WithValue(r.Context(), KeyEmailToken, v)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
 		tokenString, err := GetAuthBearerToken(r)
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -48,21 +84,36 @@ func AuthenticateMiddleware(next http.Handler) http.Handler {
 			http.Error(w, "Error parsing token", http.StatusUnauthorized)
 			return
 		}
+		if clientCertOpt.Mode != ClientCertAuthBoth {
+			certEmail = ""
+		}
+		if strings.HasPrefix(tokenString, APITokenPrefix) {
+			// API tokens are checked against the database in GetAuthUserDetails
+			v := ContextStruct{TokenString: tokenString, APIToken: true, ClientCert: certEmail}
+			ctx := context.WithValue(r.Context(), KeyEmailToken, v)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
 		jwtOpt := GetJWTOpt()
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// validate the alg is
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				http.Error(w, "Unexpected signing method", http.StatusUnauthorized)
-				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-			}
-
-			// hmacSampleSecret is a []byte containing your secret, e.g. []byte("my_secret_key")
-			return jwtOpt.JWTKey, nil
-		})
-		v := ContextStruct{}
+		// the alg and kid of the token must match one of the keys
+		token, err := jwt.Parse(tokenString, JWTKeyFunc(jwtOpt))
+		v := ContextStruct{ClientCert: certEmail}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 752,
+			}).Error(err)
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 			v.Email = claims["EmailAddr"].(string)
 			v.TokenString = tokenString
+			if sessionID, ok := claims["SessionID"].(string); ok {
+				v.SessionID = sessionID
+			}
+			if iat, ok := claims["iat"].(float64); ok {
+				v.IssuedAt = int64(iat)
+			}
 		} else {
 			log.WithFields(log.Fields{
 				"msgnum": 752,
@@ -0,0 +1,149 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/* error message range: 1000-1099 */
+
+// DefaultDeniedNets - the networks the requests to user supplied urls may
+// not reach by default, loopback, link-local, private and unspecified
+var DefaultDeniedNets = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+// ErrOutboundDenied - the address of a user supplied url is in a denied
+// network
+var ErrOutboundDenied = errors.New("Address is not allowed")
+
+// OutboundOptions - for the requests made to user supplied urls, the
+// outgoing webhooks and the commands; an empty DeniedNets allows every
+// address
+type OutboundOptions struct {
+	DeniedNets []string `mapstructure:"denied_nets"`
+}
+
+var deniedNets = mustParseNets(DefaultDeniedNets)
+
+func parseNets(cidrs []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func mustParseNets(cidrs []string) []*net.IPNet {
+	nets, err := parseNets(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+// SetOutboundOpt set the networks denied to the requests to user supplied
+// urls
+func SetOutboundOpt(opt *OutboundOptions) error {
+	nets, err := parseNets(opt.DeniedNets)
+	if err != nil {
+		log.WithFields(log.Fields{"msgnum": 1000}).Error(err)
+		return err
+	}
+	deniedNets = nets
+	return nil
+}
+
+// OutboundDenied - whether ip is in a denied network
+func OutboundDenied(ip net.IP) bool {
+	for _, ipNet := range deniedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// outboundControl - checks the address after the name is resolved and
+// before the connection is made, so that rebinding the name to a denied
+// address after the url was validated does not get through
+func outboundControl(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || OutboundDenied(ip) {
+		log.WithFields(log.Fields{"msgnum": 1001, "address": address}).Error(ErrOutboundDenied)
+		return ErrOutboundDenied
+	}
+	return nil
+}
+
+// OutboundClient - an http client for user supplied urls which does not
+// connect to the denied networks, also after redirects
+func OutboundClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: outboundControl}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+}
+
+// CheckOutboundURL - ErrOutboundDenied when the host of rawURL is or
+// resolves to a denied address; a host that does not resolve yet is
+// left to the check made when connecting
+func CheckOutboundURL(ctx context.Context, rawURL string) error {
+	if len(deniedNets) == 0 {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if OutboundDenied(ip) {
+			return ErrOutboundDenied
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		log.WithFields(log.Fields{"msgnum": 1002, "host": host}).Warn(err)
+		return nil
+	}
+	for _, addr := range addrs {
+		if OutboundDenied(addr.IP) {
+			return ErrOutboundDenied
+		}
+	}
+	return nil
+}
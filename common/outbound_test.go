@@ -0,0 +1,73 @@
+package common
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOutboundDenied(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"169.254.169.254", true},
+		{"10.1.2.3", true},
+		{"172.20.0.1", true},
+		{"192.168.1.1", true},
+		{"0.0.0.0", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"93.184.216.34", false},
+		{"2606:2800:220:1:248:1893:25c8:1946", false},
+	}
+	for _, tt := range tests {
+		if got := OutboundDenied(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("OutboundDenied(%v) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestOutboundClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	defer func() {
+		_ = SetOutboundOpt(&OutboundOptions{DeniedNets: DefaultDeniedNets})
+	}()
+
+	err := CheckOutboundURL(context.Background(), ts.URL)
+	if err != ErrOutboundDenied {
+		t.Errorf("CheckOutboundURL(%v) = %v, want %v", ts.URL, err, ErrOutboundDenied)
+	}
+	err = CheckOutboundURL(context.Background(), "http://localhost:8080/hook")
+	if err != ErrOutboundDenied {
+		t.Errorf("CheckOutboundURL(localhost) = %v, want %v", err, ErrOutboundDenied)
+	}
+	// the dialer refuses the address also when the url was not checked
+	_, err = OutboundClient(time.Second).Get(ts.URL)
+	if err == nil {
+		t.Errorf("OutboundClient().Get(%v) connected to a denied address", ts.URL)
+	}
+
+	err = SetOutboundOpt(&OutboundOptions{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	resp, err := OutboundClient(time.Second).Get(ts.URL)
+	if err != nil {
+		t.Errorf("OutboundClient().Get(%v) error = %v, want no denied networks", ts.URL, err)
+		return
+	}
+	resp.Body.Close()
+	err = SetOutboundOpt(&OutboundOptions{DeniedNets: []string{"not a network"}})
+	if err == nil {
+		t.Errorf("SetOutboundOpt() accepted an invalid network")
+	}
+}
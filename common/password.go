@@ -0,0 +1,224 @@
+package common
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+/* error message range: 15000-15099 */
+
+// The password hashing algorithms
+const (
+	PasswordBcrypt   = "bcrypt"
+	PasswordArgon2id = "argon2id"
+)
+
+// The password options used when they are not set
+const (
+	PasswordMinLength     = 6
+	PasswordMaxLength     = 50
+	PasswordArgon2Time    = 2
+	PasswordArgon2Memory  = 19 * 1024
+	PasswordArgon2Threads = 1
+)
+
+// argon2KeyLen, argon2SaltLen - the sizes of the argon2id hash and salt
+const (
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+// ErrPasswordBreached - the password is in the breached password list
+var ErrPasswordBreached = errors.New("Password has appeared in a data breach, choose another password")
+
+// ErrPasswordReused - the password is one of the earlier passwords
+var ErrPasswordReused = errors.New("Password was used recently, choose another password")
+
+// passwordDefaults - the options with the defaults for the values not set
+func passwordDefaults(opt *PasswordOptions) PasswordOptions {
+	o := PasswordOptions{}
+	if opt != nil {
+		o = *opt
+	}
+	if o.MinLength <= 0 {
+		o.MinLength = PasswordMinLength
+	}
+	if o.MaxLength <= 0 {
+		o.MaxLength = PasswordMaxLength
+	}
+	if o.Algorithm == "" {
+		o.Algorithm = PasswordBcrypt
+	}
+	if o.BcryptCost == 0 {
+		o.BcryptCost = bcrypt.DefaultCost
+	}
+	if o.Argon2Time == 0 {
+		o.Argon2Time = PasswordArgon2Time
+	}
+	if o.Argon2Memory == 0 {
+		o.Argon2Memory = PasswordArgon2Memory
+	}
+	if o.Argon2Threads == 0 {
+		o.Argon2Threads = PasswordArgon2Threads
+	}
+	return o
+}
+
+// argon2Hash - the parameters, salt and key of an argon2id hash
+type argon2Hash struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func parseArgon2Hash(hash []byte) (*argon2Hash, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != PasswordArgon2id {
+		return nil, errors.New("Invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errors.New("Unsupported argon2id version")
+	}
+	h := argon2Hash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, errors.New("Invalid argon2id parameters")
+	}
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, err
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// ComparePassword - check the password against a bcrypt or argon2id hash,
+// a wrong password is bcrypt.ErrMismatchedHashAndPassword
+func ComparePassword(hash []byte, password string) error {
+	if !strings.HasPrefix(string(hash), "$"+PasswordArgon2id+"$") {
+		return bcrypt.CompareHashAndPassword(hash, []byte(password))
+	}
+	h, err := parseArgon2Hash(hash)
+	if err != nil {
+		return err
+	}
+	key := argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	if subtle.ConstantTimeCompare(key, h.key) != 1 {
+		return bcrypt.ErrMismatchedHashAndPassword
+	}
+	return nil
+}
+
+// PasswordNeedsRehash - whether the hash was made with another algorithm
+// or other parameters than the options
+func PasswordNeedsRehash(hash []byte, opt *PasswordOptions) bool {
+	o := passwordDefaults(opt)
+	if o.Algorithm == PasswordArgon2id {
+		h, err := parseArgon2Hash(hash)
+		return err != nil || h.time != o.Argon2Time || h.memory != o.Argon2Memory || h.threads != o.Argon2Threads || len(h.key) != argon2KeyLen
+	}
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost != o.BcryptCost
+}
+
+// CheckPasswordPolicy - check the length and character classes of the
+// password and that it is not in the breached password list
+func CheckPasswordPolicy(password string, opt *PasswordOptions, requestID string) error {
+	o := passwordDefaults(opt)
+	n := len([]rune(password))
+	if n < o.MinLength || n > o.MaxLength {
+		return fmt.Errorf("Password must have %d to %d characters", o.MinLength, o.MaxLength)
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	missing := []string{}
+	if o.RequireUpper && !upper {
+		missing = append(missing, "an upper case letter")
+	}
+	if o.RequireLower && !lower {
+		missing = append(missing, "a lower case letter")
+	}
+	if o.RequireDigit && !digit {
+		missing = append(missing, "a digit")
+	}
+	if o.RequireSymbol && !symbol {
+		missing = append(missing, "a symbol")
+	}
+	if len(missing) > 0 {
+		return errors.New("Password must have " + strings.Join(missing, ", "))
+	}
+	breached, err := PasswordBreached(password, o.BreachPath)
+	if err != nil {
+		// an unreadable list does not lock users out of changing passwords
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15001}).Error(err)
+		return nil
+	}
+	if breached {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+// PasswordBreached - whether the password is in the breached password
+// list, a directory of range files named by the first 5 hex digits of the
+// SHA-1 of the passwords (with or without .txt) listing the other 35
+// digits and a count as SUFFIX:COUNT, as the k-anonymity range API
+// returns them; there is no list when dir is empty
+func PasswordBreached(password string, dir string) (bool, error) {
+	if dir == "" {
+		return false, nil
+	}
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := digest[:5], digest[5:]
+	f, err := os.Open(filepath.Join(dir, prefix+".txt"))
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(dir, prefix))
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.Index(line, ":")
+		if i < 0 || !strings.EqualFold(line[:i], suffix) {
+			continue
+		}
+		// padding entries of the range API have a count of 0
+		return strings.TrimSpace(line[i+1:]) != "0", nil
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,78 @@
+package common_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+func TestHashPassword(t *testing.T) {
+	bcryptOpt := &common.PasswordOptions{Algorithm: common.PasswordBcrypt, BcryptCost: 4}
+	argonOpt := &common.PasswordOptions{Algorithm: common.PasswordArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}
+	for _, opt := range []*common.PasswordOptions{bcryptOpt, argonOpt} {
+		hash, err := common.HashPassword("s3cret pass", opt, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = common.ComparePassword(hash, "s3cret pass"); err != nil {
+			t.Errorf("ComparePassword(%s) error = %v", opt.Algorithm, err)
+		}
+		if err = common.ComparePassword(hash, "wrong"); err == nil {
+			t.Errorf("ComparePassword(%s) error = nil, want a mismatch", opt.Algorithm)
+		}
+		if common.PasswordNeedsRehash(hash, opt) {
+			t.Errorf("PasswordNeedsRehash(%s) = true with the same options", opt.Algorithm)
+		}
+	}
+	hash, _ := common.HashPassword("s3cret pass", bcryptOpt, "")
+	if !common.PasswordNeedsRehash(hash, argonOpt) {
+		t.Errorf("PasswordNeedsRehash() = false, want a bcrypt hash moved to argon2id")
+	}
+	stronger := *argonOpt
+	stronger.Argon2Memory = 2048
+	hash, _ = common.HashPassword("s3cret pass", argonOpt, "")
+	if !common.PasswordNeedsRehash(hash, &stronger) {
+		t.Errorf("PasswordNeedsRehash() = false, want new argon2id parameters applied")
+	}
+}
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "breached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sum := sha1.Sum([]byte("Password1!"))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	err = ioutil.WriteFile(filepath.Join(dir, digest[:5]+".txt"), []byte("0000000000000000000000000000000000A:0\r\n"+digest[5:]+":42\r\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opt := &common.PasswordOptions{MinLength: 8, MaxLength: 64, RequireUpper: true, RequireDigit: true, BreachPath: dir}
+	tests := []struct {
+		password string
+		ok       bool
+	}{
+		{"Sh0rt", false},
+		{"alllowercase1", false},
+		{"NoDigitsHere", false},
+		{"Password1!", false},
+		{"Correct horse 9", true},
+	}
+	for _, tt := range tests {
+		err := common.CheckPasswordPolicy(tt.password, opt, "")
+		if (err == nil) != tt.ok {
+			t.Errorf("CheckPasswordPolicy(%q) error = %v", tt.password, err)
+		}
+	}
+	if err = common.CheckPasswordPolicy("Password1!", opt, ""); err != common.ErrPasswordBreached {
+		t.Errorf("CheckPasswordPolicy() error = %v, want the breached password refused", err)
+	}
+}
@@ -0,0 +1,115 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+// routeDocRe - a route in the comment above processGet, processPost ..
+var routeDocRe = regexp.MustCompile(`^\s*(GET|POST|PUT|DELETE)\s+"(/v0\.1/[^"]*)"`)
+
+// routePathParamRe - a path parameter like {id}
+var routePathParamRe = regexp.MustCompile(`\{[^}]+\}`)
+
+// routeRoles - the routes that are not for co_admin, "" when the route is
+// public and not checked against the roles
+var routeRoles = map[string]string{
+	"/v0.1/users/force_logout": SiteAdminRole,
+	"/v0.1/hooks/1":            "",
+}
+
+// TestRoutePolicies - every route documented in the controllers has a
+// policy for its role in config.json
+func TestRoutePolicies(t *testing.T) {
+	data, err := ioutil.ReadFile("config.json")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	config := struct {
+		Roles []Role `json:"roles"`
+	}{}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	e, err := casbin.NewEnforcer("vilom_rbac_policy.conf")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, r := range config.Roles {
+		if r.PType == "g" {
+			_, err = e.AddGroupingPolicy(r.V0, r.V1)
+		} else {
+			_, err = e.AddPolicy(r.V0, r.V1, r.V2)
+		}
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	files := []string{}
+	for _, dir := range []string{"../user/usercontrollers", "../msg/msgcontrollers"} {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		files = append(files, matches...)
+	}
+	numRoutes := 0
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			m := routeDocRe.FindStringSubmatch(scanner.Text())
+			if m == nil {
+				continue
+			}
+			method := m[1]
+			path := routePathParamRe.ReplaceAllString(strings.SplitN(m[2], "?", 2)[0], "1")
+			role, ok := routeRoles[path]
+			if !ok {
+				role = "co_admin"
+			}
+			numRoutes++
+			if role == "" {
+				continue
+			}
+			allowed, err := e.Enforce(role, path, method)
+			if err != nil {
+				t.Error(err)
+			}
+			if !allowed {
+				t.Errorf("%v: no policy for %v %v %v", filepath.Base(file), role, method, m[2])
+			}
+		}
+		err = scanner.Err()
+		_ = f.Close()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if numRoutes == 0 {
+		t.Errorf("no routes found in the controllers")
+	}
+}
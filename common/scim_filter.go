@@ -0,0 +1,309 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The types of the SCIM attributes a filter can compare, SCIMBool
+// attributes are the statusc column
+const (
+	SCIMString = "string"
+	SCIMBool   = "bool"
+	SCIMUUID   = "uuid"
+	SCIMTime   = "time"
+)
+
+// SCIMAttr - the column a SCIM attribute is stored in
+type SCIMAttr struct {
+	Column string
+	Type   string
+}
+
+// ErrSCIMInvalidFilter - the filter cannot be parsed or uses an attribute
+// or operator that is not supported
+var ErrSCIMInvalidFilter = errors.New("Invalid SCIM filter")
+
+type scimToken struct {
+	text   string
+	quoted bool
+}
+
+func scimTokens(filter string) ([]scimToken, error) {
+	tokens := []scimToken{}
+	for i := 0; i < len(filter); {
+		c := filter[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, scimToken{text: string(c)})
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(filter) && filter[j] != '"'; j++ {
+				if filter[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(filter) {
+				return nil, ErrSCIMInvalidFilter
+			}
+			var s string
+			if err := json.Unmarshal([]byte(filter[i:j+1]), &s); err != nil {
+				return nil, ErrSCIMInvalidFilter
+			}
+			tokens = append(tokens, scimToken{text: s, quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(filter) && !strings.ContainsRune(" \t()[]\"", rune(filter[j])); j++ {
+			}
+			tokens = append(tokens, scimToken{text: filter[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type scimFilterParser struct {
+	tokens []scimToken
+	pos    int
+	attrs  map[string]SCIMAttr
+	prefix string
+	args   []interface{}
+}
+
+func (p *scimFilterParser) peek() string {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].quoted {
+		return ""
+	}
+	return strings.ToLower(p.tokens[p.pos].text)
+}
+
+func (p *scimFilterParser) next() (scimToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return scimToken{}, false
+	}
+	p.pos++
+	return p.tokens[p.pos-1], true
+}
+
+func (p *scimFilterParser) parseOr() (string, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for p.peek() == "or" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " or " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd() (string, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return "", err
+	}
+	for p.peek() == "and" {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " and " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) expect(text string) error {
+	if p.peek() != text {
+		return ErrSCIMInvalidFilter
+	}
+	p.pos++
+	return nil
+}
+
+func (p *scimFilterParser) parseUnary() (string, error) {
+	switch p.peek() {
+	case "not":
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return "", err
+		}
+		f, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if err = p.expect(")"); err != nil {
+			return "", err
+		}
+		return "not " + f, nil
+	case "(":
+		p.pos++
+		f, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if err = p.expect(")"); err != nil {
+			return "", err
+		}
+		return f, nil
+	}
+	return p.parseAttrExp()
+}
+
+// SCIMAttrName - the attribute path in lower case without its schema URN
+// and value filter, emails[type eq "work"].value is emails.value
+func SCIMAttrName(path string) string {
+	if i := strings.Index(path, "["); i >= 0 {
+		if j := strings.LastIndex(path, "]"); j > i {
+			path = path[:i] + path[j+1:]
+		}
+	}
+	path = strings.ToLower(path)
+	if strings.HasPrefix(path, "urn:") {
+		path = path[strings.LastIndex(path, ":")+1:]
+	}
+	return path
+}
+
+func (p *scimFilterParser) parseAttrExp() (string, error) {
+	tok, ok := p.next()
+	if !ok || tok.quoted {
+		return "", ErrSCIMInvalidFilter
+	}
+	name := p.prefix + SCIMAttrName(tok.text)
+	// a value path such as emails[type eq "work"] filters the sub
+	// attributes of emails
+	if p.peek() == "[" {
+		p.pos++
+		outer := p.prefix
+		p.prefix = name + "."
+		f, err := p.parseOr()
+		p.prefix = outer
+		if err != nil {
+			return "", err
+		}
+		if err = p.expect("]"); err != nil {
+			return "", err
+		}
+		return f, nil
+	}
+	attr, ok := p.attrs[name]
+	if !ok {
+		return "", ErrSCIMInvalidFilter
+	}
+	op := p.peek()
+	p.pos++
+	if op == "pr" {
+		if attr.Type == SCIMString {
+			return "(" + attr.Column + " is not null and " + attr.Column + " <> '')", nil
+		}
+		return attr.Column + " is not null", nil
+	}
+	val, ok := p.next()
+	if !ok {
+		return "", ErrSCIMInvalidFilter
+	}
+	if !val.quoted && strings.ToLower(val.text) == "null" {
+		switch op {
+		case "eq":
+			return attr.Column + " is null", nil
+		case "ne":
+			return attr.Column + " is not null", nil
+		}
+		return "", ErrSCIMInvalidFilter
+	}
+	arg, err := scimFilterValue(attr, val)
+	if err != nil {
+		return "", err
+	}
+	sqlOps := map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+	if sqlOp, ok := sqlOps[op]; ok {
+		if (attr.Type == SCIMBool || attr.Type == SCIMUUID) && op != "eq" && op != "ne" {
+			return "", ErrSCIMInvalidFilter
+		}
+		p.args = append(p.args, arg)
+		return attr.Column + " " + sqlOp + " ?", nil
+	}
+	s, isString := arg.(string)
+	if !isString || attr.Type != SCIMString {
+		return "", ErrSCIMInvalidFilter
+	}
+	s = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+	switch op {
+	case "co":
+		s = "%" + s + "%"
+	case "sw":
+		s = s + "%"
+	case "ew":
+		s = "%" + s
+	default:
+		return "", ErrSCIMInvalidFilter
+	}
+	p.args = append(p.args, s)
+	return attr.Column + ` like ? escape '\\'`, nil
+}
+
+// scimFilterValue - the SQL argument of a comparison value
+func scimFilterValue(attr SCIMAttr, val scimToken) (interface{}, error) {
+	switch attr.Type {
+	case SCIMBool:
+		switch strings.ToLower(val.text) {
+		case "true":
+			return Active, nil
+		case "false":
+			return Inactive, nil
+		}
+		return nil, ErrSCIMInvalidFilter
+	case SCIMUUID:
+		b, err := UUIDStrToBytes(val.text)
+		if err != nil {
+			return nil, ErrSCIMInvalidFilter
+		}
+		return b, nil
+	case SCIMTime:
+		t, err := time.Parse(time.RFC3339, val.text)
+		if err != nil {
+			return nil, ErrSCIMInvalidFilter
+		}
+		return t.UTC(), nil
+	}
+	if !val.quoted {
+		if _, err := strconv.ParseFloat(val.text, 64); err != nil {
+			return nil, ErrSCIMInvalidFilter
+		}
+	}
+	return val.text, nil
+}
+
+// SCIMFilterSQL - the SQL condition and its arguments for a SCIM filter
+// such as userName eq "ann" and active eq true; attrs maps the lower case
+// attribute paths to their columns, other attributes are refused
+func SCIMFilterSQL(filter string, attrs map[string]SCIMAttr) (string, []interface{}, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "1 = 1", nil, nil
+	}
+	tokens, err := scimTokens(filter)
+	if err != nil {
+		return "", nil, err
+	}
+	p := scimFilterParser{tokens: tokens, attrs: attrs}
+	cond, err := p.parseOr()
+	if err != nil {
+		return "", nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return "", nil, ErrSCIMInvalidFilter
+	}
+	return cond, p.args, nil
+}
@@ -0,0 +1,55 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSCIMFilterSQL(t *testing.T) {
+	attrs := map[string]SCIMAttr{
+		"username":     {Column: "username", Type: SCIMString},
+		"emails.value": {Column: "email", Type: SCIMString},
+		"active":       {Column: "statusc", Type: SCIMBool},
+		"meta.created": {Column: "created_at", Type: SCIMTime},
+	}
+	tests := []struct {
+		filter string
+		cond   string
+		args   []interface{}
+	}{
+		{"", "1 = 1", nil},
+		{`userName eq "Ann@Example.com"`, "username = ?", []interface{}{"Ann@Example.com"}},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName sw "a_1"`, "username like ? escape '\\\\'", []interface{}{"a\\_1%"}},
+		{`userName co "_"`, "username like ? escape '\\\\'", []interface{}{"%\\_%"}},
+		{`userName ew "100%"`, "username like ? escape '\\\\'", []interface{}{"%100\\%"}},
+		{`emails[value co "@example.com"] and active eq true`, "(email like ? escape '\\\\' and statusc = ?)", []interface{}{"%@example.com%", Active}},
+		{`meta.created gt "2020-01-02T03:04:05+01:00"`, "created_at > ?", []interface{}{time.Date(2020, 1, 2, 2, 4, 5, 0, time.UTC)}},
+		{`not (userName pr) or active eq false`, "(not (username is not null and username <> '') or statusc = ?)", []interface{}{Inactive}},
+	}
+	for _, tt := range tests {
+		cond, args, err := SCIMFilterSQL(tt.filter, attrs)
+		if err != nil {
+			t.Errorf("SCIMFilterSQL(%q) error = %v", tt.filter, err)
+			continue
+		}
+		if cond != tt.cond || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("SCIMFilterSQL(%q) = %q %v, want %q %v", tt.filter, cond, args, tt.cond, tt.args)
+		}
+	}
+	if got := SCIMAttrName(`urn:ietf:params:scim:schemas:core:2.0:User:emails[type eq "work"].value`); got != "emails.value" {
+		t.Errorf("SCIMAttrName() = %v, want emails.value", got)
+	}
+	for _, filter := range []string{
+		`password eq "x"`,
+		`userName eq`,
+		`userName eq "ann" and`,
+		`active gt true`,
+		`(userName eq "ann"`,
+		`userName eq ann`,
+	} {
+		if _, _, err := SCIMFilterSQL(filter, attrs); err == nil {
+			t.Errorf("SCIMFilterSQL(%q) error = nil, want an invalid filter error", filter)
+		}
+	}
+}
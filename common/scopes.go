@@ -0,0 +1,116 @@
+package common
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Scopes - the scopes a personal access token can be limited to; a
+// write scope also grants read, and an admin scope grants both
+var Scopes = []string{
+	"read:messages",
+	"write:messages",
+	"read:channels",
+	"write:channels",
+	"read:workspace",
+	"admin:workspace",
+	"read:users",
+	"write:users",
+	"read:search",
+	"read:tokens",
+	"write:tokens",
+}
+
+// scopeLevels - the rank of each scope prefix
+var scopeLevels = map[string]int{
+	"read":  1,
+	"write": 2,
+	"admin": 3,
+}
+
+// scopeRoutes - the resource of the API paths starting with prefix, the
+// more specific prefixes come first; the write scope of workspace is
+// admin:workspace
+var scopeRoutes = []struct {
+	prefix   string
+	resource string
+}{
+	{"/v0.1/users/me/mentions", "messages"},
+	{"/v0.1/users/me/sessions", "users"},
+	{"/v0.1/users/me/tokens", "tokens"},
+	{"/v0.1/users/force_logout", "users"},
+	{"/v0.1/messages", "messages"},
+	{"/v0.1/uploads", "messages"},
+	{"/v0.1/commands", "messages"},
+	{"/v0.1/channels", "channels"},
+	{"/v0.1/workspaces", "workspace"},
+	{"/v0.1/invites", "workspace"},
+	{"/v0.1/webhooks", "workspace"},
+	{"/v0.1/incomingwebhooks", "workspace"},
+	{"/v0.1/grants", "workspace"},
+	{"/v0.1/users", "users"},
+	{"/v0.1/ugroups", "users"},
+	{"/v0.1/ubadges", "users"},
+	{"/v0.1/bots", "users"},
+	{"/v0.1/notifications", "users"},
+	{"/v0.1/search", "search"},
+}
+
+// IsScope - whether scope is one of Scopes
+func IsScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiredScope - the scope a request with method to path needs, empty
+// when no scope grants the path
+func RequiredScope(method string, path string) string {
+	for _, route := range scopeRoutes {
+		if path == route.prefix || strings.HasPrefix(path, route.prefix+"/") {
+			switch {
+			case method == http.MethodGet:
+				return "read:" + route.resource
+			case route.resource == "workspace":
+				return "admin:" + route.resource
+			default:
+				return "write:" + route.resource
+			}
+		}
+	}
+	return ""
+}
+
+// HasScope - whether the scopes grant the scope required
+func HasScope(scopes []string, required string) bool {
+	i := strings.Index(required, ":")
+	if i < 0 {
+		return false
+	}
+	for _, scope := range scopes {
+		j := strings.Index(scope, ":")
+		if j < 0 || scope[j+1:] != required[i+1:] {
+			continue
+		}
+		if scopeLevels[scope[:j]] >= scopeLevels[required[:i]] {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckScopes - whether a token limited to scopes may make the request,
+// tokens without scopes are limited by their role only
+func CheckScopes(r *http.Request, scopes []string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	required := RequiredScope(r.Method, r.URL.Path)
+	if required == "" {
+		return false
+	}
+	return HasScope(scopes, required)
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", "/v0.1/messages/89193ec7", "read:messages"},
+		{"PUT", "/v0.1/messages/89193ec7", "write:messages"},
+		{"GET", "/v0.1/users/me/mentions", "read:messages"},
+		{"POST", "/v0.1/workspaces/create", "admin:workspace"},
+		{"GET", "/v0.1/users/me/tokens", "read:tokens"},
+		{"GET", "/v0.1/users", "read:users"},
+		{"GET", "/v0.1/usersx", ""},
+		{"GET", "/v0.1/unknown", ""},
+	}
+	for _, tt := range tests {
+		if got := RequiredScope(tt.method, tt.path); got != tt.want {
+			t.Errorf("RequiredScope(%v, %v) = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCheckScopes(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		scopes []string
+		want   bool
+	}{
+		{"GET", "/v0.1/messages/1", nil, true},
+		{"GET", "/v0.1/messages/1", []string{"read:messages"}, true},
+		{"GET", "/v0.1/messages/1", []string{"write:messages"}, true},
+		{"PUT", "/v0.1/messages/1", []string{"read:messages"}, false},
+		{"GET", "/v0.1/channels/1", []string{"write:messages"}, false},
+		{"GET", "/v0.1/workspaces/1", []string{"admin:workspace"}, true},
+		{"GET", "/v0.1/unknown", []string{"admin:workspace"}, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := CheckScopes(r, tt.scopes); got != tt.want {
+			t.Errorf("CheckScopes(%v %v, %v) = %v, want %v", tt.method, tt.path, tt.scopes, got, tt.want)
+		}
+	}
+}
@@ -5,7 +5,7 @@
 package mocks
 
 import (
-	bleve "github.com/blevesearch/bleve"
+	context "context"
 	searchservices "github.com/cloudfresco/vilom/search/searchservices"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
@@ -35,16 +35,31 @@ func (m *MockSearchServiceIntf) EXPECT() *MockSearchServiceIntfMockRecorder {
 }
 
 // Search mocks base method
-func (m *MockSearchServiceIntf) Search(form *searchservices.BleveForm, userEmail, requestID string) (*bleve.SearchResult, error) {
+func (m *MockSearchServiceIntf) Search(ctx context.Context, form *searchservices.BleveForm, userEmail, requestID string) (*searchservices.SearchResult, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Search", form, userEmail, requestID)
-	ret0, _ := ret[0].(*bleve.SearchResult)
+	ret := m.ctrl.Call(m, "Search", ctx, form, userEmail, requestID)
+	ret0, _ := ret[0].(*searchservices.SearchResult)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Search indicates an expected call of Search
-func (mr *MockSearchServiceIntfMockRecorder) Search(form, userEmail, requestID interface{}) *gomock.Call {
+func (mr *MockSearchServiceIntfMockRecorder) Search(ctx, form, userEmail, requestID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockSearchServiceIntf)(nil).Search), form, userEmail, requestID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockSearchServiceIntf)(nil).Search), ctx, form, userEmail, requestID)
+}
+
+// Typeahead mocks base method
+func (m *MockSearchServiceIntf) Typeahead(ctx context.Context, form *searchservices.TypeaheadForm, userEmail, requestID string) ([]*searchservices.Suggestion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Typeahead", ctx, form, userEmail, requestID)
+	ret0, _ := ret[0].([]*searchservices.Suggestion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Typeahead indicates an expected call of Typeahead
+func (mr *MockSearchServiceIntfMockRecorder) Typeahead(ctx, form, userEmail, requestID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Typeahead", reflect.TypeOf((*MockSearchServiceIntf)(nil).Typeahead), ctx, form, userEmail, requestID)
 }
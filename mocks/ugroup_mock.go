@@ -224,3 +224,18 @@ func (mr *MockUgroupServiceIntfMockRecorder) DeleteUserFromGroup(ctx, form, ID,
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserFromGroup", reflect.TypeOf((*MockUgroupServiceIntf)(nil).DeleteUserFromGroup), ctx, form, ID, userEmail, requestID)
 }
+
+// GetUgroupMembers mocks base method
+func (m *MockUgroupServiceIntf) GetUgroupMembers(ctx context.Context, ID string, effective bool, userEmail, requestID string) ([]*userservices.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUgroupMembers", ctx, ID, effective, userEmail, requestID)
+	ret0, _ := ret[0].([]*userservices.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUgroupMembers indicates an expected call of GetUgroupMembers
+func (mr *MockUgroupServiceIntfMockRecorder) GetUgroupMembers(ctx, ID, effective, userEmail, requestID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUgroupMembers", reflect.TypeOf((*MockUgroupServiceIntf)(nil).GetUgroupMembers), ctx, ID, effective, userEmail, requestID)
+}
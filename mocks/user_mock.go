@@ -37,18 +37,18 @@ func (m *MockUserServiceIntf) EXPECT() *MockUserServiceIntfMockRecorder {
 }
 
 // Login mocks base method
-func (m *MockUserServiceIntf) Login(ctx context.Context, form *userservices.LoginForm, requestID string) (*userservices.User, error) {
+func (m *MockUserServiceIntf) Login(ctx context.Context, form *userservices.LoginForm, clientIP, userAgent, requestID string) (*userservices.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Login", ctx, form, requestID)
+	ret := m.ctrl.Call(m, "Login", ctx, form, clientIP, userAgent, requestID)
 	ret0, _ := ret[0].(*userservices.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Login indicates an expected call of Login
-func (mr *MockUserServiceIntfMockRecorder) Login(ctx, form, requestID interface{}) *gomock.Call {
+func (mr *MockUserServiceIntfMockRecorder) Login(ctx, form, clientIP, userAgent, requestID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Login", reflect.TypeOf((*MockUserServiceIntf)(nil).Login), ctx, form, requestID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Login", reflect.TypeOf((*MockUserServiceIntf)(nil).Login), ctx, form, clientIP, userAgent, requestID)
 }
 
 // CreateUser mocks base method
@@ -182,17 +182,17 @@ func (mr *MockUserServiceIntfMockRecorder) ConfirmForgotPassword(ctx, form, toke
 }
 
 // ChangePassword mocks base method
-func (m *MockUserServiceIntf) ChangePassword(ctx context.Context, form *userservices.PasswordForm, userEmail, requestID string) error {
+func (m *MockUserServiceIntf) ChangePassword(ctx context.Context, form *userservices.PasswordForm, sessionID, userEmail, requestID string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ChangePassword", ctx, form, userEmail, requestID)
+	ret := m.ctrl.Call(m, "ChangePassword", ctx, form, sessionID, userEmail, requestID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // ChangePassword indicates an expected call of ChangePassword
-func (mr *MockUserServiceIntfMockRecorder) ChangePassword(ctx, form, userEmail, requestID interface{}) *gomock.Call {
+func (mr *MockUserServiceIntfMockRecorder) ChangePassword(ctx, form, sessionID, userEmail, requestID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockUserServiceIntf)(nil).ChangePassword), ctx, form, userEmail, requestID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockUserServiceIntf)(nil).ChangePassword), ctx, form, sessionID, userEmail, requestID)
 }
 
 // ChangeEmail mocks base method
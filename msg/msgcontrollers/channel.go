@@ -74,10 +74,13 @@ func (tc *ChannelController) processGet(w http.ResponseWriter, r *http.Request,
 /*
  POST  "/v1/channels/create/"
  POST  "/v1/channels/channelbyname/"
+ POST  "/v1/channels/{id}/users"
 */
 func (tc *ChannelController) processPost(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
 
-	if (len(pathParts) == 3) && (pathParts[1] == "channels") {
+	if (len(pathParts) == 4) && (pathParts[1] == "channels") && (pathParts[3] == "users") {
+		tc.AddChannelUser(w, r, pathParts[2], user, requestID)
+	} else if (len(pathParts) == 3) && (pathParts[1] == "channels") {
 		if pathParts[2] == "create" {
 			tc.CreateChannel(w, r, user, requestID)
 		} else if pathParts[2] == "channelbyname" {
@@ -255,3 +258,31 @@ func (tc *ChannelController) DeleteChannel(w http.ResponseWriter, r *http.Reques
 		common.RenderJSON(w, "Deleted Successfully")
 	}
 }
+
+// AddChannelUser - used to add a user or a bot user to the channel
+func (tc *ChannelController) AddChannelUser(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := userservices.User{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 5009}).Error(err)
+			common.RenderErrorJSON(w, "5009", err.Error(), 402, requestID)
+			return
+		}
+		err = tc.Service.AddChannelUser(ctx, id, form.IDS, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 5010}).Error(err)
+			common.RenderErrorJSON(w, "5010", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Added Successfully")
+	}
+}
@@ -0,0 +1,184 @@
+package msgcontrollers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/msg/msgservices"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 10000-10099 */
+
+// CommandController - Create Command Controller
+type CommandController struct {
+	Service  msgservices.CommandServiceIntf
+	Serviceu userservices.UserServiceIntf
+}
+
+// NewCommandController - Create Command Handler
+func NewCommandController(s msgservices.CommandServiceIntf, su userservices.UserServiceIntf) *CommandController {
+	return &CommandController{
+		Service:  s,
+		Serviceu: su,
+	}
+}
+
+// ServeHTTP - parse url and call controller action
+func (cc *CommandController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, requestID, err := cc.Serviceu.GetAuthUserDetails(r)
+	if err != nil {
+		common.RenderErrorJSON(w, "1001", err.Error(), 401, requestID)
+		return
+	}
+	pathParts, queryString, err := common.ParseURL(r.URL.String())
+	if err != nil {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		cc.processGet(w, r, user, requestID, pathParts, queryString)
+	case http.MethodPost:
+		cc.processPost(w, r, user, requestID, pathParts)
+	case http.MethodDelete:
+		cc.processDelete(w, r, user, requestID, pathParts)
+	default:
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+}
+
+// processGet - Parse URL for all the GET paths and call the controller action
+/*
+ GET  "/v0.1/commands?workspace_id={workspace_id}"
+*/
+
+func (cc *CommandController) processGet(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string, queryString url.Values) {
+
+	if (len(pathParts) == 2) && (pathParts[1] == "commands") {
+		cc.GetCommands(w, r, queryString.Get("workspace_id"), user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processPost - Parse URL for all the POST paths and call the controller action
+/*
+ POST  "/v0.1/commands/create"
+*/
+
+func (cc *CommandController) processPost(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "commands") && (pathParts[2] == "create") {
+		cc.CreateCommand(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processDelete - Parse URL for all the delete paths and call the controller action
+/*
+ DELETE  "/v0.1/commands/{id}"
+*/
+
+func (cc *CommandController) processDelete(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "commands") {
+		cc.DeleteCommand(w, r, pathParts[2], user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+}
+
+// CreateCommand - used to Create an external command, the response
+// carries the secret that signs the requests to the command
+func (cc *CommandController) CreateCommand(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := msgservices.Command{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 10000}).Error(err)
+			common.RenderErrorJSON(w, "10000", err.Error(), 402, requestID)
+			return
+		}
+		v := common.NewValidator()
+		v.IsStrLenBetMinMax("Command Desc", form.CommandDesc, msgservices.CommandDescLenMin, msgservices.CommandDescLenMax)
+		if v.IsValid() {
+			common.RenderErrorJSON(w, "10001", v.Error(), 402, requestID)
+			return
+		}
+		cmd, err := cc.Service.CreateCommand(ctx, &form, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 10002}).Error(err)
+			common.RenderErrorJSON(w, "10002", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, cmd)
+	}
+}
+
+// GetCommands - used to view the external commands of a workspace
+func (cc *CommandController) GetCommands(w http.ResponseWriter, r *http.Request, workspaceID string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		wsID, err := strconv.ParseUint(workspaceID, 10, 0)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 10003}).Error(err)
+			common.RenderErrorJSON(w, "10003", "Invalid workspace_id", 402, requestID)
+			return
+		}
+		cmds, err := cc.Service.GetCommands(ctx, uint(wsID), user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 10004}).Error(err)
+			common.RenderErrorJSON(w, "10004", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, cmds)
+	}
+}
+
+// DeleteCommand - delete command
+func (cc *CommandController) DeleteCommand(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		err := cc.Service.DeleteCommand(ctx, id, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 10005}).Error(err)
+			common.RenderErrorJSON(w, "10005", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Deleted Successfully")
+	}
+}
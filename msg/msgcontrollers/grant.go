@@ -0,0 +1,189 @@
+package msgcontrollers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/msg/msgservices"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 15300-15399 */
+
+// GrantController - Create Grant Controller
+type GrantController struct {
+	Service  msgservices.GrantServiceIntf
+	Serviceu userservices.UserServiceIntf
+}
+
+// NewGrantController - Create Grant Handler
+func NewGrantController(s msgservices.GrantServiceIntf, su userservices.UserServiceIntf) *GrantController {
+	return &GrantController{
+		Service:  s,
+		Serviceu: su,
+	}
+}
+
+// ServeHTTP - parse url and call controller action
+func (gc *GrantController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, requestID, err := gc.Serviceu.GetAuthUserDetails(r)
+	if err != nil {
+		common.RenderErrorJSON(w, "1001", err.Error(), 401, requestID)
+		return
+	}
+	pathParts, queryString, err := common.ParseURL(r.URL.String())
+	if err != nil {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		gc.processGet(w, r, user, requestID, pathParts, queryString)
+	case http.MethodPost:
+		gc.processPost(w, r, user, requestID, pathParts)
+	case http.MethodDelete:
+		gc.processDelete(w, r, user, requestID, pathParts)
+	default:
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+}
+
+// processGet - Parse URL for all the GET paths and call the controller action
+/*
+ GET  "/v0.1/grants?workspace_id={workspace_id}"
+ GET  "/v0.1/grants?channel_id={channel_id}"
+*/
+
+func (gc *GrantController) processGet(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string, queryString url.Values) {
+
+	if (len(pathParts) == 2) && (pathParts[1] == "grants") {
+		gc.GetGrants(w, r, queryString.Get("workspace_id"), queryString.Get("channel_id"), user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processPost - Parse URL for all the POST paths and call the controller action
+/*
+ POST  "/v0.1/grants/create"
+*/
+
+func (gc *GrantController) processPost(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "grants") && (pathParts[2] == "create") {
+		gc.CreateGrant(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processDelete - Parse URL for all the delete paths and call the controller action
+/*
+ DELETE  "/v0.1/grants/{id}"
+*/
+
+func (gc *GrantController) processDelete(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "grants") {
+		gc.DeleteGrant(w, r, pathParts[2], user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+}
+
+// CreateGrant - used to grant a ugroup a role on a workspace or a channel
+func (gc *GrantController) CreateGrant(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := msgservices.UgroupGrant{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 15300}).Error(err)
+			common.RenderErrorJSON(w, "15300", err.Error(), 402, requestID)
+			return
+		}
+		err = msgservices.ValidateGrant(&form)
+		if err != nil {
+			common.RenderErrorJSON(w, "15301", err.Error(), 402, requestID)
+			return
+		}
+		grant, err := gc.Service.CreateGrant(ctx, &form, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 15302}).Error(err)
+			common.RenderErrorJSON(w, "15302", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, grant)
+	}
+}
+
+// GetGrants - used to view the grants on a workspace or a channel
+func (gc *GrantController) GetGrants(w http.ResponseWriter, r *http.Request, workspaceID string, channelID string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		var wsID, chID uint64
+		var err error
+		if channelID != "" {
+			chID, err = strconv.ParseUint(channelID, 10, 0)
+		} else {
+			wsID, err = strconv.ParseUint(workspaceID, 10, 0)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 15303}).Error(err)
+			common.RenderErrorJSON(w, "15303", "Invalid workspace_id or channel_id", 402, requestID)
+			return
+		}
+		grants, err := gc.Service.GetGrants(ctx, uint(wsID), uint(chID), user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 15304}).Error(err)
+			common.RenderErrorJSON(w, "15304", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, grants)
+	}
+}
+
+// DeleteGrant - used to delete grant
+func (gc *GrantController) DeleteGrant(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		err := gc.Service.DeleteGrant(ctx, id, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 15305}).Error(err)
+			common.RenderErrorJSON(w, "15305", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Deleted Successfully")
+	}
+}
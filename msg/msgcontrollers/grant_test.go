@@ -0,0 +1,68 @@
+package msgcontrollers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/msg/msgservices"
+	"github.com/cloudfresco/vilom/testhelpers"
+)
+
+func TestCreateDeleteGrant(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// only a site admin makes the first grant
+	_, err = dbService.DB.Exec(`update users set role = ? where id = 1;`, common.SiteAdminRole)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	tokenstring := LoginUser()
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "http://localhost:8000/v0.1/grants/create", bytes.NewBuffer([]byte(`{"ugroup_id": 2, "channel_id": 1, "grant_role": "read"}`)))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenstring)
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status code %d: %v", w.Code, w.Body.String())
+		return
+	}
+	grant := msgservices.UgroupGrant{}
+	err = json.NewDecoder(w.Body).Decode(&grant)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("DELETE", "http://localhost:8000/v0.1/grants/"+grant.IDS, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenstring)
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status code %d: %v", w.Code, w.Body.String())
+		return
+	}
+	expected := `"Deleted Successfully"` + "\n"
+	if w.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", w.Body.String(), expected)
+	}
+}
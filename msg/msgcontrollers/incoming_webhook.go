@@ -0,0 +1,277 @@
+package msgcontrollers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/msg/msgservices"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 9100-9299 */
+
+// IncomingWebhookController - Create Incoming Webhook Controller
+type IncomingWebhookController struct {
+	Service  msgservices.IncomingWebhookServiceIntf
+	Serviceu userservices.UserServiceIntf
+}
+
+// NewIncomingWebhookController - Create Incoming Webhook Handler
+func NewIncomingWebhookController(s msgservices.IncomingWebhookServiceIntf, su userservices.UserServiceIntf) *IncomingWebhookController {
+	return &IncomingWebhookController{
+		Service:  s,
+		Serviceu: su,
+	}
+}
+
+// ServeHTTP - parse url and call controller action
+func (ic *IncomingWebhookController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, requestID, err := ic.Serviceu.GetAuthUserDetails(r)
+	if err != nil {
+		common.RenderErrorJSON(w, "1001", err.Error(), 401, requestID)
+		return
+	}
+	pathParts, queryString, err := common.ParseURL(r.URL.String())
+	if err != nil {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		ic.processGet(w, r, user, requestID, pathParts, queryString)
+	case http.MethodPost:
+		ic.processPost(w, r, user, requestID, pathParts)
+	case http.MethodDelete:
+		ic.processDelete(w, r, user, requestID, pathParts)
+	default:
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+}
+
+// processGet - Parse URL for all the GET paths and call the controller action
+/*
+ GET  "/v0.1/incomingwebhooks?channel_id={channel_id}"
+ GET  "/v0.1/incomingwebhooks/{id}"
+*/
+
+func (ic *IncomingWebhookController) processGet(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string, queryString url.Values) {
+
+	if (len(pathParts) == 2) && (pathParts[1] == "incomingwebhooks") {
+		ic.GetIncomingWebhooks(w, r, queryString.Get("channel_id"), user, requestID)
+	} else if (len(pathParts) == 3) && (pathParts[1] == "incomingwebhooks") {
+		ic.GetIncomingWebhook(w, r, pathParts[2], user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processPost - Parse URL for all the POST paths and call the controller action
+/*
+ POST  "/v0.1/incomingwebhooks/create"
+*/
+
+func (ic *IncomingWebhookController) processPost(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "incomingwebhooks") && (pathParts[2] == "create") {
+		ic.CreateIncomingWebhook(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processDelete - Parse URL for all the delete paths and call the controller action
+/*
+ DELETE  "/v0.1/incomingwebhooks/{id}"
+*/
+
+func (ic *IncomingWebhookController) processDelete(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "incomingwebhooks") {
+		ic.RevokeIncomingWebhook(w, r, pathParts[2], user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+}
+
+// CreateIncomingWebhook - used to Create Incoming Webhook, the response
+// carries the token of the webhook url
+func (ic *IncomingWebhookController) CreateIncomingWebhook(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := msgservices.IncomingWebhook{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 9100}).Error(err)
+			common.RenderErrorJSON(w, "9100", err.Error(), 402, requestID)
+			return
+		}
+		v := common.NewValidator()
+		v.IsStrLenBetMinMax("Display Name", form.DisplayName, msgservices.DisplayNameLenMin, msgservices.DisplayNameLenMax)
+		if v.IsValid() {
+			common.RenderErrorJSON(w, "9101", v.Error(), 402, requestID)
+			return
+		}
+		webhook, err := ic.Service.CreateIncomingWebhook(ctx, &form, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 9102}).Error(err)
+			common.RenderErrorJSON(w, "9102", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, webhook)
+	}
+}
+
+// GetIncomingWebhooks - used to view the incoming webhooks of a channel
+func (ic *IncomingWebhookController) GetIncomingWebhooks(w http.ResponseWriter, r *http.Request, channelID string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		chID, err := strconv.ParseUint(channelID, 10, 0)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 9103}).Error(err)
+			common.RenderErrorJSON(w, "9103", "Invalid channel_id", 402, requestID)
+			return
+		}
+		webhooks, err := ic.Service.GetIncomingWebhooks(ctx, uint(chID), user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 9104}).Error(err)
+			common.RenderErrorJSON(w, "9104", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, webhooks)
+	}
+}
+
+// GetIncomingWebhook - used to view incoming webhook
+func (ic *IncomingWebhookController) GetIncomingWebhook(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		webhook, err := ic.Service.GetIncomingWebhook(ctx, id, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 9105}).Error(err)
+			common.RenderErrorJSON(w, "9105", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, webhook)
+	}
+}
+
+// RevokeIncomingWebhook - revoke incoming webhook
+func (ic *IncomingWebhookController) RevokeIncomingWebhook(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		err := ic.Service.RevokeIncomingWebhook(ctx, id, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 9106}).Error(err)
+			common.RenderErrorJSON(w, "9106", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Revoked Successfully")
+	}
+}
+
+// HookController - Create Hook Controller, serves the incoming webhook
+// urls, the token in the url authenticates the request
+type HookController struct {
+	Service msgservices.IncomingWebhookServiceIntf
+}
+
+// NewHookController - Create Hook Handler
+func NewHookController(s msgservices.IncomingWebhookServiceIntf) *HookController {
+	return &HookController{
+		Service: s,
+	}
+}
+
+// ServeHTTP - parse url and call controller action
+/*
+ POST  "/v0.1/hooks/{token}"
+*/
+func (hc *HookController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := common.GetRequestID()
+	pathParts := common.GetPathParts(r.URL.Path)
+
+	if (r.Method == http.MethodPost) && (len(pathParts) == 3) && (pathParts[1] == "hooks") {
+		hc.PostMessage(w, r, pathParts[2], requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// PostMessage - used to post a message through an incoming webhook
+func (hc *HookController) PostMessage(w http.ResponseWriter, r *http.Request, token string, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := msgservices.IncomingWebhookPost{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 9107}).Error(err)
+			common.RenderErrorJSON(w, "9107", err.Error(), 402, requestID)
+			return
+		}
+		v := common.NewValidator()
+		v.IsStrLenBetMinMax("Text", form.Text, msgservices.PostTextLenMin, msgservices.PostTextLenMax)
+		if form.DisplayName != "" {
+			v.IsStrLenBetMinMax("Display Name", form.DisplayName, msgservices.DisplayNameLenMin, msgservices.DisplayNameLenMax)
+		}
+		if v.IsValid() {
+			common.RenderErrorJSON(w, "9108", v.Error(), 402, requestID)
+			return
+		}
+		msg, err := hc.Service.PostMessage(ctx, token, &form, requestID)
+		if err == msgservices.ErrIncomingWebhookRateLimited {
+			common.RenderErrorJSON(w, "9109", err.Error(), http.StatusTooManyRequests, requestID)
+			return
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 9110}).Error(err)
+			common.RenderErrorJSON(w, "9110", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, msg)
+	}
+}
@@ -10,25 +10,66 @@ import (
 )
 
 // Init the msg controllers
-func Init(workspaceservice msgservices.WorkspaceServiceIntf, channelService msgservices.ChannelServiceIntf, msgService msgservices.MessageServiceIntf, userService userservices.UserServiceIntf, rateOpt *common.RateOptions, jwtOpt *common.JWTOptions, mux *http.ServeMux, store *goredisstore.GoRedisStore) {
+func Init(workspaceservice msgservices.WorkspaceServiceIntf, channelService msgservices.ChannelServiceIntf, msgService msgservices.MessageServiceIntf, webhookService msgservices.WebhookServiceIntf, incomingWebhookService msgservices.IncomingWebhookServiceIntf, commandService msgservices.CommandServiceIntf, uploadService msgservices.UploadServiceIntf, mentionService msgservices.MentionServiceIntf, grantService msgservices.GrantServiceIntf, userService userservices.UserServiceIntf, rateOpt *common.RateOptions, jwtOpt *common.JWTOptions, blobOpt *common.BlobOptions, mux *http.ServeMux, store *goredisstore.GoRedisStore) {
 
 	cc := NewWorkspaceController(workspaceservice, userService)
 	tc := NewChannelController(channelService, userService)
 	mc := NewMessageController(msgService, userService)
+	wc := NewWebhookController(webhookService, userService)
+	ic := NewIncomingWebhookController(incomingWebhookService, userService)
+	hc := NewHookController(incomingWebhookService)
+	cmc := NewCommandController(commandService, userService)
+	upc := NewUploadController(uploadService, userService, blobOpt.MaxUploadSize)
+	mnc := NewMentionController(mentionService, userService)
+	gc := NewGrantController(grantService, userService)
 
 	hrlCat := common.GetHTTPRateLimiter(store, rateOpt.WorkspaceMaxRate, rateOpt.WorkspaceMaxBurst)
 	hrlChannel := common.GetHTTPRateLimiter(store, rateOpt.ChannelMaxRate, rateOpt.ChannelMaxBurst)
 	hrlMsg := common.GetHTTPRateLimiter(store, rateOpt.MsgMaxRate, rateOpt.MsgMaxBurst)
 	mux.Handle("/v0.1/workspaces", common.AddMiddleware(hrlCat.RateLimit(cc),
 		common.AuthenticateMiddleware,
-		common.CorsMiddleware))
+		common.CorsMiddleware, common.LocaleMiddleware))
 	mux.Handle("/v0.1/workspaces/", common.AddMiddleware(hrlCat.RateLimit(cc),
 		common.AuthenticateMiddleware,
-		common.CorsMiddleware))
+		common.CorsMiddleware, common.LocaleMiddleware))
 	mux.Handle("/v0.1/channels/", common.AddMiddleware(hrlChannel.RateLimit(tc),
 		common.AuthenticateMiddleware,
-		common.CorsMiddleware))
+		common.CorsMiddleware, common.LocaleMiddleware))
 	mux.Handle("/v0.1/messages/", common.AddMiddleware(hrlMsg.RateLimit(mc),
 		common.AuthenticateMiddleware,
-		common.CorsMiddleware))
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/webhooks", common.AddMiddleware(hrlCat.RateLimit(wc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/webhooks/", common.AddMiddleware(hrlCat.RateLimit(wc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/incomingwebhooks", common.AddMiddleware(hrlChannel.RateLimit(ic),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/incomingwebhooks/", common.AddMiddleware(hrlChannel.RateLimit(ic),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/commands", common.AddMiddleware(hrlCat.RateLimit(cmc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/commands/", common.AddMiddleware(hrlCat.RateLimit(cmc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/uploads/", common.AddMiddleware(hrlMsg.RateLimit(upc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/users/me/mentions", common.AddMiddleware(hrlMsg.RateLimit(mnc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/users/me/mentions/", common.AddMiddleware(hrlMsg.RateLimit(mnc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/grants", common.AddMiddleware(hrlCat.RateLimit(gc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/grants/", common.AddMiddleware(hrlCat.RateLimit(gc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/hooks/", common.AddMiddleware(hrlMsg.RateLimit(hc), common.CorsMiddleware, common.LocaleMiddleware))
 }
@@ -0,0 +1,157 @@
+package msgcontrollers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/msg/msgservices"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 12500-12599 */
+
+// MentionController - Create Mention Controller
+type MentionController struct {
+	Service  msgservices.MentionServiceIntf
+	Serviceu userservices.UserServiceIntf
+}
+
+// NewMentionController - Create Mention Handler
+func NewMentionController(s msgservices.MentionServiceIntf, su userservices.UserServiceIntf) *MentionController {
+	return &MentionController{
+		Service:  s,
+		Serviceu: su,
+	}
+}
+
+// ServeHTTP - parse url and call controller action
+func (mc *MentionController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, requestID, err := mc.Serviceu.GetAuthUserDetails(r)
+	if err != nil {
+		common.RenderErrorJSON(w, "1001", err.Error(), 401, requestID)
+		return
+	}
+	pathParts, queryString, err := common.ParseURL(r.URL.String())
+	if err != nil {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		mc.processGet(w, r, user, requestID, pathParts, queryString)
+	case http.MethodPost:
+		mc.processPost(w, r, user, requestID, pathParts)
+	default:
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processGet - Parse URL for all the GET paths and call the controller action
+/*
+ GET  "/v0.1/users/me/mentions?limit={limit}&cursor={cursor}&unread=true"
+ GET  "/v0.1/users/me/mentions/count"
+*/
+
+func (mc *MentionController) processGet(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string, queryString url.Values) {
+
+	if (len(pathParts) == 4) && (pathParts[3] == "mentions") {
+		mc.GetUserMentions(w, r, queryString.Get("limit"), queryString.Get("cursor"), queryString.Get("unread") == "true", user, requestID)
+	} else if (len(pathParts) == 5) && (pathParts[3] == "mentions") && (pathParts[4] == "count") {
+		mc.GetUnreadMentionCount(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processPost - Parse URL for all the POST paths and call the controller action
+/*
+ POST  "/v0.1/users/me/mentions/read"
+*/
+
+func (mc *MentionController) processPost(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 5) && (pathParts[3] == "mentions") && (pathParts[4] == "read") {
+		mc.MarkMentionsRead(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// GetUserMentions - used to view the mentions of the user
+func (mc *MentionController) GetUserMentions(w http.ResponseWriter, r *http.Request, limit string, cursor string, unread bool, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		mentions, err := mc.Service.GetUserMentions(ctx, limit, cursor, unread, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12500}).Error(err)
+			common.RenderErrorJSON(w, "12500", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, mentions)
+	}
+}
+
+// GetUnreadMentionCount - used to view the number of unread mentions of the user
+func (mc *MentionController) GetUnreadMentionCount(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		count, err := mc.Service.GetUnreadMentionCount(ctx, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12501}).Error(err)
+			common.RenderErrorJSON(w, "12501", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, count)
+	}
+}
+
+// MarkMentionsRead - used to mark the mentions of the user as read, of
+// one channel if the body has a channel_id
+func (mc *MentionController) MarkMentionsRead(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := msgservices.MentionRead{}
+		if r.ContentLength != 0 {
+			decoder := json.NewDecoder(r.Body)
+			err := decoder.Decode(&form)
+			if err != nil {
+				log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12502}).Error(err)
+				common.RenderErrorJSON(w, "12502", err.Error(), 402, requestID)
+				return
+			}
+		}
+		err := mc.Service.MarkMentionsRead(ctx, &form, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12503}).Error(err)
+			common.RenderErrorJSON(w, "12503", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Updated Successfully")
+	}
+}
@@ -42,11 +42,29 @@ func TestMain(m *testing.M) {
 	Layout = "2006-01-02T15:04:05Z"
 
 	workspaceservice := msgservices.NewWorkspaceService(dbService, redisService)
-	channelService := msgservices.NewChannelService(dbService, redisService)
-	msgService := msgservices.NewMessageService(dbService, redisService)
+	channelService := msgservices.NewChannelService(dbService, redisService, userOpt)
+	msgService := msgservices.NewMessageService(dbService, redisService, userOpt)
+	webhookService := msgservices.NewWebhookService(dbService, redisService, userOpt)
+	incomingWebhookService := msgservices.NewIncomingWebhookService(dbService, redisService, userOpt)
 	userService := userservices.NewUserService(dbService, redisService, mailerService, jwtOpt, userOpt, authEnforcer)
-	ugroupService := userservices.NewUgroupService(dbService, redisService)
+	ugroupService := userservices.NewUgroupService(dbService, redisService, userOpt)
 	ubadgeService := userservices.NewUbadgeService(dbService, redisService)
+	botService := userservices.NewBotService(dbService, redisService)
+	notificationService := userservices.NewNotificationService(dbService, redisService)
+	digestService := userservices.NewDigestService(dbService, redisService, userOpt)
+	inviteService := userservices.NewInviteService(dbService, redisService, userOpt, authEnforcer)
+	sessionService := userservices.NewSessionService(dbService, redisService)
+	tokenService := userservices.NewTokenService(dbService, redisService)
+	scimService := userservices.NewSCIMService(dbService, redisService, userOpt)
+	blobOpt := &common.BlobOptions{Backend: common.BlobBackendLocal, LocalPath: os.TempDir() + "/vilom-uploads-test", MaxUploadSize: 1 << 20}
+	blobStore, err := common.CreateBlobStore(blobOpt)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	uploadService := msgservices.NewUploadService(dbService, redisService, userOpt, blobStore, blobOpt.MaxUploadSize)
+	mentionService := msgservices.NewMentionService(dbService, redisService)
+	grantService := msgservices.NewGrantService(dbService, redisService, userOpt)
 	store, err := goredisstore.New(redisService.RedisClient, "throttled:")
 	if err != nil {
 		log.Println(err)
@@ -54,8 +72,8 @@ func TestMain(m *testing.M) {
 	}
 
 	mux = http.NewServeMux()
-	Init(workspaceservice, channelService, msgService, userService, rateOpt, jwtOpt, mux, store)
-	usercontrollers.Init(userService, ugroupService, ubadgeService, rateOpt, jwtOpt, mux, store)
+	Init(workspaceservice, channelService, msgService, webhookService, incomingWebhookService, msgService.CommandService, uploadService, mentionService, grantService, userService, rateOpt, jwtOpt, blobOpt, mux, store)
+	usercontrollers.Init(userService, ugroupService, ubadgeService, botService, notificationService, digestService, inviteService, sessionService, tokenService, scimService, rateOpt, jwtOpt, userOpt, mux, store)
 	os.Exit(m.Run())
 }
 
@@ -0,0 +1,265 @@
+package msgcontrollers
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/msg/msgservices"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 11000-11099 */
+
+// uploadFormOverhead - allowance for the multipart headers of an upload
+const uploadFormOverhead = 1 << 20
+
+// UploadController - Create Upload Controller
+type UploadController struct {
+	Service       msgservices.UploadServiceIntf
+	Serviceu      userservices.UserServiceIntf
+	MaxUploadSize int64
+}
+
+// NewUploadController - Create Upload Handler, maxUploadSize caps the
+// request body before the limit of the workspace is known
+func NewUploadController(s msgservices.UploadServiceIntf, su userservices.UserServiceIntf, maxUploadSize int64) *UploadController {
+	return &UploadController{
+		Service:       s,
+		Serviceu:      su,
+		MaxUploadSize: maxUploadSize,
+	}
+}
+
+// ServeHTTP - parse url and call controller action
+func (uc *UploadController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, requestID, err := uc.Serviceu.GetAuthUserDetails(r)
+	if err != nil {
+		common.RenderErrorJSON(w, "1001", err.Error(), 401, requestID)
+		return
+	}
+	pathParts, queryString, err := common.ParseURL(r.URL.String())
+	if err != nil {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		uc.processGet(w, r, user, requestID, pathParts)
+	case http.MethodPost:
+		uc.processPost(w, r, user, requestID, pathParts, queryString)
+	default:
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processGet - Parse URL for all the GET paths and call the controller action
+/*
+ GET  "/v0.1/uploads/{id}"
+ GET  "/v0.1/uploads/{id}/info"
+ GET  "/v0.1/uploads/{id}/thumbnail"
+*/
+
+func (uc *UploadController) processGet(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "uploads") {
+		uc.DownloadUpload(w, r, pathParts[2], user, requestID)
+	} else if (len(pathParts) == 4) && (pathParts[1] == "uploads") && (pathParts[3] == "info") {
+		uc.GetUpload(w, r, pathParts[2], user, requestID)
+	} else if (len(pathParts) == 4) && (pathParts[1] == "uploads") && (pathParts[3] == "thumbnail") {
+		uc.DownloadThumbnail(w, r, pathParts[2], user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processPost - Parse URL for all the POST paths and call the controller action
+/*
+ POST  "/v0.1/uploads/create?channel_id={channel_id}"
+ POST  "/v0.1/uploads/limits"
+*/
+
+func (uc *UploadController) processPost(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string, queryString url.Values) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "uploads") && (pathParts[2] == "create") {
+		uc.CreateUpload(w, r, queryString.Get("channel_id"), user, requestID)
+	} else if (len(pathParts) == 3) && (pathParts[1] == "uploads") && (pathParts[2] == "limits") {
+		uc.SetUploadLimit(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// CreateUpload - used to upload the "file" part of a multipart form,
+// the response carries the id to attach to a message
+func (uc *UploadController) CreateUpload(w http.ResponseWriter, r *http.Request, channelID string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		r.Body = http.MaxBytesReader(w, r.Body, uc.MaxUploadSize+uploadFormOverhead)
+		mr, err := r.MultipartReader()
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 11000}).Error(err)
+			common.RenderErrorJSON(w, "11000", err.Error(), 402, requestID)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				common.RenderErrorJSON(w, "11001", "Missing file", 402, requestID)
+				return
+			}
+			if err != nil {
+				log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 11002}).Error(err)
+				common.RenderErrorJSON(w, "11002", err.Error(), 402, requestID)
+				return
+			}
+			if part.FormName() != "file" {
+				continue
+			}
+			v := common.NewValidator()
+			v.IsStrLenBetMinMax("File Name", part.FileName(), msgservices.FileNameLenMin, msgservices.FileNameLenMax)
+			if v.IsValid() {
+				common.RenderErrorJSON(w, "11003", v.Error(), 402, requestID)
+				return
+			}
+			upload, err := uc.Service.CreateUpload(ctx, channelID, part.FileName(), part, user.UserID, user.Email, requestID)
+			if err == msgservices.ErrUploadTooLarge {
+				common.RenderErrorJSON(w, "11004", err.Error(), http.StatusRequestEntityTooLarge, requestID)
+				return
+			}
+			if err != nil {
+				log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 11005}).Error(err)
+				common.RenderErrorJSON(w, "11005", err.Error(), 402, requestID)
+				return
+			}
+
+			common.RenderJSON(w, upload)
+			return
+		}
+	}
+}
+
+// GetUpload - used to view upload details
+func (uc *UploadController) GetUpload(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		upload, err := uc.Service.GetUpload(ctx, id, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 11006}).Error(err)
+			common.RenderErrorJSON(w, "11006", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, upload)
+	}
+}
+
+// DownloadUpload - used to download the content of an upload, only
+// images are shown inline
+func (uc *UploadController) DownloadUpload(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		upload, rc, err := uc.Service.OpenUpload(ctx, id, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 11007}).Error(err)
+			common.RenderErrorJSON(w, "11007", err.Error(), 402, requestID)
+			return
+		}
+		defer rc.Close()
+
+		disposition := "attachment"
+		if strings.HasPrefix(upload.ContentType, "image/") {
+			disposition = "inline"
+		}
+		w.Header().Set("Content-Type", upload.ContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(upload.FileSize, 10))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": upload.FileName}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("ETag", `"`+upload.Checksum+`"`)
+		_, err = io.Copy(w, rc)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 11008}).Error(err)
+		}
+	}
+}
+
+// DownloadThumbnail - used to download the thumbnail of an image upload
+func (uc *UploadController) DownloadThumbnail(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		upload, rc, err := uc.Service.OpenThumbnail(ctx, id, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 11011}).Error(err)
+			common.RenderErrorJSON(w, "11011", err.Error(), 402, requestID)
+			return
+		}
+		defer rc.Close()
+
+		w.Header().Set("Content-Type", msgservices.ThumbnailContentType(upload.ContentType))
+		w.Header().Set("Content-Disposition", "inline")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		_, err = io.Copy(w, rc)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 11012}).Error(err)
+		}
+	}
+}
+
+// SetUploadLimit - used to set the upload size limit of a workspace
+func (uc *UploadController) SetUploadLimit(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := msgservices.UploadLimit{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 11009}).Error(err)
+			common.RenderErrorJSON(w, "11009", err.Error(), 402, requestID)
+			return
+		}
+		err = uc.Service.SetUploadLimit(ctx, &form, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 11010}).Error(err)
+			common.RenderErrorJSON(w, "11010", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Updated Successfully")
+	}
+}
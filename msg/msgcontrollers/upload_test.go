@@ -0,0 +1,94 @@
+package msgcontrollers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/cloudfresco/vilom/msg/msgservices"
+	"github.com/cloudfresco/vilom/testhelpers"
+)
+
+func TestCreateGetUpload(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	tokenstring := LoginUser()
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	part, err := mw.CreateFormFile("file", "notes.txt")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	content := "meeting notes"
+	_, err = part.Write([]byte(content))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = mw.Close()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "http://localhost:8000/v0.1/uploads/create?channel_id=44b2e674-7031-4487-be96-60093bfe8ac3", body)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenstring)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status code %d: %v", w.Code, w.Body.String())
+		return
+	}
+	upload := msgservices.Upload{}
+	err = json.NewDecoder(w.Body).Decode(&upload)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "http://localhost:8000/v0.1/uploads/"+upload.IDS+"/info", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenstring)
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status code %d: %v", w.Code, w.Body.String())
+		return
+	}
+
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "http://localhost:8000/v0.1/uploads/"+upload.IDS, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenstring)
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status code %d: %v", w.Code, w.Body.String())
+		return
+	}
+	if w.Body.String() != content {
+		t.Errorf("handler returned unexpected body: got %v want %v", w.Body.String(), content)
+	}
+}
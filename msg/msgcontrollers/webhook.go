@@ -0,0 +1,253 @@
+package msgcontrollers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/msg/msgservices"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 8000-8299 */
+
+// WebhookController - Create Webhook Controller
+type WebhookController struct {
+	Service  msgservices.WebhookServiceIntf
+	Serviceu userservices.UserServiceIntf
+}
+
+// NewWebhookController - Create Webhook Handler
+func NewWebhookController(s msgservices.WebhookServiceIntf, su userservices.UserServiceIntf) *WebhookController {
+	return &WebhookController{
+		Service:  s,
+		Serviceu: su,
+	}
+}
+
+// ServeHTTP - parse url and call controller action
+func (wc *WebhookController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, requestID, err := wc.Serviceu.GetAuthUserDetails(r)
+	if err != nil {
+		common.RenderErrorJSON(w, "1001", err.Error(), 401, requestID)
+		return
+	}
+	pathParts, queryString, err := common.ParseURL(r.URL.String())
+	if err != nil {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		wc.processGet(w, r, user, requestID, pathParts, queryString)
+	case http.MethodPost:
+		wc.processPost(w, r, user, requestID, pathParts)
+	case http.MethodDelete:
+		wc.processDelete(w, r, user, requestID, pathParts)
+	default:
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+}
+
+// processGet - Parse URL for all the GET paths and call the controller action
+/*
+ GET  "/v0.1/webhooks?workspace_id={workspace_id}"
+ GET  "/v0.1/webhooks/{id}"
+ GET  "/v0.1/webhooks/{id}/deliveries"
+*/
+
+func (wc *WebhookController) processGet(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string, queryString url.Values) {
+
+	if (len(pathParts) == 2) && (pathParts[1] == "webhooks") {
+		wc.GetWebhooks(w, r, queryString.Get("workspace_id"), user, requestID)
+	} else if (len(pathParts) == 3) && (pathParts[1] == "webhooks") {
+		wc.GetWebhook(w, r, pathParts[2], user, requestID)
+	} else if (len(pathParts) == 4) && (pathParts[1] == "webhooks") && (pathParts[3] == "deliveries") {
+		wc.GetWebhookDeliveries(w, r, pathParts[2], user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processPost - Parse URL for all the POST paths and call the controller action
+/*
+ POST  "/v0.1/webhooks/create"
+ POST  "/v0.1/webhooks/{id}/deliveries/{deliveryid}/redeliver"
+*/
+
+func (wc *WebhookController) processPost(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "webhooks") && (pathParts[2] == "create") {
+		wc.CreateWebhook(w, r, user, requestID)
+	} else if (len(pathParts) == 6) && (pathParts[1] == "webhooks") && (pathParts[3] == "deliveries") && (pathParts[5] == "redeliver") {
+		wc.Redeliver(w, r, pathParts[2], pathParts[4], user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processDelete - Parse URL for all the delete paths and call the controller action
+/*
+ DELETE  "/v0.1/webhooks/{id}"
+*/
+
+func (wc *WebhookController) processDelete(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "webhooks") {
+		wc.DeleteWebhook(w, r, pathParts[2], user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+}
+
+// CreateWebhook - used to Create Webhook, the response carries the
+// secret used to sign the deliveries
+func (wc *WebhookController) CreateWebhook(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := msgservices.Webhook{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 8000}).Error(err)
+			common.RenderErrorJSON(w, "8000", err.Error(), 402, requestID)
+			return
+		}
+		v := common.NewValidator()
+		v.IsStrLenBetMinMax("Target URL", form.TargetURL, msgservices.WebhookTargetURLLenMin, msgservices.WebhookTargetURLLenMax)
+		if v.IsValid() {
+			common.RenderErrorJSON(w, "8001", v.Error(), 402, requestID)
+			return
+		}
+		webhook, err := wc.Service.CreateWebhook(ctx, &form, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 8002}).Error(err)
+			common.RenderErrorJSON(w, "8002", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, webhook)
+	}
+}
+
+// GetWebhooks - used to view the webhooks of a workspace
+func (wc *WebhookController) GetWebhooks(w http.ResponseWriter, r *http.Request, workspaceID string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		wsID, err := strconv.ParseUint(workspaceID, 10, 0)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 8003}).Error(err)
+			common.RenderErrorJSON(w, "8003", "Invalid workspace_id", 402, requestID)
+			return
+		}
+		webhooks, err := wc.Service.GetWebhooks(ctx, uint(wsID), user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 8004}).Error(err)
+			common.RenderErrorJSON(w, "8004", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, webhooks)
+	}
+}
+
+// GetWebhook - used to view webhook
+func (wc *WebhookController) GetWebhook(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		webhook, err := wc.Service.GetWebhook(ctx, id, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 8005}).Error(err)
+			common.RenderErrorJSON(w, "8005", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, webhook)
+	}
+}
+
+// GetWebhookDeliveries - used to view the delivery log of a webhook
+func (wc *WebhookController) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		deliveries, err := wc.Service.GetWebhookDeliveries(ctx, id, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 8006}).Error(err)
+			common.RenderErrorJSON(w, "8006", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, deliveries)
+	}
+}
+
+// Redeliver - used to send a delivery again
+func (wc *WebhookController) Redeliver(w http.ResponseWriter, r *http.Request, id string, deliveryID string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		delivery, err := wc.Service.Redeliver(ctx, id, deliveryID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 8007}).Error(err)
+			common.RenderErrorJSON(w, "8007", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, delivery)
+	}
+}
+
+// DeleteWebhook - delete webhook
+func (wc *WebhookController) DeleteWebhook(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		err := wc.Service.DeleteWebhook(ctx, id, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 8008}).Error(err)
+			common.RenderErrorJSON(w, "8008", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Deleted Successfully")
+	}
+}
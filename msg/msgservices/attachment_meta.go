@@ -0,0 +1,332 @@
+package msgservices
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Thumbnail and metadata limits
+const (
+	ThumbnailMaxSize     = 256
+	ThumbnailMaxPixels   = 50000000
+	FirstPageTextLenMax  = 2000
+	pdfStreamInflateMax  = 4 << 20
+	pdfTextStreamsToScan = 64
+)
+
+// AttachmentMeta - metadata extracted from the content of an attachment
+type AttachmentMeta struct {
+	Width         uint
+	Height        uint
+	PageCount     uint
+	FirstPageText string
+	Thumbnail     []byte
+}
+
+// IsThumbnailType - the content types that get a thumbnail
+func IsThumbnailType(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// ThumbnailContentType - the content type of the thumbnail of an image,
+// jpeg photos keep jpeg, the others are png
+func ThumbnailContentType(contentType string) string {
+	if contentType == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// ExtractAttachmentMeta - the metadata of content of the given type,
+// images are decoded and scaled into a thumbnail, pdfs give their page
+// count and the text of the first page
+func ExtractAttachmentMeta(content []byte, contentType string) (*AttachmentMeta, error) {
+	if IsThumbnailType(contentType) {
+		return imageMeta(content, contentType)
+	}
+	if contentType == "application/pdf" {
+		pages, text := PDFMeta(content)
+		return &AttachmentMeta{PageCount: pages, FirstPageText: text}, nil
+	}
+	return &AttachmentMeta{}, nil
+}
+
+// imageMeta - size and thumbnail of an image
+func imageMeta(content []byte, contentType string) (*AttachmentMeta, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > ThumbnailMaxPixels {
+		return nil, errors.New("Image dimensions out of range")
+	}
+	var img image.Image
+	switch contentType {
+	case "image/png":
+		img, err = png.Decode(bytes.NewReader(content))
+	case "image/jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(content))
+	case "image/gif":
+		img, err = gif.Decode(bytes.NewReader(content))
+	}
+	if err != nil {
+		return nil, err
+	}
+	thumb := Thumbnail(img, ThumbnailMaxSize)
+	buf := bytes.Buffer{}
+	if ThumbnailContentType(contentType) == "image/jpeg" {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &AttachmentMeta{Width: uint(cfg.Width), Height: uint(cfg.Height), Thumbnail: buf.Bytes()}, nil
+}
+
+// Thumbnail - img scaled down to fit in a maxSize square, keeping its
+// aspect ratio, each pixel is the average of the pixels it covers
+func Thumbnail(img image.Image, maxSize int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > maxSize || h > maxSize {
+		if w >= h {
+			tw, th = maxSize, h*maxSize/w
+		} else {
+			tw, th = w*maxSize/h, maxSize
+		}
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+	thumb := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := b.Min.Y+ty*h/th, b.Min.Y+(ty+1)*h/th
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := b.Min.X+tx*w/tw, b.Min.X+(tx+1)*w/tw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					cr, cg, cb, ca := img.At(x, y).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			thumb.SetRGBA(tx, ty, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(bl / n >> 8), A: uint8(a / n >> 8)})
+		}
+	}
+	return thumb
+}
+
+var (
+	pdfPageRe   = regexp.MustCompile(`/Type\s*/Page([^s]|$)`)
+	pdfCountRe  = regexp.MustCompile(`/Type\s*/Pages[^>]*?/Count\s+(\d+)|/Count\s+(\d+)[^>]*?/Type\s*/Pages`)
+	pdfStreamRe = regexp.MustCompile(`(?s)<<((?:[^<>]|<<[^<>]*>>|<[^<>]*>)*)>>\s*stream\r?\n`)
+)
+
+// PDFMeta - the page count of a pdf and the text of its first page. This
+// is a best effort reader for search indexing, it handles uncompressed
+// and flate compressed content streams, the first stream that shows
+// text is taken as the first page
+func PDFMeta(content []byte) (uint, string) {
+	pages := uint(len(pdfPageRe.FindAll(content, -1)))
+	for _, m := range pdfCountRe.FindAllSubmatch(content, -1) {
+		count := m[1]
+		if len(count) == 0 {
+			count = m[2]
+		}
+		if n, err := strconv.ParseUint(string(count), 10, 32); err == nil && uint(n) > pages {
+			pages = uint(n)
+		}
+	}
+
+	scanned := 0
+	for _, loc := range pdfStreamRe.FindAllSubmatchIndex(content, -1) {
+		if scanned >= pdfTextStreamsToScan {
+			break
+		}
+		dict := string(content[loc[2]:loc[3]])
+		if strings.Contains(dict, "/Subtype") || strings.Contains(dict, "/Length1") || strings.Contains(dict, "/Type") {
+			continue
+		}
+		start := loc[1]
+		end := bytes.Index(content[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		data := content[start : start+end]
+		if strings.Contains(dict, "/FlateDecode") {
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				continue
+			}
+			data, err = ioutil.ReadAll(io.LimitReader(zr, pdfStreamInflateMax))
+			_ = zr.Close()
+			if err != nil && len(data) == 0 {
+				continue
+			}
+		} else if strings.Contains(dict, "/Filter") {
+			continue
+		}
+		scanned++
+		if text := pdfContentText(data); text != "" {
+			if runes := []rune(text); len(runes) > FirstPageTextLenMax {
+				text = string(runes[:FirstPageTextLenMax])
+			}
+			return pages, text
+		}
+	}
+	return pages, ""
+}
+
+// pdfContentText - the text shown by the Tj, TJ, ' and " operators of
+// a content stream
+func pdfContentText(data []byte) string {
+	var text strings.Builder
+	var strs []string
+	inText := false
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '(':
+			s, n := pdfLiteralString(data[i:])
+			strs = append(strs, s)
+			i += n
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case isPDFRegular(c):
+			j := i
+			for j < len(data) && isPDFRegular(data[j]) {
+				j++
+			}
+			op := string(data[i:j])
+			i = j
+			switch op {
+			case "BT":
+				inText = true
+				strs = nil
+			case "ET":
+				inText = false
+				strs = nil
+				text.WriteString("\n")
+			case "Tj", "TJ", "'", "\"":
+				if inText {
+					if op == "'" || op == "\"" {
+						text.WriteString("\n")
+					}
+					text.WriteString(strings.Join(strs, ""))
+				}
+				strs = nil
+			case "T*", "Td", "TD":
+				if inText && text.Len() > 0 {
+					text.WriteString(" ")
+				}
+				strs = nil
+			}
+		default:
+			i++
+		}
+	}
+	return strings.Join(strings.Fields(latin1ToUTF8(text.String())), " ")
+}
+
+// latin1ToUTF8 - the bytes of s read as latin1, pdf strings of simple
+// fonts are single byte
+func latin1ToUTF8(s string) string {
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes)
+}
+
+// pdfLiteralString - the value of the literal string at the start of
+// data and the number of bytes it takes
+func pdfLiteralString(data []byte) (string, int) {
+	var b bytes.Buffer
+	depth := 0
+	i := 0
+	for ; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '\\':
+			i++
+			if i >= len(data) {
+				break
+			}
+			switch e := data[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'b', 'f':
+			case '\r', '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					for k := 0; k < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; k++ {
+						v = v*8 + int(data[i]-'0')
+						i++
+					}
+					i--
+					b.WriteByte(byte(v))
+				} else {
+					b.WriteByte(e)
+				}
+			}
+		case '(':
+			if depth > 0 {
+				b.WriteByte(c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b.String(), i + 1
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), i
+}
+
+// isPDFRegular - not a pdf white space or delimiter character
+func isPDFRegular(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return false
+	}
+	return true
+}
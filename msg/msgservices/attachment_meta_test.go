@@ -0,0 +1,139 @@
+package msgservices
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(w int, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func TestExtractAttachmentMeta_Images(t *testing.T) {
+	img := testImage(600, 300)
+	pngBuf := bytes.Buffer{}
+	if err := png.Encode(&pngBuf, img); err != nil {
+		t.Fatal(err)
+	}
+	jpegBuf := bytes.Buffer{}
+	if err := jpeg.Encode(&jpegBuf, testImage(100, 400), nil); err != nil {
+		t.Fatal(err)
+	}
+	gifBuf := bytes.Buffer{}
+	if err := gif.Encode(&gifBuf, testImage(40, 30), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		content     []byte
+		contentType string
+		width       uint
+		height      uint
+		thumbWidth  int
+		thumbHeight int
+		thumbFormat string
+	}{
+		{pngBuf.Bytes(), "image/png", 600, 300, 256, 128, "png"},
+		{jpegBuf.Bytes(), "image/jpeg", 100, 400, 64, 256, "jpeg"},
+		{gifBuf.Bytes(), "image/gif", 40, 30, 40, 30, "png"},
+	}
+	for _, tt := range tests {
+		meta, err := ExtractAttachmentMeta(tt.content, tt.contentType)
+		if err != nil {
+			t.Errorf("ExtractAttachmentMeta(%v) error = %v", tt.contentType, err)
+			continue
+		}
+		if meta.Width != tt.width || meta.Height != tt.height {
+			t.Errorf("ExtractAttachmentMeta(%v) size = %dx%d, want %dx%d", tt.contentType, meta.Width, meta.Height, tt.width, tt.height)
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(meta.Thumbnail))
+		if err != nil {
+			t.Errorf("ExtractAttachmentMeta(%v) thumbnail error = %v", tt.contentType, err)
+			continue
+		}
+		if cfg.Width != tt.thumbWidth || cfg.Height != tt.thumbHeight || format != tt.thumbFormat {
+			t.Errorf("ExtractAttachmentMeta(%v) thumbnail = %dx%d %v, want %dx%d %v", tt.contentType, cfg.Width, cfg.Height, format, tt.thumbWidth, tt.thumbHeight, tt.thumbFormat)
+		}
+	}
+
+	if _, err := ExtractAttachmentMeta([]byte("not an image"), "image/png"); err == nil {
+		t.Errorf("ExtractAttachmentMeta() with a broken image, want error")
+	}
+	meta, err := ExtractAttachmentMeta([]byte("some text"), "text/plain; charset=utf-8")
+	if err != nil || meta.Width != 0 || len(meta.Thumbnail) != 0 {
+		t.Errorf("ExtractAttachmentMeta(text/plain) = %v, %v", meta, err)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		img.SetRGBA(x, 0, color.RGBA{R: 255, A: 255})
+		img.SetRGBA(x, 1, color.RGBA{B: 255, A: 255})
+	}
+	thumb := Thumbnail(img, 2)
+	if thumb.Bounds().Dx() != 2 || thumb.Bounds().Dy() != 1 {
+		t.Fatalf("Thumbnail() bounds = %v", thumb.Bounds())
+	}
+	if got := thumb.RGBAAt(0, 0); got.R != 127 || got.B != 127 || got.A != 255 {
+		t.Errorf("Thumbnail() pixel = %v, want the average of red and blue", got)
+	}
+}
+
+// testPDF - a pdf with two pages, the first page content is compressed
+// when compress is set
+func testPDF(compress bool) []byte {
+	page1 := []byte("BT /F1 12 Tf 72 720 Td (Quarterly \\(Q3\\) report) Tj 0 -14 Td [(caf) -20 (\\351)] TJ ET")
+	page2 := []byte("BT /F1 12 Tf 72 720 Td (Second page) Tj ET")
+	dict1 := fmt.Sprintf("<< /Length %d >>", len(page1))
+	if compress {
+		buf := bytes.Buffer{}
+		zw := zlib.NewWriter(&buf)
+		_, _ = zw.Write(page1)
+		_ = zw.Close()
+		page1 = buf.Bytes()
+		dict1 = fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>", len(page1))
+	}
+	b := bytes.Buffer{}
+	b.WriteString("%PDF-1.4\n")
+	b.WriteString("1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n")
+	b.WriteString("2 0 obj << /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >> endobj\n")
+	b.WriteString("3 0 obj << /Type /Page /Parent 2 0 R /Contents 5 0 R >> endobj\n")
+	b.WriteString("4 0 obj << /Type /Page /Parent 2 0 R /Contents 6 0 R >> endobj\n")
+	b.WriteString("5 0 obj " + dict1 + " stream\n")
+	b.Write(page1)
+	b.WriteString("\nendstream endobj\n")
+	b.WriteString(fmt.Sprintf("6 0 obj << /Length %d >> stream\n", len(page2)))
+	b.Write(page2)
+	b.WriteString("\nendstream endobj\n%%EOF\n")
+	return b.Bytes()
+}
+
+func TestPDFMeta(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		pages, text := PDFMeta(testPDF(compress))
+		if pages != 2 || text != "Quarterly (Q3) report café" {
+			t.Errorf("PDFMeta(compress %v) = %d, %q", compress, pages, text)
+		}
+	}
+	meta, err := ExtractAttachmentMeta(testPDF(true), "application/pdf")
+	if err != nil || meta.PageCount != 2 || meta.FirstPageText == "" {
+		t.Errorf("ExtractAttachmentMeta(application/pdf) = %v, %v", meta, err)
+	}
+	if pages, text := PDFMeta([]byte("not a pdf")); pages != 0 || text != "" {
+		t.Errorf("PDFMeta() = %d, %q, want nothing", pages, text)
+	}
+}
@@ -0,0 +1,270 @@
+package msgservices
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+/* error message range: 11500-11999 */
+
+// Metadata status of message attachments, attachments that are not
+// uploads stay at MetaNone
+const (
+	MetaNone       = 0
+	MetaPending    = 1
+	MetaProcessing = 2
+	MetaDone       = 3
+	MetaFailed     = 4
+)
+
+// Attachment worker settings, an attachment left in processing longer
+// than AttachmentClaimTimeout is picked up again
+const (
+	AttachmentWorkerInterval = 10 * time.Second
+	AttachmentWorkerBatch    = 20
+	AttachmentClaimTimeout   = 10 * time.Minute
+)
+
+// AttachmentServiceIntf - interface for Attachment Service
+type AttachmentServiceIntf interface {
+	ProcessPendingAttachments(ctx context.Context, userEmail string, requestID string) (int, error)
+}
+
+// AttachmentService - For extracting the metadata and thumbnails of
+// uploaded attachments
+type AttachmentService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+	BlobStore    common.BlobStore
+}
+
+// NewAttachmentService - Create attachment service
+func NewAttachmentService(dbOpt *common.DBService, redisOpt *common.RedisService, blobStore common.BlobStore) *AttachmentService {
+	return &AttachmentService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+		BlobStore:    blobStore,
+	}
+}
+
+// pendingAttachment - an attachment waiting for its metadata
+type pendingAttachment struct {
+	ID          uint
+	ContentType string
+	BlobKey     string
+}
+
+// ProcessPendingAttachments - extract the metadata of the pending
+// attachments, returns the number of attachments processed
+func (at *AttachmentService) ProcessPendingAttachments(ctx context.Context, userEmail string, requestID string) (int, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11500}).Error(err)
+		return 0, err
+	default:
+		db := at.DBService.DB
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(`select
+		ma.id,
+		ma.content_type,
+		u.blob_key from message_attachments ma inner join uploads u on (ma.upload_id = u.id)
+		where ma.meta_status = ? or (ma.meta_status = ? and ma.updated_at < ?) order by ma.id limit %d;`, AttachmentWorkerBatch),
+			MetaPending, MetaProcessing, time.Now().UTC().Add(-AttachmentClaimTimeout))
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11501}).Error(err)
+			return 0, err
+		}
+		pending := []*pendingAttachment{}
+		for rows.Next() {
+			p := pendingAttachment{}
+			err = rows.Scan(&p.ID, &p.ContentType, &p.BlobKey)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11502}).Error(err)
+				err = rows.Close()
+				return 0, err
+			}
+			pending = append(pending, &p)
+		}
+		err = rows.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11503}).Error(err)
+			return 0, err
+		}
+
+		processed := 0
+		for _, p := range pending {
+			claimed, err := at.claimAttachment(ctx, p.ID, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11504}).Error(err)
+				return processed, err
+			}
+			if !claimed {
+				// another worker is processing it
+				continue
+			}
+			err = at.processAttachment(ctx, p, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11505}).Error(err)
+				return processed, err
+			}
+			processed++
+		}
+		return processed, nil
+	}
+}
+
+// RunAttachmentWorker - process the pending attachments every interval until ctx is done
+func (at *AttachmentService) RunAttachmentWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := at.ProcessPendingAttachments(ctx, "", common.GetRequestID())
+			if err != nil {
+				log.WithFields(log.Fields{"msgnum": 11506}).Error(err)
+			}
+		}
+	}
+}
+
+// claimAttachment - mark the attachment as processing, so that it is
+// processed by one worker only
+func (at *AttachmentService) claimAttachment(ctx context.Context, ID uint, userEmail string, requestID string) (bool, error) {
+	db := at.DBService.DB
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	res, err := db.ExecContext(ctx, `update message_attachments set
+		  meta_status = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where id = ? and (meta_status = ? or (meta_status = ? and updated_at < ?));`,
+		MetaProcessing,
+		tn,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear,
+		ID,
+		MetaPending,
+		MetaProcessing,
+		tn.Add(-AttachmentClaimTimeout))
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11507}).Error(err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11508}).Error(err)
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// processAttachment - extract the metadata of the attachment and store
+// its thumbnail, attachments that cannot be read are marked failed
+func (at *AttachmentService) processAttachment(ctx context.Context, p *pendingAttachment, userEmail string, requestID string) error {
+	meta, err := at.extractMeta(ctx, p, userEmail, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11509}).Error(err)
+		return at.updateAttachmentMeta(ctx, p.ID, &AttachmentMeta{}, "", MetaFailed, userEmail, requestID)
+	}
+	thumbnailKey := ""
+	if len(meta.Thumbnail) > 0 {
+		thumbnailKey = p.BlobKey + ".thumb"
+		err = at.BlobStore.Put(ctx, thumbnailKey, bytes.NewReader(meta.Thumbnail), int64(len(meta.Thumbnail)), ThumbnailContentType(p.ContentType))
+		if err != nil {
+			// the blob store may be down, leave it for the next run
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11510}).Error(err)
+			return err
+		}
+	}
+	return at.updateAttachmentMeta(ctx, p.ID, meta, thumbnailKey, MetaDone, userEmail, requestID)
+}
+
+// extractMeta - read the upload of the attachment and extract its metadata
+func (at *AttachmentService) extractMeta(ctx context.Context, p *pendingAttachment, userEmail string, requestID string) (*AttachmentMeta, error) {
+	rc, err := at.BlobStore.Get(ctx, p.BlobKey)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11511}).Error(err)
+		return nil, err
+	}
+	defer rc.Close()
+	content, err := ioutil.ReadAll(rc)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11512}).Error(err)
+		return nil, err
+	}
+	return ExtractAttachmentMeta(content, p.ContentType)
+}
+
+// updateAttachmentMeta - store the metadata of the attachment
+func (at *AttachmentService) updateAttachmentMeta(ctx context.Context, ID uint, meta *AttachmentMeta, thumbnailKey string, metaStatus uint, userEmail string, requestID string) error {
+	db := at.DBService.DB
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	_, err := db.ExecContext(ctx, `update message_attachments set
+		  width = ?,
+			height = ?,
+			thumbnail_key = ?,
+			page_count = ?,
+			first_page_text = ?,
+			meta_status = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where id = ?;`,
+		meta.Width,
+		meta.Height,
+		thumbnailKey,
+		meta.PageCount,
+		meta.FirstPageText,
+		metaStatus,
+		tn,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear,
+		ID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11513}).Error(err)
+		return err
+	}
+	return nil
+}
+
+// setAttachmentUpload - record the upload of a new attachment, its
+// metadata is extracted later by the attachment worker
+func setAttachmentUpload(ctx context.Context, tx *sql.Tx, msgath *MessageAttachment, upload *Upload, userEmail string, requestID string) error {
+	msgath.UploadID = upload.ID
+	msgath.ContentType = upload.ContentType
+	msgath.FileSize = upload.FileSize
+	msgath.MetaStatus = MetaPending
+	_, err := tx.ExecContext(ctx, `update message_attachments set
+		  upload_id = ?,
+			content_type = ?,
+			file_size = ?,
+			meta_status = ? where id = ?;`,
+		msgath.UploadID,
+		msgath.ContentType,
+		msgath.FileSize,
+		msgath.MetaStatus,
+		msgath.ID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11514}).Error(err)
+		return err
+	}
+	return nil
+}
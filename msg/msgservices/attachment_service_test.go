@@ -0,0 +1,101 @@
+package msgservices
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestAttachmentService_ProcessPendingAttachments(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	dir, err := ioutil.TempDir("", "vilom-uploads")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	blobStore, err := common.NewLocalBlobStore(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx := context.Background()
+	uploadService := NewUploadService(dbService, redisService, userOpt, blobStore, 1<<20)
+	messageService := NewMessageService(dbService, redisService, userOpt)
+	attachmentService := NewAttachmentService(dbService, redisService, blobStore)
+	userID := "29ea215b-8fb3-4453-b413-81a661e44495"
+	channelID := "44b2e674-7031-4487-be96-60093bfe8ac3"
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	content := bytes.Buffer{}
+	err = png.Encode(&content, testImage(512, 128))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	upload, err := uploadService.CreateUpload(ctx, channelID, "banner.png", &content, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	form := Message{}
+	form.WorkspaceID = uint(2)
+	form.ChannelID = uint(1)
+	form.Mtext = "the banner"
+	form.Uploads = []string{upload.IDS}
+	msg, err := messageService.CreateMessage(ctx, &form, userID, false, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	n, err := attachmentService.ProcessPendingAttachments(ctx, userEmail, requestID)
+	if err != nil || n != 1 {
+		t.Errorf("AttachmentService.ProcessPendingAttachments() = %v, %v, want 1", n, err)
+		return
+	}
+	n, err = attachmentService.ProcessPendingAttachments(ctx, userEmail, requestID)
+	if err != nil || n != 0 {
+		t.Errorf("AttachmentService.ProcessPendingAttachments() again = %v, %v, want 0", n, err)
+	}
+
+	attachments, err := messageService.GetMessageAttachments(ctx, msg.ID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(attachments) != 1 {
+		t.Errorf("MessageService.GetMessageAttachments() = %v", attachments)
+		return
+	}
+	got := attachments[0]
+	if got.Width != 512 || got.Height != 128 || got.ContentType != "image/png" || got.MetaStatus != MetaDone || got.ThumbnailURL != upload.URL+UploadThumbnailSuffix {
+		t.Errorf("MessageService.GetMessageAttachments() = %v", got)
+	}
+
+	_, rc, err := uploadService.OpenThumbnail(ctx, upload.IDS, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer rc.Close()
+	cfg, _, err := image.DecodeConfig(rc)
+	if err != nil || cfg.Width != 256 || cfg.Height != 64 {
+		t.Errorf("UploadService.OpenThumbnail() = %dx%d, %v", cfg.Width, cfg.Height, err)
+	}
+}
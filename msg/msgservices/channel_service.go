@@ -93,19 +93,22 @@ type ChannelServiceIntf interface {
 	GetChannelsUser(ctx context.Context, ID uint, UserID uint, userEmail string, requestID string) (*ChannelsUser, error)
 	UpdateChannel(ctx context.Context, ID string, form *Channel, UserID string, userEmail string, requestID string) error
 	DeleteChannel(ctx context.Context, ID string, userEmail string, requestID string) error
+	AddChannelUser(ctx context.Context, ID string, MemberID string, userEmail string, requestID string) error
 }
 
 // ChannelService - For accessing channel services
 type ChannelService struct {
 	DBService    *common.DBService
 	RedisService *common.RedisService
+	UserOptions  *common.UserOptions
 }
 
 // NewChannelService - Create channel service
-func NewChannelService(dbOpt *common.DBService, redisOpt *common.RedisService) *ChannelService {
+func NewChannelService(dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions) *ChannelService {
 	return &ChannelService{
 		DBService:    dbOpt,
 		RedisService: redisOpt,
+		UserOptions:  userOpt,
 	}
 }
 
@@ -130,6 +133,11 @@ func (t *ChannelService) CreateChannel(ctx context.Context, form *Channel, UserI
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5326}).Error(err)
 			return nil, err
 		}
+		err = checkWorkspaceAccess(ctx, t.DBService, t.RedisService, t.UserOptions, workspace.ID, GrantPost, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5405}).Error(err)
+			return nil, err
+		}
 
 		insertChannelStmt, err := t.insertChannelPrepare(ctx, userEmail, requestID)
 		if err != nil {
@@ -168,7 +176,7 @@ func (t *ChannelService) CreateChannel(ctx context.Context, form *Channel, UserI
 			return nil, err
 		}
 		if form.Mtext != "" {
-			msgserv := &MessageService{DBService: t.DBService, RedisService: t.RedisService}
+			msgserv := &MessageService{DBService: t.DBService, RedisService: t.RedisService, UserOptions: t.UserOptions}
 			msgform := Message{}
 			msgform.WorkspaceID = workspace.ID
 			msgform.ChannelID = channel.ID
@@ -197,6 +205,8 @@ func (t *ChannelService) CreateChannel(ctx context.Context, form *Channel, UserI
 			err = tx.Rollback()
 			return nil, err
 		}
+
+		emitWebhookEvent(ctx, t.DBService, t.RedisService, t.UserOptions, channel.WorkspaceID, channel.ID, EventChannelCreated, channel, userEmail, requestID)
 		return channel, nil
 	}
 }
@@ -601,6 +611,11 @@ func (t *ChannelService) ShowChannel(ctx context.Context, ID string, UserID stri
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5379}).Error(err)
 			return nil, err
 		}
+
+		if !isPresent {
+			joined := UserJoined{ChannelID: channel.ID, ChannelIDS: channel.IDS, UserID: user.ID, UserIDS: user.IDS}
+			emitWebhookEvent(ctx, t.DBService, t.RedisService, t.UserOptions, channel.WorkspaceID, channel.ID, EventUserJoined, &joined, userEmail, requestID)
+		}
 		return channel, nil
 	}
 }
@@ -1149,6 +1164,11 @@ func (t *ChannelService) GetChannelWithMessages(ctx context.Context, ID string,
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5312}).Error(err)
 			return nil, err
 		}
+		err = checkChannelAccess(ctx, t.DBService, t.RedisService, t.UserOptions, chnl.ID, GrantRead, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5406}).Error(err)
+			return nil, err
+		}
 		var isPresent bool
 		row := db.QueryRowContext(ctx, `select exists (select 1 from messages where channel_id = ?);`, chnl.ID)
 		err = row.Scan(&isPresent)
@@ -1167,7 +1187,7 @@ func (t *ChannelService) GetChannelWithMessages(ctx context.Context, ID string,
 		}
 
 		if len(channel.Messages) > 0 {
-			msgserv := &MessageService{DBService: t.DBService, RedisService: t.RedisService}
+			msgserv := &MessageService{DBService: t.DBService, RedisService: t.RedisService, UserOptions: t.UserOptions}
 			Messages, err := msgserv.GetMessagesWithTextAttach(ctx, channel.Messages, userEmail, requestID)
 			if err != nil {
 				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5320}).Error(err)
@@ -1408,6 +1428,11 @@ func (t *ChannelService) UpdateChannel(ctx context.Context, ID string, form *Cha
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5383}).Error(err)
 			return err
 		}
+		err = checkChannelAccess(ctx, t.DBService, t.RedisService, t.UserOptions, channel.ID, GrantModerate, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5407}).Error(err)
+			return err
+		}
 
 		db := t.DBService.DB
 
@@ -1483,6 +1508,16 @@ func (t *ChannelService) DeleteChannel(ctx context.Context, ID string, userEmail
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5377}).Error(err)
 			return err
 		}
+		channel, err := t.GetChannel(ctx, ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5408}).Error(err)
+			return err
+		}
+		err = checkChannelAccess(ctx, t.DBService, t.RedisService, t.UserOptions, channel.ID, GrantAdmin, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5409}).Error(err)
+			return err
+		}
 		db := t.DBService.DB
 		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
 		stmt, err := db.PrepareContext(ctx, `update channels set 
@@ -1553,3 +1588,78 @@ func (t *ChannelService) DeleteChannel(ctx context.Context, ID string, userEmail
 		return nil
 	}
 }
+
+// AddChannelUser - Add a user or a bot user as a member of the channel
+func (t *ChannelService) AddChannelUser(ctx context.Context, ID string, MemberID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5395}).Error(err)
+		return err
+	default:
+		db := t.DBService.DB
+		channel, err := t.GetChannel(ctx, ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5396}).Error(err)
+			return err
+		}
+		err = checkChannelAccess(ctx, t.DBService, t.RedisService, t.UserOptions, channel.ID, GrantModerate, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5410}).Error(err)
+			return err
+		}
+		userserv := &userservices.UserService{DBService: t.DBService, RedisService: t.RedisService}
+		user, err := userserv.GetUser(ctx, MemberID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5397}).Error(err)
+			return err
+		}
+		var isPresent bool
+		row := db.QueryRowContext(ctx, `select exists (select 1 from user_channels where channel_id = ? and user_id = ? and statusc = ?);`, channel.ID, user.ID, common.Active)
+		err = row.Scan(&isPresent)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5398}).Error(err)
+			return err
+		}
+		if isPresent {
+			return nil
+		}
+
+		insertUserChannelStmt, err := t.insertUserChannelPrepare(ctx, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5399}).Error(err)
+			return err
+		}
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5400}).Error(err)
+			_ = insertUserChannelStmt.Close()
+			return err
+		}
+		err = t.createUserChannel(ctx, insertUserChannelStmt, tx, channel.ID, user.ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5401}).Error(err)
+			if rerr := tx.Rollback(); rerr != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5402}).Error(rerr)
+			}
+			_ = insertUserChannelStmt.Close()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5403}).Error(err)
+			err = tx.Rollback()
+			return err
+		}
+		err = insertUserChannelStmt.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 5404}).Error(err)
+			return err
+		}
+
+		joined := UserJoined{ChannelID: channel.ID, ChannelIDS: channel.IDS, UserID: user.ID, UserIDS: user.IDS}
+		emitWebhookEvent(ctx, t.DBService, t.RedisService, t.UserOptions, channel.WorkspaceID, channel.ID, EventUserJoined, &joined, userEmail, requestID)
+		notifyChannelInvite(ctx, t.DBService, t.RedisService, channel, user.ID, userEmail, requestID)
+		return nil
+	}
+}
@@ -22,7 +22,7 @@ func TestChannelService_ShowChannel(t *testing.T) {
 		t.Error(err)
 	}
 	ctx := context.Background()
-	channelService := NewChannelService(dbService, redisService)
+	channelService := NewChannelService(dbService, redisService, userOpt)
 	channel := Channel{}
 	channel.ID = uint(1)
 	channel.UUID4 = []byte{68, 178, 230, 116, 112, 49, 68, 135, 190, 150, 96, 9, 59, 254, 138, 195}
@@ -182,7 +182,7 @@ func TestChannelService_GetChannelByID(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	channelService := NewChannelService(dbService, redisService)
+	channelService := NewChannelService(dbService, redisService, userOpt)
 	channel := Channel{}
 	channel.ID = uint(1)
 	channel.UUID4 = []byte{68, 178, 230, 116, 112, 49, 68, 135, 190, 150, 96, 9, 59, 254, 138, 195}
@@ -267,7 +267,7 @@ func TestChannelService_GetChannel(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	channelService := NewChannelService(dbService, redisService)
+	channelService := NewChannelService(dbService, redisService, userOpt)
 	channel := Channel{}
 	channel.ID = uint(1)
 	channel.UUID4 = []byte{68, 178, 230, 116, 112, 49, 68, 135, 190, 150, 96, 9, 59, 254, 138, 195}
@@ -352,7 +352,7 @@ func TestChannelService_GetChannelByName(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	channelService := NewChannelService(dbService, redisService)
+	channelService := NewChannelService(dbService, redisService, userOpt)
 	channel := Channel{}
 	channel.ID = uint(1)
 	channel.UUID4 = []byte{68, 178, 230, 116, 112, 49, 68, 135, 190, 150, 96, 9, 59, 254, 138, 195}
@@ -437,7 +437,7 @@ func TestChannelService_GetChannelWithMessages(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	channelService := NewChannelService(dbService, redisService)
+	channelService := NewChannelService(dbService, redisService, userOpt)
 	channel := Channel{}
 	channel.ID = uint(1)
 	channel.UUID4 = []byte{68, 178, 230, 116, 112, 49, 68, 135, 190, 150, 96, 9, 59, 254, 138, 195}
@@ -594,7 +594,7 @@ func TestChannelService_GetChannelMessages(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	channelService := NewChannelService(dbService, redisService)
+	channelService := NewChannelService(dbService, redisService, userOpt)
 	channel := Channel{}
 	channel.ID = uint(1)
 	channel.UUID4 = []byte{68, 178, 230, 116, 112, 49, 68, 135, 190, 150, 96, 9, 59, 254, 138, 195}
@@ -707,7 +707,7 @@ func TestChannelService_GetChannelsUser(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	channelService := NewChannelService(dbService, redisService)
+	channelService := NewChannelService(dbService, redisService, userOpt)
 
 	tu := ChannelsUser{}
 	tu.ID = uint(1)
@@ -777,7 +777,7 @@ func TestChannelService_UpdateChannel(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	channelService := NewChannelService(dbService, redisService)
+	channelService := NewChannelService(dbService, redisService, userOpt)
 	form1 := Channel{}
 	form1.ChannelName = "Hard drive security2"
 	form1.ChannelDesc = "Hard drive security2"
@@ -823,7 +823,7 @@ func TestChannelService_DeleteChannel(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	channelService := NewChannelService(dbService, redisService)
+	channelService := NewChannelService(dbService, redisService, userOpt)
 	type args struct {
 		ctx       context.Context
 		ID        string
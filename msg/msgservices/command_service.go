@@ -0,0 +1,659 @@
+package msgservices
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 10300-10999 */
+
+// For validation of command fields
+const (
+	CommandDescLenMin = 0
+	CommandDescLenMax = 255
+)
+
+// Command response types, an ephemeral response is only returned to the
+// user who ran the command, an in_channel response is posted as a message
+const (
+	ResponseEphemeral = "ephemeral"
+	ResponseInChannel = "in_channel"
+)
+
+// CommandTimeout - timeout of the requests to external commands
+const CommandTimeout = 5 * time.Second
+
+// CommandHeader - header carrying the command name in requests to
+// external commands, the body is signed like webhook deliveries
+const CommandHeader = "X-Vilom-Command"
+
+var commandNameRe = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Command - Command view representation, an external command handled
+// by an HTTP endpoint, the secret is only returned when it is created
+type Command struct {
+	ID          uint   `json:"id,omitempty"`
+	UUID4       []byte `json:"-"`
+	IDS         string `json:"id_s,omitempty"`
+	WorkspaceID uint   `json:"workspace_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	CommandDesc string `json:"command_desc,omitempty"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Secret      string `json:"secret,omitempty"`
+	BotUserID   uint   `json:"bot_user_id,omitempty"`
+	BotUserIDS  string `json:"bot_user_id_s,omitempty"`
+	UserID      uint   `json:"user_id,omitempty"`
+
+	common.StatusDates
+}
+
+// CommandRequest - a command run by a user, passed to the handler
+type CommandRequest struct {
+	Command     string `json:"command"`
+	Text        string `json:"text"`
+	WorkspaceID uint   `json:"workspace_id"`
+	ChannelID   uint   `json:"channel_id"`
+	UserID      string `json:"user_id"`
+	UserName    string `json:"user_name"`
+	RequestID   string `json:"request_id"`
+}
+
+// CommandResponse - reply of a command handler
+type CommandResponse struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// CommandHandler - handles the commands registered for a name
+type CommandHandler interface {
+	HandleCommand(ctx context.Context, req *CommandRequest) (*CommandResponse, error)
+}
+
+// CommandHandlerFunc - adapter to use a function as a CommandHandler
+type CommandHandlerFunc func(ctx context.Context, req *CommandRequest) (*CommandResponse, error)
+
+// HandleCommand - calls f(ctx, req)
+func (f CommandHandlerFunc) HandleCommand(ctx context.Context, req *CommandRequest) (*CommandResponse, error) {
+	return f(ctx, req)
+}
+
+// registeredCommand - a built-in command
+type registeredCommand struct {
+	desc    string
+	handler CommandHandler
+}
+
+// CommandRegistry - the built-in commands, safe for concurrent use
+type CommandRegistry struct {
+	mu       sync.RWMutex
+	commands map[string]registeredCommand
+}
+
+// NewCommandRegistry - Create an empty command registry
+func NewCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{
+		commands: make(map[string]registeredCommand),
+	}
+}
+
+// Register - register a built-in command, name is given without the
+// leading slash
+func (cr *CommandRegistry) Register(name string, desc string, handler CommandHandler) error {
+	if !commandNameRe.MatchString(name) {
+		return errors.New("Invalid command name " + name)
+	}
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if _, ok := cr.commands[name]; ok {
+		return errors.New("Command already registered " + name)
+	}
+	cr.commands[name] = registeredCommand{desc: desc, handler: handler}
+	return nil
+}
+
+// Lookup - the handler of a built-in command
+func (cr *CommandRegistry) Lookup(name string) (CommandHandler, bool) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	cmd, ok := cr.commands[name]
+	return cmd.handler, ok
+}
+
+// Describe - the sorted "/name - description" lines of the built-in commands
+func (cr *CommandRegistry) Describe() []string {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	lines := []string{}
+	for name, cmd := range cr.commands {
+		lines = append(lines, "/"+name+" - "+cmd.desc)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// HTTPCommandHandler - handles a command by posting the request to an
+// external endpoint, which replies with a CommandResponse; without a
+// Client the denied networks of common.OutboundOptions are not reached
+type HTTPCommandHandler struct {
+	TargetURL string
+	Secret    string
+	Client    *http.Client
+}
+
+// HandleCommand - post the command to the endpoint
+func (h *HTTPCommandHandler) HandleCommand(ctx context.Context, req *CommandRequest) (*CommandResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, h.TargetURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "vilom-commands")
+	httpReq.Header.Set(CommandHeader, req.Command)
+	httpReq.Header.Set(WebhookSignatureHeader, SignWebhookPayload(h.Secret, body))
+
+	client := h.Client
+	if client == nil {
+		client = common.OutboundClient(CommandTimeout)
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.New("Command failed with status " + resp.Status)
+	}
+	cmdResp := CommandResponse{}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&cmdResp)
+	if err != nil {
+		return nil, err
+	}
+	return &cmdResp, nil
+}
+
+// CommandServiceIntf - interface for Command Service
+type CommandServiceIntf interface {
+	CreateCommand(ctx context.Context, form *Command, UserID string, userEmail string, requestID string) (*Command, error)
+	GetCommands(ctx context.Context, workspaceID uint, userEmail string, requestID string) ([]*Command, error)
+	DeleteCommand(ctx context.Context, ID string, userEmail string, requestID string) error
+	RunCommand(ctx context.Context, form *Message, UserID string, userEmail string, requestID string) (*Message, bool, error)
+}
+
+// CommandService - For accessing command services, built-in commands
+// are in Registry, external commands are stored per workspace
+type CommandService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+	UserOptions  *common.UserOptions
+	Registry     *CommandRegistry
+	Client       *http.Client
+}
+
+// NewCommandService - Create command service with the built-in commands
+func NewCommandService(dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions) *CommandService {
+	c := &CommandService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+		UserOptions:  userOpt,
+		Registry:     NewCommandRegistry(),
+		Client:       common.OutboundClient(CommandTimeout),
+	}
+	_ = c.Registry.Register("help", "list the commands", CommandHandlerFunc(c.helpCommand))
+	_ = c.Registry.Register("me", "post an action, /me waves", CommandHandlerFunc(meCommand))
+	return c
+}
+
+// CreateCommand - Create an external command for a workspace along with
+// the bot user that posts its in_channel replies
+func (c *CommandService) CreateCommand(ctx context.Context, form *Command, UserID string, userEmail string, requestID string) (*Command, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10300}).Error(err)
+		return nil, err
+	default:
+		form.Name = strings.TrimPrefix(form.Name, "/")
+		if !commandNameRe.MatchString(form.Name) {
+			err := errors.New("Invalid command name " + form.Name)
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10301}).Error(err)
+			return nil, err
+		}
+		err := ValidateWebhook(&Webhook{TargetURL: form.TargetURL, Events: WebhookEvents})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10302}).Error(err)
+			return nil, err
+		}
+		if _, ok := c.Registry.Lookup(form.Name); ok {
+			err = errors.New("Command already exists " + form.Name)
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10303}).Error(err)
+			return nil, err
+		}
+		existing, err := c.getCommands(ctx, `workspace_id = ? and name = ? and c.statusc = ?`, userEmail, requestID, form.WorkspaceID, form.Name, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10304}).Error(err)
+			return nil, err
+		}
+		if len(existing) > 0 {
+			err = errors.New("Command already exists " + form.Name)
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10305}).Error(err)
+			return nil, err
+		}
+		userserv := &userservices.UserService{DBService: c.DBService, RedisService: c.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10306}).Error(err)
+			return nil, err
+		}
+		workspaceserv := &WorkspaceService{DBService: c.DBService, RedisService: c.RedisService}
+		workspace, err := workspaceserv.GetWorkspaceByID(ctx, form.WorkspaceID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10307}).Error(err)
+			return nil, err
+		}
+
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		cmd := Command{}
+		cmd.UUID4, err = common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10308}).Error(err)
+			return nil, err
+		}
+		cmd.Secret, err = genWebhookSecret()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10309}).Error(err)
+			return nil, err
+		}
+		cmd.WorkspaceID = workspace.ID
+		cmd.Name = form.Name
+		cmd.CommandDesc = form.CommandDesc
+		cmd.TargetURL = form.TargetURL
+		cmd.UserID = user.ID
+		/*  StatusDates  */
+		cmd.Statusc = common.Active
+		cmd.CreatedAt = tn
+		cmd.UpdatedAt = tn
+		cmd.CreatedDay = tnday
+		cmd.CreatedWeek = tnweek
+		cmd.CreatedMonth = tnmonth
+		cmd.CreatedYear = tnyear
+		cmd.UpdatedDay = tnday
+		cmd.UpdatedWeek = tnweek
+		cmd.UpdatedMonth = tnmonth
+		cmd.UpdatedYear = tnyear
+
+		db := c.DBService.DB
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10310}).Error(err)
+			return nil, err
+		}
+		bot, err := userserv.CreateBotUser(ctx, tx, cmd.Name, user.ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10311}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		cmd.BotUserID = bot.ID
+		cmd.BotUserIDS = bot.IDS
+
+		res, err := tx.ExecContext(ctx, `insert into commands
+	  (
+			uuid4,
+			workspace_id,
+			name,
+			command_desc,
+			target_url,
+			secret,
+			bot_user_id,
+			user_id,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?,?,?);`,
+			cmd.UUID4,
+			cmd.WorkspaceID,
+			cmd.Name,
+			cmd.CommandDesc,
+			cmd.TargetURL,
+			cmd.Secret,
+			cmd.BotUserID,
+			cmd.UserID,
+			/*  StatusDates  */
+			cmd.Statusc,
+			cmd.CreatedAt,
+			cmd.UpdatedAt,
+			cmd.CreatedDay,
+			cmd.CreatedWeek,
+			cmd.CreatedMonth,
+			cmd.CreatedYear,
+			cmd.UpdatedDay,
+			cmd.UpdatedWeek,
+			cmd.UpdatedMonth,
+			cmd.UpdatedYear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10312}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		uID, err := res.LastInsertId()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10313}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10314}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		cmd.ID = uint(uID)
+		cmd.IDS, err = common.UUIDBytesToStr(cmd.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10315}).Error(err)
+			return nil, err
+		}
+		return &cmd, nil
+	}
+}
+
+// GetCommands - Get the external commands of a workspace
+func (c *CommandService) GetCommands(ctx context.Context, workspaceID uint, userEmail string, requestID string) ([]*Command, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10316}).Error(err)
+		return nil, err
+	default:
+		cmds, err := c.getCommands(ctx, `workspace_id = ? and c.statusc = ?`, userEmail, requestID, workspaceID, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10317}).Error(err)
+			return nil, err
+		}
+		for _, cmd := range cmds {
+			cmd.Secret = ""
+		}
+		return cmds, nil
+	}
+}
+
+// getCommands - Get external commands with the uuid of their bot user
+func (c *CommandService) getCommands(ctx context.Context, where string, userEmail string, requestID string, args ...interface{}) ([]*Command, error) {
+	db := c.DBService.DB
+	cmds := []*Command{}
+	rows, err := db.QueryContext(ctx, `select
+    c.id,
+		c.uuid4,
+		c.workspace_id,
+		c.name,
+		c.command_desc,
+		c.target_url,
+		c.secret,
+		c.bot_user_id,
+		u.uuid4,
+		c.user_id,
+		c.statusc,
+		c.created_at,
+		c.updated_at,
+		c.created_day,
+		c.created_week,
+		c.created_month,
+		c.created_year,
+		c.updated_day,
+		c.updated_week,
+		c.updated_month,
+		c.updated_year from commands c inner join users u on (c.bot_user_id = u.id) where `+where+` order by c.name;`, args...)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10318}).Error(err)
+		return nil, err
+	}
+	for rows.Next() {
+		cmd := Command{}
+		botUUID4 := []byte{}
+		err = rows.Scan(
+			&cmd.ID,
+			&cmd.UUID4,
+			&cmd.WorkspaceID,
+			&cmd.Name,
+			&cmd.CommandDesc,
+			&cmd.TargetURL,
+			&cmd.Secret,
+			&cmd.BotUserID,
+			&botUUID4,
+			&cmd.UserID,
+			/*  StatusDates  */
+			&cmd.Statusc,
+			&cmd.CreatedAt,
+			&cmd.UpdatedAt,
+			&cmd.CreatedDay,
+			&cmd.CreatedWeek,
+			&cmd.CreatedMonth,
+			&cmd.CreatedYear,
+			&cmd.UpdatedDay,
+			&cmd.UpdatedWeek,
+			&cmd.UpdatedMonth,
+			&cmd.UpdatedYear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10319}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		cmd.IDS, err = common.UUIDBytesToStr(cmd.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10320}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		cmd.BotUserIDS, err = common.UUIDBytesToStr(botUUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10321}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		cmds = append(cmds, &cmd)
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10322}).Error(err)
+		return nil, err
+	}
+	err = rows.Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10323}).Error(err)
+		return nil, err
+	}
+	return cmds, nil
+}
+
+// DeleteCommand - Delete an external command
+func (c *CommandService) DeleteCommand(ctx context.Context, ID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10324}).Error(err)
+		return err
+	default:
+		uuid4byte, err := common.UUIDStrToBytes(ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10325}).Error(err)
+			return err
+		}
+		db := c.DBService.DB
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10326}).Error(err)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `update commands set
+		  statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where uuid4= ?;`,
+			common.Inactive,
+			tn,
+			tnday,
+			tnweek,
+			tnmonth,
+			tnyear,
+			uuid4byte)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10327}).Error(err)
+			err = tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10328}).Error(err)
+			err = tx.Rollback()
+			return err
+		}
+		return nil
+	}
+}
+
+// RunCommand - run the command in form.Mtext, returns false when the
+// text is not a known command so that it is posted as a plain message.
+// Ephemeral replies are returned as a message that is not stored
+func (c *CommandService) RunCommand(ctx context.Context, form *Message, UserID string, userEmail string, requestID string) (*Message, bool, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10329}).Error(err)
+		return nil, false, err
+	default:
+		name, args, ok := ParseCommand(form.Mtext)
+		if !ok {
+			return nil, false, nil
+		}
+		posterID := UserID
+		handler, ok := c.Registry.Lookup(name)
+		if !ok {
+			cmds, err := c.getCommands(ctx, `workspace_id = ? and name = ? and c.statusc = ?`, userEmail, requestID, form.WorkspaceID, name, common.Active)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10330}).Error(err)
+				return nil, false, err
+			}
+			if len(cmds) == 0 {
+				return nil, false, nil
+			}
+			handler = &HTTPCommandHandler{TargetURL: cmds[0].TargetURL, Secret: cmds[0].Secret, Client: c.Client}
+			posterID = cmds[0].BotUserIDS
+		}
+
+		userserv := &userservices.UserService{DBService: c.DBService, RedisService: c.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10331}).Error(err)
+			return nil, true, err
+		}
+		req := CommandRequest{
+			Command:     name,
+			Text:        args,
+			WorkspaceID: form.WorkspaceID,
+			ChannelID:   form.ChannelID,
+			UserID:      user.IDS,
+			UserName:    user.FirstName,
+			RequestID:   requestID,
+		}
+		resp, err := handler.HandleCommand(ctx, &req)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10332}).Error(err)
+			return nil, true, err
+		}
+
+		if resp.ResponseType == ResponseInChannel && resp.Text != "" {
+			// CommandService is not set, so the reply is never run as a command
+			msgserv := &MessageService{DBService: c.DBService, RedisService: c.RedisService, UserOptions: c.UserOptions}
+			msgform := Message{}
+			msgform.WorkspaceID = form.WorkspaceID
+			msgform.ChannelID = form.ChannelID
+			msgform.UgroupID = form.UgroupID
+			msgform.Mtext = resp.Text
+			msg, err := msgserv.CreateMessage(ctx, &msgform, posterID, false, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 10333}).Error(err)
+				return nil, true, err
+			}
+			return msg, true, nil
+		}
+
+		msg := Message{}
+		msg.WorkspaceID = form.WorkspaceID
+		msg.ChannelID = form.ChannelID
+		msg.UserID = user.ID
+		msg.Ephemeral = true
+		msg.MessageTexts = []*MessageText{{Mtext: resp.Text, Mhtml: common.RenderMarkdown(resp.Text), WorkspaceID: form.WorkspaceID, ChannelID: form.ChannelID, UserID: user.ID}}
+		return &msg, true, nil
+	}
+}
+
+// ParseCommand - split "/name args" into name and args, ok is false
+// when text is not a command
+func ParseCommand(text string) (string, string, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+	fields := strings.SplitN(strings.TrimPrefix(text, "/"), " ", 2)
+	name := strings.ToLower(fields[0])
+	if !commandNameRe.MatchString(name) {
+		return "", "", false
+	}
+	args := ""
+	if len(fields) == 2 {
+		args = strings.TrimSpace(fields[1])
+	}
+	return name, args, true
+}
+
+// helpCommand - built-in /help, lists the built-in and the workspace commands
+func (c *CommandService) helpCommand(ctx context.Context, req *CommandRequest) (*CommandResponse, error) {
+	lines := c.Registry.Describe()
+	cmds, err := c.getCommands(ctx, `workspace_id = ? and c.statusc = ?`, "", req.RequestID, req.WorkspaceID, common.Active)
+	if err != nil {
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		lines = append(lines, "/"+cmd.Name+" - "+cmd.CommandDesc)
+	}
+	return &CommandResponse{ResponseType: ResponseEphemeral, Text: strings.Join(lines, "\n")}, nil
+}
+
+// meCommand - built-in /me, posts an action in the channel
+func meCommand(ctx context.Context, req *CommandRequest) (*CommandResponse, error) {
+	if req.Text == "" {
+		return &CommandResponse{ResponseType: ResponseEphemeral, Text: "Usage: /me action"}, nil
+	}
+	return &CommandResponse{ResponseType: ResponseInChannel, Text: "_" + req.UserName + " " + req.Text + "_"}, nil
+}
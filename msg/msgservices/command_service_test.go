@@ -0,0 +1,166 @@
+package msgservices
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		name string
+		args string
+		ok   bool
+	}{
+		{"/help", "help", "", true},
+		{"/me  waves at everyone ", "me", "waves at everyone", true},
+		{"/Deploy prod", "deploy", "prod", true},
+		{"hello /me", "", "", false},
+		{"/", "", "", false},
+		{"/path/to/file", "", "", false},
+	}
+	for _, tt := range tests {
+		name, args, ok := ParseCommand(tt.text)
+		if name != tt.name || args != tt.args || ok != tt.ok {
+			t.Errorf("ParseCommand(%q) = %q, %q, %v, want %q, %q, %v", tt.text, name, args, ok, tt.name, tt.args, tt.ok)
+		}
+	}
+}
+
+func TestCommandRegistry_Register(t *testing.T) {
+	registry := NewCommandRegistry()
+	handler := CommandHandlerFunc(func(ctx context.Context, req *CommandRequest) (*CommandResponse, error) {
+		return &CommandResponse{ResponseType: ResponseEphemeral, Text: req.Text}, nil
+	})
+	if err := registry.Register("echo", "echo the text", handler); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := registry.Register("echo", "echo the text", handler); err == nil {
+		t.Errorf("CommandRegistry.Register() of a registered name, want error")
+	}
+	if err := registry.Register("Not Valid", "", handler); err == nil {
+		t.Errorf("CommandRegistry.Register() of an invalid name, want error")
+	}
+	got, ok := registry.Lookup("echo")
+	if !ok {
+		t.Errorf("CommandRegistry.Lookup() = %v, want %v", ok, true)
+		return
+	}
+	resp, err := got.HandleCommand(context.Background(), &CommandRequest{Text: "hi"})
+	if err != nil || resp.Text != "hi" {
+		t.Errorf("HandleCommand() = %v, %v", resp, err)
+	}
+}
+
+func TestHTTPCommandHandler_HandleCommand(t *testing.T) {
+	secret := "s3cr3t"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !VerifyWebhookSignature(secret, body, r.Header.Get(WebhookSignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		req := CommandRequest{}
+		_ = json.Unmarshal(body, &req)
+		_ = json.NewEncoder(w).Encode(&CommandResponse{ResponseType: ResponseInChannel, Text: "deploying " + req.Text})
+	}))
+	defer server.Close()
+
+	handler := HTTPCommandHandler{TargetURL: server.URL, Secret: secret}
+	resp, err := handler.HandleCommand(context.Background(), &CommandRequest{Command: "deploy", Text: "prod"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if resp.ResponseType != ResponseInChannel || resp.Text != "deploying prod" {
+		t.Errorf("HTTPCommandHandler.HandleCommand() = %v", resp)
+	}
+
+	handler.Secret = "wrong"
+	_, err = handler.HandleCommand(context.Background(), &CommandRequest{Command: "deploy"})
+	if err == nil {
+		t.Errorf("HTTPCommandHandler.HandleCommand() with a wrong secret, want error")
+	}
+
+	// with the default denied networks the loopback endpoint is refused
+	err = common.SetOutboundOpt(&common.OutboundOptions{DeniedNets: common.DefaultDeniedNets})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer func() {
+		_ = common.SetOutboundOpt(&common.OutboundOptions{})
+	}()
+	handler.Secret = secret
+	_, err = handler.HandleCommand(context.Background(), &CommandRequest{Command: "deploy", Text: "prod"})
+	if err == nil {
+		t.Errorf("HTTPCommandHandler.HandleCommand() posted to a loopback address")
+	}
+}
+
+func TestMessageService_CreateMessageCommand(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx := context.Background()
+	messageService := NewMessageService(dbService, redisService, userOpt)
+	userID := "29ea215b-8fb3-4453-b413-81a661e44495"
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	form := Message{}
+	form.WorkspaceID = uint(2)
+	form.ChannelID = uint(1)
+	form.Mtext = "/help"
+	msg, err := messageService.CreateMessage(ctx, &form, userID, false, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !msg.Ephemeral || msg.ID != 0 || len(msg.MessageTexts) != 1 {
+		t.Errorf("MessageService.CreateMessage(/help) = %v, want an ephemeral reply", msg)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&CommandResponse{ResponseType: ResponseInChannel, Text: "deployed"})
+	}))
+	defer server.Close()
+	cmd, err := messageService.CommandService.CreateCommand(ctx, &Command{WorkspaceID: uint(2), Name: "deploy", TargetURL: server.URL}, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	form.Mtext = "/deploy prod"
+	msg, err = messageService.CreateMessage(ctx, &form, userID, false, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if msg.Ephemeral || msg.ID == 0 || msg.UserID != cmd.BotUserID {
+		t.Errorf("MessageService.CreateMessage(/deploy) = %v, want a message from the bot user", msg)
+	}
+
+	form.Mtext = "/unknown"
+	msg, err = messageService.CreateMessage(ctx, &form, userID, false, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if msg.Ephemeral || msg.ID == 0 {
+		t.Errorf("MessageService.CreateMessage(/unknown) = %v, want a plain message", msg)
+	}
+}
@@ -0,0 +1,109 @@
+package msgservices
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	"github.com/cloudfresco/vilom/user/userservices"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+type testMailer struct {
+	emails []common.Email
+}
+
+func (tm *testMailer) SendMail(msg common.Email) error {
+	tm.emails = append(tm.emails, msg)
+	return nil
+}
+
+func TestDigestService_SendDigests(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	userID := "29ea215b-8fb3-4453-b413-81a661e44495"
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	// the digest template is read relative to the repository root
+	pwd, _ := os.Getwd()
+	err = os.Chdir("../..")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.Chdir(pwd)
+
+	annUUID4, err := common.GetUUIDBytes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = dbService.DB.Exec(`insert into users (id, uuid4, email, username, first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year)
+		select 2, ?, 'ann@example.com', 'ann', 'Ann', last_name, role, 0, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year from users where id = 1;`, annUUID4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	userservices.Notify(ctx, dbService, redisService, []*userservices.Notification{{UserID: 1, Ntype: userservices.NotificationMention, ActorID: 2, ChannelID: 1, Ntext: "hi <b>there</b>"}}, userEmail, requestID)
+
+	mailer := &testMailer{}
+	digestOpt := *userOpt
+	digestOpt.DigestHour = 0
+	digestOpt.DigestTokenDuration = "720h"
+	digestOpt.AppURL = "http://localhost:8000"
+	digestService := userservices.NewDigestService(dbService, redisService, &digestOpt)
+	emailOutbox := common.NewEmailOutbox(dbService, mailer)
+
+	sent, err := digestService.SendDigests(ctx, "", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	delivered, err := emailOutbox.DeliverPending(ctx, requestID)
+	if err != nil || delivered != 1 {
+		t.Errorf("EmailOutbox.DeliverPending() = %v, %v, want 1", delivered, err)
+		return
+	}
+	if sent != 1 || len(mailer.emails) != 1 || mailer.emails[0].To != userEmail {
+		t.Errorf("DigestService.SendDigests() = %v, %v, want one email to %v", sent, mailer.emails, userEmail)
+		return
+	}
+	body := mailer.emails[0].Body
+	if !strings.Contains(body, "hi &lt;b&gt;there&lt;/b&gt;") {
+		t.Errorf("DigestService.SendDigests() body = %v, want the escaped mention", body)
+	}
+	if !strings.Contains(mailer.emails[0].TextBody, "hi <b>there</b>") {
+		t.Errorf("DigestService.SendDigests() text body = %v, want the mention", mailer.emails[0].TextBody)
+	}
+
+	// a digest goes out once per due time
+	sent, err = digestService.SendDigests(ctx, "", requestID)
+	if err != nil || sent != 0 {
+		t.Errorf("DigestService.SendDigests() = %v, %v, want 0", sent, err)
+	}
+
+	i := strings.Index(body, "/v0.1/u/digest_unsubscribe/")
+	if i < 0 {
+		t.Errorf("DigestService.SendDigests() body = %v, want an unsubscribe link", body)
+		return
+	}
+	token := strings.Fields(body[i+len("/v0.1/u/digest_unsubscribe/"):])[0]
+	err = digestService.Unsubscribe(ctx, token, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	pref, err := digestService.GetDigestPref(ctx, userID, userEmail, requestID)
+	if err != nil || pref.Frequency != userservices.DigestOff {
+		t.Errorf("DigestService.GetDigestPref() = %v, %v, want off", pref, err)
+	}
+}
@@ -0,0 +1,741 @@
+package msgservices
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 15400-15699 */
+
+// The roles a ugroup can be granted on a workspace or a channel, each role
+// includes the ones before it
+const (
+	GrantRead     = "read"
+	GrantPost     = "post"
+	GrantModerate = "moderate"
+	GrantAdmin    = "admin"
+)
+
+// GrantRoles - the roles in ascending order
+var GrantRoles = []string{GrantRead, GrantPost, GrantModerate, GrantAdmin}
+
+// ErrAccessDenied - the user has no grant with the role needed
+var ErrAccessDenied = errors.New("Access denied")
+
+// UgroupGrant - UgroupGrant view representation, a grant is on either a
+// workspace, and then on its channels and child workspaces, or a channel
+type UgroupGrant struct {
+	ID          uint   `json:"id,omitempty"`
+	UUID4       []byte `json:"-"`
+	IDS         string `json:"id_s,omitempty"`
+	UgroupID    uint   `json:"ugroup_id,omitempty"`
+	WorkspaceID uint   `json:"workspace_id,omitempty"`
+	ChannelID   uint   `json:"channel_id,omitempty"`
+	GrantRole   string `json:"grant_role,omitempty"`
+	UserID      uint   `json:"user_id,omitempty"`
+
+	common.StatusDates
+}
+
+// GrantServiceIntf - interface for Grant Service
+type GrantServiceIntf interface {
+	CreateGrant(ctx context.Context, form *UgroupGrant, UserID string, userEmail string, requestID string) (*UgroupGrant, error)
+	GetGrants(ctx context.Context, workspaceID uint, channelID uint, userEmail string, requestID string) ([]*UgroupGrant, error)
+	DeleteGrant(ctx context.Context, ID string, userEmail string, requestID string) error
+	ChannelRole(ctx context.Context, channelID uint, userEmail string, requestID string) (string, uint, error)
+}
+
+// GrantService - For granting ugroups roles on workspaces and channels
+// and checking them
+type GrantService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+	UserOptions  *common.UserOptions
+}
+
+// NewGrantService - Create grant service
+func NewGrantService(dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions) *GrantService {
+	return &GrantService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+		UserOptions:  userOpt,
+	}
+}
+
+// grantLevel - the rank of the role, 0 for no role
+func grantLevel(role string) int {
+	for i, r := range GrantRoles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// GrantAllows - whether role includes need
+func GrantAllows(role string, need string) bool {
+	return grantLevel(role) >= grantLevel(need) && grantLevel(role) > 0
+}
+
+// ValidateGrant - the role must be one of GrantRoles and the grant on
+// either a workspace or a channel
+func ValidateGrant(form *UgroupGrant) error {
+	if grantLevel(form.GrantRole) == 0 {
+		return errors.New("Role must be one of " + strings.Join(GrantRoles, ", "))
+	}
+	if form.UgroupID == 0 {
+		return errors.New("Ugroup is required")
+	}
+	if (form.WorkspaceID == 0) == (form.ChannelID == 0) {
+		return errors.New("Grant either a workspace or a channel")
+	}
+	return nil
+}
+
+// CreateGrant - Grant a ugroup a role on a workspace or a channel, it
+// replaces the earlier grant of the ugroup on it; the user needs admin on
+// the workspace or the channel, and the first grant is made by a site admin
+func (g *GrantService) CreateGrant(ctx context.Context, form *UgroupGrant, UserID string, userEmail string, requestID string) (*UgroupGrant, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15400}).Error(err)
+		return nil, err
+	default:
+		err := ValidateGrant(form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15401}).Error(err)
+			return nil, err
+		}
+		userserv := &userservices.UserService{DBService: g.DBService, RedisService: g.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15402}).Error(err)
+			return nil, err
+		}
+		ugroupserv := &userservices.UgroupService{DBService: g.DBService, RedisService: g.RedisService, UserOptions: g.UserOptions}
+		_, err = ugroupserv.GetUgroupByIDuint(ctx, form.UgroupID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15403}).Error(err)
+			return nil, err
+		}
+		if form.WorkspaceID != 0 {
+			workspaceserv := &WorkspaceService{DBService: g.DBService, RedisService: g.RedisService}
+			_, err = workspaceserv.GetWorkspaceByID(ctx, form.WorkspaceID, userEmail, requestID)
+		} else {
+			channelserv := &ChannelService{DBService: g.DBService, RedisService: g.RedisService, UserOptions: g.UserOptions}
+			_, err = channelserv.GetChannelByID(ctx, form.ChannelID, userEmail, requestID)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15404}).Error(err)
+			return nil, err
+		}
+		err = g.checkGrantAdmin(ctx, form.WorkspaceID, form.ChannelID, userEmail, requestID)
+		if err != nil {
+			return nil, err
+		}
+
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		grant := UgroupGrant{}
+		grant.UUID4, err = common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15405}).Error(err)
+			return nil, err
+		}
+		grant.UgroupID = form.UgroupID
+		grant.WorkspaceID = form.WorkspaceID
+		grant.ChannelID = form.ChannelID
+		grant.GrantRole = form.GrantRole
+		grant.UserID = user.ID
+		/*  StatusDates  */
+		grant.Statusc = common.Active
+		grant.CreatedAt = tn
+		grant.UpdatedAt = tn
+		grant.CreatedDay = tnday
+		grant.CreatedWeek = tnweek
+		grant.CreatedMonth = tnmonth
+		grant.CreatedYear = tnyear
+		grant.UpdatedDay = tnday
+		grant.UpdatedWeek = tnweek
+		grant.UpdatedMonth = tnmonth
+		grant.UpdatedYear = tnyear
+
+		db := g.DBService.DB
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15406}).Error(err)
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `update ugroup_grants set
+		  statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where ugroup_id = ? and workspace_id = ? and channel_id = ? and statusc = ?;`,
+			common.Inactive, tn, tnday, tnweek, tnmonth, tnyear, grant.UgroupID, grant.WorkspaceID, grant.ChannelID, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15407}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		res, err := tx.ExecContext(ctx, `insert into ugroup_grants
+	  (
+			uuid4,
+			ugroup_id,
+			workspace_id,
+			channel_id,
+			grant_role,
+			user_id,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?);`,
+			grant.UUID4,
+			grant.UgroupID,
+			grant.WorkspaceID,
+			grant.ChannelID,
+			grant.GrantRole,
+			grant.UserID,
+			/*  StatusDates  */
+			grant.Statusc,
+			grant.CreatedAt,
+			grant.UpdatedAt,
+			grant.CreatedDay,
+			grant.CreatedWeek,
+			grant.CreatedMonth,
+			grant.CreatedYear,
+			grant.UpdatedDay,
+			grant.UpdatedWeek,
+			grant.UpdatedMonth,
+			grant.UpdatedYear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15408}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		uID, err := res.LastInsertId()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15409}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15410}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		grant.ID = uint(uID)
+		grant.IDS, err = common.UUIDBytesToStr(grant.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15411}).Error(err)
+			return nil, err
+		}
+		return &grant, nil
+	}
+}
+
+// GetGrants - Get the active grants on a workspace or a channel
+func (g *GrantService) GetGrants(ctx context.Context, workspaceID uint, channelID uint, userEmail string, requestID string) ([]*UgroupGrant, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15412}).Error(err)
+		return nil, err
+	default:
+		db := g.DBService.DB
+		grants := []*UgroupGrant{}
+		rows, err := db.QueryContext(ctx, `select
+    id,
+		uuid4,
+		ugroup_id,
+		workspace_id,
+		channel_id,
+		grant_role,
+		user_id,
+		statusc,
+		created_at,
+		updated_at,
+		created_day,
+		created_week,
+		created_month,
+		created_year,
+		updated_day,
+		updated_week,
+		updated_month,
+		updated_year from ugroup_grants where workspace_id = ? and channel_id = ? and statusc = ? order by id;`, workspaceID, channelID, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15413}).Error(err)
+			return nil, err
+		}
+		for rows.Next() {
+			grant := UgroupGrant{}
+			err = rows.Scan(
+				&grant.ID,
+				&grant.UUID4,
+				&grant.UgroupID,
+				&grant.WorkspaceID,
+				&grant.ChannelID,
+				&grant.GrantRole,
+				&grant.UserID,
+				/*  StatusDates  */
+				&grant.Statusc,
+				&grant.CreatedAt,
+				&grant.UpdatedAt,
+				&grant.CreatedDay,
+				&grant.CreatedWeek,
+				&grant.CreatedMonth,
+				&grant.CreatedYear,
+				&grant.UpdatedDay,
+				&grant.UpdatedWeek,
+				&grant.UpdatedMonth,
+				&grant.UpdatedYear)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15414}).Error(err)
+				_ = rows.Close()
+				return nil, err
+			}
+			grant.IDS, err = common.UUIDBytesToStr(grant.UUID4)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15415}).Error(err)
+				_ = rows.Close()
+				return nil, err
+			}
+			grants = append(grants, &grant)
+		}
+		err = rows.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15416}).Error(err)
+			return nil, err
+		}
+		err = rows.Err()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15417}).Error(err)
+			return nil, err
+		}
+		return grants, nil
+	}
+}
+
+// DeleteGrant - Delete grant, the user needs admin on its workspace or
+// channel
+func (g *GrantService) DeleteGrant(ctx context.Context, ID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15418}).Error(err)
+		return err
+	default:
+		uuid4byte, err := common.UUIDStrToBytes(ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15419}).Error(err)
+			return err
+		}
+		db := g.DBService.DB
+		var workspaceID, channelID uint
+		err = db.QueryRowContext(ctx, `select workspace_id, channel_id from ugroup_grants where uuid4 = ? and statusc = ?;`, uuid4byte, common.Active).Scan(&workspaceID, &channelID)
+		if err == sql.ErrNoRows {
+			err = errors.New("Grant not found")
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15437}).Error(err)
+			return err
+		}
+		err = g.checkGrantAdmin(ctx, workspaceID, channelID, userEmail, requestID)
+		if err != nil {
+			return err
+		}
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15420}).Error(err)
+			return err
+		}
+		res, err := tx.ExecContext(ctx, `update ugroup_grants set
+		  statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where uuid4= ? and statusc = ?;`,
+			common.Inactive,
+			tn,
+			tnday,
+			tnweek,
+			tnmonth,
+			tnyear,
+			uuid4byte,
+			common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15421}).Error(err)
+			err = tx.Rollback()
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err == nil && n == 0 {
+			err = errors.New("Grant not found")
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15422}).Error(err)
+			_ = tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15423}).Error(err)
+			err = tx.Rollback()
+			return err
+		}
+		return nil
+	}
+}
+
+// workspaceAncestors - the workspace and the workspaces above it through
+// workspace_chds, nearest first
+func (g *GrantService) workspaceAncestors(ctx context.Context, workspaceID uint, requestID string) ([]uint, error) {
+	ids := []uint{workspaceID}
+	seen := map[uint]bool{workspaceID: true}
+	for id := workspaceID; ; {
+		var parentID uint
+		err := g.DBService.DB.QueryRowContext(ctx, `select workspace_id from workspace_chds where workspace_chd_id = ? and statusc = ? limit 1;`, id, common.Active).Scan(&parentID)
+		if err == sql.ErrNoRows {
+			return ids, nil
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15424}).Error(err)
+			return nil, err
+		}
+		// a cycle in workspace_chds does not loop forever
+		if seen[parentID] {
+			return ids, nil
+		}
+		seen[parentID] = true
+		ids = append(ids, parentID)
+		id = parentID
+	}
+}
+
+// grantedRole - the highest role granted on the channel or on the
+// workspaces to the ugroups of the user, restricted is false when there
+// are no grants at all and then everyone keeps full access
+func (g *GrantService) grantedRole(ctx context.Context, workspaceIDs []uint, channelID uint, userID uint, requestID string) (string, bool, error) {
+	query := `select ugroup_id, grant_role from ugroup_grants where statusc = ? and ((channel_id <> 0 and channel_id = ?) or (channel_id = 0 and workspace_id in (` + strings.TrimSuffix(strings.Repeat("?,", len(workspaceIDs)), ",") + `)));`
+	args := []interface{}{common.Active, channelID}
+	for _, id := range workspaceIDs {
+		args = append(args, id)
+	}
+	rows, err := g.DBService.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15425}).Error(err)
+		return "", false, err
+	}
+	roles := map[uint][]string{}
+	restricted := false
+	for rows.Next() {
+		var ugroupID uint
+		var role string
+		err = rows.Scan(&ugroupID, &role)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15426}).Error(err)
+			_ = rows.Close()
+			return "", false, err
+		}
+		restricted = true
+		roles[ugroupID] = append(roles[ugroupID], role)
+	}
+	err = rows.Close()
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15427}).Error(err)
+		return "", false, err
+	}
+	if !restricted || userID == 0 {
+		return "", restricted, nil
+	}
+	ugroupserv := &userservices.UgroupService{DBService: g.DBService, RedisService: g.RedisService, UserOptions: g.UserOptions}
+	ugroupIDs, err := ugroupserv.EffectiveUgroupIDs(ctx, userID, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15428}).Error(err)
+		return "", true, err
+	}
+	best := ""
+	for _, ugroupID := range ugroupIDs {
+		for _, role := range roles[ugroupID] {
+			if grantLevel(role) > grantLevel(best) {
+				best = role
+			}
+		}
+	}
+	return best, true, nil
+}
+
+// activeUser - the id and the role of the active user with the email, 0
+// if there is none
+func (g *GrantService) activeUser(ctx context.Context, userEmail string, requestID string) (uint, string, error) {
+	var userID uint
+	var role string
+	err := g.DBService.DB.QueryRowContext(ctx, `select id, role from users where email = ? and statusc = ?;`, userEmail, common.Active).Scan(&userID, &role)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15429}).Error(err)
+		return 0, "", err
+	}
+	return userID, role, nil
+}
+
+// targetRole - the role of the user on the channel, or on the workspace
+// when channelID is 0, the id of the user, and whether there are grants
+// on it at all; site admins and the creators of the channel and of its
+// workspace are admins
+func (g *GrantService) targetRole(ctx context.Context, workspaceID uint, channelID uint, userEmail string, requestID string) (string, uint, bool, error) {
+	userID, userRole, err := g.activeUser(ctx, userEmail, requestID)
+	if err != nil {
+		return "", 0, false, err
+	}
+	var ownerID, workspaceOwnerID uint
+	if channelID != 0 {
+		err = g.DBService.DB.QueryRowContext(ctx, `select c.workspace_id, ifnull(c.user_id, 0), ifnull(w.user_id, 0) from channels c inner join workspaces w on (c.workspace_id = w.id) where c.id = ?;`, channelID).Scan(&workspaceID, &ownerID, &workspaceOwnerID)
+		if err == sql.ErrNoRows {
+			err = errors.New("Channel not found")
+		}
+	} else {
+		err = g.DBService.DB.QueryRowContext(ctx, `select ifnull(user_id, 0) from workspaces where id = ?;`, workspaceID).Scan(&workspaceOwnerID)
+		if err == sql.ErrNoRows {
+			err = errors.New("Workspace not found")
+		}
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15431}).Error(err)
+		return "", 0, false, err
+	}
+	workspaceIDs, err := g.workspaceAncestors(ctx, workspaceID, requestID)
+	if err != nil {
+		return "", 0, false, err
+	}
+	role, restricted, err := g.grantedRole(ctx, workspaceIDs, channelID, userID, requestID)
+	if err != nil {
+		return "", 0, false, err
+	}
+	if userID != 0 && (userRole == common.SiteAdminRole || userID == ownerID || userID == workspaceOwnerID) {
+		role = GrantAdmin
+	}
+	return role, userID, restricted, nil
+}
+
+// ChannelRole - the role of the user on the channel and the id of the
+// user; without grants on the channel or its workspaces everyone is admin,
+// site admins and the creators of the channel and of its workspace are
+// admins, the bot of an incoming webhook of the channel posts in it
+func (g *GrantService) ChannelRole(ctx context.Context, channelID uint, userEmail string, requestID string) (string, uint, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15430}).Error(err)
+		return "", 0, err
+	default:
+		role, userID, restricted, err := g.targetRole(ctx, 0, channelID, userEmail, requestID)
+		if err != nil {
+			return "", 0, err
+		}
+		if !restricted {
+			return GrantAdmin, userID, nil
+		}
+		if userID != 0 && !GrantAllows(role, GrantPost) {
+			var isWebhookBot bool
+			err = g.DBService.DB.QueryRowContext(ctx, `select exists (select 1 from incoming_webhooks where channel_id = ? and bot_user_id = ? and statusc = ?);`, channelID, userID, common.Active).Scan(&isWebhookBot)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15439}).Error(err)
+				return "", 0, err
+			}
+			if isWebhookBot {
+				role = GrantPost
+			}
+		}
+		return role, userID, nil
+	}
+}
+
+// WorkspaceRole - the role of the user on the workspace, as ChannelRole
+func (g *GrantService) WorkspaceRole(ctx context.Context, workspaceID uint, userEmail string, requestID string) (string, uint, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15432}).Error(err)
+		return "", 0, err
+	default:
+		role, userID, restricted, err := g.targetRole(ctx, workspaceID, 0, userEmail, requestID)
+		if err != nil {
+			return "", 0, err
+		}
+		if !restricted {
+			return GrantAdmin, userID, nil
+		}
+		return role, userID, nil
+	}
+}
+
+// UnreadableChannels - the ids and the uuids of the channels the user
+// cannot read, used to leave them out of the search; none without grants
+func (g *GrantService) UnreadableChannels(ctx context.Context, userEmail string, requestID string) ([]uint, []string, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15440}).Error(err)
+		return nil, nil, err
+	default:
+		db := g.DBService.DB
+		var restricted bool
+		err := db.QueryRowContext(ctx, `select exists (select 1 from ugroup_grants where statusc = ?);`, common.Active).Scan(&restricted)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15441}).Error(err)
+			return nil, nil, err
+		}
+		if !restricted {
+			return nil, nil, nil
+		}
+		rows, err := db.QueryContext(ctx, `select id, uuid4 from channels;`)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15442}).Error(err)
+			return nil, nil, err
+		}
+		ids := []uint{}
+		uuids := [][]byte{}
+		for rows.Next() {
+			var id uint
+			var uuid4 []byte
+			err = rows.Scan(&id, &uuid4)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15443}).Error(err)
+				_ = rows.Close()
+				return nil, nil, err
+			}
+			ids = append(ids, id)
+			uuids = append(uuids, uuid4)
+		}
+		err = rows.Close()
+		if err == nil {
+			err = rows.Err()
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15444}).Error(err)
+			return nil, nil, err
+		}
+		channelIDs := []uint{}
+		channelIDS := []string{}
+		for i, id := range ids {
+			role, _, err := g.ChannelRole(ctx, id, userEmail, requestID)
+			if err != nil {
+				return nil, nil, err
+			}
+			if GrantAllows(role, GrantRead) {
+				continue
+			}
+			IDS, err := common.UUIDBytesToStr(uuids[i])
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15445}).Error(err)
+				return nil, nil, err
+			}
+			channelIDs = append(channelIDs, id)
+			channelIDS = append(channelIDS, IDS)
+		}
+		return channelIDs, channelIDS, nil
+	}
+}
+
+// checkGrantAdmin - ErrAccessDenied unless the user may manage the grants
+// on the workspace or the channel, which needs admin on it; the open
+// access without grants does not count, so that only site admins make the
+// first grant
+func (g *GrantService) checkGrantAdmin(ctx context.Context, workspaceID uint, channelID uint, userEmail string, requestID string) error {
+	_, userRole, err := g.activeUser(ctx, userEmail, requestID)
+	if err != nil {
+		return err
+	}
+	if userRole == common.SiteAdminRole {
+		return nil
+	}
+	role, _, restricted, err := g.targetRole(ctx, workspaceID, channelID, userEmail, requestID)
+	if err != nil {
+		return err
+	}
+	if !restricted || !GrantAllows(role, GrantAdmin) {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15436, "workspace": workspaceID, "channel": channelID}).Error(ErrAccessDenied)
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// checkChannelAccess - ErrAccessDenied unless the user has need on the
+// channel, authorID is the author of the content acted on who only needs
+// to be able to post, 0 when there is none
+func checkChannelAccess(ctx context.Context, dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions, channelID uint, need string, authorID uint, userEmail string, requestID string) error {
+	grantserv := &GrantService{DBService: dbOpt, RedisService: redisOpt, UserOptions: userOpt}
+	role, userID, err := grantserv.ChannelRole(ctx, channelID, userEmail, requestID)
+	if err != nil {
+		return err
+	}
+	if authorID != 0 && authorID == userID && grantLevel(need) > grantLevel(GrantPost) {
+		need = GrantPost
+	}
+	if !GrantAllows(role, need) {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15434, "channel": channelID, "need": need}).Error(ErrAccessDenied)
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// checkWorkspaceAccess - ErrAccessDenied unless the user has need on the
+// workspace
+func checkWorkspaceAccess(ctx context.Context, dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions, workspaceID uint, need string, userEmail string, requestID string) error {
+	grantserv := &GrantService{DBService: dbOpt, RedisService: redisOpt, UserOptions: userOpt}
+	role, _, err := grantserv.WorkspaceRole(ctx, workspaceID, userEmail, requestID)
+	if err != nil {
+		return err
+	}
+	if !GrantAllows(role, need) {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15435, "workspace": workspaceID, "need": need}).Error(ErrAccessDenied)
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// checkTargetAdmin - ErrAccessDenied unless the user created the object
+// acted on, creatorID is 0 when there is none, or is an admin of the
+// channel, or of the workspace when channelID is 0; the open access
+// without grants does not make the user an admin
+func checkTargetAdmin(ctx context.Context, dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions, workspaceID uint, channelID uint, creatorID uint, userEmail string, requestID string) error {
+	grantserv := &GrantService{DBService: dbOpt, RedisService: redisOpt, UserOptions: userOpt}
+	role, userID, _, err := grantserv.targetRole(ctx, workspaceID, channelID, userEmail, requestID)
+	if err != nil {
+		return err
+	}
+	if userID != 0 && userID == creatorID {
+		return nil
+	}
+	if !GrantAllows(role, GrantAdmin) {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15438, "workspace": workspaceID, "channel": channelID}).Error(ErrAccessDenied)
+		return ErrAccessDenied
+	}
+	return nil
+}
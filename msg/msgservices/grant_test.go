@@ -0,0 +1,168 @@
+package msgservices
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestGrantAllows(t *testing.T) {
+	tests := []struct {
+		role string
+		need string
+		want bool
+	}{
+		{GrantAdmin, GrantModerate, true},
+		{GrantModerate, GrantPost, true},
+		{GrantPost, GrantPost, true},
+		{GrantRead, GrantPost, false},
+		{GrantPost, GrantModerate, false},
+		{"", GrantRead, false},
+		{"owner", GrantRead, false},
+	}
+	for _, tt := range tests {
+		if got := GrantAllows(tt.role, tt.need); got != tt.want {
+			t.Errorf("GrantAllows(%q, %q) = %v, want %v", tt.role, tt.need, got, tt.want)
+		}
+	}
+}
+
+func TestGrantService_ChannelAccess(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	messageService := NewMessageService(dbService, redisService, userOpt)
+	grantService := NewGrantService(dbService, redisService, userOpt)
+	userID := "29ea215b-8fb3-4453-b413-81a661e44495"
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	// ann is a member of subugroup1, bob is in no ugroup
+	for _, q := range []struct {
+		id    uint
+		email string
+	}{
+		{2, "ann@example.com"},
+		{3, "bob@example.com"},
+	} {
+		uuid4, err := common.GetUUIDBytes()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = dbService.DB.Exec(`insert into users (id, uuid4, email, username, first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year)
+			select ?, ?, ?, ?, first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year from users where id = 1;`, q.id, uuid4, q.email, q.email)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	_, err = dbService.DB.Exec(`insert into ugroups_users (ugroup_id, user_id, statusc) values (2, 2, 1);`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	form := Message{}
+	form.WorkspaceID = uint(2)
+	form.ChannelID = uint(1)
+	form.Mtext = "before any grant"
+	// without grants the channel stays open to everyone
+	_, err = messageService.CreateMessage(ctx, &form, userID, false, "bob@example.com", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the creator of the channel is no site admin and cannot make the
+	// first grant
+	_, err = grantService.CreateGrant(ctx, &UgroupGrant{UgroupID: 2, ChannelID: 1, GrantRole: GrantRead}, userID, userEmail, requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("GrantService.CreateGrant() error = %v, want %v", err, ErrAccessDenied)
+		return
+	}
+	_, err = dbService.DB.Exec(`update users set role = ? where id = 1;`, common.SiteAdminRole)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	grant, err := grantService.CreateGrant(ctx, &UgroupGrant{UgroupID: 2, ChannelID: 1, GrantRole: GrantRead}, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// a member who can read cannot grant itself more
+	_, err = grantService.CreateGrant(ctx, &UgroupGrant{UgroupID: 2, ChannelID: 1, GrantRole: GrantAdmin}, userID, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("GrantService.CreateGrant() error = %v, want %v", err, ErrAccessDenied)
+		return
+	}
+	err = grantService.DeleteGrant(ctx, grant.IDS, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("GrantService.DeleteGrant() error = %v, want %v", err, ErrAccessDenied)
+		return
+	}
+	msg, err := messageService.CreateMessage(ctx, &form, userID, false, userEmail, requestID)
+	if err != nil {
+		t.Errorf("MessageService.CreateMessage() error = %v, a site admin is admin", err)
+		return
+	}
+	_, err = messageService.CreateMessage(ctx, &form, userID, false, "bob@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("MessageService.CreateMessage() error = %v, want %v", err, ErrAccessDenied)
+		return
+	}
+	_, err = messageService.GetMessage(ctx, msg.IDS, "ann@example.com", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = messageService.CreateMessage(ctx, &form, userID, false, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("MessageService.CreateMessage() error = %v, want %v", err, ErrAccessDenied)
+		return
+	}
+
+	// the new grant replaces the earlier one of the ugroup on the channel
+	_, err = grantService.CreateGrant(ctx, &UgroupGrant{UgroupID: 2, ChannelID: 1, GrantRole: GrantPost}, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	grants, err := grantService.GetGrants(ctx, 0, 1, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(grants) != 1 || grants[0].GrantRole != GrantPost {
+		t.Errorf("GrantService.GetGrants() = %v, want the post grant only", grants)
+		return
+	}
+	_, err = messageService.CreateMessage(ctx, &form, userID, false, "ann@example.com", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = grantService.DeleteGrant(ctx, grant.IDS, userEmail, requestID)
+	if err == nil {
+		t.Errorf("GrantService.DeleteGrant() deleted a replaced grant")
+		return
+	}
+	err = grantService.DeleteGrant(ctx, grants[0].IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = messageService.CreateMessage(ctx, &form, userID, false, "bob@example.com", requestID)
+	if err != nil {
+		t.Errorf("MessageService.CreateMessage() error = %v, want open access without grants", err)
+	}
+}
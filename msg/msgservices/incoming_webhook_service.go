@@ -0,0 +1,626 @@
+package msgservices
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 9300-9999 */
+
+// For validation of incoming webhook fields
+const (
+	DisplayNameLenMin = 1
+	DisplayNameLenMax = 100
+	PostTextLenMin    = 1
+	PostTextLenMax    = 4000
+)
+
+// IncomingWebhookMaxRate - default number of posts per minute allowed
+// for an incoming webhook
+const IncomingWebhookMaxRate = 60
+
+// ErrIncomingWebhookRateLimited - the webhook posted more than its
+// max rate in the current minute
+var ErrIncomingWebhookRateLimited = errors.New("Rate limit exceeded")
+
+// IncomingWebhook - IncomingWebhook view representation, the token is
+// only returned when the webhook is created
+type IncomingWebhook struct {
+	ID          uint   `json:"id,omitempty"`
+	UUID4       []byte `json:"-"`
+	IDS         string `json:"id_s,omitempty"`
+	WorkspaceID uint   `json:"workspace_id,omitempty"`
+	ChannelID   uint   `json:"channel_id,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	Token       string `json:"token,omitempty"`
+	BotUserID   uint   `json:"bot_user_id,omitempty"`
+	BotUserIDS  string `json:"bot_user_id_s,omitempty"`
+	MaxRate     uint   `json:"max_rate,omitempty"`
+	UserID      uint   `json:"user_id,omitempty"`
+
+	common.StatusDates
+}
+
+// IncomingWebhookPost - payload posted to an incoming webhook url
+type IncomingWebhookPost struct {
+	Text        string   `json:"text"`
+	Attachments []string `json:"attachments,omitempty"`
+	DisplayName string   `json:"display_name,omitempty"`
+}
+
+// IncomingWebhookMessage - a message posted through an incoming webhook
+type IncomingWebhookMessage struct {
+	ID                uint   `json:"id,omitempty"`
+	UUID4             []byte `json:"-"`
+	IDS               string `json:"id_s,omitempty"`
+	IncomingWebhookID uint   `json:"incoming_webhook_id,omitempty"`
+	MessageID         uint   `json:"message_id,omitempty"`
+	DisplayName       string `json:"display_name,omitempty"`
+
+	common.StatusDates
+
+	Message *Message `json:"message,omitempty"`
+}
+
+// IncomingWebhookServiceIntf - interface for Incoming Webhook Service
+type IncomingWebhookServiceIntf interface {
+	CreateIncomingWebhook(ctx context.Context, form *IncomingWebhook, UserID string, userEmail string, requestID string) (*IncomingWebhook, error)
+	GetIncomingWebhooks(ctx context.Context, channelID uint, userEmail string, requestID string) ([]*IncomingWebhook, error)
+	GetIncomingWebhook(ctx context.Context, ID string, userEmail string, requestID string) (*IncomingWebhook, error)
+	RevokeIncomingWebhook(ctx context.Context, ID string, userEmail string, requestID string) error
+	PostMessage(ctx context.Context, token string, form *IncomingWebhookPost, requestID string) (*IncomingWebhookMessage, error)
+}
+
+// IncomingWebhookService - For accessing incoming webhook services
+type IncomingWebhookService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+	UserOptions  *common.UserOptions
+}
+
+// NewIncomingWebhookService - Create incoming webhook service
+func NewIncomingWebhookService(dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions) *IncomingWebhookService {
+	return &IncomingWebhookService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+		UserOptions:  userOpt,
+	}
+}
+
+// CreateIncomingWebhook - Create incoming webhook for a channel along
+// with the bot user that posts its messages, the user has to be able to
+// post in the channel
+func (iw *IncomingWebhookService) CreateIncomingWebhook(ctx context.Context, form *IncomingWebhook, UserID string, userEmail string, requestID string) (*IncomingWebhook, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9300}).Error(err)
+		return nil, err
+	default:
+		userserv := &userservices.UserService{DBService: iw.DBService, RedisService: iw.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9301}).Error(err)
+			return nil, err
+		}
+		channelserv := &ChannelService{DBService: iw.DBService, RedisService: iw.RedisService, UserOptions: iw.UserOptions}
+		channel, err := channelserv.GetChannelByID(ctx, form.ChannelID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9302}).Error(err)
+			return nil, err
+		}
+		err = checkChannelAccess(ctx, iw.DBService, iw.RedisService, iw.UserOptions, channel.ID, GrantPost, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9340}).Error(err)
+			return nil, err
+		}
+
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		webhook := IncomingWebhook{}
+		webhook.UUID4, err = common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9303}).Error(err)
+			return nil, err
+		}
+		webhook.Token, err = genIncomingWebhookToken()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9304}).Error(err)
+			return nil, err
+		}
+		webhook.WorkspaceID = channel.WorkspaceID
+		webhook.ChannelID = channel.ID
+		webhook.DisplayName = form.DisplayName
+		webhook.MaxRate = form.MaxRate
+		if webhook.MaxRate == 0 {
+			webhook.MaxRate = IncomingWebhookMaxRate
+		}
+		webhook.UserID = user.ID
+		/*  StatusDates  */
+		webhook.Statusc = common.Active
+		webhook.CreatedAt = tn
+		webhook.UpdatedAt = tn
+		webhook.CreatedDay = tnday
+		webhook.CreatedWeek = tnweek
+		webhook.CreatedMonth = tnmonth
+		webhook.CreatedYear = tnyear
+		webhook.UpdatedDay = tnday
+		webhook.UpdatedWeek = tnweek
+		webhook.UpdatedMonth = tnmonth
+		webhook.UpdatedYear = tnyear
+
+		db := iw.DBService.DB
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9305}).Error(err)
+			return nil, err
+		}
+		bot, err := userserv.CreateBotUser(ctx, tx, webhook.DisplayName, user.ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9306}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		webhook.BotUserID = bot.ID
+		webhook.BotUserIDS = bot.IDS
+
+		res, err := tx.ExecContext(ctx, `insert into incoming_webhooks
+	  (
+			uuid4,
+			workspace_id,
+			channel_id,
+			display_name,
+			token_hash,
+			bot_user_id,
+			max_rate,
+			user_id,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?,?,?);`,
+			webhook.UUID4,
+			webhook.WorkspaceID,
+			webhook.ChannelID,
+			webhook.DisplayName,
+			hashIncomingWebhookToken(webhook.Token),
+			webhook.BotUserID,
+			webhook.MaxRate,
+			webhook.UserID,
+			/*  StatusDates  */
+			webhook.Statusc,
+			webhook.CreatedAt,
+			webhook.UpdatedAt,
+			webhook.CreatedDay,
+			webhook.CreatedWeek,
+			webhook.CreatedMonth,
+			webhook.CreatedYear,
+			webhook.UpdatedDay,
+			webhook.UpdatedWeek,
+			webhook.UpdatedMonth,
+			webhook.UpdatedYear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9307}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		uID, err := res.LastInsertId()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9308}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9309}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		webhook.ID = uint(uID)
+		webhook.IDS, err = common.UUIDBytesToStr(webhook.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9310}).Error(err)
+			return nil, err
+		}
+		return &webhook, nil
+	}
+}
+
+// GetIncomingWebhooks - Get the active incoming webhooks of a channel,
+// the user has to be able to read the channel
+func (iw *IncomingWebhookService) GetIncomingWebhooks(ctx context.Context, channelID uint, userEmail string, requestID string) ([]*IncomingWebhook, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9311}).Error(err)
+		return nil, err
+	default:
+		err := checkChannelAccess(ctx, iw.DBService, iw.RedisService, iw.UserOptions, channelID, GrantRead, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9341}).Error(err)
+			return nil, err
+		}
+		webhooks, err := iw.getIncomingWebhooks(ctx, `iw.channel_id = ? and iw.statusc = ?`, userEmail, requestID, channelID, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9312}).Error(err)
+			return nil, err
+		}
+		return webhooks, nil
+	}
+}
+
+// GetIncomingWebhook - Get incoming webhook, the user has to be able to
+// read its channel
+func (iw *IncomingWebhookService) GetIncomingWebhook(ctx context.Context, ID string, userEmail string, requestID string) (*IncomingWebhook, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9313}).Error(err)
+		return nil, err
+	default:
+		uuid4byte, err := common.UUIDStrToBytes(ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9314}).Error(err)
+			return nil, err
+		}
+		webhooks, err := iw.getIncomingWebhooks(ctx, `iw.uuid4 = ? and iw.statusc = ?`, userEmail, requestID, uuid4byte, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9315}).Error(err)
+			return nil, err
+		}
+		if len(webhooks) == 0 {
+			err = errors.New("Incoming webhook not found")
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9316}).Error(err)
+			return nil, err
+		}
+		err = checkChannelAccess(ctx, iw.DBService, iw.RedisService, iw.UserOptions, webhooks[0].ChannelID, GrantRead, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9342}).Error(err)
+			return nil, err
+		}
+		return webhooks[0], nil
+	}
+}
+
+// getIncomingWebhooks - Get incoming webhooks with the uuid of their bot user
+func (iw *IncomingWebhookService) getIncomingWebhooks(ctx context.Context, where string, userEmail string, requestID string, args ...interface{}) ([]*IncomingWebhook, error) {
+	db := iw.DBService.DB
+	webhooks := []*IncomingWebhook{}
+	rows, err := db.QueryContext(ctx, `select
+    iw.id,
+		iw.uuid4,
+		iw.workspace_id,
+		iw.channel_id,
+		iw.display_name,
+		iw.bot_user_id,
+		u.uuid4,
+		iw.max_rate,
+		iw.user_id,
+		iw.statusc,
+		iw.created_at,
+		iw.updated_at,
+		iw.created_day,
+		iw.created_week,
+		iw.created_month,
+		iw.created_year,
+		iw.updated_day,
+		iw.updated_week,
+		iw.updated_month,
+		iw.updated_year from incoming_webhooks iw inner join users u on (iw.bot_user_id = u.id) where `+where+` order by iw.id;`, args...)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9317}).Error(err)
+		return nil, err
+	}
+	for rows.Next() {
+		webhook := IncomingWebhook{}
+		botUUID4 := []byte{}
+		err = rows.Scan(
+			&webhook.ID,
+			&webhook.UUID4,
+			&webhook.WorkspaceID,
+			&webhook.ChannelID,
+			&webhook.DisplayName,
+			&webhook.BotUserID,
+			&botUUID4,
+			&webhook.MaxRate,
+			&webhook.UserID,
+			/*  StatusDates  */
+			&webhook.Statusc,
+			&webhook.CreatedAt,
+			&webhook.UpdatedAt,
+			&webhook.CreatedDay,
+			&webhook.CreatedWeek,
+			&webhook.CreatedMonth,
+			&webhook.CreatedYear,
+			&webhook.UpdatedDay,
+			&webhook.UpdatedWeek,
+			&webhook.UpdatedMonth,
+			&webhook.UpdatedYear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9318}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		webhook.IDS, err = common.UUIDBytesToStr(webhook.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9319}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		webhook.BotUserIDS, err = common.UUIDBytesToStr(botUUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9320}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9321}).Error(err)
+		return nil, err
+	}
+	err = rows.Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9322}).Error(err)
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// RevokeIncomingWebhook - Revoke incoming webhook, its token stops
+// working; the user has to be the creator of the webhook or an admin of
+// its channel
+func (iw *IncomingWebhookService) RevokeIncomingWebhook(ctx context.Context, ID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9323}).Error(err)
+		return err
+	default:
+		uuid4byte, err := common.UUIDStrToBytes(ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9324}).Error(err)
+			return err
+		}
+		webhooks, err := iw.getIncomingWebhooks(ctx, `iw.uuid4 = ? and iw.statusc = ?`, userEmail, requestID, uuid4byte, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9343}).Error(err)
+			return err
+		}
+		if len(webhooks) == 0 {
+			err = errors.New("Incoming webhook not found")
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9344}).Error(err)
+			return err
+		}
+		err = checkTargetAdmin(ctx, iw.DBService, iw.RedisService, iw.UserOptions, webhooks[0].WorkspaceID, webhooks[0].ChannelID, webhooks[0].UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9345}).Error(err)
+			return err
+		}
+		db := iw.DBService.DB
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9325}).Error(err)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `update incoming_webhooks set
+		  statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where id = ?;`,
+			common.Inactive,
+			tn,
+			tnday,
+			tnweek,
+			tnmonth,
+			tnyear,
+			webhooks[0].ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9326}).Error(err)
+			err = tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9327}).Error(err)
+			err = tx.Rollback()
+			return err
+		}
+		return nil
+	}
+}
+
+// PostMessage - post a message into the channel of the incoming webhook
+// identified by token, the message is created by the bot user
+func (iw *IncomingWebhookService) PostMessage(ctx context.Context, token string, form *IncomingWebhookPost, requestID string) (*IncomingWebhookMessage, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 9328}).Error(err)
+		return nil, err
+	default:
+		webhooks, err := iw.getIncomingWebhooks(ctx, `iw.token_hash = ? and iw.statusc = ?`, "", requestID, hashIncomingWebhookToken(token), common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 9329}).Error(err)
+			return nil, err
+		}
+		if len(webhooks) == 0 {
+			err = errors.New("Incoming webhook not found")
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 9330}).Error(err)
+			return nil, err
+		}
+		webhook := webhooks[0]
+		botEmail := webhook.BotUserIDS + "@" + userservices.BotEmailDomain
+
+		err = iw.checkRate(webhook, botEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": botEmail, "reqid": requestID, "msgnum": 9331}).Error(err)
+			return nil, err
+		}
+
+		msgserv := &MessageService{DBService: iw.DBService, RedisService: iw.RedisService, UserOptions: iw.UserOptions}
+		msgform := Message{}
+		msgform.WorkspaceID = webhook.WorkspaceID
+		msgform.ChannelID = webhook.ChannelID
+		msgform.Mtext = form.Text
+		msgform.Mattachs = form.Attachments
+		msg, err := msgserv.CreateMessage(ctx, &msgform, webhook.BotUserIDS, false, botEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": botEmail, "reqid": requestID, "msgnum": 9332}).Error(err)
+			return nil, err
+		}
+
+		displayName := form.DisplayName
+		if displayName == "" {
+			displayName = webhook.DisplayName
+		}
+		webhookMsg, err := iw.createIncomingWebhookMessage(ctx, webhook.ID, msg, displayName, botEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": botEmail, "reqid": requestID, "msgnum": 9333}).Error(err)
+			return nil, err
+		}
+		return webhookMsg, nil
+	}
+}
+
+// createIncomingWebhookMessage - record the display name a message was
+// posted with
+func (iw *IncomingWebhookService) createIncomingWebhookMessage(ctx context.Context, incomingWebhookID uint, msg *Message, displayName string, userEmail string, requestID string) (*IncomingWebhookMessage, error) {
+	var err error
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	webhookMsg := IncomingWebhookMessage{}
+	webhookMsg.UUID4, err = common.GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9334}).Error(err)
+		return nil, err
+	}
+	webhookMsg.IncomingWebhookID = incomingWebhookID
+	webhookMsg.MessageID = msg.ID
+	webhookMsg.DisplayName = displayName
+	webhookMsg.Message = msg
+	/*  StatusDates  */
+	webhookMsg.Statusc = common.Active
+	webhookMsg.CreatedAt = tn
+	webhookMsg.UpdatedAt = tn
+	webhookMsg.CreatedDay = tnday
+	webhookMsg.CreatedWeek = tnweek
+	webhookMsg.CreatedMonth = tnmonth
+	webhookMsg.CreatedYear = tnyear
+	webhookMsg.UpdatedDay = tnday
+	webhookMsg.UpdatedWeek = tnweek
+	webhookMsg.UpdatedMonth = tnmonth
+	webhookMsg.UpdatedYear = tnyear
+
+	db := iw.DBService.DB
+	res, err := db.ExecContext(ctx, `insert into incoming_webhook_messages
+	  (
+			uuid4,
+			incoming_webhook_id,
+			message_id,
+			display_name,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?);`,
+		webhookMsg.UUID4,
+		webhookMsg.IncomingWebhookID,
+		webhookMsg.MessageID,
+		webhookMsg.DisplayName,
+		/*  StatusDates  */
+		webhookMsg.Statusc,
+		webhookMsg.CreatedAt,
+		webhookMsg.UpdatedAt,
+		webhookMsg.CreatedDay,
+		webhookMsg.CreatedWeek,
+		webhookMsg.CreatedMonth,
+		webhookMsg.CreatedYear,
+		webhookMsg.UpdatedDay,
+		webhookMsg.UpdatedWeek,
+		webhookMsg.UpdatedMonth,
+		webhookMsg.UpdatedYear)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9335}).Error(err)
+		return nil, err
+	}
+	uID, err := res.LastInsertId()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9336}).Error(err)
+		return nil, err
+	}
+	webhookMsg.ID = uint(uID)
+	webhookMsg.IDS, err = common.UUIDBytesToStr(webhookMsg.UUID4)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9337}).Error(err)
+		return nil, err
+	}
+	return &webhookMsg, nil
+}
+
+// checkRate - count the post in the current minute of the webhook and
+// fail once the webhook's max rate is exceeded
+func (iw *IncomingWebhookService) checkRate(webhook *IncomingWebhook, userEmail string, requestID string) error {
+	key := fmt.Sprintf("incoming_webhook:%s:%d", webhook.IDS, time.Now().Unix()/60)
+	n, err := iw.RedisService.RedisClient.Incr(key).Result()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9338}).Error(err)
+		return err
+	}
+	if n == 1 {
+		err = iw.RedisService.RedisClient.Expire(key, 2*time.Minute).Err()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9339}).Error(err)
+			return err
+		}
+	}
+	if uint(n) > webhook.MaxRate {
+		return ErrIncomingWebhookRateLimited
+	}
+	return nil
+}
+
+// genIncomingWebhookToken - random token of an incoming webhook url
+func genIncomingWebhookToken() (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashIncomingWebhookToken - only the sha256 of the token is stored
+func hashIncomingWebhookToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,192 @@
+package msgservices
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestIncomingWebhookService_PostMessage(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx := context.Background()
+	incomingWebhookService := NewIncomingWebhookService(dbService, redisService, userOpt)
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	form := IncomingWebhook{}
+	form.ChannelID = uint(1)
+	form.DisplayName = "Build Bot"
+	form.MaxRate = uint(2)
+	webhook, err := incomingWebhookService.CreateIncomingWebhook(ctx, &form, "29ea215b-8fb3-4453-b413-81a661e44495", userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if webhook.Token == "" || webhook.WorkspaceID != uint(2) {
+		t.Errorf("IncomingWebhookService.CreateIncomingWebhook() = %v", webhook)
+		return
+	}
+
+	post := IncomingWebhookPost{Text: "build passed", Attachments: []string{"log.txt", "report.html"}, DisplayName: "CI"}
+	got, err := incomingWebhookService.PostMessage(ctx, webhook.Token, &post, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got.DisplayName != "CI" || got.Message.ChannelID != uint(1) || got.Message.UserID != webhook.BotUserID {
+		t.Errorf("IncomingWebhookService.PostMessage() = %v", got)
+	}
+	if len(got.Message.MessageAttachments) != 2 {
+		t.Errorf("IncomingWebhookService.PostMessage() attachments = %v, want %v", len(got.Message.MessageAttachments), 2)
+	}
+
+	_, err = incomingWebhookService.PostMessage(ctx, "invalid", &post, requestID)
+	if err == nil {
+		t.Errorf("IncomingWebhookService.PostMessage() with an invalid token, want error")
+	}
+
+	_, err = incomingWebhookService.PostMessage(ctx, webhook.Token, &post, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = incomingWebhookService.PostMessage(ctx, webhook.Token, &post, requestID)
+	if err != ErrIncomingWebhookRateLimited {
+		t.Errorf("IncomingWebhookService.PostMessage() error = %v, want %v", err, ErrIncomingWebhookRateLimited)
+	}
+
+	err = incomingWebhookService.RevokeIncomingWebhook(ctx, webhook.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = incomingWebhookService.GetIncomingWebhook(ctx, webhook.IDS, userEmail, requestID)
+	if err == nil {
+		t.Errorf("IncomingWebhookService.GetIncomingWebhook() of a revoked webhook, want error")
+	}
+}
+
+func TestIncomingWebhookService_Access(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx := context.Background()
+	incomingWebhookService := NewIncomingWebhookService(dbService, redisService, userOpt)
+	grantService := NewGrantService(dbService, redisService, userOpt)
+	userID := "29ea215b-8fb3-4453-b413-81a661e44495"
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	// ann is in no ugroup and no admin of the channel
+	annUUID4, err := common.GetUUIDBytes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	annID, err := common.UUIDBytesToStr(annUUID4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = dbService.DB.Exec(`insert into users (id, uuid4, email, username, first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year)
+		select 2, ?, 'ann@example.com', 'ann@example.com', first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year from users where id = 1;`, annUUID4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	form := IncomingWebhook{}
+	form.ChannelID = uint(1)
+	form.DisplayName = "Build Bot"
+	webhook, err := incomingWebhookService.CreateIncomingWebhook(ctx, &form, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = incomingWebhookService.RevokeIncomingWebhook(ctx, webhook.IDS, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("IncomingWebhookService.RevokeIncomingWebhook() error = %v, want %v", err, ErrAccessDenied)
+	}
+
+	_, err = dbService.DB.Exec(`update users set role = ? where id = 1;`, common.SiteAdminRole)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = grantService.CreateGrant(ctx, &UgroupGrant{UgroupID: 2, ChannelID: 1, GrantRole: GrantRead}, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = incomingWebhookService.GetIncomingWebhooks(ctx, uint(1), "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("IncomingWebhookService.GetIncomingWebhooks() error = %v, want %v", err, ErrAccessDenied)
+	}
+	_, err = incomingWebhookService.CreateIncomingWebhook(ctx, &form, annID, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("IncomingWebhookService.CreateIncomingWebhook() error = %v, want %v", err, ErrAccessDenied)
+	}
+	err = incomingWebhookService.RevokeIncomingWebhook(ctx, webhook.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIncomingWebhookService_PostMessageGranted(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx := context.Background()
+	incomingWebhookService := NewIncomingWebhookService(dbService, redisService, userOpt)
+	grantService := NewGrantService(dbService, redisService, userOpt)
+	userID := "29ea215b-8fb3-4453-b413-81a661e44495"
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	_, err = dbService.DB.Exec(`update users set role = ? where id = 1;`, common.SiteAdminRole)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	form := IncomingWebhook{}
+	form.ChannelID = uint(1)
+	form.DisplayName = "Build Bot"
+	webhook, err := incomingWebhookService.CreateIncomingWebhook(ctx, &form, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// the grant restricts the channel, the bot of the webhook is in no ugroup
+	_, err = grantService.CreateGrant(ctx, &UgroupGrant{UgroupID: 2, ChannelID: 1, GrantRole: GrantRead}, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	post := IncomingWebhookPost{Text: "build passed"}
+	got, err := incomingWebhookService.PostMessage(ctx, webhook.Token, &post, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got.Message.ChannelID != uint(1) || got.Message.UserID != webhook.BotUserID {
+		t.Errorf("IncomingWebhookService.PostMessage() = %v", got)
+	}
+}
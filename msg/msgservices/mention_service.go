@@ -0,0 +1,540 @@
+package msgservices
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 12000-12499 */
+
+// Mention types
+const (
+	MentionUser    = "user"
+	MentionChannel = "channel"
+	MentionUgroup  = "ugroup"
+)
+
+// MentionAllName - the name that mentions all the members of the channel
+const MentionAllName = "channel"
+
+// ugroupDepthMax - child groups deeper than this are not resolved
+const ugroupDepthMax = 16
+
+// Mention - a user mentioned in a message
+type Mention struct {
+	ID          uint   `json:"id,omitempty"`
+	UUID4       []byte `json:"-"`
+	IDS         string `json:"id_s,omitempty"`
+	WorkspaceID uint   `json:"workspace_id,omitempty"`
+	ChannelID   uint   `json:"channel_id,omitempty"`
+	MessageID   uint   `json:"message_id,omitempty"`
+	MessageIDS  string `json:"message_id_s,omitempty"`
+	UserID      uint   `json:"user_id,omitempty"`
+	ByUserID    uint   `json:"by_user_id,omitempty"`
+	MentionType string `json:"mention_type,omitempty"`
+	MentionName string `json:"mention_name,omitempty"`
+	IsRead      bool   `json:"is_read"`
+
+	common.StatusDates
+}
+
+// MentionCursor - used to get mentions
+type MentionCursor struct {
+	Mentions   []*Mention
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// MentionCount - the number of unread mentions of a user
+type MentionCount struct {
+	Unread uint `json:"unread"`
+}
+
+// MentionRead - the mentions to mark as read, all the mentions of the
+// user if ChannelID is 0
+type MentionRead struct {
+	ChannelID uint `json:"channel_id,omitempty"`
+}
+
+// MentionServiceIntf - interface for Mention Service
+type MentionServiceIntf interface {
+	GetUserMentions(ctx context.Context, limit string, nextCursor string, unread bool, UserID string, userEmail string, requestID string) (*MentionCursor, error)
+	GetUnreadMentionCount(ctx context.Context, UserID string, userEmail string, requestID string) (*MentionCount, error)
+	MarkMentionsRead(ctx context.Context, form *MentionRead, UserID string, userEmail string, requestID string) error
+}
+
+// MentionService - For accessing mention services
+type MentionService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+}
+
+// NewMentionService - Create mention service
+func NewMentionService(dbOpt *common.DBService, redisOpt *common.RedisService) *MentionService {
+	return &MentionService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+	}
+}
+
+// GetUserMentions - Get the mentions of the user, newest first
+func (mn *MentionService) GetUserMentions(ctx context.Context, limit string, nextCursor string, unread bool, UserID string, userEmail string, requestID string) (*MentionCursor, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12000}).Error(err)
+		return nil, err
+	default:
+		if limit == "" {
+			limit = mn.DBService.LimitSQLRows
+		}
+		limitn, err := strconv.ParseUint(limit, 10, 32)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12001}).Error(err)
+			return nil, errors.New("Invalid limit")
+		}
+		cursor := uint64(1<<32 - 1)
+		if nextCursor != "" {
+			cursor, err = strconv.ParseUint(common.DecodeCursor(nextCursor), 10, 32)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12002}).Error(err)
+				return nil, errors.New("Invalid cursor")
+			}
+		}
+		userserv := &userservices.UserService{DBService: mn.DBService, RedisService: mn.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12003}).Error(err)
+			return nil, err
+		}
+		query := ""
+		if unread {
+			query = " and mm.is_read = 0"
+		}
+
+		db := mn.DBService.DB
+		rows, err := db.QueryContext(ctx, `select
+      mm.id,
+			mm.uuid4,
+			mm.workspace_id,
+			mm.channel_id,
+			mm.message_id,
+			m.uuid4,
+			mm.user_id,
+			mm.by_user_id,
+			mm.mention_type,
+			mm.mention_name,
+			mm.is_read,
+			mm.statusc,
+			mm.created_at,
+			mm.updated_at,
+			mm.created_day,
+			mm.created_week,
+			mm.created_month,
+			mm.created_year,
+			mm.updated_day,
+			mm.updated_week,
+			mm.updated_month,
+			mm.updated_year from message_mentions mm inner join messages m on (mm.message_id = m.id)
+			where mm.user_id = ? and mm.statusc = ? and m.statusc = ? and mm.id <= ?`+query+` order by mm.id desc limit ?;`,
+			user.ID, common.Active, common.Active, cursor, limitn)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12004}).Error(err)
+			return nil, err
+		}
+
+		mentions := []*Mention{}
+		for rows.Next() {
+			mention := Mention{}
+			var messageUUID4 []byte
+			err = rows.Scan(
+				&mention.ID,
+				&mention.UUID4,
+				&mention.WorkspaceID,
+				&mention.ChannelID,
+				&mention.MessageID,
+				&messageUUID4,
+				&mention.UserID,
+				&mention.ByUserID,
+				&mention.MentionType,
+				&mention.MentionName,
+				&mention.IsRead,
+				/*  StatusDates  */
+				&mention.Statusc,
+				&mention.CreatedAt,
+				&mention.UpdatedAt,
+				&mention.CreatedDay,
+				&mention.CreatedWeek,
+				&mention.CreatedMonth,
+				&mention.CreatedYear,
+				&mention.UpdatedDay,
+				&mention.UpdatedWeek,
+				&mention.UpdatedMonth,
+				&mention.UpdatedYear)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12005}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			mention.IDS, err = common.UUIDBytesToStr(mention.UUID4)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12006}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			mention.MessageIDS, err = common.UUIDBytesToStr(messageUUID4)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12007}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			mentions = append(mentions, &mention)
+		}
+		err = rows.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12008}).Error(err)
+			return nil, err
+		}
+
+		err = rows.Err()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12009}).Error(err)
+			return nil, err
+		}
+		x := MentionCursor{Mentions: mentions, NextCursor: "0"}
+		if len(mentions) != 0 {
+			x.NextCursor = common.EncodeCursor(mentions[len(mentions)-1].ID - 1)
+		}
+		return &x, nil
+	}
+}
+
+// GetUnreadMentionCount - Get the number of unread mentions of the user
+func (mn *MentionService) GetUnreadMentionCount(ctx context.Context, UserID string, userEmail string, requestID string) (*MentionCount, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12010}).Error(err)
+		return nil, err
+	default:
+		userserv := &userservices.UserService{DBService: mn.DBService, RedisService: mn.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12011}).Error(err)
+			return nil, err
+		}
+		db := mn.DBService.DB
+		count := MentionCount{}
+		row := db.QueryRowContext(ctx, `select count(*) from message_mentions mm inner join messages m on (mm.message_id = m.id)
+			where mm.user_id = ? and mm.is_read = 0 and mm.statusc = ? and m.statusc = ?;`, user.ID, common.Active, common.Active)
+		err = row.Scan(&count.Unread)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12012}).Error(err)
+			return nil, err
+		}
+		return &count, nil
+	}
+}
+
+// MarkMentionsRead - mark the mentions of the user as read
+func (mn *MentionService) MarkMentionsRead(ctx context.Context, form *MentionRead, UserID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12013}).Error(err)
+		return err
+	default:
+		userserv := &userservices.UserService{DBService: mn.DBService, RedisService: mn.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12014}).Error(err)
+			return err
+		}
+		query := ""
+		args := []interface{}{}
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		args = append(args, tn, tnday, tnweek, tnmonth, tnyear, user.ID)
+		if form.ChannelID != 0 {
+			query = " and channel_id = ?"
+			args = append(args, form.ChannelID)
+		}
+		db := mn.DBService.DB
+		_, err = db.ExecContext(ctx, `update message_mentions set
+		  is_read = 1,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where user_id = ? and is_read = 0`+query+`;`, args...)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12015}).Error(err)
+			return err
+		}
+		return nil
+	}
+}
+
+// createMentions - record the users mentioned in text, a message from
+// msg, users already mentioned in the message are skipped so that an
+// edit does not mention them again. Only members of the channel are
+// mentioned and the author is never mentioned. Returns the new mentions
+func createMentions(ctx context.Context, tx *sql.Tx, msg *Message, text string, userEmail string, requestID string) ([]*Mention, error) {
+	names := common.MarkdownMentions(text)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	members, err := channelMembers(ctx, tx, msg.ChannelID, userEmail, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12016}).Error(err)
+		return nil, err
+	}
+
+	mentions := []*Mention{}
+	seen := map[uint]bool{msg.UserID: true}
+	add := func(userID uint, mentionType string, name string) {
+		if seen[userID] || !members[userID] {
+			return
+		}
+		seen[userID] = true
+		mentions = append(mentions, &Mention{WorkspaceID: msg.WorkspaceID, ChannelID: msg.ChannelID, MessageID: msg.ID, UserID: userID, ByUserID: msg.UserID, MentionType: mentionType, MentionName: name})
+	}
+	for _, name := range names {
+		if name == MentionAllName {
+			for userID := range members {
+				add(userID, MentionChannel, name)
+			}
+			continue
+		}
+		var userID uint
+		row := tx.QueryRowContext(ctx, `select id from users where username = ? and statusc = ?;`, name, common.Active)
+		err = row.Scan(&userID)
+		if err == nil {
+			add(userID, MentionUser, name)
+			continue
+		}
+		if err != sql.ErrNoRows {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12017}).Error(err)
+			return nil, err
+		}
+		userIDs, err := ugroupMembers(ctx, tx, name, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12018}).Error(err)
+			return nil, err
+		}
+		for _, userID := range userIDs {
+			add(userID, MentionUgroup, name)
+		}
+	}
+
+	created := []*Mention{}
+	for _, mention := range mentions {
+		ok, err := insertMention(ctx, tx, mention, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12019}).Error(err)
+			return nil, err
+		}
+		if ok {
+			created = append(created, mention)
+		}
+	}
+	return created, nil
+}
+
+// insertMention - insert the mention unless the user is already
+// mentioned in the message, returns true if it was inserted
+func insertMention(ctx context.Context, tx *sql.Tx, mention *Mention, userEmail string, requestID string) (bool, error) {
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	uuid4, err := common.GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12020}).Error(err)
+		return false, err
+	}
+	mention.UUID4 = uuid4
+	mention.Statusc = common.Active
+	mention.CreatedAt = tn
+	mention.UpdatedAt = tn
+	mention.CreatedDay = tnday
+	mention.CreatedWeek = tnweek
+	mention.CreatedMonth = tnmonth
+	mention.CreatedYear = tnyear
+	mention.UpdatedDay = tnday
+	mention.UpdatedWeek = tnweek
+	mention.UpdatedMonth = tnmonth
+	mention.UpdatedYear = tnyear
+	res, err := tx.ExecContext(ctx, `insert into message_mentions
+	  (
+      uuid4,
+			workspace_id,
+			channel_id,
+			message_id,
+			user_id,
+			by_user_id,
+			mention_type,
+			mention_name,
+			is_read,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?,?,?,?)
+  on duplicate key update id = id;`,
+		mention.UUID4,
+		mention.WorkspaceID,
+		mention.ChannelID,
+		mention.MessageID,
+		mention.UserID,
+		mention.ByUserID,
+		mention.MentionType,
+		mention.MentionName,
+		mention.IsRead,
+		/*  StatusDates  */
+		mention.Statusc,
+		mention.CreatedAt,
+		mention.UpdatedAt,
+		mention.CreatedDay,
+		mention.CreatedWeek,
+		mention.CreatedMonth,
+		mention.CreatedYear,
+		mention.UpdatedDay,
+		mention.UpdatedWeek,
+		mention.UpdatedMonth,
+		mention.UpdatedYear)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12021}).Error(err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12022}).Error(err)
+		return false, err
+	}
+	if n != 1 {
+		return false, nil
+	}
+	uID, err := res.LastInsertId()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12023}).Error(err)
+		return false, err
+	}
+	mention.ID = uint(uID)
+	mention.IDS, err = common.UUIDBytesToStr(mention.UUID4)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12024}).Error(err)
+		return false, err
+	}
+	return true, nil
+}
+
+// channelMembers - the ids of the members of the channel
+func channelMembers(ctx context.Context, tx *sql.Tx, channelID uint, userEmail string, requestID string) (map[uint]bool, error) {
+	rows, err := tx.QueryContext(ctx, `select user_id from user_channels where channel_id = ? and statusc = ?;`, channelID, common.Active)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12025}).Error(err)
+		return nil, err
+	}
+	members := make(map[uint]bool)
+	for rows.Next() {
+		var userID uint
+		err = rows.Scan(&userID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12026}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		members[userID] = true
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12027}).Error(err)
+		return nil, err
+	}
+	return members, nil
+}
+
+// ugroupMembers - the ids of the users of the group named name and of
+// its child groups, nil if there is no such group
+func ugroupMembers(ctx context.Context, tx *sql.Tx, name string, userEmail string, requestID string) ([]uint, error) {
+	var ugroupID uint
+	row := tx.QueryRowContext(ctx, `select id from ugroups where ugroup_name = ? and statusc = ?;`, name, common.Active)
+	err := row.Scan(&ugroupID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12028}).Error(err)
+		return nil, err
+	}
+
+	ugroupIDs := []uint{ugroupID}
+	visited := map[uint]bool{ugroupID: true}
+	level := []uint{ugroupID}
+	for depth := 0; depth < ugroupDepthMax && len(level) > 0; depth++ {
+		next := []uint{}
+		for _, parentID := range level {
+			chdIDs, err := queryIDs(ctx, tx, `select ugroup_chd_id from ugroup_chds where ugroup_id = ? and statusc = ?;`, parentID, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12029}).Error(err)
+				return nil, err
+			}
+			for _, chdID := range chdIDs {
+				if !visited[chdID] {
+					visited[chdID] = true
+					next = append(next, chdID)
+					ugroupIDs = append(ugroupIDs, chdID)
+				}
+			}
+		}
+		level = next
+	}
+
+	userIDs := []uint{}
+	for _, id := range ugroupIDs {
+		ids, err := queryIDs(ctx, tx, `select user_id from ugroups_users where ugroup_id = ? and statusc = ?;`, id, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12030}).Error(err)
+			return nil, err
+		}
+		userIDs = append(userIDs, ids...)
+	}
+	return userIDs, nil
+}
+
+// queryIDs - the ids selected by query for the active rows of id
+func queryIDs(ctx context.Context, tx *sql.Tx, query string, id uint, userEmail string, requestID string) ([]uint, error) {
+	rows, err := tx.QueryContext(ctx, query, id, common.Active)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12031}).Error(err)
+		return nil, err
+	}
+	ids := []uint{}
+	for rows.Next() {
+		var n uint
+		err = rows.Scan(&n)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12032}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		ids = append(ids, n)
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12033}).Error(err)
+		return nil, err
+	}
+	return ids, nil
+}
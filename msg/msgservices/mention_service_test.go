@@ -0,0 +1,106 @@
+package msgservices
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestMentionService_Mentions(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	db := dbService.DB
+	messageService := NewMessageService(dbService, redisService, userOpt)
+	mentionService := NewMentionService(dbService, redisService)
+	userID := "29ea215b-8fb3-4453-b413-81a661e44495"
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	// ann is a member of the channel and of subugroup1, a child of ugroup1
+	annUUID4, err := common.GetUUIDBytes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	annID, err := common.UUIDBytesToStr(annUUID4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, q := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{`insert into users (id, uuid4, email, username, first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year)
+			select 2, ?, 'ann@example.com', 'ann', 'Ann', last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year from users where id = 1;`, []interface{}{annUUID4}},
+		{`insert into user_channels (channel_id, ugroup_id, user_id, statusc) values (1, 0, 2, 1);`, nil},
+		{`insert into ugroups_users (ugroup_id, user_id, statusc) values (2, 2, 1);`, nil},
+	} {
+		_, err = db.Exec(q.query, q.args...)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	form := Message{}
+	form.WorkspaceID = uint(2)
+	form.ChannelID = uint(1)
+	form.Mtext = "hi @ann and @abcd145@gmail.com"
+	msg, err := messageService.CreateMessage(ctx, &form, userID, false, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(msg.Mentions) != 1 || msg.Mentions[0].UserID != 2 || msg.Mentions[0].MentionType != MentionUser {
+		t.Errorf("MessageService.CreateMessage() mentions = %v, want ann", msg.Mentions)
+	}
+
+	form.Mtext = "@ann @channel again"
+	err = messageService.UpdateMessage(ctx, msg.IDS, &form, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	form.Mtext = "ping `@ann` @ugroup1"
+	msg2, err := messageService.CreateMessage(ctx, &form, userID, false, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(msg2.Mentions) != 1 || msg2.Mentions[0].MentionType != MentionUgroup {
+		t.Errorf("MessageService.CreateMessage() mentions = %v, want ugroup1", msg2.Mentions)
+	}
+
+	mentions, err := mentionService.GetUserMentions(ctx, "10", "", true, annID, "ann@example.com", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(mentions.Mentions) != 2 || mentions.Mentions[0].MessageIDS != msg2.IDS || mentions.Mentions[1].MessageIDS != msg.IDS {
+		t.Errorf("MentionService.GetUserMentions() = %v", mentions.Mentions)
+	}
+	count, err := mentionService.GetUnreadMentionCount(ctx, annID, "ann@example.com", requestID)
+	if err != nil || count.Unread != 2 {
+		t.Errorf("MentionService.GetUnreadMentionCount() = %v, %v, want 2", count, err)
+	}
+
+	err = mentionService.MarkMentionsRead(ctx, &MentionRead{ChannelID: 1}, annID, "ann@example.com", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	count, err = mentionService.GetUnreadMentionCount(ctx, annID, "ann@example.com", requestID)
+	if err != nil || count.Unread != 0 {
+		t.Errorf("MentionService.GetUnreadMentionCount() = %v, %v, want 0", count, err)
+	}
+}
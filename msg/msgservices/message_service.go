@@ -25,6 +25,9 @@ type Message struct {
 	UUID4 []byte `json:"-"`
 	IDS   string `json:"id_s,omitempty"`
 
+	// Ephemeral is set on command replies shown only to the sender
+	Ephemeral bool `json:"ephemeral,omitempty"`
+
 	NumLikes     uint `json:"num_likes,omitempty"`
 	NumUpvotes   uint `json:"num_upvotes,omitempty"`
 	NumDownvotes uint `json:"num_downvotes,omitempty"`
@@ -38,10 +41,13 @@ type Message struct {
 
 	MessageTexts       []*MessageText
 	MessageAttachments []*MessageAttachment
+	Mentions           []*Mention `json:"mentions,omitempty"`
 
 	//only for logic purpose to create message
-	Mtext   string
-	Mattach string
+	Mtext    string
+	Mattach  string
+	Mattachs []string
+	Uploads  []string
 }
 
 // MessageText - MessageText view representation
@@ -49,6 +55,7 @@ type MessageText struct {
 	ID          uint   `json:"id,omitempty"`
 	UUID4       []byte `json:"-"`
 	Mtext       string `json:"mtext,omitempty"`
+	Mhtml       string `json:"mhtml,omitempty"`
 	WorkspaceID uint   `json:"workspace_id,omitempty"`
 	ChannelID   uint   `json:"channel_id,omitempty"`
 	MessageID   uint   `json:"message_id,omitempty"`
@@ -69,6 +76,18 @@ type MessageAttachment struct {
 	UserID      uint   `json:"user_id,omitempty"`
 	UgroupID    uint   `json:"ugroup_id,omitempty"`
 
+	// metadata of uploaded files, filled in by the attachment worker
+	UploadID      uint   `json:"-"`
+	ContentType   string `json:"content_type,omitempty"`
+	FileSize      int64  `json:"file_size,omitempty"`
+	Width         uint   `json:"width,omitempty"`
+	Height        uint   `json:"height,omitempty"`
+	ThumbnailKey  string `json:"-"`
+	ThumbnailURL  string `json:"thumbnail_url,omitempty"`
+	PageCount     uint   `json:"page_count,omitempty"`
+	FirstPageText string `json:"first_page_text,omitempty"`
+	MetaStatus    uint   `json:"meta_status,omitempty"`
+
 	common.StatusDates
 }
 
@@ -124,19 +143,24 @@ type MessageServiceIntf interface {
 
 // MessageService - For accessing message services
 type MessageService struct {
-	DBService    *common.DBService
-	RedisService *common.RedisService
+	DBService      *common.DBService
+	RedisService   *common.RedisService
+	UserOptions    *common.UserOptions
+	CommandService *CommandService
 }
 
 // NewMessageService - Create message service
-func NewMessageService(dbOpt *common.DBService, redisOpt *common.RedisService) *MessageService {
+func NewMessageService(dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions) *MessageService {
 	return &MessageService{
-		DBService:    dbOpt,
-		RedisService: redisOpt,
+		DBService:      dbOpt,
+		RedisService:   redisOpt,
+		UserOptions:    userOpt,
+		CommandService: NewCommandService(dbOpt, redisOpt, userOpt),
 	}
 }
 
-//CreateMessage - Create message
+//CreateMessage - Create message, a message starting with /name is run
+// as a command when a command of that name exists
 func (m *MessageService) CreateMessage(ctx context.Context, form *Message, UserID string, rplymsg bool, userEmail string, requestID string) (*Message, error) {
 	select {
 	case <-ctx.Done():
@@ -144,6 +168,21 @@ func (m *MessageService) CreateMessage(ctx context.Context, form *Message, UserI
 		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6300}).Error(err)
 		return nil, err
 	default:
+		err := checkChannelAccess(ctx, m.DBService, m.RedisService, m.UserOptions, form.ChannelID, GrantPost, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6445}).Error(err)
+			return nil, err
+		}
+		if m.CommandService != nil && !rplymsg {
+			cmdmsg, ok, err := m.CommandService.RunCommand(ctx, form, UserID, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6437}).Error(err)
+				return nil, err
+			}
+			if ok {
+				return cmdmsg, nil
+			}
+		}
 		db := m.DBService.DB
 
 		insertMessageStmt, insertMessageTextStmt, insertMessageAttachmentStmt, updateNumMessagesStmt, insertUserReplyStmt, err := m.createMessagePrepareStmts(ctx, userEmail, requestID)
@@ -192,6 +231,9 @@ func (m *MessageService) CreateMessage(ctx context.Context, form *Message, UserI
 			return nil, err
 		}
 
+		emitWebhookEvent(ctx, m.DBService, m.RedisService, m.UserOptions, msg.WorkspaceID, msg.ChannelID, EventMessageCreated, msg, userEmail, requestID)
+		notifyMessage(ctx, m.DBService, m.RedisService, msg, form.Mtext, rplymsg, userEmail, requestID)
+
 		return msg, nil
 	}
 
@@ -335,7 +377,38 @@ func (m *MessageService) createMessage(ctx context.Context, stmt *sql.Stmt, inse
 			}
 			msg.MessageAttachments = append(msg.MessageAttachments, msgattach)
 		}
-		channelserv := &ChannelService{DBService: m.DBService, RedisService: m.RedisService}
+		for _, mattach := range form.Mattachs {
+			attachform := *form
+			attachform.Mattach = mattach
+			msgattach, err := m.createMessageAttachment(ctx, insertMessageAttachmentStmt, tx, &attachform, msg.ID, user.ID, userEmail, requestID)
+
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6436}).Error(err)
+				return nil, err
+			}
+			msg.MessageAttachments = append(msg.MessageAttachments, msgattach)
+		}
+		for _, uploadID := range form.Uploads {
+			upload, err := linkUpload(ctx, tx, uploadID, msg.ChannelID, user.ID, msg.ID, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6438}).Error(err)
+				return nil, err
+			}
+			attachform := *form
+			attachform.Mattach = upload.URL
+			msgattach, err := m.createMessageAttachment(ctx, insertMessageAttachmentStmt, tx, &attachform, msg.ID, user.ID, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6439}).Error(err)
+				return nil, err
+			}
+			err = setAttachmentUpload(ctx, tx, msgattach, upload, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6440}).Error(err)
+				return nil, err
+			}
+			msg.MessageAttachments = append(msg.MessageAttachments, msgattach)
+		}
+		channelserv := &ChannelService{DBService: m.DBService, RedisService: m.RedisService, UserOptions: m.UserOptions}
 		channel, err := channelserv.GetChannelByID(ctx, form.ChannelID, userEmail, requestID)
 		if err != nil {
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6328}).Error(err)
@@ -358,6 +431,12 @@ func (m *MessageService) createMessage(ctx context.Context, stmt *sql.Stmt, inse
 			}
 		}
 
+		msg.Mentions, err = createMentions(ctx, tx, &msg, form.Mtext, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6441}).Error(err)
+			return nil, err
+		}
+
 		return &msg, nil
 	}
 }
@@ -469,6 +548,7 @@ func (m *MessageService) createMessageText(ctx context.Context, stmt *sql.Stmt,
 		msgtxt := MessageText{}
 		msgtxt.UUID4 = uuid4
 		msgtxt.Mtext = form.Mtext
+		msgtxt.Mhtml = common.RenderMarkdown(form.Mtext)
 		msgtxt.WorkspaceID = form.WorkspaceID
 		msgtxt.ChannelID = form.ChannelID
 		msgtxt.MessageID = messageID
@@ -509,6 +589,7 @@ func (m *MessageService) insertMessageTextPrepare(ctx context.Context, userEmail
 	  ( 
       uuid4,
 			mtext,
+			mhtml,
 			workspace_id,
 			channel_id,
 			message_id,
@@ -526,7 +607,7 @@ func (m *MessageService) insertMessageTextPrepare(ctx context.Context, userEmail
 			updated_month,
 			updated_year)
   values (?,?,?,?,?,?,?,?,?,?,
-					?,?,?,?,?,?,?,?);`)
+					?,?,?,?,?,?,?,?,?);`)
 		if err != nil {
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6341}).Error(err)
 			return nil, err
@@ -546,6 +627,7 @@ func (m *MessageService) insertMessageText(ctx context.Context, stmt *sql.Stmt,
 		res, err := tx.StmtContext(ctx, stmt).Exec(
 			msgtxt.UUID4,
 			msgtxt.Mtext,
+			msgtxt.Mhtml,
 			msgtxt.WorkspaceID,
 			msgtxt.ChannelID,
 			msgtxt.MessageID,
@@ -891,6 +973,11 @@ func (m *MessageService) CreateUserLike(ctx context.Context, form *UserLike, Use
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6362}).Error(err)
 			return nil, err
 		}
+		err = checkChannelAccess(ctx, m.DBService, m.RedisService, m.UserOptions, form.ChannelID, GrantRead, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6446}).Error(err)
+			return nil, err
+		}
 		db := m.DBService.DB
 		insertUserLikeStmt, err := m.insertUserLikePrepare(ctx, userEmail, requestID)
 		if err != nil {
@@ -956,6 +1043,7 @@ func (m *MessageService) CreateUserLike(ctx context.Context, form *UserLike, Use
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6370}).Error(err)
 			return nil, err
 		}
+		notifyReaction(ctx, m.DBService, m.RedisService, ul.MessageID, user.ID, userEmail, requestID)
 		return &ul, nil
 	}
 }
@@ -1052,6 +1140,11 @@ func (m *MessageService) CreateUserVote(ctx context.Context, form *UserVote, Use
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6377}).Error(err)
 			return nil, err
 		}
+		err = checkChannelAccess(ctx, m.DBService, m.RedisService, m.UserOptions, form.ChannelID, GrantRead, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6447}).Error(err)
+			return nil, err
+		}
 		db := m.DBService.DB
 		insertUserVoteStmt, err := m.insertUserVotePrepare(ctx, userEmail, requestID)
 		if err != nil {
@@ -1133,6 +1226,7 @@ func (m *MessageService) CreateUserVote(ctx context.Context, form *UserVote, Use
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6388}).Error(err)
 			return nil, err
 		}
+		notifyReaction(ctx, m.DBService, m.RedisService, ul.MessageID, user.ID, userEmail, requestID)
 		return &ul, nil
 	}
 }
@@ -1282,6 +1376,11 @@ func (m *MessageService) GetMessage(ctx context.Context, ID string, userEmail st
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6396}).Error(err)
 			return nil, err
 		}
+		err = checkChannelAccess(ctx, m.DBService, m.RedisService, m.UserOptions, msg.ChannelID, GrantRead, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6448}).Error(err)
+			return nil, err
+		}
 		uuid4Str, err := common.UUIDBytesToStr(msg.UUID4)
 		if err != nil {
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6397}).Error(err)
@@ -1380,6 +1479,7 @@ func (m *MessageService) GetMessagesTexts(ctx context.Context, messageID uint, u
         id,
         uuid4,
 				mtext,
+				ifnull(mhtml, ''),
 				workspace_id,
 				channel_id,
 				message_id,
@@ -1407,6 +1507,7 @@ func (m *MessageService) GetMessagesTexts(ctx context.Context, messageID uint, u
 			&msgtxt.ID,
 			&msgtxt.UUID4,
 			&msgtxt.Mtext,
+			&msgtxt.Mhtml,
 			&msgtxt.WorkspaceID,
 			&msgtxt.ChannelID,
 			&msgtxt.MessageID,
@@ -1427,6 +1528,12 @@ func (m *MessageService) GetMessagesTexts(ctx context.Context, messageID uint, u
 
 		if err != nil {
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6408}).Error(err)
+			_ = rows.Close()
+			return nil, err
+		}
+		if msgtxt.Mhtml == "" && msgtxt.Mtext != "" {
+			// texts stored before markdown rendering
+			msgtxt.Mhtml = common.RenderMarkdown(msgtxt.Mtext)
 		}
 
 		mtexts = append(mtexts, &msgtxt)
@@ -1453,6 +1560,15 @@ func (m *MessageService) GetMessageAttachments(ctx context.Context, messageID ui
 				message_id,
 				ugroup_id,
 				user_id,
+				upload_id,
+				content_type,
+				file_size,
+				width,
+				height,
+				thumbnail_key,
+				page_count,
+				first_page_text,
+				meta_status,
 				statusc,
 				created_at,
 				updated_at,
@@ -1479,6 +1595,15 @@ func (m *MessageService) GetMessageAttachments(ctx context.Context, messageID ui
 			&msgath.MessageID,
 			&msgath.UgroupID,
 			&msgath.UserID,
+			&msgath.UploadID,
+			&msgath.ContentType,
+			&msgath.FileSize,
+			&msgath.Width,
+			&msgath.Height,
+			&msgath.ThumbnailKey,
+			&msgath.PageCount,
+			&msgath.FirstPageText,
+			&msgath.MetaStatus,
 			/*  StatusDates  */
 			&msgath.Statusc,
 			&msgath.CreatedAt,
@@ -1495,6 +1620,9 @@ func (m *MessageService) GetMessageAttachments(ctx context.Context, messageID ui
 		if err != nil {
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6411}).Error(err)
 		}
+		if msgath.ThumbnailKey != "" {
+			msgath.ThumbnailURL = msgath.Mattach + UploadThumbnailSuffix
+		}
 
 		messageAttachments = append(messageAttachments, &msgath)
 	}
@@ -1520,12 +1648,19 @@ func (m *MessageService) UpdateMessage(ctx context.Context, ID string, form *Mes
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6414}).Error(err)
 			return err
 		}
+		// the author edits with post, others need moderate
+		err = checkChannelAccess(ctx, m.DBService, m.RedisService, m.UserOptions, msg.ChannelID, GrantModerate, msg.UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6449}).Error(err)
+			return err
+		}
 
 		db := m.DBService.DB
 
 		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
 		stmt, err := db.PrepareContext(ctx, `update message_texts set 
 		  mtext = ?,
+			mhtml = ?,
 			updated_at = ?, 
 			updated_day = ?, 
 			updated_week = ?, 
@@ -1544,6 +1679,7 @@ func (m *MessageService) UpdateMessage(ctx context.Context, ID string, form *Mes
 
 		_, err = tx.StmtContext(ctx, stmt).Exec(
 			form.Mtext,
+			common.RenderMarkdown(form.Mtext),
 			tn,
 			tnday,
 			tnweek,
@@ -1566,6 +1702,22 @@ func (m *MessageService) UpdateMessage(ctx context.Context, ID string, form *Mes
 			return err
 		}
 
+		msg.Mentions, err = createMentions(ctx, tx, msg, form.Mtext, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6442}).Error(err)
+			err = tx.Rollback()
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6443}).Error(err)
+				return err
+			}
+			err = stmt.Close()
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6444}).Error(err)
+				return err
+			}
+			return errors.New("Could not record mentions")
+		}
+
 		err = tx.Commit()
 		if err != nil {
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6420}).Error(err)
@@ -1577,6 +1729,10 @@ func (m *MessageService) UpdateMessage(ctx context.Context, ID string, form *Mes
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6421}).Error(err)
 			return err
 		}
+
+		msg.Mtext = form.Mtext
+		emitWebhookEvent(ctx, m.DBService, m.RedisService, m.UserOptions, msg.WorkspaceID, msg.ChannelID, EventMessageUpdated, msg, userEmail, requestID)
+		notifyMessage(ctx, m.DBService, m.RedisService, msg, form.Mtext, false, userEmail, requestID)
 		return nil
 	}
 }
@@ -1594,6 +1750,16 @@ func (m *MessageService) DeleteMessage(ctx context.Context, ID string, userEmail
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6423}).Error(err)
 			return err
 		}
+		msg, err := m.GetMessage(ctx, ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6435}).Error(err)
+			return err
+		}
+		err = checkChannelAccess(ctx, m.DBService, m.RedisService, m.UserOptions, msg.ChannelID, GrantModerate, msg.UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6450}).Error(err)
+			return err
+		}
 		db := m.DBService.DB
 		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
 		stmt, err := db.PrepareContext(ctx, `update messages set 
@@ -1648,6 +1814,8 @@ func (m *MessageService) DeleteMessage(ctx context.Context, ID string, userEmail
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 6430}).Error(err)
 			return err
 		}
+
+		emitWebhookEvent(ctx, m.DBService, m.RedisService, m.UserOptions, msg.WorkspaceID, msg.ChannelID, EventMessageDeleted, msg, userEmail, requestID)
 		return nil
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cloudfresco/vilom/common"
 	"github.com/cloudfresco/vilom/testhelpers"
 )
 
@@ -23,7 +24,7 @@ func TestMessageService_GetMessage(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	messageService := NewMessageService(dbService, redisService)
+	messageService := NewMessageService(dbService, redisService, userOpt)
 	msg := Message{}
 	msg.ID = uint(1)
 	msg.UUID4 = []byte{137, 25, 62, 199, 70, 158, 69, 128, 139, 206, 230, 140, 235, 90, 162, 1}
@@ -51,6 +52,7 @@ func TestMessageService_GetMessage(t *testing.T) {
 	msgtxt.ID = uint(1)
 	msgtxt.UUID4 = []byte{148, 157, 162, 242, 107, 10, 67, 245, 165, 223, 218, 71, 208, 232, 206, 72}
 	msgtxt.Mtext = "Hi. I am looking into buying a Floptical Drive, and was wondering what experience people have with the drives from Iomega, PLI, MASS MicroSystems, or Procom. These seem to be the main drives on the market. Any advice? Also, I heard about some article in MacWorld about Flopticals. Could someone post a summary, if they have it? Thanks in advance"
+	msgtxt.Mhtml = "<p>Hi. I am looking into buying a Floptical Drive, and was wondering what experience people have with the drives from Iomega, PLI, MASS MicroSystems, or Procom. These seem to be the main drives on the market. Any advice? Also, I heard about some article in MacWorld about Flopticals. Could someone post a summary, if they have it? Thanks in advance</p>"
 	msgtxt.WorkspaceID = uint(2)
 	msgtxt.ChannelID = uint(1)
 	msgtxt.MessageID = uint(1)
@@ -143,7 +145,7 @@ func TestMessageService_GetMessagesWithTextAttach(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	messageService := NewMessageService(dbService, redisService)
+	messageService := NewMessageService(dbService, redisService, userOpt)
 	messages := []*Message{}
 	opMessages := []*Message{}
 	msg := Message{}
@@ -175,6 +177,7 @@ func TestMessageService_GetMessagesWithTextAttach(t *testing.T) {
 	msgtxt.ID = uint(1)
 	msgtxt.UUID4 = []byte{148, 157, 162, 242, 107, 10, 67, 245, 165, 223, 218, 71, 208, 232, 206, 72}
 	msgtxt.Mtext = "Hi. I am looking into buying a Floptical Drive, and was wondering what experience people have with the drives from Iomega, PLI, MASS MicroSystems, or Procom. These seem to be the main drives on the market. Any advice? Also, I heard about some article in MacWorld about Flopticals. Could someone post a summary, if they have it? Thanks in advance"
+	msgtxt.Mhtml = "<p>Hi. I am looking into buying a Floptical Drive, and was wondering what experience people have with the drives from Iomega, PLI, MASS MicroSystems, or Procom. These seem to be the main drives on the market. Any advice? Also, I heard about some article in MacWorld about Flopticals. Could someone post a summary, if they have it? Thanks in advance</p>"
 	msgtxt.WorkspaceID = uint(2)
 	msgtxt.ChannelID = uint(1)
 	msgtxt.MessageID = uint(1)
@@ -270,13 +273,14 @@ func TestMessageService_GetMessagesTexts(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	messageService := NewMessageService(dbService, redisService)
+	messageService := NewMessageService(dbService, redisService, userOpt)
 
 	msgtxt := MessageText{}
 	msgtxts := []*MessageText{}
 	msgtxt.ID = uint(1)
 	msgtxt.UUID4 = []byte{148, 157, 162, 242, 107, 10, 67, 245, 165, 223, 218, 71, 208, 232, 206, 72}
 	msgtxt.Mtext = "Hi. I am looking into buying a Floptical Drive, and was wondering what experience people have with the drives from Iomega, PLI, MASS MicroSystems, or Procom. These seem to be the main drives on the market. Any advice? Also, I heard about some article in MacWorld about Flopticals. Could someone post a summary, if they have it? Thanks in advance"
+	msgtxt.Mhtml = "<p>Hi. I am looking into buying a Floptical Drive, and was wondering what experience people have with the drives from Iomega, PLI, MASS MicroSystems, or Procom. These seem to be the main drives on the market. Any advice? Also, I heard about some article in MacWorld about Flopticals. Could someone post a summary, if they have it? Thanks in advance</p>"
 	msgtxt.WorkspaceID = uint(2)
 	msgtxt.ChannelID = uint(1)
 	msgtxt.MessageID = uint(1)
@@ -334,6 +338,36 @@ func TestMessageService_GetMessagesTexts(t *testing.T) {
 	}
 }
 
+func TestMessageService_GetMessagesTextsNullHTML(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	messageService := NewMessageService(dbService, redisService, userOpt)
+
+	// a text stored before markdown rendering has no mhtml
+	_, err = dbService.DB.Exec(`update message_texts set mtext = ?, mhtml = NULL where id = 1;`, "**old** text")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	got, err := messageService.GetMessagesTexts(ctx, uint(1), "abcd145@gmail.com", "bks1m1g91jau4nkks2f0")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(got) != 1 {
+		t.Errorf("MessageService.GetMessagesTexts() = %v, want one text", got)
+		return
+	}
+	if got[0].Mhtml != common.RenderMarkdown("**old** text") || got[0].WorkspaceID != 2 || got[0].ChannelID != 1 || got[0].MessageID != 1 || got[0].UpdatedYear != 2019 {
+		t.Errorf("MessageService.GetMessagesTexts() = %v, want the rendered text with all the fields", got[0])
+	}
+}
+
 func TestMessageService_GetMessageAttachments(t *testing.T) {
 	var err error
 	err = testhelpers.LoadSQL(dbService)
@@ -348,7 +382,7 @@ func TestMessageService_GetMessageAttachments(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	messageService := NewMessageService(dbService, redisService)
+	messageService := NewMessageService(dbService, redisService, userOpt)
 
 	msgaths := []*MessageAttachment{}
 	msgath := MessageAttachment{}
@@ -420,7 +454,7 @@ func TestMessageService_UpdateMessage(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	messageService := NewMessageService(dbService, redisService)
+	messageService := NewMessageService(dbService, redisService, userOpt)
 
 	form1 := Message{}
 	form1.Mtext = "Messagetext2"
@@ -467,7 +501,7 @@ func TestMessageService_DeleteMessage(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	messageService := NewMessageService(dbService, redisService)
+	messageService := NewMessageService(dbService, redisService, userOpt)
 	type args struct {
 		ctx       context.Context
 		ID        string
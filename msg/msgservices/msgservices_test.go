@@ -24,6 +24,11 @@ func TestMain(m *testing.M) {
 		log.Fatal(err)
 	}
 	Layout = "2006-01-02T15:04:05Z"
+	// the webhook and command tests post to httptest servers on loopback
+	err = common.SetOutboundOpt(&common.OutboundOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	os.Exit(m.Run())
 
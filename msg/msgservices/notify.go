@@ -0,0 +1,93 @@
+package msgservices
+
+import (
+	"context"
+	"database/sql"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 13000-13099 */
+
+// notifyMessage - notify the users mentioned in the message, and the
+// starter of the channel when the message is a reply
+func notifyMessage(ctx context.Context, dbOpt *common.DBService, redisOpt *common.RedisService, msg *Message, text string, rplymsg bool, userEmail string, requestID string) {
+	ntext := common.MarkdownText(text)
+	notifications := []*userservices.Notification{}
+	notified := make(map[uint]bool)
+	for _, mention := range msg.Mentions {
+		if notified[mention.UserID] {
+			continue
+		}
+		notified[mention.UserID] = true
+		notifications = append(notifications, &userservices.Notification{
+			UserID:      mention.UserID,
+			Ntype:       userservices.NotificationMention,
+			ActorID:     msg.UserID,
+			WorkspaceID: msg.WorkspaceID,
+			ChannelID:   msg.ChannelID,
+			MessageID:   msg.ID,
+			Ntext:       ntext,
+		})
+	}
+	if rplymsg {
+		var channelUserID uint
+		row := dbOpt.DB.QueryRowContext(ctx, `select user_id from channels where id = ?;`, msg.ChannelID)
+		err := row.Scan(&channelUserID)
+		if err != nil && err != sql.ErrNoRows {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13000}).Error(err)
+		}
+		if channelUserID != 0 && !notified[channelUserID] {
+			notifications = append(notifications, &userservices.Notification{
+				UserID:      channelUserID,
+				Ntype:       userservices.NotificationReply,
+				ActorID:     msg.UserID,
+				WorkspaceID: msg.WorkspaceID,
+				ChannelID:   msg.ChannelID,
+				MessageID:   msg.ID,
+				Ntext:       ntext,
+			})
+		}
+	}
+	userservices.Notify(ctx, dbOpt, redisOpt, notifications, userEmail, requestID)
+}
+
+// notifyReaction - notify the author of the message that actorID liked
+// or voted on it
+func notifyReaction(ctx context.Context, dbOpt *common.DBService, redisOpt *common.RedisService, messageID uint, actorID uint, userEmail string, requestID string) {
+	n := userservices.Notification{
+		Ntype:     userservices.NotificationReaction,
+		ActorID:   actorID,
+		MessageID: messageID,
+	}
+	row := dbOpt.DB.QueryRowContext(ctx, `select user_id, workspace_id, channel_id from messages where id = ?;`, messageID)
+	err := row.Scan(&n.UserID, &n.WorkspaceID, &n.ChannelID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13001}).Error(err)
+		return
+	}
+	userservices.Notify(ctx, dbOpt, redisOpt, []*userservices.Notification{&n}, userEmail, requestID)
+}
+
+// notifyChannelInvite - notify userID that the user with userEmail added
+// them to the channel
+func notifyChannelInvite(ctx context.Context, dbOpt *common.DBService, redisOpt *common.RedisService, channel *Channel, userID uint, userEmail string, requestID string) {
+	userserv := &userservices.UserService{DBService: dbOpt, RedisService: redisOpt}
+	actor, err := userserv.GetUserByEmail(ctx, userEmail, userEmail, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13002}).Error(err)
+		return
+	}
+	n := userservices.Notification{
+		UserID:      userID,
+		Ntype:       userservices.NotificationChannelInvite,
+		ActorID:     actor.ID,
+		WorkspaceID: channel.WorkspaceID,
+		ChannelID:   channel.ID,
+		Ntext:       channel.ChannelName,
+	}
+	userservices.Notify(ctx, dbOpt, redisOpt, []*userservices.Notification{&n}, userEmail, requestID)
+}
@@ -0,0 +1,92 @@
+package msgservices
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	"github.com/cloudfresco/vilom/user/userservices"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestNotify_Mentions(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	db := dbService.DB
+	messageService := NewMessageService(dbService, redisService, userOpt)
+	notificationService := userservices.NewNotificationService(dbService, redisService)
+	userID := "29ea215b-8fb3-4453-b413-81a661e44495"
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	annUUID4, err := common.GetUUIDBytes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	annID, err := common.UUIDBytesToStr(annUUID4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, q := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{`insert into users (id, uuid4, email, username, first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year)
+			select 2, ?, 'ann@example.com', 'ann', 'Ann', last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year from users where id = 1;`, []interface{}{annUUID4}},
+		{`insert into user_channels (channel_id, ugroup_id, user_id, statusc) values (1, 0, 2, 1);`, nil},
+	} {
+		_, err = db.Exec(q.query, q.args...)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	form := Message{}
+	form.WorkspaceID = uint(2)
+	form.ChannelID = uint(1)
+	form.Mtext = "**hi** @ann"
+	_, err = messageService.CreateMessage(ctx, &form, userID, false, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	notifications, err := notificationService.GetNotifications(ctx, "10", "", true, annID, "ann@example.com", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(notifications.Notifications) != 1 || notifications.Notifications[0].Ntype != userservices.NotificationMention || notifications.Notifications[0].Ntext != "hi @ann" {
+		t.Errorf("NotificationService.GetNotifications() = %v", notifications.Notifications)
+		return
+	}
+
+	err = notificationService.UpdateNotificationPrefs(ctx, []*userservices.NotificationPref{{Ntype: userservices.NotificationMention, Enabled: false}}, annID, "ann@example.com", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = messageService.CreateMessage(ctx, &form, userID, false, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = notificationService.MarkNotificationRead(ctx, notifications.Notifications[0].IDS, annID, "ann@example.com", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	notifications, err = notificationService.GetNotifications(ctx, "10", "", true, annID, "ann@example.com", requestID)
+	if err != nil || len(notifications.Notifications) != 0 {
+		t.Errorf("NotificationService.GetNotifications() = %v, %v, want none unread", notifications, err)
+	}
+}
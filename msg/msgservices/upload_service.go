@@ -0,0 +1,625 @@
+package msgservices
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 11100-11499 */
+
+// For validation of Upload fields
+const (
+	FileNameLenMin = 1
+	FileNameLenMax = 255
+)
+
+// UploadURLPrefix - path of the authenticated download url of an upload,
+// followed by its id
+const UploadURLPrefix = "/v0.1/uploads/"
+
+// UploadThumbnailSuffix - added to the download url of an image upload
+// for its thumbnail
+const UploadThumbnailSuffix = "/thumbnail"
+
+// DefaultMaxUploadSize - used when neither the config nor the workspace
+// sets a limit
+const DefaultMaxUploadSize = 25 << 20
+
+// ErrUploadTooLarge - the file is larger than the limit of the workspace
+var ErrUploadTooLarge = errors.New("Upload exceeds the size limit of the workspace")
+
+// Upload - Upload view representation, a stored file that is attached
+// to a message once the message is created
+type Upload struct {
+	ID          uint   `json:"id,omitempty"`
+	UUID4       []byte `json:"-"`
+	IDS         string `json:"id_s,omitempty"`
+	WorkspaceID uint   `json:"workspace_id,omitempty"`
+	ChannelID   uint   `json:"channel_id,omitempty"`
+	MessageID   uint   `json:"message_id,omitempty"`
+	UserID      uint   `json:"user_id,omitempty"`
+	FileName    string `json:"file_name,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	FileSize    int64  `json:"file_size,omitempty"`
+	Checksum    string `json:"checksum,omitempty"`
+	BlobKey     string `json:"-"`
+	URL         string `json:"url,omitempty"`
+
+	common.StatusDates
+}
+
+// UploadLimit - the upload size limit of a workspace
+type UploadLimit struct {
+	WorkspaceID   uint  `json:"workspace_id,omitempty"`
+	MaxUploadSize int64 `json:"max_upload_size,omitempty"`
+}
+
+// UploadServiceIntf - interface for Upload Service
+type UploadServiceIntf interface {
+	CreateUpload(ctx context.Context, ChannelID string, fileName string, r io.Reader, UserID string, userEmail string, requestID string) (*Upload, error)
+	GetUpload(ctx context.Context, ID string, UserID string, userEmail string, requestID string) (*Upload, error)
+	OpenUpload(ctx context.Context, ID string, UserID string, userEmail string, requestID string) (*Upload, io.ReadCloser, error)
+	OpenThumbnail(ctx context.Context, ID string, UserID string, userEmail string, requestID string) (*Upload, io.ReadCloser, error)
+	GetUploadLimit(ctx context.Context, workspaceID uint, userEmail string, requestID string) (int64, error)
+	SetUploadLimit(ctx context.Context, form *UploadLimit, userEmail string, requestID string) error
+}
+
+// UploadService - For accessing upload services
+type UploadService struct {
+	DBService     *common.DBService
+	RedisService  *common.RedisService
+	UserOptions   *common.UserOptions
+	BlobStore     common.BlobStore
+	MaxUploadSize int64
+}
+
+// NewUploadService - Create upload service, maxUploadSize is the limit
+// of the workspaces that do not set one
+func NewUploadService(dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions, blobStore common.BlobStore, maxUploadSize int64) *UploadService {
+	if maxUploadSize <= 0 {
+		maxUploadSize = DefaultMaxUploadSize
+	}
+	return &UploadService{
+		DBService:     dbOpt,
+		RedisService:  redisOpt,
+		UserOptions:   userOpt,
+		BlobStore:     blobStore,
+		MaxUploadSize: maxUploadSize,
+	}
+}
+
+// CreateUpload - store the file read from r for the channel, the user
+// has to be able to post in it; the content type is sniffed from the
+// content and a sha256 checksum kept
+func (u *UploadService) CreateUpload(ctx context.Context, ChannelID string, fileName string, r io.Reader, UserID string, userEmail string, requestID string) (*Upload, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11100}).Error(err)
+		return nil, err
+	default:
+		channelserv := &ChannelService{DBService: u.DBService, RedisService: u.RedisService, UserOptions: u.UserOptions}
+		channel, err := channelserv.GetChannel(ctx, ChannelID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11101}).Error(err)
+			return nil, err
+		}
+		userserv := &userservices.UserService{DBService: u.DBService, RedisService: u.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11102}).Error(err)
+			return nil, err
+		}
+		err = u.checkChannelUser(ctx, channel.ID, user.ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11103}).Error(err)
+			return nil, err
+		}
+		err = checkChannelAccess(ctx, u.DBService, u.RedisService, u.UserOptions, channel.ID, GrantPost, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11142}).Error(err)
+			return nil, err
+		}
+		limit, err := u.GetUploadLimit(ctx, channel.WorkspaceID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11104}).Error(err)
+			return nil, err
+		}
+
+		// spool to a temporary file so that the size, checksum and content
+		// type are known before anything is written to the blob store
+		tmp, err := ioutil.TempFile("", "vilom-upload-")
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11105}).Error(err)
+			return nil, err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		hash := sha256.New()
+		size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, limit+1))
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11106}).Error(err)
+			return nil, err
+		}
+		if size > limit {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11107}).Error(ErrUploadTooLarge)
+			return nil, ErrUploadTooLarge
+		}
+		if size == 0 {
+			err = errors.New("Empty upload")
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11108}).Error(err)
+			return nil, err
+		}
+		head := make([]byte, 512)
+		n, err := tmp.ReadAt(head, 0)
+		if err != nil && err != io.EOF {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11109}).Error(err)
+			return nil, err
+		}
+
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		upload := Upload{}
+		upload.UUID4, err = common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11110}).Error(err)
+			return nil, err
+		}
+		upload.IDS, err = common.UUIDBytesToStr(upload.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11111}).Error(err)
+			return nil, err
+		}
+		upload.WorkspaceID = channel.WorkspaceID
+		upload.ChannelID = channel.ID
+		upload.UserID = user.ID
+		upload.FileName = cleanFileName(fileName)
+		upload.ContentType = SniffContentType(head[:n], upload.FileName)
+		upload.FileSize = size
+		upload.Checksum = hex.EncodeToString(hash.Sum(nil))
+		upload.BlobKey = "workspaces/" + strconv.FormatUint(uint64(channel.WorkspaceID), 10) + "/" + upload.IDS
+		upload.URL = UploadURLPrefix + upload.IDS
+		/*  StatusDates  */
+		upload.Statusc = common.Active
+		upload.CreatedAt = tn
+		upload.UpdatedAt = tn
+		upload.CreatedDay = tnday
+		upload.CreatedWeek = tnweek
+		upload.CreatedMonth = tnmonth
+		upload.CreatedYear = tnyear
+		upload.UpdatedDay = tnday
+		upload.UpdatedWeek = tnweek
+		upload.UpdatedMonth = tnmonth
+		upload.UpdatedYear = tnyear
+
+		_, err = tmp.Seek(0, io.SeekStart)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11112}).Error(err)
+			return nil, err
+		}
+		err = u.BlobStore.Put(ctx, upload.BlobKey, tmp, upload.FileSize, upload.ContentType)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11113}).Error(err)
+			return nil, err
+		}
+
+		db := u.DBService.DB
+		res, err := db.ExecContext(ctx, `insert into uploads
+	  (
+			uuid4,
+			workspace_id,
+			channel_id,
+			message_id,
+			user_id,
+			file_name,
+			content_type,
+			file_size,
+			checksum,
+			blob_key,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?,?,?,?,?);`,
+			upload.UUID4,
+			upload.WorkspaceID,
+			upload.ChannelID,
+			upload.MessageID,
+			upload.UserID,
+			upload.FileName,
+			upload.ContentType,
+			upload.FileSize,
+			upload.Checksum,
+			upload.BlobKey,
+			/*  StatusDates  */
+			upload.Statusc,
+			upload.CreatedAt,
+			upload.UpdatedAt,
+			upload.CreatedDay,
+			upload.CreatedWeek,
+			upload.CreatedMonth,
+			upload.CreatedYear,
+			upload.UpdatedDay,
+			upload.UpdatedWeek,
+			upload.UpdatedMonth,
+			upload.UpdatedYear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11114}).Error(err)
+			if derr := u.BlobStore.Delete(ctx, upload.BlobKey); derr != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11115}).Error(derr)
+			}
+			return nil, err
+		}
+		uID, err := res.LastInsertId()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11116}).Error(err)
+			return nil, err
+		}
+		upload.ID = uint(uID)
+		return &upload, nil
+	}
+}
+
+// GetUpload - Get upload details, the user has to be a member of the
+// channel of the upload who can read it
+func (u *UploadService) GetUpload(ctx context.Context, ID string, UserID string, userEmail string, requestID string) (*Upload, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11117}).Error(err)
+		return nil, err
+	default:
+		uuid4byte, err := common.UUIDStrToBytes(ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11118}).Error(err)
+			return nil, err
+		}
+		db := u.DBService.DB
+		upload := Upload{}
+		row := db.QueryRowContext(ctx, `select
+    id,
+		uuid4,
+		workspace_id,
+		channel_id,
+		message_id,
+		user_id,
+		file_name,
+		content_type,
+		file_size,
+		checksum,
+		blob_key,
+		statusc,
+		created_at,
+		updated_at,
+		created_day,
+		created_week,
+		created_month,
+		created_year,
+		updated_day,
+		updated_week,
+		updated_month,
+		updated_year from uploads where uuid4 = ? and statusc = ?;`, uuid4byte, common.Active)
+		err = row.Scan(
+			&upload.ID,
+			&upload.UUID4,
+			&upload.WorkspaceID,
+			&upload.ChannelID,
+			&upload.MessageID,
+			&upload.UserID,
+			&upload.FileName,
+			&upload.ContentType,
+			&upload.FileSize,
+			&upload.Checksum,
+			&upload.BlobKey,
+			/*  StatusDates  */
+			&upload.Statusc,
+			&upload.CreatedAt,
+			&upload.UpdatedAt,
+			&upload.CreatedDay,
+			&upload.CreatedWeek,
+			&upload.CreatedMonth,
+			&upload.CreatedYear,
+			&upload.UpdatedDay,
+			&upload.UpdatedWeek,
+			&upload.UpdatedMonth,
+			&upload.UpdatedYear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11119}).Error(err)
+			return nil, err
+		}
+		upload.IDS = ID
+		upload.URL = UploadURLPrefix + ID
+
+		userserv := &userservices.UserService{DBService: u.DBService, RedisService: u.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11120}).Error(err)
+			return nil, err
+		}
+		err = u.checkChannelUser(ctx, upload.ChannelID, user.ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11121}).Error(err)
+			return nil, err
+		}
+		err = checkChannelAccess(ctx, u.DBService, u.RedisService, u.UserOptions, upload.ChannelID, GrantRead, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11143}).Error(err)
+			return nil, err
+		}
+		return &upload, nil
+	}
+}
+
+// OpenUpload - Get upload details and open its content, the caller
+// closes the reader
+func (u *UploadService) OpenUpload(ctx context.Context, ID string, UserID string, userEmail string, requestID string) (*Upload, io.ReadCloser, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11122}).Error(err)
+		return nil, nil, err
+	default:
+		upload, err := u.GetUpload(ctx, ID, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11123}).Error(err)
+			return nil, nil, err
+		}
+		rc, err := u.BlobStore.Get(ctx, upload.BlobKey)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11124}).Error(err)
+			return nil, nil, err
+		}
+		return upload, rc, nil
+	}
+}
+
+// OpenThumbnail - Get upload details and open the thumbnail of the
+// upload, the caller closes the reader
+func (u *UploadService) OpenThumbnail(ctx context.Context, ID string, UserID string, userEmail string, requestID string) (*Upload, io.ReadCloser, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11138}).Error(err)
+		return nil, nil, err
+	default:
+		upload, err := u.GetUpload(ctx, ID, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11139}).Error(err)
+			return nil, nil, err
+		}
+		db := u.DBService.DB
+		var thumbnailKey string
+		row := db.QueryRowContext(ctx, `select thumbnail_key from message_attachments where upload_id = ? and thumbnail_key != '' limit 1;`, upload.ID)
+		err = row.Scan(&thumbnailKey)
+		if err == sql.ErrNoRows {
+			return nil, nil, errors.New("Thumbnail not found")
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11140}).Error(err)
+			return nil, nil, err
+		}
+		rc, err := u.BlobStore.Get(ctx, thumbnailKey)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11141}).Error(err)
+			return nil, nil, err
+		}
+		return upload, rc, nil
+	}
+}
+
+// GetUploadLimit - the upload size limit of the workspace
+func (u *UploadService) GetUploadLimit(ctx context.Context, workspaceID uint, userEmail string, requestID string) (int64, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11125}).Error(err)
+		return 0, err
+	default:
+		db := u.DBService.DB
+		var limit int64
+		row := db.QueryRowContext(ctx, `select max_upload_size from upload_limits where workspace_id = ? and statusc = ?;`, workspaceID, common.Active)
+		err := row.Scan(&limit)
+		if err == sql.ErrNoRows {
+			return u.MaxUploadSize, nil
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11126}).Error(err)
+			return 0, err
+		}
+		return limit, nil
+	}
+}
+
+// SetUploadLimit - set the upload size limit of the workspace
+func (u *UploadService) SetUploadLimit(ctx context.Context, form *UploadLimit, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11127}).Error(err)
+		return err
+	default:
+		if form.MaxUploadSize <= 0 {
+			err := errors.New("Invalid max_upload_size")
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11128}).Error(err)
+			return err
+		}
+		workspaceserv := &WorkspaceService{DBService: u.DBService, RedisService: u.RedisService}
+		workspace, err := workspaceserv.GetWorkspaceByID(ctx, form.WorkspaceID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11129}).Error(err)
+			return err
+		}
+		uuid4, err := common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11130}).Error(err)
+			return err
+		}
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		db := u.DBService.DB
+		_, err = db.ExecContext(ctx, `insert into upload_limits
+	  (
+			uuid4,
+			workspace_id,
+			max_upload_size,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+  on duplicate key update
+			max_upload_size = values(max_upload_size),
+			statusc = values(statusc),
+			updated_at = values(updated_at),
+			updated_day = values(updated_day),
+			updated_week = values(updated_week),
+			updated_month = values(updated_month),
+			updated_year = values(updated_year);`,
+			uuid4,
+			workspace.ID,
+			form.MaxUploadSize,
+			common.Active,
+			tn,
+			tn,
+			tnday,
+			tnweek,
+			tnmonth,
+			tnyear,
+			tnday,
+			tnweek,
+			tnmonth,
+			tnyear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11131}).Error(err)
+			return err
+		}
+		return nil
+	}
+}
+
+// checkChannelUser - error unless the user is a member of the channel
+func (u *UploadService) checkChannelUser(ctx context.Context, channelID uint, userID uint, userEmail string, requestID string) error {
+	db := u.DBService.DB
+	var isPresent bool
+	row := db.QueryRowContext(ctx, `select exists (select 1 from user_channels where channel_id = ? and user_id = ? and statusc = ?);`, channelID, userID, common.Active)
+	err := row.Scan(&isPresent)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11132}).Error(err)
+		return err
+	}
+	if !isPresent {
+		return errors.New("User is not a member of the channel")
+	}
+	return nil
+}
+
+// linkUpload - attach an upload of the user in the channel to the
+// message, an upload is attached only once
+func linkUpload(ctx context.Context, tx *sql.Tx, ID string, channelID uint, userID uint, messageID uint, userEmail string, requestID string) (*Upload, error) {
+	uuid4byte, err := common.UUIDStrToBytes(ID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11133}).Error(err)
+		return nil, err
+	}
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	res, err := tx.ExecContext(ctx, `update uploads set
+		  message_id = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where uuid4 = ? and channel_id = ? and user_id = ? and message_id = 0 and statusc = ?;`,
+		messageID,
+		tn,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear,
+		uuid4byte,
+		channelID,
+		userID,
+		common.Active)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11134}).Error(err)
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11135}).Error(err)
+		return nil, err
+	}
+	if n != 1 {
+		err = errors.New("Invalid upload " + ID)
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11136}).Error(err)
+		return nil, err
+	}
+	upload := Upload{IDS: ID, URL: UploadURLPrefix + ID, MessageID: messageID}
+	row := tx.QueryRowContext(ctx, `select id, content_type, file_size from uploads where uuid4 = ?;`, uuid4byte)
+	err = row.Scan(&upload.ID, &upload.ContentType, &upload.FileSize)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 11137}).Error(err)
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// SniffContentType - the content type detected from the first bytes of
+// a file, the extension of fileName is only used when sniffing finds
+// nothing more specific than binary data
+func SniffContentType(head []byte, fileName string) string {
+	contentType := http.DetectContentType(head)
+	if contentType == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(filepath.Ext(fileName)); byExt != "" && !strings.HasPrefix(byExt, "text/html") {
+			return byExt
+		}
+	}
+	return contentType
+}
+
+// cleanFileName - the base name of fileName, without path or control
+// characters
+func cleanFileName(fileName string) string {
+	fileName = filepath.Base(strings.Replace(fileName, "\\", "/", -1))
+	fileName = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, fileName)
+	if fileName == "." || fileName == "/" || fileName == "" {
+		fileName = "file"
+	}
+	if runes := []rune(fileName); len(runes) > FileNameLenMax {
+		fileName = string(runes[:FileNameLenMax])
+	}
+	return fileName
+}
@@ -0,0 +1,162 @@
+package msgservices
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestUploadService_CreateUpload(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	dir, err := ioutil.TempDir("", "vilom-uploads")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	blobStore, err := common.NewLocalBlobStore(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx := context.Background()
+	uploadService := NewUploadService(dbService, redisService, userOpt, blobStore, 1024)
+	messageService := NewMessageService(dbService, redisService, userOpt)
+	userID := "29ea215b-8fb3-4453-b413-81a661e44495"
+	channelID := "44b2e674-7031-4487-be96-60093bfe8ac3"
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	content := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 100)...)
+	upload, err := uploadService.CreateUpload(ctx, channelID, "../dir/logo.png", bytes.NewReader(content), userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	sum := sha256.Sum256(content)
+	if upload.ContentType != "image/png" || upload.FileName != "logo.png" || upload.FileSize != int64(len(content)) || upload.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("UploadService.CreateUpload() = %v", upload)
+	}
+
+	_, err = uploadService.CreateUpload(ctx, channelID, "big.bin", bytes.NewReader(make([]byte, 2048)), userID, userEmail, requestID)
+	if err != ErrUploadTooLarge {
+		t.Errorf("UploadService.CreateUpload() error = %v, want %v", err, ErrUploadTooLarge)
+	}
+	err = uploadService.SetUploadLimit(ctx, &UploadLimit{WorkspaceID: uint(2), MaxUploadSize: 4096}, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = uploadService.CreateUpload(ctx, channelID, "big.bin", bytes.NewReader(make([]byte, 2048)), userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	form := Message{}
+	form.WorkspaceID = uint(2)
+	form.ChannelID = uint(1)
+	form.Mtext = "the logo"
+	form.Uploads = []string{upload.IDS}
+	msg, err := messageService.CreateMessage(ctx, &form, userID, false, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(msg.MessageAttachments) != 1 || msg.MessageAttachments[0].Mattach != upload.URL {
+		t.Errorf("MessageService.CreateMessage() attachments = %v, want %v", msg.MessageAttachments, upload.URL)
+	}
+	_, err = messageService.CreateMessage(ctx, &form, userID, false, userEmail, requestID)
+	if err == nil {
+		t.Errorf("MessageService.CreateMessage() with an attached upload, want error")
+	}
+
+	got, rc, err := uploadService.OpenUpload(ctx, upload.IDS, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	body, _ := ioutil.ReadAll(rc)
+	_ = rc.Close()
+	if got.MessageID != msg.ID || !bytes.Equal(body, content) {
+		t.Errorf("UploadService.OpenUpload() = %v", got)
+	}
+
+	// ann is a member of the channel, but not of the ugroup granted it
+	annUUID4, err := common.GetUUIDBytes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	annID, err := common.UUIDBytesToStr(annUUID4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, q := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{`insert into users (id, uuid4, email, username, first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year)
+			select 2, ?, 'ann@example.com', 'ann', 'Ann', last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year from users where id = 1;`, []interface{}{annUUID4}},
+		{`insert into user_channels (channel_id, ugroup_id, user_id, statusc) values (1, 0, 2, 1);`, nil},
+		{`update users set role = ? where id = 1;`, []interface{}{common.SiteAdminRole}},
+	} {
+		_, err = dbService.DB.Exec(q.query, q.args...)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	_, err = uploadService.GetUpload(ctx, upload.IDS, annID, "ann@example.com", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	grantService := NewGrantService(dbService, redisService, userOpt)
+	_, err = grantService.CreateGrant(ctx, &UgroupGrant{UgroupID: 2, ChannelID: 1, GrantRole: GrantRead}, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, _, err = uploadService.OpenUpload(ctx, upload.IDS, annID, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("UploadService.OpenUpload() error = %v, want %v", err, ErrAccessDenied)
+	}
+	_, err = uploadService.CreateUpload(ctx, channelID, "logo.png", bytes.NewReader(content), annID, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("UploadService.CreateUpload() error = %v, want %v", err, ErrAccessDenied)
+	}
+}
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		head     []byte
+		fileName string
+		want     string
+	}{
+		{[]byte("\x89PNG\r\n\x1a\n"), "a.txt", "image/png"},
+		{[]byte("<html><body>"), "a.png", "text/html; charset=utf-8"},
+		{[]byte{0, 1, 2, 3}, "a.pdf", "application/pdf"},
+		{[]byte{0, 1, 2, 3}, "a.html", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if got := SniffContentType(tt.head, tt.fileName); got != tt.want {
+			t.Errorf("SniffContentType(%q) = %v, want %v", tt.fileName, got, tt.want)
+		}
+	}
+}
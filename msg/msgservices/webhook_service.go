@@ -0,0 +1,1066 @@
+package msgservices
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 8300-8999 */
+
+// Webhook events
+const (
+	EventMessageCreated = "message.created"
+	EventMessageUpdated = "message.updated"
+	EventMessageDeleted = "message.deleted"
+	EventChannelCreated = "channel.created"
+	EventUserJoined     = "user.joined"
+)
+
+// WebhookEvents - all the events a webhook can subscribe to
+var WebhookEvents = []string{EventMessageCreated, EventMessageUpdated, EventMessageDeleted, EventChannelCreated, EventUserJoined}
+
+// Status of a webhook delivery
+const (
+	DeliveryPending   = 1
+	DeliveryDelivered = 2
+	DeliveryFailed    = 3
+)
+
+// For validation of webhook fields
+const (
+	WebhookTargetURLLenMin = 1
+	WebhookTargetURLLenMax = 2048
+)
+
+// Webhook delivery settings, a delivery is retried with exponential
+// backoff starting at WebhookBackoffMin, and marked as failed after
+// WebhookMaxAttempts attempts
+const (
+	WebhookMaxAttempts      = 8
+	WebhookBackoffMin       = 30 * time.Second
+	WebhookBackoffMax       = 6 * time.Hour
+	WebhookDeliveryInterval = 5 * time.Second
+	WebhookDeliveryTimeout  = 10 * time.Second
+	WebhookDeliveryBatch    = 100
+)
+
+// Webhook delivery headers
+const (
+	WebhookEventHeader     = "X-Vilom-Event"
+	WebhookDeliveryHeader  = "X-Vilom-Delivery"
+	WebhookSignatureHeader = "X-Vilom-Signature-256"
+)
+
+// Webhook - Webhook view representation, the secret is only
+// returned when the webhook is created
+type Webhook struct {
+	ID          uint     `json:"id,omitempty"`
+	UUID4       []byte   `json:"-"`
+	IDS         string   `json:"id_s,omitempty"`
+	WorkspaceID uint     `json:"workspace_id,omitempty"`
+	TargetURL   string   `json:"target_url,omitempty"`
+	Secret      string   `json:"secret,omitempty"`
+	Events      []string `json:"events,omitempty"`
+	UserID      uint     `json:"user_id,omitempty"`
+
+	common.StatusDates
+}
+
+// WebhookDelivery - WebhookDelivery view representation
+type WebhookDelivery struct {
+	ID             uint      `json:"id,omitempty"`
+	UUID4          []byte    `json:"-"`
+	IDS            string    `json:"id_s,omitempty"`
+	WebhookID      uint      `json:"webhook_id,omitempty"`
+	Event          string    `json:"event,omitempty"`
+	Payload        string    `json:"payload,omitempty"`
+	DeliveryStatus uint      `json:"delivery_status,omitempty"`
+	Attempts       uint      `json:"attempts,omitempty"`
+	NextAttemptAt  time.Time `json:"next_attempt_at,omitempty"`
+	ResponseCode   uint      `json:"response_code,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+
+	common.StatusDates
+}
+
+// WebhookPayload - body posted to the target url of a webhook
+type WebhookPayload struct {
+	ID          string      `json:"id"`
+	Event       string      `json:"event"`
+	WorkspaceID uint        `json:"workspace_id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Data        interface{} `json:"data"`
+}
+
+// UserJoined - data of the user.joined event
+type UserJoined struct {
+	ChannelID  uint   `json:"channel_id"`
+	ChannelIDS string `json:"channel_id_s"`
+	UserID     uint   `json:"user_id"`
+	UserIDS    string `json:"user_id_s"`
+}
+
+// WebhookServiceIntf - interface for Webhook Service
+type WebhookServiceIntf interface {
+	CreateWebhook(ctx context.Context, form *Webhook, UserID string, userEmail string, requestID string) (*Webhook, error)
+	GetWebhooks(ctx context.Context, workspaceID uint, userEmail string, requestID string) ([]*Webhook, error)
+	GetWebhook(ctx context.Context, ID string, userEmail string, requestID string) (*Webhook, error)
+	DeleteWebhook(ctx context.Context, ID string, userEmail string, requestID string) error
+	GetWebhookDeliveries(ctx context.Context, ID string, userEmail string, requestID string) ([]*WebhookDelivery, error)
+	Redeliver(ctx context.Context, ID string, deliveryID string, userEmail string, requestID string) (*WebhookDelivery, error)
+	Emit(ctx context.Context, workspaceID uint, channelID uint, event string, data interface{}, userEmail string, requestID string) error
+	DeliverPending(ctx context.Context, userEmail string, requestID string) (int, error)
+}
+
+// WebhookService - For accessing webhook services
+type WebhookService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+	UserOptions  *common.UserOptions
+	Client       *http.Client
+}
+
+// NewWebhookService - Create webhook service
+func NewWebhookService(dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions) *WebhookService {
+	return &WebhookService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+		UserOptions:  userOpt,
+		Client:       common.OutboundClient(WebhookDeliveryTimeout),
+	}
+}
+
+// CreateWebhook - Create webhook, the user has to be an admin of the
+// workspace
+func (wh *WebhookService) CreateWebhook(ctx context.Context, form *Webhook, UserID string, userEmail string, requestID string) (*Webhook, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8300}).Error(err)
+		return nil, err
+	default:
+		err := ValidateWebhook(form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8301}).Error(err)
+			return nil, err
+		}
+		userserv := &userservices.UserService{DBService: wh.DBService, RedisService: wh.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8302}).Error(err)
+			return nil, err
+		}
+		workspaceserv := &WorkspaceService{DBService: wh.DBService, RedisService: wh.RedisService}
+		workspace, err := workspaceserv.GetWorkspaceByID(ctx, form.WorkspaceID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8303}).Error(err)
+			return nil, err
+		}
+		err = checkTargetAdmin(ctx, wh.DBService, wh.RedisService, wh.UserOptions, workspace.ID, 0, 0, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8364}).Error(err)
+			return nil, err
+		}
+
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		webhook := Webhook{}
+		webhook.UUID4, err = common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8304}).Error(err)
+			return nil, err
+		}
+		webhook.Secret, err = genWebhookSecret()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8305}).Error(err)
+			return nil, err
+		}
+		webhook.WorkspaceID = workspace.ID
+		webhook.TargetURL = form.TargetURL
+		webhook.Events = form.Events
+		webhook.UserID = user.ID
+		/*  StatusDates  */
+		webhook.Statusc = common.Active
+		webhook.CreatedAt = tn
+		webhook.UpdatedAt = tn
+		webhook.CreatedDay = tnday
+		webhook.CreatedWeek = tnweek
+		webhook.CreatedMonth = tnmonth
+		webhook.CreatedYear = tnyear
+		webhook.UpdatedDay = tnday
+		webhook.UpdatedWeek = tnweek
+		webhook.UpdatedMonth = tnmonth
+		webhook.UpdatedYear = tnyear
+
+		db := wh.DBService.DB
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8306}).Error(err)
+			return nil, err
+		}
+		res, err := tx.ExecContext(ctx, `insert into webhooks
+	  (
+			uuid4,
+			workspace_id,
+			target_url,
+			secret,
+			events,
+			user_id,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?);`,
+			webhook.UUID4,
+			webhook.WorkspaceID,
+			webhook.TargetURL,
+			webhook.Secret,
+			strings.Join(webhook.Events, ","),
+			webhook.UserID,
+			/*  StatusDates  */
+			webhook.Statusc,
+			webhook.CreatedAt,
+			webhook.UpdatedAt,
+			webhook.CreatedDay,
+			webhook.CreatedWeek,
+			webhook.CreatedMonth,
+			webhook.CreatedYear,
+			webhook.UpdatedDay,
+			webhook.UpdatedWeek,
+			webhook.UpdatedMonth,
+			webhook.UpdatedYear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8307}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		uID, err := res.LastInsertId()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8308}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8309}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		webhook.ID = uint(uID)
+		webhook.IDS, err = common.UUIDBytesToStr(webhook.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8310}).Error(err)
+			return nil, err
+		}
+		return &webhook, nil
+	}
+}
+
+// ValidateWebhook - the target url must be an absolute http(s) url, not
+// to a denied address, and every event must be one of WebhookEvents
+func ValidateWebhook(form *Webhook) error {
+	u, err := url.Parse(form.TargetURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Target URL must be an http or https URL")
+	}
+	if common.CheckOutboundURL(context.Background(), form.TargetURL) != nil {
+		return errors.New("Target URL must not be an internal address")
+	}
+	if len(form.Events) == 0 {
+		return errors.New("At least one event is required")
+	}
+	for _, event := range form.Events {
+		if !isWebhookEvent(event) {
+			return errors.New("Unknown event " + event)
+		}
+	}
+	return nil
+}
+
+// GetWebhooks - Get the active webhooks of a workspace
+func (wh *WebhookService) GetWebhooks(ctx context.Context, workspaceID uint, userEmail string, requestID string) ([]*Webhook, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8311}).Error(err)
+		return nil, err
+	default:
+		webhooks, err := wh.getWebhooks(ctx, `workspace_id = ? and statusc = ?`, userEmail, requestID, workspaceID, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8312}).Error(err)
+			return nil, err
+		}
+		return webhooks, nil
+	}
+}
+
+// GetWebhook - Get webhook
+func (wh *WebhookService) GetWebhook(ctx context.Context, ID string, userEmail string, requestID string) (*Webhook, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8313}).Error(err)
+		return nil, err
+	default:
+		uuid4byte, err := common.UUIDStrToBytes(ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8314}).Error(err)
+			return nil, err
+		}
+		webhooks, err := wh.getWebhooks(ctx, `uuid4 = ? and statusc = ?`, userEmail, requestID, uuid4byte, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8315}).Error(err)
+			return nil, err
+		}
+		if len(webhooks) == 0 {
+			err = errors.New("Webhook not found")
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8316}).Error(err)
+			return nil, err
+		}
+		return webhooks[0], nil
+	}
+}
+
+// getAdminWebhook - Get webhook, ErrAccessDenied unless the user is its
+// creator or an admin of its workspace
+func (wh *WebhookService) getAdminWebhook(ctx context.Context, ID string, userEmail string, requestID string) (*Webhook, error) {
+	webhook, err := wh.GetWebhook(ctx, ID, userEmail, requestID)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTargetAdmin(ctx, wh.DBService, wh.RedisService, wh.UserOptions, webhook.WorkspaceID, 0, webhook.UserID, userEmail, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8365}).Error(err)
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// getWebhooks - Get webhooks, the secret is not returned
+func (wh *WebhookService) getWebhooks(ctx context.Context, where string, userEmail string, requestID string, args ...interface{}) ([]*Webhook, error) {
+	db := wh.DBService.DB
+	webhooks := []*Webhook{}
+	rows, err := db.QueryContext(ctx, `select
+    id,
+		uuid4,
+		workspace_id,
+		target_url,
+		events,
+		user_id,
+		statusc,
+		created_at,
+		updated_at,
+		created_day,
+		created_week,
+		created_month,
+		created_year,
+		updated_day,
+		updated_week,
+		updated_month,
+		updated_year from webhooks where `+where+` order by id;`, args...)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8317}).Error(err)
+		return nil, err
+	}
+	for rows.Next() {
+		webhook := Webhook{}
+		events := ""
+		err = rows.Scan(
+			&webhook.ID,
+			&webhook.UUID4,
+			&webhook.WorkspaceID,
+			&webhook.TargetURL,
+			&events,
+			&webhook.UserID,
+			/*  StatusDates  */
+			&webhook.Statusc,
+			&webhook.CreatedAt,
+			&webhook.UpdatedAt,
+			&webhook.CreatedDay,
+			&webhook.CreatedWeek,
+			&webhook.CreatedMonth,
+			&webhook.CreatedYear,
+			&webhook.UpdatedDay,
+			&webhook.UpdatedWeek,
+			&webhook.UpdatedMonth,
+			&webhook.UpdatedYear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8318}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		webhook.Events = strings.Split(events, ",")
+		webhook.IDS, err = common.UUIDBytesToStr(webhook.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8319}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8320}).Error(err)
+		return nil, err
+	}
+	err = rows.Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8321}).Error(err)
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook - Delete webhook, pending deliveries are not sent; the
+// user has to be the creator of the webhook or an admin of its workspace
+func (wh *WebhookService) DeleteWebhook(ctx context.Context, ID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8322}).Error(err)
+		return err
+	default:
+		webhook, err := wh.getAdminWebhook(ctx, ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8323}).Error(err)
+			return err
+		}
+		db := wh.DBService.DB
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8324}).Error(err)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `update webhooks set
+		  statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where id = ?;`,
+			common.Inactive,
+			tn,
+			tnday,
+			tnweek,
+			tnmonth,
+			tnyear,
+			webhook.ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8325}).Error(err)
+			err = tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8326}).Error(err)
+			err = tx.Rollback()
+			return err
+		}
+		return nil
+	}
+}
+
+// GetWebhookDeliveries - Get the delivery log of a webhook, latest
+// first, the user has to be the creator of the webhook or an admin of its
+// workspace
+func (wh *WebhookService) GetWebhookDeliveries(ctx context.Context, ID string, userEmail string, requestID string) ([]*WebhookDelivery, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8327}).Error(err)
+		return nil, err
+	default:
+		webhook, err := wh.getAdminWebhook(ctx, ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8328}).Error(err)
+			return nil, err
+		}
+		deliveries, err := wh.getDeliveries(ctx, `webhook_id = ? order by id desc limit `+wh.DBService.LimitSQLRows, userEmail, requestID, webhook.ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8329}).Error(err)
+			return nil, err
+		}
+		return deliveries, nil
+	}
+}
+
+// getDeliveries - Get webhook deliveries
+func (wh *WebhookService) getDeliveries(ctx context.Context, where string, userEmail string, requestID string, args ...interface{}) ([]*WebhookDelivery, error) {
+	db := wh.DBService.DB
+	deliveries := []*WebhookDelivery{}
+	rows, err := db.QueryContext(ctx, `select
+    id,
+		uuid4,
+		webhook_id,
+		event,
+		payload,
+		delivery_status,
+		attempts,
+		next_attempt_at,
+		response_code,
+		last_error,
+		statusc,
+		created_at,
+		updated_at,
+		created_day,
+		created_week,
+		created_month,
+		created_year,
+		updated_day,
+		updated_week,
+		updated_month,
+		updated_year from webhook_deliveries where `+where+`;`, args...)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8330}).Error(err)
+		return nil, err
+	}
+	for rows.Next() {
+		delivery := WebhookDelivery{}
+		err = rows.Scan(
+			&delivery.ID,
+			&delivery.UUID4,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.DeliveryStatus,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.ResponseCode,
+			&delivery.LastError,
+			/*  StatusDates  */
+			&delivery.Statusc,
+			&delivery.CreatedAt,
+			&delivery.UpdatedAt,
+			&delivery.CreatedDay,
+			&delivery.CreatedWeek,
+			&delivery.CreatedMonth,
+			&delivery.CreatedYear,
+			&delivery.UpdatedDay,
+			&delivery.UpdatedWeek,
+			&delivery.UpdatedMonth,
+			&delivery.UpdatedYear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8331}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		delivery.IDS, err = common.UUIDBytesToStr(delivery.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8332}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8333}).Error(err)
+		return nil, err
+	}
+	err = rows.Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8334}).Error(err)
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Redeliver - queue a new delivery with the payload of a previous one,
+// the user has to be the creator of the webhook or an admin of its
+// workspace
+func (wh *WebhookService) Redeliver(ctx context.Context, ID string, deliveryID string, userEmail string, requestID string) (*WebhookDelivery, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8335}).Error(err)
+		return nil, err
+	default:
+		webhook, err := wh.getAdminWebhook(ctx, ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8336}).Error(err)
+			return nil, err
+		}
+		uuid4byte, err := common.UUIDStrToBytes(deliveryID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8337}).Error(err)
+			return nil, err
+		}
+		deliveries, err := wh.getDeliveries(ctx, `webhook_id = ? and uuid4 = ?`, userEmail, requestID, webhook.ID, uuid4byte)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8338}).Error(err)
+			return nil, err
+		}
+		if len(deliveries) == 0 {
+			err = errors.New("Webhook delivery not found")
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8339}).Error(err)
+			return nil, err
+		}
+
+		db := wh.DBService.DB
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8340}).Error(err)
+			return nil, err
+		}
+		delivery, err := wh.insertDelivery(ctx, tx, webhook.ID, deliveries[0].Event, deliveries[0].Payload, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8341}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8342}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		return delivery, nil
+	}
+}
+
+// Emit - queue a delivery of the event for every active webhook of the
+// workspace subscribed to it, the deliveries are sent by DeliverPending;
+// the events of a channel are not sent to the webhooks whose creator
+// cannot read the channel
+func (wh *WebhookService) Emit(ctx context.Context, workspaceID uint, channelID uint, event string, data interface{}, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8343}).Error(err)
+		return err
+	default:
+		webhooks, err := wh.GetWebhooks(ctx, workspaceID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8344}).Error(err)
+			return err
+		}
+		subscribed := []*Webhook{}
+		for _, webhook := range webhooks {
+			if !containsEvent(webhook.Events, event) {
+				continue
+			}
+			if channelID != 0 {
+				canRead, err := wh.creatorCanRead(ctx, webhook, channelID, userEmail, requestID)
+				if err != nil {
+					return err
+				}
+				if !canRead {
+					continue
+				}
+			}
+			subscribed = append(subscribed, webhook)
+		}
+		if len(subscribed) == 0 {
+			return nil
+		}
+
+		db := wh.DBService.DB
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8345}).Error(err)
+			return err
+		}
+		for _, webhook := range subscribed {
+			payloadID := common.GetUUID().String()
+			payload, err := json.Marshal(WebhookPayload{
+				ID:          payloadID,
+				Event:       event,
+				WorkspaceID: workspaceID,
+				CreatedAt:   time.Now().UTC(),
+				Data:        data,
+			})
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8346}).Error(err)
+				err = tx.Rollback()
+				return err
+			}
+			_, err = wh.insertDelivery(ctx, tx, webhook.ID, event, string(payload), userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8347}).Error(err)
+				err = tx.Rollback()
+				return err
+			}
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8348}).Error(err)
+			err = tx.Rollback()
+			return err
+		}
+		return nil
+	}
+}
+
+// creatorCanRead - whether the creator of the webhook can read the
+// channel, the webhooks of inactive users get no channel events
+func (wh *WebhookService) creatorCanRead(ctx context.Context, webhook *Webhook, channelID uint, userEmail string, requestID string) (bool, error) {
+	var creatorEmail string
+	err := wh.DBService.DB.QueryRowContext(ctx, `select email from users where id = ? and statusc = ?;`, webhook.UserID, common.Active).Scan(&creatorEmail)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8363}).Error(err)
+		return false, err
+	}
+	grantserv := &GrantService{DBService: wh.DBService, RedisService: wh.RedisService, UserOptions: wh.UserOptions}
+	role, _, err := grantserv.ChannelRole(ctx, channelID, creatorEmail, requestID)
+	if err != nil {
+		return false, err
+	}
+	return GrantAllows(role, GrantRead), nil
+}
+
+// insertDelivery - insert a pending delivery
+func (wh *WebhookService) insertDelivery(ctx context.Context, tx *sql.Tx, webhookID uint, event string, payload string, userEmail string, requestID string) (*WebhookDelivery, error) {
+	var err error
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	delivery := WebhookDelivery{}
+	delivery.UUID4, err = common.GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8349}).Error(err)
+		return nil, err
+	}
+	delivery.WebhookID = webhookID
+	delivery.Event = event
+	delivery.Payload = payload
+	delivery.DeliveryStatus = DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = tn
+	/*  StatusDates  */
+	delivery.Statusc = common.Active
+	delivery.CreatedAt = tn
+	delivery.UpdatedAt = tn
+	delivery.CreatedDay = tnday
+	delivery.CreatedWeek = tnweek
+	delivery.CreatedMonth = tnmonth
+	delivery.CreatedYear = tnyear
+	delivery.UpdatedDay = tnday
+	delivery.UpdatedWeek = tnweek
+	delivery.UpdatedMonth = tnmonth
+	delivery.UpdatedYear = tnyear
+
+	res, err := tx.ExecContext(ctx, `insert into webhook_deliveries
+	  (
+			uuid4,
+			webhook_id,
+			event,
+			payload,
+			delivery_status,
+			attempts,
+			next_attempt_at,
+			response_code,
+			last_error,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?,?,?,?);`,
+		delivery.UUID4,
+		delivery.WebhookID,
+		delivery.Event,
+		delivery.Payload,
+		delivery.DeliveryStatus,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.ResponseCode,
+		delivery.LastError,
+		/*  StatusDates  */
+		delivery.Statusc,
+		delivery.CreatedAt,
+		delivery.UpdatedAt,
+		delivery.CreatedDay,
+		delivery.CreatedWeek,
+		delivery.CreatedMonth,
+		delivery.CreatedYear,
+		delivery.UpdatedDay,
+		delivery.UpdatedWeek,
+		delivery.UpdatedMonth,
+		delivery.UpdatedYear)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8350}).Error(err)
+		return nil, err
+	}
+	uID, err := res.LastInsertId()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8351}).Error(err)
+		return nil, err
+	}
+	delivery.ID = uint(uID)
+	delivery.IDS, err = common.UUIDBytesToStr(delivery.UUID4)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8352}).Error(err)
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// DeliverPending - send the pending deliveries that are due, returns
+// the number of deliveries attempted
+func (wh *WebhookService) DeliverPending(ctx context.Context, userEmail string, requestID string) (int, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8353}).Error(err)
+		return 0, err
+	default:
+		deliveries, err := wh.getDeliveries(ctx, fmt.Sprintf(`delivery_status = ? and next_attempt_at <= ? order by next_attempt_at limit %d`, WebhookDeliveryBatch), userEmail, requestID, DeliveryPending, time.Now().UTC())
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8354}).Error(err)
+			return 0, err
+		}
+		attempted := 0
+		for _, delivery := range deliveries {
+			claimed, err := wh.claimDelivery(ctx, delivery, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8355}).Error(err)
+				return attempted, err
+			}
+			if !claimed {
+				// another worker is sending it
+				continue
+			}
+			err = wh.deliver(ctx, delivery, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8356}).Error(err)
+				return attempted, err
+			}
+			attempted++
+		}
+		return attempted, nil
+	}
+}
+
+// RunDeliveryWorker - send the pending deliveries every interval until ctx is done
+func (wh *WebhookService) RunDeliveryWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := wh.DeliverPending(ctx, "", common.GetRequestID())
+			if err != nil {
+				log.WithFields(log.Fields{"msgnum": 8357}).Error(err)
+			}
+		}
+	}
+}
+
+// claimDelivery - count the attempt and push back next_attempt_at, so
+// that a delivery is sent by one worker only
+func (wh *WebhookService) claimDelivery(ctx context.Context, delivery *WebhookDelivery, userEmail string, requestID string) (bool, error) {
+	db := wh.DBService.DB
+	delivery.Attempts = delivery.Attempts + 1
+	res, err := db.ExecContext(ctx, `update webhook_deliveries set
+		  attempts = ?,
+			next_attempt_at = ? where id = ? and attempts = ? and delivery_status = ?;`,
+		delivery.Attempts,
+		time.Now().UTC().Add(WebhookDeliveryTimeout*2),
+		delivery.ID,
+		delivery.Attempts-1,
+		DeliveryPending)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8358}).Error(err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8359}).Error(err)
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// deliver - post the payload to the target url and record the result,
+// failed deliveries are retried with exponential backoff
+func (wh *WebhookService) deliver(ctx context.Context, delivery *WebhookDelivery, userEmail string, requestID string) error {
+	db := wh.DBService.DB
+	var targetURL, secret string
+	var statusc uint
+	row := db.QueryRowContext(ctx, `select target_url, secret, statusc from webhooks where id = ?;`, delivery.WebhookID)
+	err := row.Scan(&targetURL, &secret, &statusc)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8360}).Error(err)
+		return err
+	}
+
+	delivery.ResponseCode = 0
+	delivery.LastError = ""
+	if statusc != common.Active {
+		delivery.DeliveryStatus = DeliveryFailed
+		delivery.LastError = "Webhook deleted"
+	} else {
+		delivery.ResponseCode, err = wh.post(ctx, targetURL, secret, delivery)
+		if err == nil && delivery.ResponseCode >= 200 && delivery.ResponseCode < 300 {
+			delivery.DeliveryStatus = DeliveryDelivered
+		} else {
+			if err != nil {
+				delivery.LastError = err.Error()
+			} else {
+				delivery.LastError = http.StatusText(int(delivery.ResponseCode))
+			}
+			if delivery.Attempts >= WebhookMaxAttempts {
+				delivery.DeliveryStatus = DeliveryFailed
+			} else {
+				delivery.NextAttemptAt = time.Now().UTC().Add(WebhookBackoff(delivery.Attempts))
+			}
+		}
+	}
+	if len(delivery.LastError) > 1000 {
+		delivery.LastError = delivery.LastError[:1000]
+	}
+
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	_, err = db.ExecContext(ctx, `update webhook_deliveries set
+		  delivery_status = ?,
+			next_attempt_at = ?,
+			response_code = ?,
+			last_error = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where id = ?;`,
+		delivery.DeliveryStatus,
+		delivery.NextAttemptAt,
+		delivery.ResponseCode,
+		delivery.LastError,
+		tn,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear,
+		delivery.ID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8361}).Error(err)
+		return err
+	}
+	return nil
+}
+
+// post - post the payload of a delivery with its signature
+func (wh *WebhookService) post(ctx context.Context, targetURL string, secret string, delivery *WebhookDelivery) (uint, error) {
+	req, err := http.NewRequest(http.MethodPost, targetURL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "vilom-webhooks")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, delivery.IDS)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(secret, []byte(delivery.Payload)))
+
+	client := wh.Client
+	if client == nil {
+		client = common.OutboundClient(WebhookDeliveryTimeout)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	err = resp.Body.Close()
+	if err != nil {
+		return uint(resp.StatusCode), err
+	}
+	return uint(resp.StatusCode), nil
+}
+
+// SignWebhookPayload - the value of the signature header,
+// "sha256=" followed by the hex HMAC-SHA256 of the body
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature - used by receivers to check the signature header
+func VerifyWebhookSignature(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhookPayload(secret, body)), []byte(signature))
+}
+
+// WebhookBackoff - delay before the next attempt after a failed attempt,
+// doubling from WebhookBackoffMin up to WebhookBackoffMax
+func WebhookBackoff(attempts uint) time.Duration {
+	backoff := WebhookBackoffMin
+	for i := uint(1); i < attempts; i++ {
+		backoff = backoff * 2
+		if backoff >= WebhookBackoffMax {
+			return WebhookBackoffMax
+		}
+	}
+	return backoff
+}
+
+// genWebhookSecret - random secret used to sign the deliveries
+func genWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// isWebhookEvent - whether event is one of WebhookEvents
+func isWebhookEvent(event string) bool {
+	return containsEvent(WebhookEvents, event)
+}
+
+// containsEvent - whether event is in events
+func containsEvent(events []string, event string) bool {
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// emitWebhookEvent - emit an event, errors are logged only so that
+// webhooks never fail the action that triggered the event
+func emitWebhookEvent(ctx context.Context, dbService *common.DBService, redisService *common.RedisService, userOpt *common.UserOptions, workspaceID uint, channelID uint, event string, data interface{}, userEmail string, requestID string) {
+	webhookserv := &WebhookService{DBService: dbService, RedisService: redisService, UserOptions: userOpt}
+	err := webhookserv.Emit(ctx, workspaceID, channelID, event, data, userEmail, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 8362}).Error(err)
+	}
+}
@@ -0,0 +1,295 @@
+package msgservices
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestWebhookService_Deliveries(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx := context.Background()
+	webhookService := NewWebhookService(dbService, redisService, userOpt)
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	secret := ""
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if r.Header.Get(WebhookEventHeader) != EventChannelCreated {
+			t.Errorf("event header = %v, want %v", r.Header.Get(WebhookEventHeader), EventChannelCreated)
+		}
+		if !VerifyWebhookSignature(secret, body, r.Header.Get(WebhookSignatureHeader)) {
+			t.Errorf("invalid signature %v", r.Header.Get(WebhookSignatureHeader))
+		}
+		// fail the first delivery so that it is retried
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	form := Webhook{}
+	form.WorkspaceID = uint(2)
+	form.TargetURL = ts.URL
+	form.Events = []string{EventChannelCreated}
+	webhook, err := webhookService.CreateWebhook(ctx, &form, "29ea215b-8fb3-4453-b413-81a661e44495", userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	secret = webhook.Secret
+
+	// not subscribed, no delivery is queued
+	err = webhookService.Emit(ctx, uint(2), uint(0), EventMessageCreated, map[string]string{"mtext": "hello"}, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = webhookService.Emit(ctx, uint(2), uint(0), EventChannelCreated, map[string]string{"channel_name": "webhooks"}, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	n, err := webhookService.DeliverPending(ctx, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != 1 {
+		t.Errorf("WebhookService.DeliverPending() = %v, want %v", n, 1)
+	}
+
+	deliveries, err := webhookService.GetWebhookDeliveries(ctx, webhook.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(deliveries) != 1 {
+		t.Errorf("WebhookService.GetWebhookDeliveries() = %v deliveries, want %v", len(deliveries), 1)
+		return
+	}
+	failed := deliveries[0]
+	if failed.DeliveryStatus != DeliveryPending || failed.Attempts != 1 || failed.ResponseCode != http.StatusInternalServerError {
+		t.Errorf("failed delivery = %v, %v, %v", failed.DeliveryStatus, failed.Attempts, failed.ResponseCode)
+	}
+	if !failed.NextAttemptAt.After(time.Now().UTC()) {
+		t.Errorf("next attempt %v is not in the future", failed.NextAttemptAt)
+	}
+
+	redelivery, err := webhookService.Redeliver(ctx, webhook.IDS, failed.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if redelivery.Payload != failed.Payload {
+		t.Errorf("redelivery payload = %v, want %v", redelivery.Payload, failed.Payload)
+	}
+	n, err = webhookService.DeliverPending(ctx, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != 1 {
+		t.Errorf("WebhookService.DeliverPending() = %v, want %v", n, 1)
+	}
+
+	deliveries, err = webhookService.GetWebhookDeliveries(ctx, webhook.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(deliveries) != 2 || deliveries[0].DeliveryStatus != DeliveryDelivered || deliveries[0].ResponseCode != http.StatusOK {
+		t.Errorf("WebhookService.GetWebhookDeliveries() = %v", deliveries)
+	}
+	if requests != 2 {
+		t.Errorf("receiver got %v requests, want %v", requests, 2)
+	}
+}
+
+func TestWebhookService_Admin(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx := context.Background()
+	webhookService := NewWebhookService(dbService, redisService, userOpt)
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	// ann is no admin of workspace 2, which user 1 created
+	annUUID4, err := common.GetUUIDBytes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	annID, err := common.UUIDBytesToStr(annUUID4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = dbService.DB.Exec(`insert into users (id, uuid4, email, username, first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year)
+		select 2, ?, 'ann@example.com', 'ann@example.com', first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year from users where id = 1;`, annUUID4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	form := Webhook{}
+	form.WorkspaceID = uint(2)
+	form.TargetURL = "http://93.184.216.34/hook"
+	form.Events = []string{EventChannelCreated}
+	_, err = webhookService.CreateWebhook(ctx, &form, annID, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("WebhookService.CreateWebhook() error = %v, want %v", err, ErrAccessDenied)
+		return
+	}
+	webhook, err := webhookService.CreateWebhook(ctx, &form, "29ea215b-8fb3-4453-b413-81a661e44495", userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = webhookService.GetWebhookDeliveries(ctx, webhook.IDS, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("WebhookService.GetWebhookDeliveries() error = %v, want %v", err, ErrAccessDenied)
+	}
+	_, err = webhookService.Redeliver(ctx, webhook.IDS, webhook.IDS, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("WebhookService.Redeliver() error = %v, want %v", err, ErrAccessDenied)
+	}
+	err = webhookService.DeleteWebhook(ctx, webhook.IDS, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("WebhookService.DeleteWebhook() error = %v, want %v", err, ErrAccessDenied)
+	}
+	err = webhookService.DeleteWebhook(ctx, webhook.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWebhookService_EmitRestricted(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx := context.Background()
+	webhookService := NewWebhookService(dbService, redisService, userOpt)
+	grantService := NewGrantService(dbService, redisService, userOpt)
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	form := Webhook{}
+	form.WorkspaceID = uint(2)
+	form.TargetURL = "http://93.184.216.34/hook"
+	form.Events = []string{EventMessageCreated}
+	webhook, err := webhookService.CreateWebhook(ctx, &form, "29ea215b-8fb3-4453-b413-81a661e44495", userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// the webhook belongs to ann, who is in no ugroup
+	uuid4, err := common.GetUUIDBytes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = dbService.DB.Exec(`insert into users (id, uuid4, email, username, first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year)
+		select 2, ?, 'ann@example.com', 'ann@example.com', first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year from users where id = 1;`, uuid4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = dbService.DB.Exec(`update webhooks set user_id = 2 where id = ?;`, webhook.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = dbService.DB.Exec(`update users set role = ? where id = 1;`, common.SiteAdminRole)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// without grants ann can read the channel
+	err = webhookService.Emit(ctx, uint(2), uint(1), EventMessageCreated, map[string]string{"mtext": "open"}, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = grantService.CreateGrant(ctx, &UgroupGrant{UgroupID: 2, ChannelID: 1, GrantRole: GrantRead}, "29ea215b-8fb3-4453-b413-81a661e44495", userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// ann is not in the ugroup of the grant, the event is not queued
+	err = webhookService.Emit(ctx, uint(2), uint(1), EventMessageCreated, map[string]string{"mtext": "restricted"}, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	deliveries, err := webhookService.GetWebhookDeliveries(ctx, webhook.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(deliveries) != 1 || !strings.Contains(deliveries[0].Payload, "open") {
+		t.Errorf("WebhookService.GetWebhookDeliveries() = %v, want the delivery made before the grant only", deliveries)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts uint
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{7, 32 * time.Minute},
+		{20, WebhookBackoffMax},
+	}
+	for _, tt := range tests {
+		if got := WebhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("WebhookBackoff(%v) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	// HMAC-SHA256 test vector from RFC 4231, test case 2
+	got := SignWebhookPayload("Jefe", []byte("what do ya want for nothing?"))
+	want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Errorf("SignWebhookPayload() = %v, want %v", got, want)
+	}
+	if !VerifyWebhookSignature("Jefe", []byte("what do ya want for nothing?"), want) {
+		t.Errorf("VerifyWebhookSignature() = false, want true")
+	}
+}
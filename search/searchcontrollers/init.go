@@ -18,5 +18,5 @@ func Init(searchService searchservices.SearchServiceIntf, userService userservic
 
 	mux.Handle("/v0.1/search/", common.AddMiddleware(hrlSearch.RateLimit(sc),
 		common.AuthenticateMiddleware,
-		common.CorsMiddleware))
+		common.CorsMiddleware, common.LocaleMiddleware))
 }
@@ -3,6 +3,9 @@ package searchcontrollers
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
@@ -33,13 +36,23 @@ func (sc *SearchController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		common.RenderErrorJSON(w, "1001", err.Error(), 401, requestID)
 		return
 	}
-	var pathParts []string
-
-	path := r.URL.Path
-	pathParts = common.GetPathParts(path)
+	pathParts, queryString, err := common.ParseURL(r.URL.String())
+	if err != nil {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
+		/*
+		   GET  "/v1/search/typeahead?q=jo&types=user,channel&limit=10"
+		*/
+		if (len(pathParts) == 3) && (pathParts[1] == "search") && (pathParts[2] == "typeahead") {
+			sc.Typeahead(w, r, queryString, user, requestID)
+		} else {
+			common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+			return
+		}
 	case http.MethodPost:
 		/*
 		   GET  "/v1/search/"
@@ -77,7 +90,7 @@ func (sc *SearchController) Search(w http.ResponseWriter, r *http.Request, user
 			common.RenderErrorJSON(w, "7000", err.Error(), 402, requestID)
 			return
 		}
-		SearchResults, err := sc.Service.Search(&form, user.Email, requestID)
+		SearchResults, err := sc.Service.Search(ctx, &form, user.Email, requestID)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"user":   user.Email,
@@ -91,3 +104,54 @@ func (sc *SearchController) Search(w http.ResponseWriter, r *http.Request, user
 		common.RenderJSON(w, SearchResults.Hits)
 	}
 }
+
+// Typeahead - Suggest users, channels, workspaces, ugroups and tags
+// for autocomplete
+func (sc *SearchController) Typeahead(w http.ResponseWriter, r *http.Request, queryString url.Values, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := searchservices.TypeaheadForm{}
+		form.SearchText = strings.TrimSpace(queryString.Get("q"))
+		if types := queryString.Get("types"); types != "" {
+			form.Types = strings.Split(types, ",")
+		}
+		if limit := queryString.Get("limit"); limit != "" {
+			l, err := strconv.Atoi(limit)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"user":   user.Email,
+					"reqid":  requestID,
+					"msgnum": 7023,
+				}).Error(err)
+				common.RenderErrorJSON(w, "7023", err.Error(), 402, requestID)
+				return
+			}
+			form.Limit = l
+		}
+
+		v := common.NewValidator()
+		v.IsStrLenBetMinMax("Search Text", form.SearchText, searchservices.TypeaheadTextLenMin, searchservices.TypeaheadTextLenMax)
+		if v.IsValid() {
+			common.RenderErrorJSON(w, "7024", v.Error(), 402, requestID)
+			return
+		}
+
+		suggestions, err := sc.Service.Typeahead(ctx, &form, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"user":   user.Email,
+				"reqid":  requestID,
+				"msgnum": 7025,
+			}).Error(err)
+			common.RenderErrorJSON(w, "7025", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, suggestions)
+	}
+}
@@ -0,0 +1,194 @@
+package searchservices
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+	log "github.com/sirupsen/logrus"
+)
+
+// Search backends, selected by search_options.backend in the config
+const (
+	BackendBleve = "bleve"
+	BackendMySQL = "mysql"
+)
+
+// QueryRequest - a backend neutral query, Prefix matches every word of
+// Text as the start of a word (used for typeahead), Types restricts the
+// results to the given document types (all types when empty), the
+// channels of ExcludeChannelIDs (ExcludeChannelIDS are their uuids) and
+// their messages are left out
+type QueryRequest struct {
+	Text              string
+	Types             []string
+	Prefix            bool
+	Size              int
+	From              int
+	Fields            []string
+	ExcludeChannelIDs []uint
+	ExcludeChannelIDS []string
+}
+
+// SearchHit - one document matching a query
+type SearchHit struct {
+	ID     string                 `json:"id"`
+	Type   string                 `json:"type"`
+	Score  float64                `json:"score"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// SearchResult - result of a query
+type SearchResult struct {
+	Total uint64       `json:"total"`
+	Hits  []*SearchHit `json:"hits"`
+}
+
+// FacetTerm - number of documents matching a query that have Term
+type FacetTerm struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+// SearchBackend - interface implemented by the search backends,
+// documents are maps of the fields listed in buildIndexMapping
+type SearchBackend interface {
+	Index(docID string, doc map[string]interface{}) error
+	Delete(docID string) error
+	Query(req *QueryRequest) (*SearchResult, error)
+	Facets(req *QueryRequest, field string, size int) ([]*FacetTerm, error)
+}
+
+// BleveBackend - search backend using a bleve index
+type BleveBackend struct {
+	SearchIndex bleve.Index
+}
+
+// NewBleveBackend - Create bleve search backend
+func NewBleveBackend(searchIndex bleve.Index) *BleveBackend {
+	return &BleveBackend{
+		SearchIndex: searchIndex,
+	}
+}
+
+// Index - add or replace a document
+func (b *BleveBackend) Index(docID string, doc map[string]interface{}) error {
+	err := b.SearchIndex.Index(docID, doc)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7372,
+		}).Error(err)
+		return err
+	}
+	return nil
+}
+
+// Delete - remove a document
+func (b *BleveBackend) Delete(docID string) error {
+	err := b.SearchIndex.Delete(docID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7373,
+		}).Error(err)
+		return err
+	}
+	return nil
+}
+
+// Query - search the index
+func (b *BleveBackend) Query(req *QueryRequest) (*SearchResult, error) {
+	searchRequest := bleve.NewSearchRequestOptions(bleveQuery(req), req.Size, req.From, false)
+	searchRequest.Fields = append([]string{"Type"}, req.Fields...)
+	searchResults, err := b.SearchIndex.Search(searchRequest)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7374,
+		}).Error(err)
+		return nil, err
+	}
+
+	result := SearchResult{Total: searchResults.Total, Hits: []*SearchHit{}}
+	for _, hit := range searchResults.Hits {
+		searchHit := SearchHit{ID: hit.ID, Score: hit.Score, Fields: hit.Fields}
+		searchHit.Type, _ = hit.Fields["Type"].(string)
+		result.Hits = append(result.Hits, &searchHit)
+	}
+	return &result, nil
+}
+
+// Facets - the most frequent values of field among the matching documents
+func (b *BleveBackend) Facets(req *QueryRequest, field string, size int) ([]*FacetTerm, error) {
+	searchRequest := bleve.NewSearchRequestOptions(bleveQuery(req), 0, 0, false)
+	searchRequest.AddFacet(field, bleve.NewFacetRequest(field, size))
+	searchResults, err := b.SearchIndex.Search(searchRequest)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7375,
+		}).Error(err)
+		return nil, err
+	}
+	facet, ok := searchResults.Facets[field]
+	if !ok {
+		err = errors.New("Facet not found")
+		log.WithFields(log.Fields{
+			"msgnum": 7376,
+		}).Error(err)
+		return nil, err
+	}
+	terms := []*FacetTerm{}
+	for _, term := range facet.Terms {
+		terms = append(terms, &FacetTerm{Term: term.Term, Count: term.Count})
+	}
+	return terms, nil
+}
+
+// bleveQuery - the bleve query for a request, prefix queries match the
+// text against the edge ngrams of the "Suggest" field
+func bleveQuery(req *QueryRequest) query.Query {
+	matchQuery := bleve.NewMatchQuery(req.Text)
+	if req.Prefix {
+		matchQuery.SetField(suggestFieldName)
+		matchQuery.Analyzer = "enLowercase"
+		matchQuery.SetOperator(query.MatchQueryOperatorAnd)
+	}
+
+	var q query.Query = matchQuery
+	if strings.TrimSpace(req.Text) == "" {
+		q = bleve.NewMatchAllQuery()
+	}
+	if len(req.Types) > 0 {
+		typeQueries := []query.Query{}
+		for _, docType := range req.Types {
+			typeQuery := bleve.NewTermQuery(docType)
+			typeQuery.SetField("Type")
+			typeQueries = append(typeQueries, typeQuery)
+		}
+		q = bleve.NewConjunctionQuery(q, bleve.NewDisjunctionQuery(typeQueries...))
+	}
+	if len(req.ExcludeChannelIDs) > 0 {
+		// messages have the channel id as Pid, channels their uuid
+		excluded := []query.Query{}
+		for _, channelID := range req.ExcludeChannelIDs {
+			excluded = append(excluded, bleveTypePidQuery(DocTypeMessage, strconv.FormatUint(uint64(channelID), 10)))
+		}
+		for _, channelIDS := range req.ExcludeChannelIDS {
+			excluded = append(excluded, bleveTypePidQuery(DocTypeChannel, channelIDS))
+		}
+		boolQuery := bleve.NewBooleanQuery()
+		boolQuery.AddMust(q)
+		boolQuery.AddMustNot(excluded...)
+		q = boolQuery
+	}
+	return q
+}
+
+// bleveTypePidQuery - the documents of docType with Pid
+func bleveTypePidQuery(docType string, pid string) query.Query {
+	typeQuery := bleve.NewTermQuery(docType)
+	typeQuery.SetField("Type")
+	pidQuery := bleve.NewTermQuery(pid)
+	pidQuery.SetField("Pid")
+	return bleve.NewConjunctionQuery(typeQuery, pidQuery)
+}
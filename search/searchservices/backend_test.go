@@ -0,0 +1,136 @@
+package searchservices
+
+import (
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestBleveBackend_Facets(t *testing.T) {
+	indexMapping, err := buildIndexMapping()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	index, err := bleve.NewMemOnly(indexMapping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	backend := NewBleveBackend(index)
+	docs := map[string]map[string]interface{}{
+		"channel##1": {"Type": DocTypeChannel, "ChannelName": "Go project", "Tags": []string{"go", "backend"}, "Pid": "1"},
+		"channel##2": {"Type": DocTypeChannel, "ChannelName": "Go tooling", "Tags": []string{"go"}, "Pid": "2"},
+		"channel##3": {"Type": DocTypeChannel, "ChannelName": "Design", "Tags": []string{"ui"}, "Pid": "3"},
+	}
+	for docID, doc := range docs {
+		err = backend.Index(docID, doc)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	terms, err := backend.Facets(&QueryRequest{Text: "go"}, "Tags", 10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(terms) != 2 || terms[0].Term != "go" || terms[0].Count != 2 || terms[1].Term != "backend" {
+		t.Errorf("BleveBackend.Facets() got %+v", terms)
+	}
+
+	err = backend.Delete("channel##2")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result, err := backend.Query(&QueryRequest{Text: "go", Size: 10, Fields: []string{"Pid"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result.Total != 1 || result.Hits[0].ID != "channel##1" || result.Hits[0].Type != DocTypeChannel {
+		t.Errorf("BleveBackend.Query() got %+v", result)
+	}
+}
+
+func TestMysqlAgainst(t *testing.T) {
+	tests := []struct {
+		req     *QueryRequest
+		against string
+		mode    string
+	}{
+		{&QueryRequest{Text: "john doe"}, "john doe", mysqlNaturalLanguageMode},
+		{&QueryRequest{Text: "joh d", Prefix: true}, "+joh* +d*", mysqlBooleanMode},
+		{&QueryRequest{Text: `-jo"h* (x)`, Prefix: true}, "+joh* +x*", mysqlBooleanMode},
+	}
+	for _, tt := range tests {
+		against, mode := mysqlAgainst(tt.req)
+		if against != tt.against || mode != tt.mode {
+			t.Errorf("mysqlAgainst(%v) = %v, %v, want %v, %v", tt.req.Text, against, mode, tt.against, tt.mode)
+		}
+	}
+}
+
+func TestTagMatches(t *testing.T) {
+	tests := []struct {
+		tag    string
+		words  []string
+		prefix bool
+		want   bool
+	}{
+		{"machine-learning", []string{"learning"}, false, true},
+		{"machine-learning", []string{"learn"}, false, false},
+		{"machine-learning", []string{"mach", "lea"}, true, true},
+		{"golang", []string{"rust"}, true, false},
+	}
+	for _, tt := range tests {
+		if got := tagMatches(tt.tag, tt.words, tt.prefix); got != tt.want {
+			t.Errorf("tagMatches(%v, %v, %v) = %v, want %v", tt.tag, tt.words, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestBleveBackend_QueryExclude(t *testing.T) {
+	indexMapping, err := buildIndexMapping()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	index, err := bleve.NewMemOnly(indexMapping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	backend := NewBleveBackend(index)
+	docs := map[string]map[string]interface{}{
+		"channel##c1": {"Type": DocTypeChannel, "ChannelName": "Go project", "Pid": "c1"},
+		"channel##c2": {"Type": DocTypeChannel, "ChannelName": "Go tooling", "Pid": "c2"},
+		"1##1":        {"Type": DocTypeMessage, "Name": "Go project", "MessageText": "go release", "Pid": "1"},
+		"2##2":        {"Type": DocTypeMessage, "Name": "Go tooling", "MessageText": "go vet", "Pid": "2"},
+	}
+	for docID, doc := range docs {
+		err = backend.Index(docID, doc)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// channel 1 (uuid c1) and its messages are left out of the hits and the total
+	result, err := backend.Query(&QueryRequest{Text: "go", Size: 10, ExcludeChannelIDs: []uint{1}, ExcludeChannelIDS: []string{"c1"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result.Total != 2 || len(result.Hits) != 2 {
+		t.Errorf("BleveBackend.Query() got %+v", result)
+		return
+	}
+	for _, hit := range result.Hits {
+		if hit.ID != "channel##c2" && hit.ID != "2##2" {
+			t.Errorf("BleveBackend.Query() got excluded hit %v", hit.ID)
+		}
+	}
+}
@@ -0,0 +1,598 @@
+package searchservices
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+// The live index path is a symlink to a versioned index directory
+// "<index_path>.v<mapping_version>.<unix time>", a reindex builds a new
+// directory next to it and then atomically replaces the symlink
+
+// mappingVersionKey - internal key holding the mapping version of an index
+var mappingVersionKey = []byte("_mapping_version")
+
+// DocTypes - all the document types stored in the search index
+var DocTypes = []string{DocTypeMessage, DocTypeChannel, DocTypeWorkspace, DocTypeUser, DocTypeUgroup, DocTypeTag}
+
+// IndexStats - stats of an index
+type IndexStats struct {
+	Path           string            `json:"path"`
+	MappingVersion int               `json:"mapping_version"`
+	DocCount       uint64            `json:"doc_count"`
+	TypeCounts     map[string]uint64 `json:"type_counts"`
+	SizeBytes      int64             `json:"size_bytes"`
+}
+
+// TypeVerification - the index and MySQL document counts of a type
+type TypeVerification struct {
+	Type       string `json:"type"`
+	IndexCount uint64 `json:"index_count"`
+	DBCount    uint64 `json:"db_count"`
+}
+
+// IndexVerification - result of verifying an index against MySQL
+type IndexVerification struct {
+	Path           string              `json:"path"`
+	MappingVersion int                 `json:"mapping_version"`
+	Types          []*TypeVerification `json:"types"`
+	OK             bool                `json:"ok"`
+}
+
+// GetIndexPath - absolute path of the live index, relative
+// paths are resolved from the working directory
+func GetIndexPath(searchOpt *common.SearchOptions) string {
+	indexPath := filepath.FromSlash(searchOpt.IndexPath)
+	if !filepath.IsAbs(indexPath) {
+		pwd, _ := os.Getwd()
+		indexPath = filepath.Join(pwd, indexPath)
+	}
+	return indexPath
+}
+
+// ReloadInterval - how often the server checks for a swapped index
+func ReloadInterval(searchOpt *common.SearchOptions) time.Duration {
+	interval, err := time.ParseDuration(searchOpt.ReloadInterval)
+	if err != nil || interval <= 0 {
+		return 30 * time.Second
+	}
+	return interval
+}
+
+// OpenIndex - open the live index read only
+func OpenIndex(searchOpt *common.SearchOptions) (bleve.Index, error) {
+	index, err := bleve.OpenUsing(GetIndexPath(searchOpt), map[string]interface{}{
+		"read_only": true,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7329,
+		}).Error(err)
+		return nil, err
+	}
+	version, err := getMappingVersion(index)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7330,
+		}).Error(err)
+		_ = index.Close()
+		return nil, err
+	}
+	if version != searchOpt.MappingVersion {
+		log.WithFields(log.Fields{
+			"msgnum": 7331,
+		}).Warn(fmt.Sprintf("search index mapping version %d, config mapping version %d, run vilom search reindex", version, searchOpt.MappingVersion))
+	}
+	return index, nil
+}
+
+// WatchIndex - reopen the live index when the symlink is swapped by a
+// reindex or compact, the old index is closed once it is no longer used
+func WatchIndex(alias bleve.IndexAlias, current bleve.Index, searchOpt *common.SearchOptions) {
+	indexPath := GetIndexPath(searchOpt)
+	target, _ := os.Readlink(indexPath)
+	ticker := time.NewTicker(ReloadInterval(searchOpt))
+	defer ticker.Stop()
+	for range ticker.C {
+		newTarget, err := os.Readlink(indexPath)
+		if err != nil || newTarget == target {
+			continue
+		}
+		index, err := OpenIndex(searchOpt)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7332,
+			}).Error(err)
+			continue
+		}
+		if current == nil {
+			alias.Add(index)
+		} else {
+			alias.Swap([]bleve.Index{index}, []bleve.Index{current})
+			err = current.Close()
+			if err != nil {
+				log.WithFields(log.Fields{
+					"msgnum": 7333,
+				}).Error(err)
+			}
+		}
+		log.WithFields(log.Fields{
+			"msgnum": 7334,
+		}).Info("search index reloaded from " + newTarget)
+		current = index
+		target = newTarget
+	}
+}
+
+// Reindex - build a new index from MySQL next to the live one,
+// verify it and atomically swap it in
+func Reindex(searchOpt *common.SearchOptions, db *sql.DB) (*IndexVerification, error) {
+	indexPath := GetIndexPath(searchOpt)
+	err := os.MkdirAll(filepath.Dir(indexPath), 0755)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7335,
+		}).Error(err)
+		return nil, err
+	}
+	newPath, index, err := newVersionedIndex(indexPath, searchOpt.MappingVersion)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7336,
+		}).Error(err)
+		return nil, err
+	}
+
+	err = IndexAll(db, index)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7337,
+		}).Error(err)
+		_ = index.Close()
+		_ = os.RemoveAll(newPath)
+		return nil, err
+	}
+
+	verification, err := verifyIndex(index, newPath, db)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7338,
+		}).Error(err)
+		_ = index.Close()
+		_ = os.RemoveAll(newPath)
+		return nil, err
+	}
+	err = index.Close()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7339,
+		}).Error(err)
+		return nil, err
+	}
+	if !verification.OK {
+		_ = os.RemoveAll(newPath)
+		err = errors.New("search index document counts do not match the database")
+		log.WithFields(log.Fields{
+			"msgnum": 7340,
+		}).Error(err)
+		return verification, err
+	}
+
+	err = swapIndex(indexPath, newPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7341,
+		}).Error(err)
+		_ = os.RemoveAll(newPath)
+		return nil, err
+	}
+	return verification, nil
+}
+
+// VerifyIndex - compare the document counts of the live index against MySQL
+func VerifyIndex(searchOpt *common.SearchOptions, db *sql.DB) (*IndexVerification, error) {
+	index, err := OpenIndex(searchOpt)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7342,
+		}).Error(err)
+		return nil, err
+	}
+	defer index.Close()
+	return verifyIndex(index, GetIndexPath(searchOpt), db)
+}
+
+// GetIndexStats - document counts and size of the live index
+func GetIndexStats(searchOpt *common.SearchOptions) (*IndexStats, error) {
+	index, err := OpenIndex(searchOpt)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7343,
+		}).Error(err)
+		return nil, err
+	}
+	defer index.Close()
+	return indexStats(index, GetIndexPath(searchOpt))
+}
+
+// CompactIndex - copy the stored documents of the live index into a
+// new index, dropping the space held by deleted documents, and swap it in
+func CompactIndex(searchOpt *common.SearchOptions) (*IndexStats, error) {
+	indexPath := GetIndexPath(searchOpt)
+	index, err := OpenIndex(searchOpt)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7344,
+		}).Error(err)
+		return nil, err
+	}
+	defer index.Close()
+
+	// the documents keep the mapping they were indexed with
+	version, err := getMappingVersion(index)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7371,
+		}).Error(err)
+		return nil, err
+	}
+	newPath, newIndex, err := newVersionedIndex(indexPath, version)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7345,
+		}).Error(err)
+		return nil, err
+	}
+
+	err = copyIndex(index, newIndex)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7346,
+		}).Error(err)
+		_ = newIndex.Close()
+		_ = os.RemoveAll(newPath)
+		return nil, err
+	}
+
+	stats, err := indexStats(newIndex, newPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7347,
+		}).Error(err)
+		_ = newIndex.Close()
+		_ = os.RemoveAll(newPath)
+		return nil, err
+	}
+	err = newIndex.Close()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7348,
+		}).Error(err)
+		return nil, err
+	}
+
+	docCount, err := index.DocCount()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7349,
+		}).Error(err)
+		_ = os.RemoveAll(newPath)
+		return nil, err
+	}
+	if docCount != stats.DocCount {
+		_ = os.RemoveAll(newPath)
+		err = fmt.Errorf("compacted index has %d documents, live index has %d", stats.DocCount, docCount)
+		log.WithFields(log.Fields{
+			"msgnum": 7350,
+		}).Error(err)
+		return nil, err
+	}
+
+	err = swapIndex(indexPath, newPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7351,
+		}).Error(err)
+		_ = os.RemoveAll(newPath)
+		return nil, err
+	}
+	stats.Path = indexPath
+	return stats, nil
+}
+
+// newVersionedIndex - create an empty index next to the live one
+func newVersionedIndex(indexPath string, mappingVersion int) (string, bleve.Index, error) {
+	indexMapping, err := buildIndexMapping()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7352,
+		}).Error(err)
+		return "", nil, err
+	}
+	newPath := fmt.Sprintf("%s.v%d.%d", indexPath, mappingVersion, time.Now().UnixNano())
+	index, err := bleve.New(newPath, indexMapping)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7353,
+		}).Error(err)
+		return "", nil, err
+	}
+	err = index.SetInternal(mappingVersionKey, []byte(strconv.Itoa(mappingVersion)))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7354,
+		}).Error(err)
+		_ = index.Close()
+		_ = os.RemoveAll(newPath)
+		return "", nil, err
+	}
+	return newPath, index, nil
+}
+
+// swapIndex - point the live index symlink at newPath, the symlink is
+// created under a temporary name and renamed over the live path so that
+// readers always see either the old or the new index, the previous
+// index is kept for rollback and older ones are removed
+func swapIndex(indexPath string, newPath string) error {
+	fi, err := os.Lstat(indexPath)
+	if err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		// an index built before versioning, keep it next to the new ones
+		legacyPath := fmt.Sprintf("%s.v0.%d", indexPath, time.Now().UnixNano())
+		err = os.Rename(indexPath, legacyPath)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7355,
+			}).Error(err)
+			return err
+		}
+	} else if err != nil && !os.IsNotExist(err) {
+		log.WithFields(log.Fields{
+			"msgnum": 7356,
+		}).Error(err)
+		return err
+	}
+	oldTarget, _ := os.Readlink(indexPath)
+
+	tmpLink := indexPath + ".swap"
+	_ = os.Remove(tmpLink)
+	err = os.Symlink(filepath.Base(newPath), tmpLink)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7357,
+		}).Error(err)
+		return err
+	}
+	err = os.Rename(tmpLink, indexPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7358,
+		}).Error(err)
+		_ = os.Remove(tmpLink)
+		return err
+	}
+
+	pruneIndexes(indexPath, []string{filepath.Base(newPath), filepath.Base(oldTarget)})
+	return nil
+}
+
+// pruneIndexes - remove the versioned indexes that are not in keep
+func pruneIndexes(indexPath string, keep []string) {
+	matches, err := filepath.Glob(indexPath + ".v*")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7359,
+		}).Error(err)
+		return
+	}
+	for _, match := range matches {
+		kept := false
+		for _, k := range keep {
+			if k == filepath.Base(match) {
+				kept = true
+			}
+		}
+		if kept {
+			continue
+		}
+		err = os.RemoveAll(match)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7360,
+			}).Error(err)
+		}
+	}
+}
+
+// getMappingVersion - mapping version stored in the index, 0 for
+// indexes built before versioning
+func getMappingVersion(index bleve.Index) (int, error) {
+	v, err := index.GetInternal(mappingVersionKey)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7361,
+		}).Error(err)
+		return 0, err
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+	return strconv.Atoi(string(v))
+}
+
+// indexStats - document counts per type of an index
+func indexStats(index bleve.Index, indexPath string) (*IndexStats, error) {
+	stats := IndexStats{Path: indexPath, TypeCounts: make(map[string]uint64)}
+	var err error
+	stats.MappingVersion, err = getMappingVersion(index)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7362,
+		}).Error(err)
+		return nil, err
+	}
+	stats.DocCount, err = index.DocCount()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7363,
+		}).Error(err)
+		return nil, err
+	}
+	for _, docType := range DocTypes {
+		q := bleve.NewTermQuery(docType)
+		q.SetField("Type")
+		searchRequest := bleve.NewSearchRequestOptions(q, 0, 0, false)
+		searchResult, err := index.Search(searchRequest)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7364,
+			}).Error(err)
+			return nil, err
+		}
+		stats.TypeCounts[docType] = searchResult.Total
+	}
+	stats.SizeBytes = dirSize(indexPath)
+	return &stats, nil
+}
+
+// verifyIndex - compare the document counts of an index against MySQL
+func verifyIndex(index bleve.Index, indexPath string, db *sql.DB) (*IndexVerification, error) {
+	stats, err := indexStats(index, indexPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7365,
+		}).Error(err)
+		return nil, err
+	}
+	dbCounts, err := getDBCounts(db)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7366,
+		}).Error(err)
+		return nil, err
+	}
+	verification := IndexVerification{Path: indexPath, MappingVersion: stats.MappingVersion, OK: true}
+	for _, docType := range DocTypes {
+		typeVerification := TypeVerification{Type: docType, IndexCount: stats.TypeCounts[docType], DBCount: dbCounts[docType]}
+		if typeVerification.IndexCount != typeVerification.DBCount {
+			verification.OK = false
+		}
+		verification.Types = append(verification.Types, &typeVerification)
+	}
+	return &verification, nil
+}
+
+// getDBCounts - number of documents of each type that IndexAll indexes
+func getDBCounts(db *sql.DB) (map[string]uint64, error) {
+	counts := make(map[string]uint64)
+	queries := map[string]string{
+		DocTypeMessage:   `select count(*) from message_texts mt inner join channels c on (mt.channel_id = c.id)`,
+		DocTypeChannel:   `select count(*) from channels`,
+		DocTypeWorkspace: `select count(*) from workspaces where statusc = ?`,
+		DocTypeUser:      `select count(*) from users where statusc = ?`,
+		DocTypeUgroup:    `select count(*) from ugroups where statusc = ?`,
+	}
+	for docType, countSQL := range queries {
+		args := []interface{}{}
+		if strings.Contains(countSQL, "?") {
+			args = append(args, common.Active)
+		}
+		var count uint64
+		err := db.QueryRow(countSQL, args...).Scan(&count)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7367,
+			}).Error(err)
+			return nil, err
+		}
+		counts[docType] = count
+	}
+
+	// tags are normalized before indexing, so count them the same way
+	channels, err := getChannels(db)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7368,
+		}).Error(err)
+		return nil, err
+	}
+	tags := make(map[string]bool)
+	for _, channel := range channels {
+		for _, tag := range channelTags(channel) {
+			tags[tag] = true
+		}
+	}
+	counts[DocTypeTag] = uint64(len(tags))
+	return counts, nil
+}
+
+// copyIndex - copy the stored fields of all the documents of src into
+// dst, paging through src in document id order
+func copyIndex(src bleve.Index, dst bleve.Index) error {
+	batch := dst.NewBatch()
+	var after []string
+	for {
+		searchRequest := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 500, 0, false)
+		searchRequest.Fields = []string{"*"}
+		searchRequest.SortBy([]string{"_id"})
+		if after != nil {
+			searchRequest.SetSearchAfter(after)
+		}
+		searchResult, err := src.Search(searchRequest)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7369,
+			}).Error(err)
+			return err
+		}
+		if len(searchResult.Hits) == 0 {
+			break
+		}
+		for _, hit := range searchResult.Hits {
+			err = indexDoc(dst, &batch, hit.ID, storedDoc(hit))
+			if err != nil {
+				log.WithFields(log.Fields{
+					"msgnum": 7370,
+				}).Error(err)
+				return err
+			}
+		}
+		after = []string{searchResult.Hits[len(searchResult.Hits)-1].ID}
+	}
+	return flushBatch(dst, batch)
+}
+
+// storedDoc - rebuild a document from the stored fields of a hit
+func storedDoc(hit *search.DocumentMatch) map[string]interface{} {
+	doc := make(map[string]interface{}, len(hit.Fields))
+	for k, v := range hit.Fields {
+		doc[k] = v
+	}
+	return doc
+}
+
+// dirSize - total size of the files under path, following the live symlink
+func dirSize(path string) int64 {
+	var size int64
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	_ = filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
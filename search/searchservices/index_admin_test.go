@@ -0,0 +1,97 @@
+package searchservices
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+func TestCompactIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vilom-search")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	searchOpt := &common.SearchOptions{IndexPath: filepath.Join(dir, "channels.bleve"), MappingVersion: 2}
+	indexPath := GetIndexPath(searchOpt)
+
+	newPath, index, err := newVersionedIndex(indexPath, searchOpt.MappingVersion)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	docs := map[string]map[string]interface{}{
+		"user##1":      {"Type": DocTypeUser, "Username": "johnd", "Pid": "1", suggestFieldName: "johnd John Doe"},
+		"channel##2":   {"Type": DocTypeChannel, "ChannelName": "Johnson Project", "Pid": "2", suggestFieldName: "Johnson Project"},
+		"workspace##3": {"Type": DocTypeWorkspace, "WorkspaceName": "Drive", "Pid": "3", suggestFieldName: "Drive"},
+	}
+	for docID, doc := range docs {
+		err = index.Index(docID, doc)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	err = index.Delete("workspace##3")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = index.Close()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = swapIndex(indexPath, newPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	stats, err := GetIndexStats(searchOpt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.DocCount != 2 || stats.TypeCounts[DocTypeUser] != 1 || stats.TypeCounts[DocTypeWorkspace] != 0 || stats.MappingVersion != 2 {
+		t.Errorf("GetIndexStats() = %+v", stats)
+	}
+
+	stats, err = CompactIndex(searchOpt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.DocCount != 2 || stats.TypeCounts[DocTypeChannel] != 1 {
+		t.Errorf("CompactIndex() = %+v", stats)
+	}
+	target, err := os.Readlink(indexPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if target == filepath.Base(newPath) {
+		t.Errorf("CompactIndex() did not swap the index, still %v", target)
+	}
+
+	index, err = OpenIndex(searchOpt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer index.Close()
+	searchService := NewSearchService(nil, nil, nil, NewBleveBackend(index))
+	suggestions, err := searchService.Typeahead(context.Background(), &TypeaheadForm{SearchText: "joh"}, "", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(suggestions) != 2 {
+		t.Errorf("Typeahead() after compact got %v suggestions, want 2", len(suggestions))
+	}
+}
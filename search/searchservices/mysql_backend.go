@@ -0,0 +1,482 @@
+package searchservices
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+// MySQLBackend - search backend using the FULLTEXT indexes of the
+// tables, there is no separate index to build, so small deployments
+// can run without the on-disk bleve index. InnoDB ignores words shorter
+// than innodb_ft_min_token_size (3 by default) and stopwords.
+type MySQLBackend struct {
+	DB *sql.DB
+}
+
+// NewMySQLBackend - Create MySQL search backend
+func NewMySQLBackend(db *sql.DB) *MySQLBackend {
+	return &MySQLBackend{
+		DB: db,
+	}
+}
+
+// mysqlDocType - how a document type is read from its table, Select
+// lists the columns of the document fields in the order of Fields,
+// the first column is the uuid4 (the channel id for messages)
+type mysqlDocType struct {
+	Select string
+	From   string
+	Where  string
+	Match  string
+	Fields []string
+}
+
+var mysqlDocTypes = map[string]*mysqlDocType{
+	DocTypeMessage: {
+		Select: "mt.channel_id, mt.id, c.channel_name, c.channel_desc, mt.mtext",
+		From:   "message_texts mt inner join channels c on (mt.channel_id = c.id)",
+		Match:  "mt.mtext",
+		Fields: []string{"Pid", "", "Name", "Description", "MessageText"},
+	},
+	DocTypeChannel: {
+		Select: "c.uuid4, c.channel_name, c.channel_desc",
+		From:   "channels c",
+		Match:  "c.channel_name, c.channel_desc",
+		Fields: []string{"Pid", "ChannelName", "ChannelDesc"},
+	},
+	DocTypeWorkspace: {
+		Select: "w.uuid4, w.workspace_name, w.workspace_desc",
+		From:   "workspaces w",
+		Where:  "w.statusc = ?",
+		Match:  "w.workspace_name, w.workspace_desc",
+		Fields: []string{"Pid", "WorkspaceName", "WorkspaceDesc"},
+	},
+	DocTypeUser: {
+		Select: "u.uuid4, u.username, u.first_name, u.last_name",
+		From:   "users u",
+		Where:  "u.statusc = ?",
+		Match:  "u.username, u.first_name, u.last_name",
+		Fields: []string{"Pid", "Username", "FirstName", "LastName"},
+	},
+	DocTypeUgroup: {
+		Select: "g.uuid4, g.ugroup_name, g.ugroup_desc",
+		From:   "ugroups g",
+		Where:  "g.statusc = ?",
+		Match:  "g.ugroup_name, g.ugroup_desc",
+		Fields: []string{"Pid", "UgroupName", "UgroupDesc"},
+	},
+}
+
+// channelTagsMatch - the tag columns of the ft_channels_tags index
+const channelTagsMatch = "c.tag1, c.tag2, c.tag3, c.tag4, c.tag5, c.tag6, c.tag7, c.tag8, c.tag9, c.tag10"
+
+// Index - the tables are the index, nothing to do
+func (b *MySQLBackend) Index(docID string, doc map[string]interface{}) error {
+	return nil
+}
+
+// Delete - the tables are the index, nothing to do
+func (b *MySQLBackend) Delete(docID string) error {
+	return nil
+}
+
+// Query - run the query against the FULLTEXT index of every type
+// and merge the results by score
+func (b *MySQLBackend) Query(req *QueryRequest) (*SearchResult, error) {
+	against, mode := mysqlAgainst(req)
+	result := SearchResult{Hits: []*SearchHit{}}
+	for _, docType := range queryTypes(req) {
+		var hits []*SearchHit
+		var err error
+		if docType == DocTypeTag {
+			hits, err = b.queryTags(req, against, mode)
+		} else {
+			hits, err = b.queryType(req, docType, req.From+req.Size, against, mode)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7377,
+			}).Error(err)
+			return nil, err
+		}
+		count, err := b.countType(req, docType, against, mode)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7378,
+			}).Error(err)
+			return nil, err
+		}
+		result.Total = result.Total + count
+		result.Hits = append(result.Hits, hits...)
+	}
+
+	sort.SliceStable(result.Hits, func(i, j int) bool {
+		return result.Hits[i].Score > result.Hits[j].Score
+	})
+	if req.From >= len(result.Hits) {
+		result.Hits = []*SearchHit{}
+	} else {
+		result.Hits = result.Hits[req.From:]
+	}
+	if len(result.Hits) > req.Size {
+		result.Hits = result.Hits[:req.Size]
+	}
+	return &result, nil
+}
+
+// Facets - the number of matching documents of each type ("Type"),
+// or the most frequent tags of the matching channels ("Tags")
+func (b *MySQLBackend) Facets(req *QueryRequest, field string, size int) ([]*FacetTerm, error) {
+	against, mode := mysqlAgainst(req)
+	terms := []*FacetTerm{}
+	switch field {
+	case "Type":
+		for _, docType := range queryTypes(req) {
+			count, err := b.countType(req, docType, against, mode)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"msgnum": 7379,
+				}).Error(err)
+				return nil, err
+			}
+			if count > 0 {
+				terms = append(terms, &FacetTerm{Term: docType, Count: int(count)})
+			}
+		}
+	case "Tags":
+		rows, err := b.DB.Query(`select c.tag1, c.tag2, c.tag3, c.tag4, c.tag5, c.tag6, c.tag7, c.tag8, c.tag9, c.tag10
+		 from channels c where match(c.channel_name, c.channel_desc) against (? `+mode+`)`, against)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7380,
+			}).Error(err)
+			return nil, err
+		}
+		counts := make(map[string]int)
+		for rows.Next() {
+			tags, err := scanTags(rows)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"msgnum": 7381,
+				}).Error(err)
+				_ = rows.Close()
+				return nil, err
+			}
+			for _, tag := range tags {
+				counts[tag]++
+			}
+		}
+		err = rows.Close()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7382,
+			}).Error(err)
+			return nil, err
+		}
+		for term, count := range counts {
+			terms = append(terms, &FacetTerm{Term: term, Count: count})
+		}
+	default:
+		err := errors.New("Facet " + field + " is not supported by the mysql search backend")
+		log.WithFields(log.Fields{
+			"msgnum": 7383,
+		}).Error(err)
+		return nil, err
+	}
+
+	sort.SliceStable(terms, func(i, j int) bool {
+		if terms[i].Count == terms[j].Count {
+			return terms[i].Term < terms[j].Term
+		}
+		return terms[i].Count > terms[j].Count
+	})
+	if len(terms) > size {
+		terms = terms[:size]
+	}
+	return terms, nil
+}
+
+// queryType - the best matching documents of a type
+func (b *MySQLBackend) queryType(req *QueryRequest, docType string, limit int, against string, mode string) ([]*SearchHit, error) {
+	t := mysqlDocTypes[docType]
+	where := "match(" + t.Match + ") against (? " + mode + ")"
+	args := []interface{}{against, against}
+	if t.Where != "" {
+		where = t.Where + " and " + where
+		args = []interface{}{against, common.Active, against}
+	}
+	if exclude, excludeArgs := mysqlExclude(req, docType); exclude != "" {
+		where = where + " and " + exclude
+		args = append(args, excludeArgs...)
+	}
+	args = append(args, limit)
+	rows, err := b.DB.Query(`select `+t.Select+`, match(`+t.Match+`) against (? `+mode+`) as score
+	 from `+t.From+` where `+where+` order by score desc limit ?`, args...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7384,
+		}).Error(err)
+		return nil, err
+	}
+
+	hits := []*SearchHit{}
+	for rows.Next() {
+		values := make([]sql.NullString, len(t.Fields))
+		dest := make([]interface{}, len(t.Fields)+1)
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		hit := SearchHit{Type: docType, Fields: map[string]interface{}{"Type": docType}}
+		dest[len(t.Fields)] = &hit.Score
+		err = rows.Scan(dest...)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7385,
+			}).Error(err)
+			_ = rows.Close()
+			return nil, err
+		}
+		if docType == DocTypeMessage {
+			hit.ID = values[0].String + "##" + values[1].String
+		} else {
+			// the id column is the binary uuid4
+			values[0].String, err = common.UUIDBytesToStr([]byte(values[0].String))
+			if err != nil {
+				log.WithFields(log.Fields{
+					"msgnum": 7386,
+				}).Error(err)
+				_ = rows.Close()
+				return nil, err
+			}
+			hit.ID = docType + "##" + values[0].String
+		}
+		for i, field := range t.Fields {
+			if field != "" {
+				hit.Fields[field] = values[i].String
+			}
+		}
+		hits = append(hits, &hit)
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7387,
+		}).Error(err)
+		return nil, err
+	}
+	return hits, nil
+}
+
+// queryTags - the tags of the channels matching the query, every
+// matching tag is one document scored by the number of its channels
+func (b *MySQLBackend) queryTags(req *QueryRequest, against string, mode string) ([]*SearchHit, error) {
+	counts, err := b.matchingTags(req, against, mode)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7388,
+		}).Error(err)
+		return nil, err
+	}
+	hits := []*SearchHit{}
+	for tag, count := range counts {
+		hits = append(hits, &SearchHit{
+			ID:    DocTypeTag + "##" + tag,
+			Type:  DocTypeTag,
+			Score: float64(count),
+			Fields: map[string]interface{}{
+				"Type":        DocTypeTag,
+				"Tag":         tag,
+				"Pid":         tag,
+				"NumChannels": strconv.Itoa(count),
+			},
+		})
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+	return hits, nil
+}
+
+// matchingTags - the tags matching every word of the query, with the
+// number of channels having the tag
+func (b *MySQLBackend) matchingTags(req *QueryRequest, against string, mode string) (map[string]int, error) {
+	rows, err := b.DB.Query(`select c.tag1, c.tag2, c.tag3, c.tag4, c.tag5, c.tag6, c.tag7, c.tag8, c.tag9, c.tag10
+	 from channels c where match(`+channelTagsMatch+`) against (? `+mode+`)`, against)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7389,
+		}).Error(err)
+		return nil, err
+	}
+	words := strings.Fields(strings.ToLower(req.Text))
+	counts := make(map[string]int)
+	for rows.Next() {
+		tags, err := scanTags(rows)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7390,
+			}).Error(err)
+			_ = rows.Close()
+			return nil, err
+		}
+		for _, tag := range tags {
+			if tagMatches(tag, words, req.Prefix) {
+				counts[tag]++
+			}
+		}
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7391,
+		}).Error(err)
+		return nil, err
+	}
+	return counts, nil
+}
+
+// countType - the number of documents of a type matching the query
+func (b *MySQLBackend) countType(req *QueryRequest, docType string, against string, mode string) (uint64, error) {
+	if docType == DocTypeTag {
+		counts, err := b.matchingTags(req, against, mode)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7392,
+			}).Error(err)
+			return 0, err
+		}
+		return uint64(len(counts)), nil
+	}
+	t := mysqlDocTypes[docType]
+	where := "match(" + t.Match + ") against (? " + mode + ")"
+	args := []interface{}{against}
+	if t.Where != "" {
+		where = t.Where + " and " + where
+		args = []interface{}{common.Active, against}
+	}
+	if exclude, excludeArgs := mysqlExclude(req, docType); exclude != "" {
+		where = where + " and " + exclude
+		args = append(args, excludeArgs...)
+	}
+	var count uint64
+	err := b.DB.QueryRow(`select count(*) from `+t.From+` where `+where, args...).Scan(&count)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7393,
+		}).Error(err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// mysqlExclude - the condition leaving out the excluded channels and
+// their messages, "" for the other types or when there are none
+func mysqlExclude(req *QueryRequest, docType string) (string, []interface{}) {
+	column := ""
+	switch docType {
+	case DocTypeMessage:
+		column = "mt.channel_id"
+	case DocTypeChannel:
+		column = "c.id"
+	}
+	if column == "" || len(req.ExcludeChannelIDs) == 0 {
+		return "", nil
+	}
+	args := []interface{}{}
+	for _, channelID := range req.ExcludeChannelIDs {
+		args = append(args, channelID)
+	}
+	return column + " not in (" + strings.TrimSuffix(strings.Repeat("?,", len(args)), ",") + ")", args
+}
+
+const (
+	mysqlBooleanMode         = "in boolean mode"
+	mysqlNaturalLanguageMode = "in natural language mode"
+)
+
+// mysqlAgainst - the AGAINST text and search modifier of a request,
+// prefix requests require every word as a prefix ("+joh* +do*")
+func mysqlAgainst(req *QueryRequest) (string, string) {
+	if !req.Prefix {
+		return req.Text, mysqlNaturalLanguageMode
+	}
+	words := []string{}
+	for _, word := range strings.Fields(req.Text) {
+		word = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`+-<>()~*"@`, r) {
+				return -1
+			}
+			return r
+		}, word)
+		if word != "" {
+			words = append(words, fmt.Sprintf("+%s*", word))
+		}
+	}
+	return strings.Join(words, " "), mysqlBooleanMode
+}
+
+// scanTags - the non empty tags of a row of tag1 to tag10,
+// normalized the same way as channelTags
+func scanTags(rows *sql.Rows) ([]string, error) {
+	values := make([]sql.NullString, 10)
+	dest := make([]interface{}, 10)
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	err := rows.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for _, value := range values {
+		tag := strings.ToLower(strings.TrimSpace(value.String))
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// tagMatches - whether the tag contains every word, or a word
+// starting with every word for prefix queries
+func tagMatches(tag string, words []string, prefix bool) bool {
+	tagWords := strings.FieldsFunc(tag, func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_'
+	})
+	for _, word := range words {
+		word = strings.Trim(word, `+-<>()~*"@`)
+		found := false
+		for _, tagWord := range tagWords {
+			if tagWord == word || (prefix && strings.HasPrefix(tagWord, word)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// queryTypes - the document types a request searches
+func queryTypes(req *QueryRequest) []string {
+	if len(req.Types) == 0 {
+		return DocTypes
+	}
+	types := []string{}
+	for _, docType := range req.Types {
+		if docType == DocTypeTag || mysqlDocTypes[docType] != nil {
+			types = append(types, docType)
+		}
+	}
+	return types
+}
@@ -1,11 +1,12 @@
 package searchservices
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
 
 	"database/sql"
 	"github.com/blevesearch/bleve"
@@ -21,79 +22,114 @@ import (
 
 	"github.com/cloudfresco/vilom/common"
 	"github.com/cloudfresco/vilom/msg/msgservices"
+	"github.com/cloudfresco/vilom/user/userservices"
 )
 
 /* error message range: 7300-7999 */
 
+// Document types stored in the search index, the value is
+// stored in the "Type" field of every document
+const (
+	DocTypeMessage   = "message"
+	DocTypeChannel   = "channel"
+	DocTypeWorkspace = "workspace"
+	DocTypeUser      = "user"
+	DocTypeUgroup    = "ugroup"
+	DocTypeTag       = "tag"
+)
+
+// For validation of typeahead requests
+const (
+	TypeaheadTextLenMin = 1
+	TypeaheadTextLenMax = 50
+	TypeaheadLimitMax   = 25
+)
+
+// TypeaheadDefaultLimit - number of suggestions returned when no limit is given
+const TypeaheadDefaultLimit = 10
+
+// suggestFieldName - field holding the text used for typeahead,
+// indexed with the enWithEdgeNgram325 analyzer
+const suggestFieldName = "Suggest"
+
 // BleveForm - Search form
 type BleveForm struct {
 	SearchText string
 }
 
+// TypeaheadForm - Typeahead form, Types restricts the suggestions
+// to the given document types (all types when empty)
+type TypeaheadForm struct {
+	SearchText string
+	Types      []string
+	Limit      int
+}
+
+// Suggestion - one typeahead suggestion
+type Suggestion struct {
+	Type  string  `json:"type"`
+	ID    string  `json:"id"`
+	Label string  `json:"label"`
+	Score float64 `json:"score"`
+}
+
 // SearchServiceIntf - interface for Search Service
 type SearchServiceIntf interface {
-	Search(form *BleveForm, userEmail string, requestID string) (*bleve.SearchResult, error)
+	Search(ctx context.Context, form *BleveForm, userEmail string, requestID string) (*SearchResult, error)
+	Typeahead(ctx context.Context, form *TypeaheadForm, userEmail string, requestID string) ([]*Suggestion, error)
 }
 
 // SearchService -  For accessing  search service
 type SearchService struct {
-	DBService    *common.DBService
-	RedisService *common.RedisService
-	SearchIndex  bleve.Index
+	DBService     *common.DBService
+	RedisService  *common.RedisService
+	UserOptions   *common.UserOptions
+	SearchBackend SearchBackend
 }
 
 // NewSearchService - Create search service
-func NewSearchService(dbOpt *common.DBService, redisOpt *common.RedisService, searchIndex bleve.Index) *SearchService {
+func NewSearchService(dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions, searchBackend SearchBackend) *SearchService {
 	return &SearchService{
-		DBService:    dbOpt,
-		RedisService: redisOpt,
-		SearchIndex:  searchIndex,
+		DBService:     dbOpt,
+		RedisService:  redisOpt,
+		UserOptions:   userOpt,
+		SearchBackend: searchBackend,
 	}
 }
 
-var bSearchIndex bleve.Index
-
-// InitSearch -
-func InitSearch(p string, db *sql.DB) bleve.Index {
-	indexPath := ""
-	pwd, _ := os.Getwd()
-	indexPath = pwd + filepath.FromSlash("/files/search/channels.bleve")
-	productIndex, err := bleve.OpenUsing(indexPath, map[string]interface{}{
-		"read_only": true,
-	})
+var bSearchIndex bleve.IndexAlias
 
+// InitSearch - open the live index read only behind an alias, the index
+// is built when it does not exist yet, and reopened when it is swapped
+// by vilom search reindex or vilom search compact
+func InitSearch(searchOpt *common.SearchOptions, db *sql.DB) bleve.IndexAlias {
+	index, err := OpenIndex(searchOpt)
 	if err == bleve.ErrorIndexPathDoesNotExist {
-		productMapping, err := buildIndexMapping()
+		_, err = Reindex(searchOpt, db)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"msgnum": 7002,
 			}).Error(err)
 		}
-		productIndex, err = bleve.New(indexPath, productMapping)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"msgnum": 7003,
-			}).Error(err)
-		}
-
-	} else if err != nil {
-		log.WithFields(log.Fields{
-			"msgnum": 7004,
-		}).Error(err)
+		index, err = OpenIndex(searchOpt)
 	}
-
-	err = IndexChannels(db, productIndex)
 	if err != nil {
 		log.WithFields(log.Fields{
-			"msgnum": 7005,
+			"msgnum": 7004,
 		}).Error(err)
 	}
 
-	bSearchIndex = productIndex
+	bSearchIndex = bleve.NewIndexAlias()
+	if index != nil {
+		bSearchIndex.Add(index)
+	}
+	go WatchIndex(bSearchIndex, index, searchOpt)
 	return bSearchIndex
 }
 
-// buildIndexMapping - used for
+// buildIndexMapping - used for building the mapping of all the document
+// types, the "Suggest" field of every type is indexed with the
+// enWithEdgeNgram325 analyzer so that it can be used for typeahead
 func buildIndexMapping() (mapping.IndexMapping, error) {
 
 	edgeNgram325FieldMapping := bleve.NewTextFieldMapping()
@@ -107,22 +143,73 @@ func buildIndexMapping() (mapping.IndexMapping, error) {
 	keywordFieldMapping := bleve.NewTextFieldMapping()
 	keywordFieldMapping.Analyzer = keyword.Name
 
-	channelMapping := bleve.NewDocumentMapping()
+	// typeahead text, stored so that vilom search compact can copy it
+	suggestFieldMapping := bleve.NewTextFieldMapping()
+	suggestFieldMapping.Analyzer = "enWithEdgeNgram325"
+	suggestFieldMapping.IncludeTermVectors = false
+	suggestFieldMapping.IncludeInAll = false
+
+	messageMapping := bleve.NewDocumentMapping()
 
 	//disabledMapping := bleve.NewDocumentDisabledMapping()
 
 	// name
-	channelMapping.AddFieldMappingsAt("Name", englishTextFieldMapping)
+	messageMapping.AddFieldMappingsAt("Name", englishTextFieldMapping)
 
 	// description
-	channelMapping.AddFieldMappingsAt("Description",
+	messageMapping.AddFieldMappingsAt("Description",
 		englishTextFieldMapping, edgeNgram325FieldMapping)
 
 	// messagetext
-	channelMapping.AddFieldMappingsAt("MessageText", englishTextFieldMapping, edgeNgram325FieldMapping)
+	messageMapping.AddFieldMappingsAt("MessageText", englishTextFieldMapping, edgeNgram325FieldMapping)
+	// text of the first page of pdf attachments
+	messageMapping.AddFieldMappingsAt("AttachmentText", englishTextFieldMapping)
+	messageMapping.AddFieldMappingsAt("Pid", keywordFieldMapping)
+	messageMapping.AddFieldMappingsAt("Type", keywordFieldMapping)
+
+	channelMapping := bleve.NewDocumentMapping()
+	channelMapping.AddFieldMappingsAt("ChannelName", englishTextFieldMapping)
+	channelMapping.AddFieldMappingsAt("ChannelDesc", englishTextFieldMapping)
+	channelMapping.AddFieldMappingsAt("Tags", keywordFieldMapping)
+	channelMapping.AddFieldMappingsAt("Pid", keywordFieldMapping)
+	channelMapping.AddFieldMappingsAt("Type", keywordFieldMapping)
+	channelMapping.AddFieldMappingsAt(suggestFieldName, suggestFieldMapping)
+
+	workspaceMapping := bleve.NewDocumentMapping()
+	workspaceMapping.AddFieldMappingsAt("WorkspaceName", englishTextFieldMapping)
+	workspaceMapping.AddFieldMappingsAt("WorkspaceDesc", englishTextFieldMapping)
+	workspaceMapping.AddFieldMappingsAt("Pid", keywordFieldMapping)
+	workspaceMapping.AddFieldMappingsAt("Type", keywordFieldMapping)
+	workspaceMapping.AddFieldMappingsAt(suggestFieldName, suggestFieldMapping)
+
+	userMapping := bleve.NewDocumentMapping()
+	userMapping.AddFieldMappingsAt("Username", keywordFieldMapping)
+	userMapping.AddFieldMappingsAt("FirstName", englishTextFieldMapping)
+	userMapping.AddFieldMappingsAt("LastName", englishTextFieldMapping)
+	userMapping.AddFieldMappingsAt("Pid", keywordFieldMapping)
+	userMapping.AddFieldMappingsAt("Type", keywordFieldMapping)
+	userMapping.AddFieldMappingsAt(suggestFieldName, suggestFieldMapping)
+
+	ugroupMapping := bleve.NewDocumentMapping()
+	ugroupMapping.AddFieldMappingsAt("UgroupName", englishTextFieldMapping)
+	ugroupMapping.AddFieldMappingsAt("UgroupDesc", englishTextFieldMapping)
+	ugroupMapping.AddFieldMappingsAt("Pid", keywordFieldMapping)
+	ugroupMapping.AddFieldMappingsAt("Type", keywordFieldMapping)
+	ugroupMapping.AddFieldMappingsAt(suggestFieldName, suggestFieldMapping)
+
+	tagMapping := bleve.NewDocumentMapping()
+	tagMapping.AddFieldMappingsAt("Tag", keywordFieldMapping)
+	tagMapping.AddFieldMappingsAt("Pid", keywordFieldMapping)
+	tagMapping.AddFieldMappingsAt("Type", keywordFieldMapping)
+	tagMapping.AddFieldMappingsAt(suggestFieldName, suggestFieldMapping)
 
 	indexMapping := bleve.NewIndexMapping()
-	indexMapping.AddDocumentMapping("Name", channelMapping)
+	indexMapping.AddDocumentMapping(DocTypeMessage, messageMapping)
+	indexMapping.AddDocumentMapping(DocTypeChannel, channelMapping)
+	indexMapping.AddDocumentMapping(DocTypeWorkspace, workspaceMapping)
+	indexMapping.AddDocumentMapping(DocTypeUser, userMapping)
+	indexMapping.AddDocumentMapping(DocTypeUgroup, ugroupMapping)
+	indexMapping.AddDocumentMapping(DocTypeTag, tagMapping)
 	err := indexMapping.AddCustomTokenFilter("edgeNgram325",
 		map[string]interface{}{
 			"type": edgengram.Name,
@@ -153,17 +240,69 @@ func buildIndexMapping() (mapping.IndexMapping, error) {
 		}).Error(err)
 		return nil, err
 	}
+
+	// used to analyze the typeahead text, it must not be split into
+	// ngrams, else "joh" would also match "john"'s neighbours
+	err = indexMapping.AddCustomAnalyzer("enLowercase",
+		map[string]interface{}{
+			"type":      custom.Name,
+			"tokenizer": unicode.Name,
+			"token_filters": []string{
+				en.PossessiveName,
+				lowercase.Name,
+			},
+		})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7300,
+		}).Error(err)
+		return nil, err
+	}
 	indexMapping.TypeField = "Type"
 	indexMapping.DefaultAnalyzer = "en"
 
 	return indexMapping, nil
 }
 
+// IndexAll - index all the document types
+func IndexAll(db *sql.DB, index bleve.Index) error {
+	err := IndexChannels(db, index)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7301,
+		}).Error(err)
+		return err
+	}
+	err = IndexWorkspaces(db, index)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7302,
+		}).Error(err)
+		return err
+	}
+	err = IndexUsers(db, index)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7303,
+		}).Error(err)
+		return err
+	}
+	err = IndexUgroups(db, index)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7304,
+		}).Error(err)
+		return err
+	}
+	return nil
+}
+
 // IndexChannels - used for
 func IndexChannels(db *sql.DB, index bleve.Index) error {
 	batch := index.NewBatch()
 	var channelMsgMap map[string]string
 	docID := ""
+	tags := make(map[string][]string)
 	channels, err := getChannels(db)
 
 	if err != nil {
@@ -180,13 +319,33 @@ func IndexChannels(db *sql.DB, index bleve.Index) error {
 			}).Error(err)
 			return err
 		}
+		attachmentTexts, err := getAttachmentTextsByChannelID(channel.ID, db)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7394,
+			}).Error(err)
+			return err
+		}
+		err = indexDoc(index, &batch, DocTypeChannel+"##"+channel.IDS, channelDoc(channel))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7305,
+			}).Error(err)
+			return err
+		}
+		for _, tag := range channelTags(channel) {
+			tags[tag] = append(tags[tag], channel.IDS)
+		}
 		for _, message := range messages {
-			channelMsgMap = map[string]string{"Type": "Name"}
+			channelMsgMap = map[string]string{"Type": DocTypeMessage}
 
 			channelMsgMap["Name"] = channel.ChannelName
 			channelMsgMap["Description"] = channel.ChannelDesc
 			channelMsgMap["Pid"] = strconv.FormatUint(uint64(channel.ID), 10)
-			channelMsgMap["MessageText"] = message.Mtext
+			channelMsgMap["MessageText"] = common.MarkdownText(message.Mtext)
+			if text, ok := attachmentTexts[message.MessageID]; ok {
+				channelMsgMap["AttachmentText"] = text
+			}
 
 			docID = fmt.Sprintf("%d##%d", channel.ID, message.ID)
 
@@ -228,6 +387,22 @@ func IndexChannels(db *sql.DB, index bleve.Index) error {
 		}
 	}
 
+	for tag, channelIDs := range tags {
+		err = indexDoc(index, &batch, DocTypeTag+"##"+tag, map[string]interface{}{
+			"Type":           DocTypeTag,
+			"Tag":            tag,
+			"Pid":            tag,
+			"NumChannels":    len(channelIDs),
+			suggestFieldName: tag,
+		})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7306,
+			}).Error(err)
+			return err
+		}
+	}
+
 	if batch.Size() > 0 {
 		err := index.Batch(batch)
 		if err != nil {
@@ -240,23 +415,280 @@ func IndexChannels(db *sql.DB, index bleve.Index) error {
 	return nil
 }
 
-// Search - used for
-func (t *SearchService) Search(form *BleveForm, userEmail string, requestID string) (*bleve.SearchResult, error) {
-	query := bleve.NewMatchQuery(form.SearchText)
-	search := bleve.NewSearchRequest(query)
-	fields := []string{"Name", "Description", "Pid", "MessageText"}
+// IndexWorkspaces - index the workspace names and descriptions
+func IndexWorkspaces(db *sql.DB, index bleve.Index) error {
+	batch := index.NewBatch()
+	workspaces, err := getWorkspaces(db)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7307,
+		}).Error(err)
+		return err
+	}
+	for _, workspace := range workspaces {
+		err = indexDoc(index, &batch, DocTypeWorkspace+"##"+workspace.IDS, map[string]interface{}{
+			"Type":           DocTypeWorkspace,
+			"WorkspaceName":  workspace.WorkspaceName,
+			"WorkspaceDesc":  workspace.WorkspaceDesc,
+			"Pid":            workspace.IDS,
+			suggestFieldName: workspace.WorkspaceName,
+		})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7308,
+			}).Error(err)
+			return err
+		}
+	}
+	return flushBatch(index, batch)
+}
 
-	search.Fields = fields
-	searchResults, err := t.SearchIndex.Search(search)
+// IndexUsers - index the username, first name and last name of users
+func IndexUsers(db *sql.DB, index bleve.Index) error {
+	batch := index.NewBatch()
+	users, err := getUsers(db)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7309,
+		}).Error(err)
+		return err
+	}
+	for _, user := range users {
+		err = indexDoc(index, &batch, DocTypeUser+"##"+user.IDS, map[string]interface{}{
+			"Type":           DocTypeUser,
+			"Username":       user.Username,
+			"FirstName":      user.FirstName,
+			"LastName":       user.LastName,
+			"Pid":            user.IDS,
+			suggestFieldName: strings.Join([]string{user.Username, user.FirstName, user.LastName}, " "),
+		})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7310,
+			}).Error(err)
+			return err
+		}
+	}
+	return flushBatch(index, batch)
+}
+
+// IndexUgroups - index the ugroup names and descriptions
+func IndexUgroups(db *sql.DB, index bleve.Index) error {
+	batch := index.NewBatch()
+	ugroups, err := getUgroups(db)
 	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7311,
+		}).Error(err)
+		return err
+	}
+	for _, ugroup := range ugroups {
+		err = indexDoc(index, &batch, DocTypeUgroup+"##"+ugroup.IDS, map[string]interface{}{
+			"Type":           DocTypeUgroup,
+			"UgroupName":     ugroup.UgroupName,
+			"UgroupDesc":     ugroup.UgroupDesc,
+			"Pid":            ugroup.IDS,
+			suggestFieldName: ugroup.UgroupName,
+		})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7312,
+			}).Error(err)
+			return err
+		}
+	}
+	return flushBatch(index, batch)
+}
+
+// indexDoc - add a document to the batch, the batch is flushed
+// to the index once it has 100 documents
+func indexDoc(index bleve.Index, batch **bleve.Batch, docID string, doc interface{}) error {
+	err := (*batch).Index(docID, doc)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7313,
+		}).Error(err)
+		return err
+	}
+	if (*batch).Size() >= 100 {
+		err = index.Batch(*batch)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7314,
+			}).Error(err)
+			return err
+		}
+		*batch = index.NewBatch()
+	}
+	return nil
+}
+
+// flushBatch - write the remaining documents of the batch to the index
+func flushBatch(index bleve.Index, batch *bleve.Batch) error {
+	if batch.Size() > 0 {
+		err := index.Batch(batch)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7315,
+			}).Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// channelDoc - the channel document, without the messages
+func channelDoc(channel *msgservices.Channel) map[string]interface{} {
+	return map[string]interface{}{
+		"Type":           DocTypeChannel,
+		"ChannelName":    channel.ChannelName,
+		"ChannelDesc":    channel.ChannelDesc,
+		"Tags":           channelTags(channel),
+		"Pid":            channel.IDS,
+		suggestFieldName: channel.ChannelName,
+	}
+}
+
+// channelTags - the non empty tags of a channel
+func channelTags(channel *msgservices.Channel) []string {
+	tags := []string{}
+	for _, tag := range []string{channel.Tag1, channel.Tag2, channel.Tag3, channel.Tag4, channel.Tag5,
+		channel.Tag6, channel.Tag7, channel.Tag8, channel.Tag9, channel.Tag10} {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Search - used for searching the messages and the channels, the
+// channels the user cannot read and their messages are left out
+func (t *SearchService) Search(ctx context.Context, form *BleveForm, userEmail string, requestID string) (*SearchResult, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
 		log.WithFields(log.Fields{
 			"user":   userEmail,
 			"reqid":  requestID,
-			"msgnum": 7015,
+			"msgnum": 7398,
 		}).Error(err)
 		return nil, err
+	default:
+		channelIDs, channelIDS, err := t.unreadableChannels(ctx, userEmail, requestID)
+		if err != nil {
+			return nil, err
+		}
+		searchResults, err := t.SearchBackend.Query(&QueryRequest{
+			Text:              form.SearchText,
+			Size:              10,
+			Fields:            []string{"Name", "Description", "Pid", "MessageText", "AttachmentText"},
+			ExcludeChannelIDs: channelIDs,
+			ExcludeChannelIDS: channelIDS,
+		})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"user":   userEmail,
+				"reqid":  requestID,
+				"msgnum": 7015,
+			}).Error(err)
+			return nil, err
+		}
+		return searchResults, nil
+	}
+}
+
+// unreadableChannels - the channels the user cannot read, without a
+// database there are no grants and the whole index is searched
+func (t *SearchService) unreadableChannels(ctx context.Context, userEmail string, requestID string) ([]uint, []string, error) {
+	if t.DBService == nil {
+		return nil, nil, nil
+	}
+	grantserv := &msgservices.GrantService{DBService: t.DBService, RedisService: t.RedisService, UserOptions: t.UserOptions}
+	channelIDs, channelIDS, err := grantserv.UnreadableChannels(ctx, userEmail, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"user":   userEmail,
+			"reqid":  requestID,
+			"msgnum": 7399,
+		}).Error(err)
+		return nil, nil, err
+	}
+	return channelIDs, channelIDS, nil
+}
+
+// Typeahead - used for @mention and channel autocomplete, matches every
+// word of the text as the start of a word of the suggestion, the channels
+// the user cannot read are not suggested
+func (t *SearchService) Typeahead(ctx context.Context, form *TypeaheadForm, userEmail string, requestID string) ([]*Suggestion, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{
+			"user":   userEmail,
+			"reqid":  requestID,
+			"msgnum": 7400,
+		}).Error(err)
+		return nil, err
+	default:
+		limit := form.Limit
+		if limit <= 0 {
+			limit = TypeaheadDefaultLimit
+		}
+		if limit > TypeaheadLimitMax {
+			limit = TypeaheadLimitMax
+		}
+
+		channelIDs, channelIDS, err := t.unreadableChannels(ctx, userEmail, requestID)
+		if err != nil {
+			return nil, err
+		}
+		searchResults, err := t.SearchBackend.Query(&QueryRequest{
+			Text:              form.SearchText,
+			Types:             form.Types,
+			Prefix:            true,
+			Size:              limit,
+			Fields:            []string{"Pid", "Username", "FirstName", "LastName", "ChannelName", "WorkspaceName", "UgroupName", "Tag"},
+			ExcludeChannelIDs: channelIDs,
+			ExcludeChannelIDS: channelIDS,
+		})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"user":   userEmail,
+				"reqid":  requestID,
+				"msgnum": 7316,
+			}).Error(err)
+			return nil, err
+		}
+
+		suggestions := []*Suggestion{}
+		for _, hit := range searchResults.Hits {
+			suggestion := Suggestion{Type: hit.Type, Score: hit.Score}
+			suggestion.ID, _ = hit.Fields["Pid"].(string)
+			suggestion.Label = suggestionLabel(suggestion.Type, hit.Fields)
+			suggestions = append(suggestions, &suggestion)
+		}
+		return suggestions, nil
 	}
-	return searchResults, nil
+}
+
+// suggestionLabel - the text shown to the user for a suggestion
+func suggestionLabel(docType string, fields map[string]interface{}) string {
+	field := ""
+	switch docType {
+	case DocTypeUser:
+		field = "Username"
+	case DocTypeChannel:
+		field = "ChannelName"
+	case DocTypeWorkspace:
+		field = "WorkspaceName"
+	case DocTypeUgroup:
+		field = "UgroupName"
+	case DocTypeTag:
+		field = "Tag"
+	}
+	label, _ := fields[field].(string)
+	return label
 }
 
 // getMessagesByChannelID - Get messages by channel id
@@ -329,6 +761,47 @@ func getMessagesByChannelID(ID uint, db *sql.DB) ([]*msgservices.MessageText, er
 	return msgs, nil
 }
 
+// getAttachmentTextsByChannelID - Get the first page text of the
+// attachments of the channel by message id
+func getAttachmentTextsByChannelID(ID uint, db *sql.DB) (map[uint]string, error) {
+	texts := make(map[uint]string)
+	rows, err := db.Query(`select 
+    message_id,
+		first_page_text from message_attachments where channel_id = ? and first_page_text != '' order by id`, ID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7395,
+		}).Error(err)
+		return nil, err
+	}
+	for rows.Next() {
+		var messageID uint
+		var text string
+		err = rows.Scan(&messageID, &text)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7396,
+			}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		if texts[messageID] != "" {
+			text = texts[messageID] + "\n" + text
+		}
+		texts[messageID] = text
+	}
+
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7397,
+		}).Error(err)
+		return nil, err
+	}
+
+	return texts, nil
+}
+
 // getChannels - Get channels
 func getChannels(db *sql.DB) ([]*msgservices.Channel, error) {
 
@@ -433,3 +906,155 @@ func getChannels(db *sql.DB) ([]*msgservices.Channel, error) {
 
 	return pohs, nil
 }
+
+// getWorkspaces - Get workspaces
+func getWorkspaces(db *sql.DB) ([]*msgservices.Workspace, error) {
+	workspaces := []*msgservices.Workspace{}
+	rows, err := db.Query(`select 
+    id,
+		uuid4,
+		workspace_name,
+		workspace_desc from workspaces where statusc = ?`, common.Active)
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7317,
+		}).Error(err)
+		return nil, err
+	}
+	for rows.Next() {
+		workspace := msgservices.Workspace{}
+		err = rows.Scan(
+			&workspace.ID,
+			&workspace.UUID4,
+			&workspace.WorkspaceName,
+			&workspace.WorkspaceDesc)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7318,
+			}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		uuid4Str, err := common.UUIDBytesToStr(workspace.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7319,
+			}).Error(err)
+		}
+		workspace.IDS = uuid4Str
+		workspaces = append(workspaces, &workspace)
+	}
+
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7320,
+		}).Error(err)
+		return nil, err
+	}
+
+	return workspaces, nil
+}
+
+// getUsers - Get users
+func getUsers(db *sql.DB) ([]*userservices.User, error) {
+	users := []*userservices.User{}
+	rows, err := db.Query(`select 
+    id,
+		uuid4,
+		username,
+		first_name,
+		last_name from users where statusc = ?`, common.Active)
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7321,
+		}).Error(err)
+		return nil, err
+	}
+	for rows.Next() {
+		user := userservices.User{}
+		err = rows.Scan(
+			&user.ID,
+			&user.UUID4,
+			&user.Username,
+			&user.FirstName,
+			&user.LastName)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7322,
+			}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		uuid4Str, err := common.UUIDBytesToStr(user.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7323,
+			}).Error(err)
+		}
+		user.IDS = uuid4Str
+		users = append(users, &user)
+	}
+
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7324,
+		}).Error(err)
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// getUgroups - Get ugroups
+func getUgroups(db *sql.DB) ([]*userservices.Ugroup, error) {
+	ugroups := []*userservices.Ugroup{}
+	rows, err := db.Query(`select 
+    id,
+		uuid4,
+		ugroup_name,
+		ugroup_desc from ugroups where statusc = ?`, common.Active)
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7325,
+		}).Error(err)
+		return nil, err
+	}
+	for rows.Next() {
+		ugroup := userservices.Ugroup{}
+		err = rows.Scan(
+			&ugroup.ID,
+			&ugroup.UUID4,
+			&ugroup.UgroupName,
+			&ugroup.UgroupDesc)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7326,
+			}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		uuid4Str, err := common.UUIDBytesToStr(ugroup.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"msgnum": 7327,
+			}).Error(err)
+		}
+		ugroup.IDS = uuid4Str
+		ugroups = append(ugroups, &ugroup)
+	}
+
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"msgnum": 7328,
+		}).Error(err)
+		return nil, err
+	}
+
+	return ugroups, nil
+}
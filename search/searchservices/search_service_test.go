@@ -0,0 +1,93 @@
+package searchservices
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestSearchService_Typeahead(t *testing.T) {
+	indexMapping, err := buildIndexMapping()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	index, err := bleve.NewMemOnly(indexMapping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	docs := map[string]map[string]interface{}{
+		"user##1": {
+			"Type":           DocTypeUser,
+			"Username":       "johnd",
+			"FirstName":      "John",
+			"LastName":       "Doe",
+			"Pid":            "1",
+			suggestFieldName: "johnd John Doe",
+		},
+		"channel##2": {
+			"Type":           DocTypeChannel,
+			"ChannelName":    "Johnson Project",
+			"Pid":            "2",
+			suggestFieldName: "Johnson Project",
+		},
+		"workspace##3": {
+			"Type":           DocTypeWorkspace,
+			"WorkspaceName":  "Drive",
+			"Pid":            "3",
+			suggestFieldName: "Drive",
+		},
+	}
+	for docID, doc := range docs {
+		err = index.Index(docID, doc)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	searchService := NewSearchService(nil, nil, nil, NewBleveBackend(index))
+
+	tests := []struct {
+		form TypeaheadForm
+		want []string
+	}{
+		{
+			form: TypeaheadForm{SearchText: "joh"},
+			want: []string{"1", "2"},
+		},
+		{
+			form: TypeaheadForm{SearchText: "joh", Types: []string{DocTypeUser}},
+			want: []string{"1"},
+		},
+		{
+			form: TypeaheadForm{SearchText: "john doe"},
+			want: []string{"1"},
+		},
+		{
+			form: TypeaheadForm{SearchText: "dri", Types: []string{DocTypeUser, DocTypeChannel}},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		suggestions, err := searchService.Typeahead(context.Background(), &tt.form, "abcd145@gmail.com", "bks1m1g91jau4nkks2f0")
+		if err != nil {
+			t.Errorf("SearchService.Typeahead() error = %v", err)
+			continue
+		}
+		got := map[string]bool{}
+		for _, suggestion := range suggestions {
+			got[suggestion.ID] = true
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("SearchService.Typeahead(%q) = %v, want %v", tt.form.SearchText, got, tt.want)
+			continue
+		}
+		for _, id := range tt.want {
+			if !got[id] {
+				t.Errorf("SearchService.Typeahead(%q) = %v, want %v", tt.form.SearchText, got, tt.want)
+			}
+		}
+	}
+}
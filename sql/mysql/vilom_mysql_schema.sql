@@ -1,5 +1,34 @@
 /*!40101 SET @saved_cs_client     = @@character_set_client */;
 /*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `api_tokens` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `name` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `token_hash` char(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `scopes` varchar(1024) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `expires_at` timestamp NULL DEFAULT NULL,
+  `last_used_at` timestamp NULL DEFAULT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_api_tokens_token_hash` (`token_hash`),
+  KEY `idx_api_tokens_deleted_at` (`deleted_at`),
+  KEY `idx_api_tokens_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
 CREATE TABLE `channels` (
   `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
   `created_at` timestamp NULL DEFAULT NULL,
@@ -34,7 +63,9 @@ CREATE TABLE `channels` (
   `updated_month` tinyint(3) unsigned DEFAULT NULL,
   `updated_year` smallint(5) unsigned DEFAULT NULL,
   PRIMARY KEY (`id`),
-  KEY `idx_channels_deleted_at` (`deleted_at`)
+  KEY `idx_channels_deleted_at` (`deleted_at`),
+  FULLTEXT KEY `ft_channels_channel_name` (`channel_name`,`channel_desc`),
+  FULLTEXT KEY `ft_channels_tags` (`tag1`,`tag2`,`tag3`,`tag4`,`tag5`,`tag6`,`tag7`,`tag8`,`tag9`,`tag10`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 /*!40101 SET character_set_client = @saved_cs_client */;
 /*!40101 SET @saved_cs_client     = @@character_set_client */;
@@ -65,6 +96,284 @@ CREATE TABLE `channels_users` (
 /*!40101 SET character_set_client = @saved_cs_client */;
 /*!40101 SET @saved_cs_client     = @@character_set_client */;
 /*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `commands` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `workspace_id` int(10) unsigned NOT NULL,
+  `name` varchar(32) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `command_desc` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `target_url` varchar(2048) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `secret` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `bot_user_id` int(10) unsigned NOT NULL,
+  `user_id` int(10) unsigned DEFAULT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_commands_deleted_at` (`deleted_at`),
+  KEY `idx_commands_workspace_id_name` (`workspace_id`,`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `digest_prefs` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `frequency` varchar(10) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_digest_prefs_deleted_at` (`deleted_at`),
+  UNIQUE KEY `idx_digest_prefs_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `digests` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `frequency` varchar(10) COLLATE utf8mb4_unicode_ci DEFAULT NULL,
+  `due_at` timestamp NULL DEFAULT NULL,
+  `num_mentions` int(10) unsigned DEFAULT 0,
+  `num_replies` int(10) unsigned DEFAULT 0,
+  `is_sent` tinyint(1) DEFAULT 0,
+  `unsub_selector` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL,
+  `unsub_verifier` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL,
+  `unsub_token_expiry` timestamp NULL DEFAULT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_digests_deleted_at` (`deleted_at`),
+  KEY `idx_digests_unsub_selector` (`unsub_selector`),
+  UNIQUE KEY `idx_digests_user_id_due_at` (`user_id`,`due_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `email_outbox` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `from_addr` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `to_addr` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `cc_addr` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `subject` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `body` mediumtext COLLATE utf8mb4_unicode_ci,
+  `text_body` mediumtext COLLATE utf8mb4_unicode_ci,
+  `status` varchar(10) COLLATE utf8mb4_unicode_ci DEFAULT NULL,
+  `attempts` int(10) unsigned DEFAULT 0,
+  `next_attempt_at` timestamp NULL DEFAULT NULL,
+  `last_error` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `sent_at` timestamp NULL DEFAULT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_email_outbox_deleted_at` (`deleted_at`),
+  KEY `idx_email_outbox_status_next_attempt_at` (`status`,`next_attempt_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `incoming_webhook_messages` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `incoming_webhook_id` int(10) unsigned NOT NULL,
+  `message_id` int(10) unsigned NOT NULL,
+  `display_name` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_incoming_webhook_messages_deleted_at` (`deleted_at`),
+  KEY `idx_incoming_webhook_messages_message_id` (`message_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `incoming_webhooks` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `workspace_id` int(10) unsigned NOT NULL,
+  `channel_id` int(10) unsigned NOT NULL,
+  `display_name` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `token_hash` char(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `bot_user_id` int(10) unsigned NOT NULL,
+  `max_rate` int(10) unsigned DEFAULT 60,
+  `user_id` int(10) unsigned DEFAULT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_incoming_webhooks_token_hash` (`token_hash`),
+  KEY `idx_incoming_webhooks_deleted_at` (`deleted_at`),
+  KEY `idx_incoming_webhooks_channel_id` (`channel_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `invite_channels` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `invite_id` int(10) unsigned NOT NULL,
+  `channel_id` int(10) unsigned NOT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_invite_channels_deleted_at` (`deleted_at`),
+  KEY `idx_invite_channels_invite_id` (`invite_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `invites` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `workspace_id` int(10) unsigned NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `role` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL,
+  `max_uses` int(10) unsigned DEFAULT 0,
+  `num_uses` int(10) unsigned DEFAULT 0,
+  `expires_at` timestamp NULL DEFAULT NULL,
+  `token_selector` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL,
+  `token_verifier` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_invites_deleted_at` (`deleted_at`),
+  KEY `idx_invites_token_selector` (`token_selector`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `ldap_groups` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `ugroup_id` int(10) unsigned NOT NULL,
+  `dn` varchar(512) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `synced_at` timestamp NULL DEFAULT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_ldap_groups_deleted_at` (`deleted_at`),
+  UNIQUE KEY `idx_ldap_groups_ugroup_id` (`ugroup_id`),
+  UNIQUE KEY `idx_ldap_groups_dn` (`dn`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `ldap_users` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `dn` varchar(512) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_ldap_users_deleted_at` (`deleted_at`),
+  UNIQUE KEY `idx_ldap_users_user_id` (`user_id`),
+  UNIQUE KEY `idx_ldap_users_dn` (`dn`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
 CREATE TABLE `mdrafts` (
   `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
   `created_at` timestamp NULL DEFAULT NULL,
@@ -108,6 +417,15 @@ CREATE TABLE `message_attachments` (
   `message_id` int(10) unsigned DEFAULT NULL,
   `ugroup_id` int(10) unsigned DEFAULT 0,
   `user_id` int(10) unsigned DEFAULT NULL,
+  `upload_id` int(10) unsigned DEFAULT 0,
+  `content_type` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `file_size` bigint(20) unsigned DEFAULT 0,
+  `width` int(10) unsigned DEFAULT 0,
+  `height` int(10) unsigned DEFAULT 0,
+  `thumbnail_key` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `page_count` int(10) unsigned DEFAULT 0,
+  `first_page_text` varchar(2000) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `meta_status` tinyint(3) unsigned DEFAULT 0,
   `statusc` tinyint(3) unsigned DEFAULT NULL,
   `created_day` smallint(5) unsigned DEFAULT NULL,
   `created_week` tinyint(3) unsigned DEFAULT NULL,
@@ -118,7 +436,39 @@ CREATE TABLE `message_attachments` (
   `updated_month` tinyint(3) unsigned DEFAULT NULL,
   `updated_year` smallint(5) unsigned DEFAULT NULL,
   PRIMARY KEY (`id`),
-  KEY `idx_message_attachments_deleted_at` (`deleted_at`)
+  KEY `idx_message_attachments_deleted_at` (`deleted_at`),
+  KEY `idx_message_attachments_meta_status` (`meta_status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `message_mentions` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `workspace_id` int(10) unsigned DEFAULT NULL,
+  `channel_id` int(10) unsigned DEFAULT NULL,
+  `message_id` int(10) unsigned NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `by_user_id` int(10) unsigned DEFAULT NULL,
+  `mention_type` varchar(20) COLLATE utf8mb4_unicode_ci DEFAULT NULL,
+  `mention_name` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL,
+  `is_read` tinyint(1) DEFAULT 0,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_message_mentions_deleted_at` (`deleted_at`),
+  KEY `idx_message_mentions_user_id` (`user_id`,`is_read`),
+  UNIQUE KEY `idx_message_mentions_message_id_user_id` (`message_id`,`user_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 /*!40101 SET character_set_client = @saved_cs_client */;
 /*!40101 SET @saved_cs_client     = @@character_set_client */;
@@ -130,6 +480,7 @@ CREATE TABLE `message_texts` (
   `deleted_at` timestamp NULL DEFAULT NULL,
   `uuid4` binary(16) DEFAULT NULL,
   `mtext` text COLLATE utf8mb4_unicode_ci DEFAULT NULL,
+  `mhtml` text COLLATE utf8mb4_unicode_ci DEFAULT NULL,
   `workspace_id` int(10) unsigned DEFAULT NULL,
   `channel_id` int(10) unsigned DEFAULT NULL,
   `message_id` int(10) unsigned DEFAULT NULL,
@@ -145,7 +496,8 @@ CREATE TABLE `message_texts` (
   `updated_month` tinyint(3) unsigned DEFAULT NULL,
   `updated_year` smallint(5) unsigned DEFAULT NULL,
   PRIMARY KEY (`id`),
-  KEY `idx_message_texts_deleted_at` (`deleted_at`)
+  KEY `idx_message_texts_deleted_at` (`deleted_at`),
+  FULLTEXT KEY `ft_message_texts_mtext` (`mtext`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 /*!40101 SET character_set_client = @saved_cs_client */;
 /*!40101 SET @saved_cs_client     = @@character_set_client */;
@@ -178,6 +530,115 @@ CREATE TABLE `messages` (
 /*!40101 SET character_set_client = @saved_cs_client */;
 /*!40101 SET @saved_cs_client     = @@character_set_client */;
 /*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `notification_prefs` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `ntype` varchar(20) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `enabled` tinyint(1) DEFAULT 1,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_notification_prefs_deleted_at` (`deleted_at`),
+  UNIQUE KEY `idx_notification_prefs_user_id_ntype` (`user_id`,`ntype`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `notifications` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `ntype` varchar(20) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `actor_id` int(10) unsigned DEFAULT 0,
+  `workspace_id` int(10) unsigned DEFAULT 0,
+  `channel_id` int(10) unsigned DEFAULT 0,
+  `message_id` int(10) unsigned DEFAULT 0,
+  `ubadge_id` int(10) unsigned DEFAULT 0,
+  `ntext` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL,
+  `is_read` tinyint(1) DEFAULT 0,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_notifications_deleted_at` (`deleted_at`),
+  KEY `idx_notifications_user_id` (`user_id`,`is_read`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `password_histories` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `password` varbinary(255) NOT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_password_histories_deleted_at` (`deleted_at`),
+  KEY `idx_password_histories_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `sessions` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `device` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `user_agent` varchar(512) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `ip` varchar(45) COLLATE utf8mb4_unicode_ci DEFAULT '',
+  `expires_at` timestamp NULL DEFAULT NULL,
+  `last_seen_at` timestamp NULL DEFAULT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_sessions_deleted_at` (`deleted_at`),
+  UNIQUE KEY `idx_sessions_uuid4` (`uuid4`),
+  KEY `idx_sessions_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
 CREATE TABLE `ubadges` (
   `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
   `created_at` timestamp NULL DEFAULT NULL,
@@ -247,6 +708,35 @@ CREATE TABLE `ugroup_chds` (
 /*!40101 SET character_set_client = @saved_cs_client */;
 /*!40101 SET @saved_cs_client     = @@character_set_client */;
 /*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `ugroup_grants` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `ugroup_id` int(10) unsigned NOT NULL,
+  `workspace_id` int(10) unsigned DEFAULT 0,
+  `channel_id` int(10) unsigned DEFAULT 0,
+  `grant_role` varchar(20) COLLATE utf8mb4_unicode_ci DEFAULT NULL,
+  `user_id` int(10) unsigned DEFAULT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_ugroup_grants_deleted_at` (`deleted_at`),
+  KEY `idx_ugroup_grants_ugroup_id` (`ugroup_id`),
+  KEY `idx_ugroup_grants_workspace_id` (`workspace_id`),
+  KEY `idx_ugroup_grants_channel_id` (`channel_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
 CREATE TABLE `ugroups` (
   `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
   `created_at` timestamp NULL DEFAULT NULL,
@@ -268,7 +758,8 @@ CREATE TABLE `ugroups` (
   `updated_month` tinyint(3) unsigned DEFAULT NULL,
   `updated_year` smallint(5) unsigned DEFAULT NULL,
   PRIMARY KEY (`id`),
-  KEY `idx_ugroups_deleted_at` (`deleted_at`)
+  KEY `idx_ugroups_deleted_at` (`deleted_at`),
+  FULLTEXT KEY `ft_ugroups_ugroup_name` (`ugroup_name`,`ugroup_desc`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 /*!40101 SET character_set_client = @saved_cs_client */;
 /*!40101 SET @saved_cs_client     = @@character_set_client */;
@@ -296,6 +787,61 @@ CREATE TABLE `ugroups_users` (
 /*!40101 SET character_set_client = @saved_cs_client */;
 /*!40101 SET @saved_cs_client     = @@character_set_client */;
 /*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `upload_limits` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `workspace_id` int(10) unsigned NOT NULL,
+  `max_upload_size` bigint(20) unsigned NOT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_upload_limits_deleted_at` (`deleted_at`),
+  UNIQUE KEY `idx_upload_limits_workspace_id` (`workspace_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `uploads` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `workspace_id` int(10) unsigned NOT NULL,
+  `channel_id` int(10) unsigned NOT NULL,
+  `message_id` int(10) unsigned DEFAULT 0,
+  `user_id` int(10) unsigned NOT NULL,
+  `file_name` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `content_type` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `file_size` bigint(20) unsigned NOT NULL,
+  `checksum` char(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `blob_key` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_uploads_deleted_at` (`deleted_at`),
+  KEY `idx_uploads_message_id` (`message_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
 CREATE TABLE `user_bookmarks` (
   `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
   `created_at` timestamp NULL DEFAULT NULL,
@@ -454,9 +1000,42 @@ CREATE TABLE `users` (
   `password_token_expiry` timestamp NULL DEFAULT NULL,
   `password_confirmed_at` timestamp NULL DEFAULT NULL,
   `timezone` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT 'Asia/Kolkata',
+  `locale` varchar(10) COLLATE utf8mb4_unicode_ci DEFAULT 'en',
   `sign_in_count` int(10) unsigned DEFAULT NULL,
   `current_sign_in_at` timestamp NULL DEFAULT NULL,
   `last_sign_in_at` timestamp NULL DEFAULT NULL,
+  `bot_owner_id` int(10) unsigned DEFAULT 0,
+  `tokens_valid_after` timestamp NULL DEFAULT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_users_deleted_at` (`deleted_at`),
+  FULLTEXT KEY `ft_users_username` (`username`,`first_name`,`last_name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `webhook_deliveries` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `webhook_id` int(10) unsigned NOT NULL,
+  `event` varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `payload` mediumtext COLLATE utf8mb4_unicode_ci NOT NULL,
+  `delivery_status` tinyint(3) unsigned DEFAULT 1,
+  `attempts` smallint(5) unsigned DEFAULT 0,
+  `next_attempt_at` timestamp NULL DEFAULT NULL,
+  `response_code` smallint(5) unsigned DEFAULT 0,
+  `last_error` varchar(1000) COLLATE utf8mb4_unicode_ci DEFAULT '',
   `statusc` tinyint(3) unsigned DEFAULT NULL,
   `created_day` smallint(5) unsigned DEFAULT NULL,
   `created_week` tinyint(3) unsigned DEFAULT NULL,
@@ -467,7 +1046,36 @@ CREATE TABLE `users` (
   `updated_month` tinyint(3) unsigned DEFAULT NULL,
   `updated_year` smallint(5) unsigned DEFAULT NULL,
   PRIMARY KEY (`id`),
-  KEY `idx_users_deleted_at` (`deleted_at`)
+  KEY `idx_webhook_deliveries_deleted_at` (`deleted_at`),
+  KEY `idx_webhook_deliveries_webhook_id` (`webhook_id`),
+  KEY `idx_webhook_deliveries_next_attempt_at` (`delivery_status`,`next_attempt_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `webhooks` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `workspace_id` int(10) unsigned NOT NULL,
+  `target_url` varchar(2048) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `secret` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `events` varchar(1000) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `user_id` int(10) unsigned DEFAULT NULL,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_webhooks_deleted_at` (`deleted_at`),
+  KEY `idx_webhooks_workspace_id` (`workspace_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 /*!40101 SET character_set_client = @saved_cs_client */;
 /*!40101 SET @saved_cs_client     = @@character_set_client */;
@@ -520,6 +1128,32 @@ CREATE TABLE `workspaces` (
   `updated_month` tinyint(3) unsigned DEFAULT NULL,
   `updated_year` smallint(5) unsigned DEFAULT NULL,
   PRIMARY KEY (`id`),
-  KEY `idx_workspaces_deleted_at` (`deleted_at`)
+  KEY `idx_workspaces_deleted_at` (`deleted_at`),
+  FULLTEXT KEY `ft_workspaces_workspace_name` (`workspace_name`,`workspace_desc`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `workspaces_users` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `deleted_at` timestamp NULL DEFAULT NULL,
+  `uuid4` binary(16) DEFAULT NULL,
+  `workspace_id` int(10) unsigned NOT NULL,
+  `user_id` int(10) unsigned NOT NULL,
+  `invite_id` int(10) unsigned DEFAULT 0,
+  `statusc` tinyint(3) unsigned DEFAULT NULL,
+  `created_day` smallint(5) unsigned DEFAULT NULL,
+  `created_week` tinyint(3) unsigned DEFAULT NULL,
+  `created_month` tinyint(3) unsigned DEFAULT NULL,
+  `created_year` smallint(5) unsigned DEFAULT NULL,
+  `updated_day` smallint(5) unsigned DEFAULT NULL,
+  `updated_week` tinyint(3) unsigned DEFAULT NULL,
+  `updated_month` tinyint(3) unsigned DEFAULT NULL,
+  `updated_year` smallint(5) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_workspaces_users_deleted_at` (`deleted_at`),
+  UNIQUE KEY `idx_workspaces_users_workspace_id_user_id` (`workspace_id`,`user_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 /*!40101 SET character_set_client = @saved_cs_client */;
@@ -1,7 +1,7 @@
 INSERT INTO `workspaces` VALUES (1,'2019-07-23 10:04:26','2019-07-23 10:04:26',NULL,'шEi\nk','Performance Portable Transmitter','Performance Portable Transmitter',0,0,0,0,1,0,1,1,204,30,7,2019,204,30,7,2019),(2,'2019-07-23 10:04:26','2019-07-23 10:04:26',NULL,'):FI,42F','Drive','Drive',0,1,1,1,0,0,1,1,204,30,7,2019,204,30,7,2019);
 INSERT INTO `workspace_chds` VALUES (1,'2019-07-23 10:04:26','2019-07-23 10:04:26',NULL,'L>NDO\ZJW',1,2,1,204,30,7,2019,204,30,7,2019);
-INSERT INTO `message_attachments` VALUES (1,'2019-07-23 10:04:26','2019-07-23 10:04:26',NULL,'٘\'M.&R`7[','mattach',2,1,1,0,1,1,204,30,7,2019,204,30,7,2019);
-INSERT INTO `message_texts` VALUES (1,'2019-07-23 10:04:26','2019-07-23 10:04:26',NULL,'k\nCGH','Hi. I am looking into buying a Floptical Drive, and was wondering what experience people have with the drives from Iomega, PLI, MASS MicroSystems, or Procom. These seem to be the main drives on the market. Any advice? Also, I heard about some article in MacWorld about Flopticals. Could someone post a summary, if they have it? Thanks in advance',2,1,1,0,1,1,204,30,7,2019,204,30,7,2019);
+INSERT INTO `message_attachments` VALUES (1,'2019-07-23 10:04:26','2019-07-23 10:04:26',NULL,'٘\'M.&R`7[','mattach',2,1,1,0,1,0,'',0,0,0,'',0,'',0,1,204,30,7,2019,204,30,7,2019);
+INSERT INTO `message_texts` VALUES (1,'2019-07-23 10:04:26','2019-07-23 10:04:26',NULL,'k\nCGH','Hi. I am looking into buying a Floptical Drive, and was wondering what experience people have with the drives from Iomega, PLI, MASS MicroSystems, or Procom. These seem to be the main drives on the market. Any advice? Also, I heard about some article in MacWorld about Flopticals. Could someone post a summary, if they have it? Thanks in advance','<p>Hi. I am looking into buying a Floptical Drive, and was wondering what experience people have with the drives from Iomega, PLI, MASS MicroSystems, or Procom. These seem to be the main drives on the market. Any advice? Also, I heard about some article in MacWorld about Flopticals. Could someone post a summary, if they have it? Thanks in advance</p>',2,1,1,0,1,1,204,30,7,2019,204,30,7,2019);
 INSERT INTO `messages` VALUES (1,'2019-07-23 10:04:26','2019-07-23 10:04:26',NULL,'>FEZ',0,0,0,2,1,0,1,1,204,30,7,2019,204,30,7,2019);
 INSERT INTO `channels` VALUES (1,'2019-07-23 10:04:26','2019-07-23 10:04:26',NULL,'Dtp1D`	;','Floptical Question','Floptical Question',0,'','','','','','','','','','',0,1,2,0,1,1,204,30,7,2019,204,30,7,2019);
 INSERT INTO `channels_users` VALUES (1,'2019-07-23 10:04:26','2019-07-23 10:04:26',NULL,'\r.E[N%yf!w\nM',1,0,1,0,1,1,204,30,7,2019,204,30,7,2019);
@@ -10,4 +10,4 @@ INSERT INTO `ugroup_chds` VALUES (1,'2019-07-23 10:04:25','2019-07-23 10:04:25',
 INSERT INTO `ugroups` VALUES (1,'2019-07-23 10:04:25','2019-07-23 10:04:25',NULL,'nL\r)GձUU','ugroup1','ugroup1 description',0,0,1,1,204,30,7,2019,204,30,7,2019),(2,'2019-07-23 10:04:25','2019-07-23 10:04:25',NULL,'M[PBz=mHD','subugroup1','subugroup1 description',1,1,0,1,204,30,7,2019,204,30,7,2019);
 INSERT INTO `user_replies` VALUES (1,'2019-07-23 10:04:26','2019-07-23 10:04:26',NULL,'AVB@k؀',1,1,0,1,1,204,30,7,2019,204,30,7,2019);
 INSERT INTO `user_channels` VALUES (1,'2019-07-23 10:04:26','2019-07-23 10:04:26',NULL,'y\rx5BoL@',1,0,1,1,204,30,7,2019,204,30,7,2019);
-INSERT INTO `users` VALUES (1,'2019-07-23 10:04:24','2019-07-23 10:04:25',NULL,')![DSaD','','abcd145@gmail.com','abcd145@gmail.com','TskZoQ','Distributor2','co_admin','$2a$10$rpUAIHIHbmjS/5qcBJbqheLXSt0Czvi4HBCbNFmf8SsITJgRTOnmq',1,'','','','2019-07-23 10:04:24','2019-08-04 18:04:24','2019-07-23 10:04:25','','','','','2019-07-23 10:04:24','2019-07-23 10:04:24','2019-07-23 10:04:24','','','','2019-07-23 10:04:24','2019-07-23 10:04:24','2019-07-23 10:04:24','Asia/Kolkata',0,'2019-07-23 10:04:24','2019-07-23 10:04:24',1,204,30,7,2019,204,30,7,2019);
+INSERT INTO `users` VALUES (1,'2019-07-23 10:04:24','2019-07-23 10:04:25',NULL,')![DSaD','','abcd145@gmail.com','abcd145@gmail.com','TskZoQ','Distributor2','co_admin','$2a$10$rpUAIHIHbmjS/5qcBJbqheLXSt0Czvi4HBCbNFmf8SsITJgRTOnmq',1,'','','','2019-07-23 10:04:24','2019-08-04 18:04:24','2019-07-23 10:04:25','','','','','2019-07-23 10:04:24','2019-07-23 10:04:24','2019-07-23 10:04:24','','','','2019-07-23 10:04:24','2019-07-23 10:04:24','2019-07-23 10:04:24','Asia/Kolkata','en',0,'2019-07-23 10:04:24','2019-07-23 10:04:24',0,NULL,1,204,30,7,2019,204,30,7,2019);
@@ -17,3 +17,25 @@ TRUNCATE user_replies;
 TRUNCATE user_channels;
 TRUNCATE user_votes;
 TRUNCATE users;
+TRUNCATE webhook_deliveries;
+TRUNCATE webhooks;
+TRUNCATE incoming_webhook_messages;
+TRUNCATE incoming_webhooks;
+TRUNCATE api_tokens;
+TRUNCATE commands;
+TRUNCATE upload_limits;
+TRUNCATE uploads;
+TRUNCATE message_mentions;
+TRUNCATE notifications;
+TRUNCATE notification_prefs;
+TRUNCATE digests;
+TRUNCATE digest_prefs;
+TRUNCATE email_outbox;
+TRUNCATE invite_channels;
+TRUNCATE invites;
+TRUNCATE workspaces_users;
+TRUNCATE sessions;
+TRUNCATE ldap_groups;
+TRUNCATE ldap_users;
+TRUNCATE password_histories;
+TRUNCATE ugroup_grants;
@@ -0,0 +1,232 @@
+package testhelpers
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+// LDAPServer - an in-process LDAP directory for tests, it answers
+// simple binds against the userPassword of its entries and searches
+type LDAPServer struct {
+	URL      string
+	listener net.Listener
+	mu       sync.Mutex
+	entries  []*common.LDAPEntry
+}
+
+// NewLDAPServer - start an LDAP server with the entries on a local port
+func NewLDAPServer(entries []*common.LDAPEntry) (*LDAPServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &LDAPServer{URL: "ldap://" + listener.Addr().String(), listener: listener, entries: entries}
+	go s.serve()
+	return s, nil
+}
+
+// SetEntries - replace the entries of the directory
+func (s *LDAPServer) SetEntries(entries []*common.LDAPEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = entries
+}
+
+// Close - stop the server
+func (s *LDAPServer) Close() error {
+	return s.listener.Close()
+}
+
+func (s *LDAPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *LDAPServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		msg, err := common.ReadBerPacket(conn)
+		if err != nil || len(msg.Children) < 2 {
+			return
+		}
+		msgID := msg.Children[0].Int()
+		op := msg.Children[1]
+		switch op.Tag {
+		case common.LDAPOpBindRequest:
+			code := int64(common.LDAPResultInvalidCredentials)
+			if entry := s.find(op.Child(1).Str()); entry != nil && op.Child(2).Str() != "" && entry.GetAttr("userPassword") == op.Child(2).Str() {
+				code = common.LDAPResultSuccess
+			}
+			if s.reply(conn, msgID, ldapResult(common.LDAPOpBindResponse, code)) != nil {
+				return
+			}
+		case common.LDAPOpSearchRequest:
+			for _, entry := range s.search(op) {
+				if s.reply(conn, msgID, entry) != nil {
+					return
+				}
+			}
+			if s.reply(conn, msgID, ldapResult(common.LDAPOpSearchResultDone, common.LDAPResultSuccess)) != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *LDAPServer) reply(conn net.Conn, msgID int64, op *common.BerPacket) error {
+	msg := common.NewBerConstructed(common.BerClassUniversal, common.BerTagSequence,
+		common.NewBerInt(common.BerClassUniversal, common.BerTagInteger, msgID), op)
+	_, err := conn.Write(msg.Bytes())
+	return err
+}
+
+func ldapResult(tag byte, code int64) *common.BerPacket {
+	return common.NewBerConstructed(common.BerClassApplication, tag,
+		common.NewBerInt(common.BerClassUniversal, common.BerTagEnumerated, code),
+		common.NewBerString(common.BerClassUniversal, common.BerTagOctetString, ""),
+		common.NewBerString(common.BerClassUniversal, common.BerTagOctetString, ""))
+}
+
+func (s *LDAPServer) find(dn string) *common.LDAPEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		if common.NormalizeLDAPDN(entry.DN) == common.NormalizeLDAPDN(dn) {
+			return entry
+		}
+	}
+	return nil
+}
+
+func (s *LDAPServer) search(op *common.BerPacket) []*common.BerPacket {
+	base := common.NormalizeLDAPDN(op.Child(0).Str())
+	scope := op.Child(1).Int()
+	filter := op.Child(6)
+	attrs := []string{}
+	if op.Child(7) != nil {
+		for _, attr := range op.Child(7).Children {
+			attrs = append(attrs, attr.Str())
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := []*common.BerPacket{}
+	for _, entry := range s.entries {
+		dn := common.NormalizeLDAPDN(entry.DN)
+		inScope := dn == base
+		switch scope {
+		case common.LDAPScopeOne:
+			inScope = strings.HasSuffix(dn, ","+base) && !strings.Contains(strings.TrimSuffix(dn, ","+base), ",")
+		case common.LDAPScopeSubtree:
+			inScope = dn == base || strings.HasSuffix(dn, ","+base)
+		}
+		if !inScope || !matchFilter(filter, entry) {
+			continue
+		}
+		attrList := common.NewBerConstructed(common.BerClassUniversal, common.BerTagSequence)
+		for name, vals := range entry.Attributes {
+			if !wantAttr(attrs, name) {
+				continue
+			}
+			set := common.NewBerConstructed(common.BerClassUniversal, common.BerTagSet)
+			for _, v := range vals {
+				set.Children = append(set.Children, common.NewBerString(common.BerClassUniversal, common.BerTagOctetString, v))
+			}
+			attrList.Children = append(attrList.Children, common.NewBerConstructed(common.BerClassUniversal, common.BerTagSequence,
+				common.NewBerString(common.BerClassUniversal, common.BerTagOctetString, name), set))
+		}
+		results = append(results, common.NewBerConstructed(common.BerClassApplication, common.LDAPOpSearchResultEntry,
+			common.NewBerString(common.BerClassUniversal, common.BerTagOctetString, entry.DN), attrList))
+	}
+	return results
+}
+
+func wantAttr(attrs []string, name string) bool {
+	if strings.EqualFold(name, "userPassword") {
+		return false
+	}
+	if len(attrs) == 0 {
+		return true
+	}
+	for _, attr := range attrs {
+		if strings.EqualFold(attr, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchFilter(f *common.BerPacket, entry *common.LDAPEntry) bool {
+	if f == nil {
+		return false
+	}
+	switch f.Tag {
+	case common.LDAPFilterAnd:
+		for _, c := range f.Children {
+			if !matchFilter(c, entry) {
+				return false
+			}
+		}
+		return true
+	case common.LDAPFilterOr:
+		for _, c := range f.Children {
+			if matchFilter(c, entry) {
+				return true
+			}
+		}
+		return false
+	case common.LDAPFilterNot:
+		return !matchFilter(f.Child(0), entry)
+	case common.LDAPFilterEquality:
+		for _, v := range entry.GetAttrs(f.Child(0).Str()) {
+			if strings.EqualFold(v, f.Child(1).Str()) {
+				return true
+			}
+		}
+		return false
+	case common.LDAPFilterPresent:
+		return len(entry.GetAttrs(f.Str())) > 0
+	case common.LDAPFilterSubstrings:
+		for _, v := range entry.GetAttrs(f.Child(0).Str()) {
+			if matchSubstrings(strings.ToLower(v), f.Child(1).Children) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func matchSubstrings(v string, subs []*common.BerPacket) bool {
+	for _, sub := range subs {
+		s := strings.ToLower(sub.Str())
+		switch sub.Tag {
+		case 0:
+			if !strings.HasPrefix(v, s) {
+				return false
+			}
+			v = v[len(s):]
+		case 1:
+			i := strings.Index(v, s)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(s):]
+		case 2:
+			if !strings.HasSuffix(v, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
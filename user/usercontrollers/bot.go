@@ -0,0 +1,191 @@
+package usercontrollers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 10100-10199 */
+
+// BotController - Create Bot Controller
+type BotController struct {
+	Service  userservices.BotServiceIntf
+	Serviceu userservices.UserServiceIntf
+}
+
+// NewBotController - Create Bot Handler
+func NewBotController(s userservices.BotServiceIntf, su userservices.UserServiceIntf) *BotController {
+	return &BotController{
+		Service:  s,
+		Serviceu: su,
+	}
+}
+
+// ServeHTTP - parse url and call controller action
+func (bc *BotController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, requestID, err := bc.Serviceu.GetAuthUserDetails(r)
+	if err != nil {
+		common.RenderErrorJSON(w, "1001", err.Error(), 401, requestID)
+		return
+	}
+	pathParts := common.GetPathParts(r.URL.Path)
+
+	switch r.Method {
+	case http.MethodGet:
+		bc.processGet(w, r, user, requestID, pathParts)
+	case http.MethodPost:
+		bc.processPost(w, r, user, requestID, pathParts)
+	case http.MethodDelete:
+		bc.processDelete(w, r, user, requestID, pathParts)
+	default:
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processGet - Parse URL for all the GET paths and call the controller action
+/*
+ GET  "/v0.1/bots"
+*/
+
+func (bc *BotController) processGet(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 2) && (pathParts[1] == "bots") {
+		bc.GetBots(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processPost - Parse URL for all the POST paths and call the controller action
+/*
+ POST  "/v0.1/bots/create"
+ POST  "/v0.1/bots/{id}/token"
+*/
+
+func (bc *BotController) processPost(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "bots") && (pathParts[2] == "create") {
+		bc.CreateBot(w, r, user, requestID)
+	} else if (len(pathParts) == 4) && (pathParts[1] == "bots") && (pathParts[3] == "token") {
+		bc.CreateBotToken(w, r, pathParts[2], user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processDelete - Parse URL for all the delete paths and call the controller action
+/*
+ DELETE  "/v0.1/bots/{id}"
+*/
+
+func (bc *BotController) processDelete(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "bots") {
+		bc.DeleteBot(w, r, pathParts[2], user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// CreateBot - used to Create a bot user, the response carries its API token
+func (bc *BotController) CreateBot(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := userservices.User{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 10100}).Error(err)
+			common.RenderErrorJSON(w, "10100", err.Error(), 402, requestID)
+			return
+		}
+		v := common.NewValidator()
+		v.IsStrLenBetMinMax("First Name", form.FirstName, userservices.FirstNameLenMin, userservices.FirstNameLenMax)
+		if v.IsValid() {
+			common.RenderErrorJSON(w, "10101", v.Error(), 402, requestID)
+			return
+		}
+		bot, err := bc.Service.CreateBot(ctx, &form, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 10102}).Error(err)
+			common.RenderErrorJSON(w, "10102", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, bot)
+	}
+}
+
+// GetBots - used to view the bot users
+func (bc *BotController) GetBots(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		bots, err := bc.Service.GetBots(ctx, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 10103}).Error(err)
+			common.RenderErrorJSON(w, "10103", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, bots)
+	}
+}
+
+// CreateBotToken - used to rotate the API token of a bot user
+func (bc *BotController) CreateBotToken(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		bot, err := bc.Service.CreateBotToken(ctx, id, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 10104}).Error(err)
+			common.RenderErrorJSON(w, "10104", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, bot)
+	}
+}
+
+// DeleteBot - delete bot user and revoke its API tokens
+func (bc *BotController) DeleteBot(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		err := bc.Service.DeleteBot(ctx, id, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 10105}).Error(err)
+			common.RenderErrorJSON(w, "10105", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Deleted Successfully")
+	}
+}
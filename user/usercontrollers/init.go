@@ -9,12 +9,19 @@ import (
 )
 
 // Init the user controllers
-func Init(userService userservices.UserServiceIntf, ugroupService userservices.UgroupServiceIntf, ubadgeService userservices.UbadgeServiceIntf, rateOpt *common.RateOptions, jwtOpt *common.JWTOptions, mux *http.ServeMux, store *goredisstore.GoRedisStore) {
+func Init(userService userservices.UserServiceIntf, ugroupService userservices.UgroupServiceIntf, ubadgeService userservices.UbadgeServiceIntf, botService userservices.BotServiceIntf, notificationService userservices.NotificationServiceIntf, digestService userservices.DigestServiceIntf, inviteService userservices.InviteServiceIntf, sessionService userservices.SessionServiceIntf, tokenService userservices.TokenServiceIntf, scimService userservices.SCIMServiceIntf, rateOpt *common.RateOptions, jwtOpt *common.JWTOptions, userOpt *common.UserOptions, mux *http.ServeMux, store *goredisstore.GoRedisStore) {
 
 	usc := NewUserController(userService)
-	uc := NewUController(userService)
+	uc := NewUController(userService, digestService, inviteService)
 	ugc := NewUgroupController(ugroupService, userService)
 	ubc := NewUbadgeController(ubadgeService, userService)
+	bc := NewBotController(botService, userService)
+	nc := NewNotificationController(notificationService, digestService, userService)
+	ic := NewInviteController(inviteService, userService)
+	sc := NewSessionController(sessionService, userService)
+	tc := NewTokenController(tokenService, userService)
+	jc := NewJWKSController(jwtOpt)
+	scc := NewSCIMController(scimService, userOpt)
 
 	hrlUser := common.GetHTTPRateLimiter(store, rateOpt.UserMaxRate, rateOpt.UserMaxBurst)
 	hrlU := common.GetHTTPRateLimiter(store, rateOpt.UMaxRate, rateOpt.UMaxBurst)
@@ -23,21 +30,57 @@ func Init(userService userservices.UserServiceIntf, ugroupService userservices.U
 
 	mux.Handle("/v0.1/users", common.AddMiddleware(hrlUser.RateLimit(usc),
 		common.AuthenticateMiddleware,
-		common.CorsMiddleware))
+		common.CorsMiddleware, common.LocaleMiddleware))
 	mux.Handle("/v0.1/users/", common.AddMiddleware(hrlUser.RateLimit(usc),
 		common.AuthenticateMiddleware,
-		common.CorsMiddleware))
-	mux.Handle("/v0.1/u/", common.AddMiddleware(hrlU.RateLimit(uc), common.CorsMiddleware))
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/u/", common.AddMiddleware(hrlU.RateLimit(uc), common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/.well-known/jwks.json", common.AddMiddleware(hrlU.RateLimit(jc), common.CorsMiddleware))
+	// the identity provider authenticates with the scim token, not a session
+	mux.Handle("/scim/v2/", hrlUser.RateLimit(scc))
 	mux.Handle("/v0.1/ugroups", common.AddMiddleware(hrlUgroup.RateLimit(ugc),
 		common.AuthenticateMiddleware,
-		common.CorsMiddleware))
+		common.CorsMiddleware, common.LocaleMiddleware))
 	mux.Handle("/v0.1/ugroups/", common.AddMiddleware(hrlUgroup.RateLimit(ugc),
 		common.AuthenticateMiddleware,
-		common.CorsMiddleware))
+		common.CorsMiddleware, common.LocaleMiddleware))
 	mux.Handle("/v0.1/ubadges", common.AddMiddleware(hrlUbadge.RateLimit(ubc),
 		common.AuthenticateMiddleware,
-		common.CorsMiddleware))
+		common.CorsMiddleware, common.LocaleMiddleware))
 	mux.Handle("/v0.1/ubadges/", common.AddMiddleware(hrlUbadge.RateLimit(ubc),
 		common.AuthenticateMiddleware,
-		common.CorsMiddleware))
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/bots", common.AddMiddleware(hrlUser.RateLimit(bc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/bots/", common.AddMiddleware(hrlUser.RateLimit(bc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/notifications", common.AddMiddleware(hrlUser.RateLimit(nc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/notifications/", common.AddMiddleware(hrlUser.RateLimit(nc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/invites", common.AddMiddleware(hrlUser.RateLimit(ic),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/invites/", common.AddMiddleware(hrlUser.RateLimit(ic),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/users/me/sessions", common.AddMiddleware(hrlUser.RateLimit(sc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/users/me/sessions/", common.AddMiddleware(hrlUser.RateLimit(sc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/users/force_logout", common.AddMiddleware(hrlUser.RateLimit(sc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/users/me/tokens", common.AddMiddleware(hrlUser.RateLimit(tc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
+	mux.Handle("/v0.1/users/me/tokens/", common.AddMiddleware(hrlUser.RateLimit(tc),
+		common.AuthenticateMiddleware,
+		common.CorsMiddleware, common.LocaleMiddleware))
 }
@@ -0,0 +1,162 @@
+package usercontrollers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 13700-13799 */
+
+// InviteController - Create Invite Controller
+type InviteController struct {
+	Service  userservices.InviteServiceIntf
+	Serviceu userservices.UserServiceIntf
+}
+
+// NewInviteController - Create Invite Handler
+func NewInviteController(s userservices.InviteServiceIntf, su userservices.UserServiceIntf) *InviteController {
+	return &InviteController{
+		Service:  s,
+		Serviceu: su,
+	}
+}
+
+// ServeHTTP - parse url and call controller action
+func (ic *InviteController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, requestID, err := ic.Serviceu.GetAuthUserDetails(r)
+	if err != nil {
+		common.RenderErrorJSON(w, "1001", err.Error(), 401, requestID)
+		return
+	}
+	pathParts := common.GetPathParts(r.URL.Path)
+
+	switch r.Method {
+	case http.MethodGet:
+		ic.processGet(w, r, user, requestID, pathParts)
+	case http.MethodPost:
+		ic.processPost(w, r, user, requestID, pathParts)
+	case http.MethodDelete:
+		ic.processDelete(w, r, user, requestID, pathParts)
+	default:
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processGet - Parse URL for all the GET paths and call the controller action
+/*
+ GET  "/v0.1/invites"
+*/
+
+func (ic *InviteController) processGet(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 2) && (pathParts[1] == "invites") {
+		ic.GetInvites(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processPost - Parse URL for all the POST paths and call the controller action
+/*
+ POST  "/v0.1/invites/create"
+*/
+
+func (ic *InviteController) processPost(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "invites") && (pathParts[2] == "create") {
+		ic.CreateInvite(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processDelete - Parse URL for all the delete paths and call the controller action
+/*
+ DELETE  "/v0.1/invites/{id}"
+*/
+
+func (ic *InviteController) processDelete(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "invites") {
+		ic.DeleteInvite(w, r, pathParts[2], user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// CreateInvite - used to Create an invite link to a workspace
+func (ic *InviteController) CreateInvite(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := userservices.InviteForm{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 13700}).Error(err)
+			common.RenderErrorJSON(w, "13700", err.Error(), 402, requestID)
+			return
+		}
+		invite, err := ic.Service.CreateInvite(ctx, &form, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 13701}).Error(err)
+			common.RenderErrorJSON(w, "13701", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, invite)
+	}
+}
+
+// GetInvites - used to view the invites
+func (ic *InviteController) GetInvites(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		invites, err := ic.Service.GetInvites(ctx, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 13702}).Error(err)
+			common.RenderErrorJSON(w, "13702", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, invites)
+	}
+}
+
+// DeleteInvite - delete the invite, its link stops working
+func (ic *InviteController) DeleteInvite(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		err := ic.Service.DeleteInvite(ctx, id, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 13703}).Error(err)
+			common.RenderErrorJSON(w, "13703", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Deleted Successfully")
+	}
+}
@@ -0,0 +1,36 @@
+package usercontrollers
+
+import (
+	"net/http"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+/* error message range: 14500-14549 */
+
+// JWKSController - serves the public keys vilom tokens are signed with,
+// so other services can verify them without the signing secret
+type JWKSController struct {
+	JWTOptions *common.JWTOptions
+}
+
+// NewJWKSController - Create JWKS Handler
+func NewJWKSController(jwtOpt *common.JWTOptions) *JWKSController {
+	return &JWKSController{
+		JWTOptions: jwtOpt,
+	}
+}
+
+// ServeHTTP - parse url and call controller action
+/*
+ GET  "/.well-known/jwks.json"
+*/
+func (jc *JWKSController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, common.GetRequestID())
+		return
+	}
+	// verifiers refetch the keys after a rotation
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	common.RenderJSON(w, common.GetJWKS(jc.JWTOptions))
+}
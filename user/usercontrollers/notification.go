@@ -0,0 +1,337 @@
+package usercontrollers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 12900-12999 */
+
+// notificationPingInterval - how often an idle notification stream sends
+// a comment, so proxies keep the connection open
+const notificationPingInterval = 30 * time.Second
+
+// NotificationController - Create Notification Controller
+type NotificationController struct {
+	Service  userservices.NotificationServiceIntf
+	Serviced userservices.DigestServiceIntf
+	Serviceu userservices.UserServiceIntf
+}
+
+// NewNotificationController - Create Notification Handler
+func NewNotificationController(s userservices.NotificationServiceIntf, sd userservices.DigestServiceIntf, su userservices.UserServiceIntf) *NotificationController {
+	return &NotificationController{
+		Service:  s,
+		Serviced: sd,
+		Serviceu: su,
+	}
+}
+
+// ServeHTTP - parse url and call controller action
+func (nc *NotificationController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, requestID, err := nc.Serviceu.GetAuthUserDetails(r)
+	if err != nil {
+		common.RenderErrorJSON(w, "1001", err.Error(), 401, requestID)
+		return
+	}
+	pathParts, queryString, err := common.ParseURL(r.URL.String())
+	if err != nil {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		nc.processGet(w, r, user, requestID, pathParts, queryString)
+	case http.MethodPost:
+		nc.processPost(w, r, user, requestID, pathParts)
+	case http.MethodPut:
+		nc.processPut(w, r, user, requestID, pathParts)
+	default:
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processGet - Parse URL for all the GET paths and call the controller action
+/*
+ GET  "/v0.1/notifications?limit={limit}&cursor={cursor}&unread=true"
+ GET  "/v0.1/notifications/stream"
+ GET  "/v0.1/notifications/prefs"
+ GET  "/v0.1/notifications/digest"
+*/
+
+func (nc *NotificationController) processGet(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string, queryString url.Values) {
+
+	if (len(pathParts) == 2) && (pathParts[1] == "notifications") {
+		nc.GetNotifications(w, r, queryString.Get("limit"), queryString.Get("cursor"), queryString.Get("unread") == "true", user, requestID)
+	} else if (len(pathParts) == 3) && (pathParts[1] == "notifications") && (pathParts[2] == "stream") {
+		nc.StreamNotifications(w, r, user, requestID)
+	} else if (len(pathParts) == 3) && (pathParts[1] == "notifications") && (pathParts[2] == "prefs") {
+		nc.GetNotificationPrefs(w, r, user, requestID)
+	} else if (len(pathParts) == 3) && (pathParts[1] == "notifications") && (pathParts[2] == "digest") {
+		nc.GetDigestPref(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processPost - Parse URL for all the POST paths and call the controller action
+/*
+ POST  "/v0.1/notifications/readall"
+ POST  "/v0.1/notifications/{id}/read"
+*/
+
+func (nc *NotificationController) processPost(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "notifications") && (pathParts[2] == "readall") {
+		nc.MarkAllNotificationsRead(w, r, user, requestID)
+	} else if (len(pathParts) == 4) && (pathParts[1] == "notifications") && (pathParts[3] == "read") {
+		nc.MarkNotificationRead(w, r, pathParts[2], user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processPut - Parse URL for all the PUT paths and call the controller action
+/*
+ PUT  "/v0.1/notifications/prefs"
+ PUT  "/v0.1/notifications/digest"
+*/
+
+func (nc *NotificationController) processPut(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 3) && (pathParts[1] == "notifications") && (pathParts[2] == "prefs") {
+		nc.UpdateNotificationPrefs(w, r, user, requestID)
+	} else if (len(pathParts) == 3) && (pathParts[1] == "notifications") && (pathParts[2] == "digest") {
+		nc.UpdateDigestPref(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// GetNotifications - used to view the notifications of the user
+func (nc *NotificationController) GetNotifications(w http.ResponseWriter, r *http.Request, limit string, cursor string, unread bool, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		notifications, err := nc.Service.GetNotifications(ctx, limit, cursor, unread, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12900}).Error(err)
+			common.RenderErrorJSON(w, "12900", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, notifications)
+	}
+}
+
+// StreamNotifications - used to push the notifications of the user as
+// server-sent events while the client stays connected
+func (nc *NotificationController) StreamNotifications(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			common.RenderErrorJSON(w, "12901", "Streaming not supported", 402, requestID)
+			return
+		}
+		notifications, stop, err := nc.Service.Subscribe(ctx, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12902}).Error(err)
+			common.RenderErrorJSON(w, "12902", err.Error(), 402, requestID)
+			return
+		}
+		defer stop()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ticker := time.NewTicker(notificationPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_, err = fmt.Fprint(w, ": ping\n\n")
+			case n, ok := <-notifications:
+				if !ok {
+					return
+				}
+				var data []byte
+				data, err = json.Marshal(n)
+				if err != nil {
+					log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12903}).Error(err)
+					continue
+				}
+				_, err = fmt.Fprintf(w, "event: notification\nid: %s\ndata: %s\n\n", n.IDS, data)
+			}
+			if err != nil {
+				log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12904}).Error(err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// GetNotificationPrefs - used to view which notification types the user gets
+func (nc *NotificationController) GetNotificationPrefs(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		prefs, err := nc.Service.GetNotificationPrefs(ctx, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12905}).Error(err)
+			common.RenderErrorJSON(w, "12905", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, prefs)
+	}
+}
+
+// UpdateNotificationPrefs - used to turn notification types on or off
+func (nc *NotificationController) UpdateNotificationPrefs(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := []*userservices.NotificationPref{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12906}).Error(err)
+			common.RenderErrorJSON(w, "12906", err.Error(), 402, requestID)
+			return
+		}
+		err = nc.Service.UpdateNotificationPrefs(ctx, form, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12907}).Error(err)
+			common.RenderErrorJSON(w, "12907", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Updated Successfully")
+	}
+}
+
+// GetDigestPref - used to view how often the user gets the email digest
+func (nc *NotificationController) GetDigestPref(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		pref, err := nc.Serviced.GetDigestPref(ctx, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12910}).Error(err)
+			common.RenderErrorJSON(w, "12910", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, pref)
+	}
+}
+
+// UpdateDigestPref - used to set the email digest to daily, weekly or off
+func (nc *NotificationController) UpdateDigestPref(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := userservices.DigestPref{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12911}).Error(err)
+			common.RenderErrorJSON(w, "12911", err.Error(), 402, requestID)
+			return
+		}
+		err = nc.Serviced.UpdateDigestPref(ctx, &form, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12912}).Error(err)
+			common.RenderErrorJSON(w, "12912", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Updated Successfully")
+	}
+}
+
+// MarkNotificationRead - used to mark a notification of the user as read
+func (nc *NotificationController) MarkNotificationRead(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		err := nc.Service.MarkNotificationRead(ctx, id, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12908}).Error(err)
+			common.RenderErrorJSON(w, "12908", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Updated Successfully")
+	}
+}
+
+// MarkAllNotificationsRead - used to mark all the notifications of the user as read
+func (nc *NotificationController) MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		err := nc.Service.MarkAllNotificationsRead(ctx, user.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 12909}).Error(err)
+			common.RenderErrorJSON(w, "12909", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Updated Successfully")
+	}
+}
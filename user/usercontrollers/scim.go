@@ -0,0 +1,382 @@
+package usercontrollers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 14550-14599 */
+
+// SCIMController - SCIM 2.0 provisioning of users and groups, the
+// identity provider authenticates with the dedicated scim_token instead
+// of a user session
+type SCIMController struct {
+	Service     userservices.SCIMServiceIntf
+	UserOptions *common.UserOptions
+}
+
+// NewSCIMController - Create SCIM Handler
+func NewSCIMController(s userservices.SCIMServiceIntf, userOpt *common.UserOptions) *SCIMController {
+	return &SCIMController{
+		Service:     s,
+		UserOptions: userOpt,
+	}
+}
+
+// scimServiceProviderConfig - what the SCIM endpoints support
+var scimServiceProviderConfig = map[string]interface{}{
+	"schemas":        []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+	"patch":          map[string]bool{"supported": true},
+	"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+	"filter":         map[string]interface{}{"supported": true, "maxResults": userservices.SCIMMaxCount},
+	"changePassword": map[string]bool{"supported": false},
+	"sort":           map[string]bool{"supported": false},
+	"etag":           map[string]bool{"supported": false},
+	"authenticationSchemes": []map[string]string{{
+		"type":        "oauthbearertoken",
+		"name":        "OAuth Bearer Token",
+		"description": "The scim_token of the user options",
+	}},
+}
+
+// ServeHTTP - parse url and call controller action
+/*
+ GET     "/scim/v2/ServiceProviderConfig"
+ GET     "/scim/v2/Users"
+ POST    "/scim/v2/Users"
+ GET     "/scim/v2/Users/{id}"
+ PUT     "/scim/v2/Users/{id}"
+ PATCH   "/scim/v2/Users/{id}"
+ DELETE  "/scim/v2/Users/{id}"
+ GET     "/scim/v2/Groups"
+ POST    "/scim/v2/Groups"
+ GET     "/scim/v2/Groups/{id}"
+ PUT     "/scim/v2/Groups/{id}"
+ PATCH   "/scim/v2/Groups/{id}"
+ DELETE  "/scim/v2/Groups/{id}"
+*/
+func (sc *SCIMController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := common.GetRequestID()
+	if !sc.authorized(r) {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14550}).Warn("SCIM request with an invalid token from " + r.RemoteAddr)
+		renderSCIMError(w, &userservices.SCIMError{Status: http.StatusUnauthorized, Detail: "Invalid token"}, requestID)
+		return
+	}
+	pathParts := common.GetPathParts(r.URL.Path)
+	if len(pathParts) < 3 || len(pathParts) > 4 {
+		renderSCIMError(w, &userservices.SCIMError{Status: http.StatusNotFound, Detail: "Invalid Request"}, requestID)
+		return
+	}
+	resource := pathParts[2]
+	ID := ""
+	if len(pathParts) == 4 {
+		ID = pathParts[3]
+	}
+
+	switch {
+	case resource == "ServiceProviderConfig" && ID == "" && r.Method == http.MethodGet:
+		renderSCIM(w, http.StatusOK, scimServiceProviderConfig)
+	case resource == "Users" && ID == "" && r.Method == http.MethodGet:
+		sc.GetUsers(w, r, requestID)
+	case resource == "Users" && ID == "" && r.Method == http.MethodPost:
+		sc.CreateUser(w, r, requestID)
+	case resource == "Users" && ID != "" && r.Method == http.MethodGet:
+		sc.GetUser(w, r, ID, requestID)
+	case resource == "Users" && ID != "" && r.Method == http.MethodPut:
+		sc.ReplaceUser(w, r, ID, requestID)
+	case resource == "Users" && ID != "" && r.Method == http.MethodPatch:
+		sc.PatchUser(w, r, ID, requestID)
+	case resource == "Users" && ID != "" && r.Method == http.MethodDelete:
+		sc.DeleteUser(w, r, ID, requestID)
+	case resource == "Groups" && ID == "" && r.Method == http.MethodGet:
+		sc.GetGroups(w, r, requestID)
+	case resource == "Groups" && ID == "" && r.Method == http.MethodPost:
+		sc.CreateGroup(w, r, requestID)
+	case resource == "Groups" && ID != "" && r.Method == http.MethodGet:
+		sc.GetGroup(w, r, ID, requestID)
+	case resource == "Groups" && ID != "" && r.Method == http.MethodPut:
+		sc.ReplaceGroup(w, r, ID, requestID)
+	case resource == "Groups" && ID != "" && r.Method == http.MethodPatch:
+		sc.PatchGroup(w, r, ID, requestID)
+	case resource == "Groups" && ID != "" && r.Method == http.MethodDelete:
+		sc.DeleteGroup(w, r, ID, requestID)
+	default:
+		renderSCIMError(w, &userservices.SCIMError{Status: http.StatusNotFound, Detail: "Invalid Request"}, requestID)
+	}
+}
+
+// authorized - whether the request has the scim_token, SCIM is disabled
+// when there is none
+func (sc *SCIMController) authorized(r *http.Request) bool {
+	if sc.UserOptions.SCIMToken == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return false
+	}
+	got := sha256.Sum256([]byte(strings.TrimSpace(auth[7:])))
+	want := sha256.Sum256([]byte(sc.UserOptions.SCIMToken))
+	return subtle.ConstantTimeCompare(got[:], want[:]) == 1
+}
+
+// renderSCIM - send a SCIM JSON response
+func renderSCIM(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	if data == nil {
+		return
+	}
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.WithFields(log.Fields{"msgnum": 14551}).Error(err)
+	}
+}
+
+// renderSCIMError - send a SCIM error, errors other than SCIMError are
+// internal errors
+func renderSCIMError(w http.ResponseWriter, err error, requestID string) {
+	scimErr, ok := err.(*userservices.SCIMError)
+	if !ok {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14552}).Error(err)
+		scimErr = &userservices.SCIMError{Status: http.StatusInternalServerError, Detail: "Internal error, request " + requestID}
+	}
+	e := map[string]interface{}{
+		"schemas": []string{userservices.SCIMSchemaError},
+		"status":  strconv.Itoa(scimErr.Status),
+		"detail":  scimErr.Detail,
+	}
+	if scimErr.SCIMType != "" {
+		e["scimType"] = scimErr.SCIMType
+	}
+	renderSCIM(w, scimErr.Status, e)
+}
+
+// scimLocation - the URL of the resource
+func scimLocation(r *http.Request, resource string, ID string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/scim/v2/" + resource + "/" + ID
+}
+
+func setUserLocation(r *http.Request, user *userservices.SCIMUser) {
+	if user.Meta != nil {
+		user.Meta.Location = scimLocation(r, "Users", user.ID)
+	}
+}
+
+func setGroupLocation(r *http.Request, group *userservices.SCIMGroup) {
+	if group.Meta != nil {
+		group.Meta.Location = scimLocation(r, "Groups", group.ID)
+	}
+}
+
+// scimListParams - the filter, startIndex and count of a list request
+func scimListParams(r *http.Request) (string, int, int) {
+	query := r.URL.Query()
+	startIndex, err := strconv.Atoi(query.Get("startIndex"))
+	if err != nil {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(query.Get("count"))
+	if err != nil {
+		count = userservices.SCIMMaxCount
+	}
+	return query.Get("filter"), startIndex, count
+}
+
+// decodeSCIM - decode the request body into form
+func decodeSCIM(r *http.Request, form interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(form)
+	if err != nil {
+		return &userservices.SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidSyntax", Detail: err.Error()}
+	}
+	return nil
+}
+
+// GetUsers - Get the users matching the filter
+func (sc *SCIMController) GetUsers(w http.ResponseWriter, r *http.Request, requestID string) {
+	filter, startIndex, count := scimListParams(r)
+	resp, err := sc.Service.GetSCIMUsers(r.Context(), filter, startIndex, count, requestID)
+	if err != nil {
+		renderSCIMError(w, err, requestID)
+		return
+	}
+	for _, res := range resp.Resources {
+		setUserLocation(r, res.(*userservices.SCIMUser))
+	}
+	renderSCIM(w, http.StatusOK, resp)
+}
+
+// GetUser - Get the user
+func (sc *SCIMController) GetUser(w http.ResponseWriter, r *http.Request, ID string, requestID string) {
+	user, err := sc.Service.GetSCIMUser(r.Context(), ID, requestID)
+	if err != nil {
+		renderSCIMError(w, err, requestID)
+		return
+	}
+	setUserLocation(r, user)
+	renderSCIM(w, http.StatusOK, user)
+}
+
+// CreateUser - Provision a user
+func (sc *SCIMController) CreateUser(w http.ResponseWriter, r *http.Request, requestID string) {
+	form := userservices.SCIMUser{}
+	err := decodeSCIM(r, &form)
+	if err == nil {
+		var user *userservices.SCIMUser
+		user, err = sc.Service.CreateSCIMUser(r.Context(), &form, requestID)
+		if err == nil {
+			setUserLocation(r, user)
+			w.Header().Set("Location", user.Meta.Location)
+			renderSCIM(w, http.StatusCreated, user)
+			return
+		}
+	}
+	log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14553}).Error(err)
+	renderSCIMError(w, err, requestID)
+}
+
+// ReplaceUser - Replace the attributes of the user
+func (sc *SCIMController) ReplaceUser(w http.ResponseWriter, r *http.Request, ID string, requestID string) {
+	form := userservices.SCIMUser{}
+	err := decodeSCIM(r, &form)
+	if err == nil {
+		var user *userservices.SCIMUser
+		user, err = sc.Service.ReplaceSCIMUser(r.Context(), ID, &form, requestID)
+		if err == nil {
+			setUserLocation(r, user)
+			renderSCIM(w, http.StatusOK, user)
+			return
+		}
+	}
+	log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14554}).Error(err)
+	renderSCIMError(w, err, requestID)
+}
+
+// PatchUser - Apply PATCH operations to the user
+func (sc *SCIMController) PatchUser(w http.ResponseWriter, r *http.Request, ID string, requestID string) {
+	form := userservices.SCIMPatchOp{}
+	err := decodeSCIM(r, &form)
+	if err == nil {
+		var user *userservices.SCIMUser
+		user, err = sc.Service.PatchSCIMUser(r.Context(), ID, &form, requestID)
+		if err == nil {
+			setUserLocation(r, user)
+			renderSCIM(w, http.StatusOK, user)
+			return
+		}
+	}
+	log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14555}).Error(err)
+	renderSCIMError(w, err, requestID)
+}
+
+// DeleteUser - Deactivate the user
+func (sc *SCIMController) DeleteUser(w http.ResponseWriter, r *http.Request, ID string, requestID string) {
+	err := sc.Service.DeleteSCIMUser(r.Context(), ID, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14556}).Error(err)
+		renderSCIMError(w, err, requestID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetGroups - Get the groups matching the filter
+func (sc *SCIMController) GetGroups(w http.ResponseWriter, r *http.Request, requestID string) {
+	filter, startIndex, count := scimListParams(r)
+	resp, err := sc.Service.GetSCIMGroups(r.Context(), filter, startIndex, count, requestID)
+	if err != nil {
+		renderSCIMError(w, err, requestID)
+		return
+	}
+	for _, res := range resp.Resources {
+		setGroupLocation(r, res.(*userservices.SCIMGroup))
+	}
+	renderSCIM(w, http.StatusOK, resp)
+}
+
+// GetGroup - Get the group
+func (sc *SCIMController) GetGroup(w http.ResponseWriter, r *http.Request, ID string, requestID string) {
+	group, err := sc.Service.GetSCIMGroup(r.Context(), ID, requestID)
+	if err != nil {
+		renderSCIMError(w, err, requestID)
+		return
+	}
+	setGroupLocation(r, group)
+	renderSCIM(w, http.StatusOK, group)
+}
+
+// CreateGroup - Create a group
+func (sc *SCIMController) CreateGroup(w http.ResponseWriter, r *http.Request, requestID string) {
+	form := userservices.SCIMGroup{}
+	err := decodeSCIM(r, &form)
+	if err == nil {
+		var group *userservices.SCIMGroup
+		group, err = sc.Service.CreateSCIMGroup(r.Context(), &form, requestID)
+		if err == nil {
+			setGroupLocation(r, group)
+			w.Header().Set("Location", group.Meta.Location)
+			renderSCIM(w, http.StatusCreated, group)
+			return
+		}
+	}
+	log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14557}).Error(err)
+	renderSCIMError(w, err, requestID)
+}
+
+// ReplaceGroup - Replace the name and members of the group
+func (sc *SCIMController) ReplaceGroup(w http.ResponseWriter, r *http.Request, ID string, requestID string) {
+	form := userservices.SCIMGroup{}
+	err := decodeSCIM(r, &form)
+	if err == nil {
+		var group *userservices.SCIMGroup
+		group, err = sc.Service.ReplaceSCIMGroup(r.Context(), ID, &form, requestID)
+		if err == nil {
+			setGroupLocation(r, group)
+			renderSCIM(w, http.StatusOK, group)
+			return
+		}
+	}
+	log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14558}).Error(err)
+	renderSCIMError(w, err, requestID)
+}
+
+// PatchGroup - Apply PATCH operations to the group
+func (sc *SCIMController) PatchGroup(w http.ResponseWriter, r *http.Request, ID string, requestID string) {
+	form := userservices.SCIMPatchOp{}
+	err := decodeSCIM(r, &form)
+	if err == nil {
+		var group *userservices.SCIMGroup
+		group, err = sc.Service.PatchSCIMGroup(r.Context(), ID, &form, requestID)
+		if err == nil {
+			setGroupLocation(r, group)
+			renderSCIM(w, http.StatusOK, group)
+			return
+		}
+	}
+	log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14559}).Error(err)
+	renderSCIMError(w, err, requestID)
+}
+
+// DeleteGroup - Delete the group
+func (sc *SCIMController) DeleteGroup(w http.ResponseWriter, r *http.Request, ID string, requestID string) {
+	err := sc.Service.DeleteSCIMGroup(r.Context(), ID, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14560}).Error(err)
+		renderSCIMError(w, err, requestID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,180 @@
+package usercontrollers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 14100-14199 */
+
+// SessionController - Create Session Controller
+type SessionController struct {
+	Service  userservices.SessionServiceIntf
+	Serviceu userservices.UserServiceIntf
+}
+
+// NewSessionController - Create Session Handler
+func NewSessionController(s userservices.SessionServiceIntf, su userservices.UserServiceIntf) *SessionController {
+	return &SessionController{
+		Service:  s,
+		Serviceu: su,
+	}
+}
+
+// ServeHTTP - parse url and call controller action
+func (sc *SessionController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, requestID, err := sc.Serviceu.GetAuthUserDetails(r)
+	if err != nil {
+		common.RenderErrorJSON(w, "1001", err.Error(), 401, requestID)
+		return
+	}
+	pathParts := common.GetPathParts(r.URL.Path)
+
+	switch r.Method {
+	case http.MethodGet:
+		sc.processGet(w, r, user, requestID, pathParts)
+	case http.MethodPost:
+		sc.processPost(w, r, user, requestID, pathParts)
+	default:
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processGet - Parse URL for all the GET paths and call the controller action
+/*
+ GET  "/v0.1/users/me/sessions"
+*/
+
+func (sc *SessionController) processGet(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 4) && (pathParts[3] == "sessions") {
+		sc.GetSessions(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processPost - Parse URL for all the POST paths and call the controller action
+/*
+ POST  "/v0.1/users/me/sessions/revoke"
+ POST  "/v0.1/users/me/sessions/revoke_others"
+ POST  "/v0.1/users/force_logout"
+*/
+
+func (sc *SessionController) processPost(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 5) && (pathParts[3] == "sessions") && (pathParts[4] == "revoke") {
+		sc.RevokeSession(w, r, user, requestID)
+	} else if (len(pathParts) == 5) && (pathParts[3] == "sessions") && (pathParts[4] == "revoke_others") {
+		sc.RevokeOtherSessions(w, r, user, requestID)
+	} else if (len(pathParts) == 3) && (pathParts[1] == "users") && (pathParts[2] == "force_logout") {
+		sc.ForceLogout(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// GetSessions - used to view the devices the user is signed in on
+func (sc *SessionController) GetSessions(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		sessions, err := sc.Service.GetSessions(ctx, user.SessionID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 14100}).Error(err)
+			common.RenderErrorJSON(w, "14100", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, sessions)
+	}
+}
+
+// RevokeSession - used to sign out one of the sessions of the user
+func (sc *SessionController) RevokeSession(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := userservices.SessionForm{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 14101}).Error(err)
+			common.RenderErrorJSON(w, "14101", err.Error(), 402, requestID)
+			return
+		}
+		err = sc.Service.RevokeSession(ctx, form.ID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 14102}).Error(err)
+			common.RenderErrorJSON(w, "14102", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Revoked Successfully")
+	}
+}
+
+// RevokeOtherSessions - used to sign out all the sessions of the user
+// except the current one
+func (sc *SessionController) RevokeOtherSessions(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		err := sc.Service.RevokeOtherSessions(ctx, user.SessionID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 14103}).Error(err)
+			common.RenderErrorJSON(w, "14103", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Revoked Successfully")
+	}
+}
+
+// ForceLogout - used by admins to sign a user out of all sessions
+func (sc *SessionController) ForceLogout(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := userservices.SessionForm{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 14104}).Error(err)
+			common.RenderErrorJSON(w, "14104", err.Error(), 402, requestID)
+			return
+		}
+		err = sc.Service.ForceLogout(ctx, form.UserID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 14105}).Error(err)
+			common.RenderErrorJSON(w, "14105", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Logged Out Successfully")
+	}
+}
@@ -0,0 +1,156 @@
+package usercontrollers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/user/userservices"
+)
+
+/* error message range: 14200-14299 */
+
+// TokenController - Create Token Controller
+type TokenController struct {
+	Service  userservices.TokenServiceIntf
+	Serviceu userservices.UserServiceIntf
+}
+
+// NewTokenController - Create Token Handler
+func NewTokenController(s userservices.TokenServiceIntf, su userservices.UserServiceIntf) *TokenController {
+	return &TokenController{
+		Service:  s,
+		Serviceu: su,
+	}
+}
+
+// ServeHTTP - parse url and call controller action
+func (tc *TokenController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, requestID, err := tc.Serviceu.GetAuthUserDetails(r)
+	if err != nil {
+		common.RenderErrorJSON(w, "1001", err.Error(), 401, requestID)
+		return
+	}
+	pathParts := common.GetPathParts(r.URL.Path)
+
+	switch r.Method {
+	case http.MethodGet:
+		tc.processGet(w, r, user, requestID, pathParts)
+	case http.MethodPost:
+		tc.processPost(w, r, user, requestID, pathParts)
+	default:
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processGet - Parse URL for all the GET paths and call the controller action
+/*
+ GET  "/v0.1/users/me/tokens"
+*/
+
+func (tc *TokenController) processGet(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 4) && (pathParts[3] == "tokens") {
+		tc.GetTokens(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// processPost - Parse URL for all the POST paths and call the controller action
+/*
+ POST  "/v0.1/users/me/tokens/create"
+ POST  "/v0.1/users/me/tokens/revoke"
+*/
+
+func (tc *TokenController) processPost(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string) {
+
+	if (len(pathParts) == 5) && (pathParts[3] == "tokens") && (pathParts[4] == "create") {
+		tc.CreateToken(w, r, user, requestID)
+	} else if (len(pathParts) == 5) && (pathParts[3] == "tokens") && (pathParts[4] == "revoke") {
+		tc.RevokeToken(w, r, user, requestID)
+	} else {
+		common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
+		return
+	}
+}
+
+// CreateToken - used to Create a personal access token
+func (tc *TokenController) CreateToken(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := userservices.TokenForm{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 14200}).Error(err)
+			common.RenderErrorJSON(w, "14200", err.Error(), 402, requestID)
+			return
+		}
+		apiToken, err := tc.Service.CreateToken(ctx, &form, user.Scopes, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 14201}).Error(err)
+			common.RenderErrorJSON(w, "14201", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, apiToken)
+	}
+}
+
+// GetTokens - used to view the personal access tokens of the user
+func (tc *TokenController) GetTokens(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		apiTokens, err := tc.Service.GetTokens(ctx, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 14202}).Error(err)
+			common.RenderErrorJSON(w, "14202", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, apiTokens)
+	}
+}
+
+// RevokeToken - used to revoke a personal access token
+func (tc *TokenController) RevokeToken(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := userservices.TokenForm{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 14203}).Error(err)
+			common.RenderErrorJSON(w, "14203", err.Error(), 402, requestID)
+			return
+		}
+		err = tc.Service.RevokeToken(ctx, form.ID, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": user.Email, "reqid": requestID, "msgnum": 14204}).Error(err)
+			common.RenderErrorJSON(w, "14204", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "Revoked Successfully")
+	}
+}
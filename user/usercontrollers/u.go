@@ -14,12 +14,14 @@ import (
 
 // UController - create u controller
 type UController struct {
-	Service userservices.UserServiceIntf
+	Service  userservices.UserServiceIntf
+	Serviced userservices.DigestServiceIntf
+	Servicei userservices.InviteServiceIntf
 }
 
 // NewUController - create u handler
-func NewUController(s userservices.UserServiceIntf) *UController {
-	return &UController{s}
+func NewUController(s userservices.UserServiceIntf, sd userservices.DigestServiceIntf, si userservices.InviteServiceIntf) *UController {
+	return &UController{s, sd, si}
 }
 
 // ServeHTTP - parse url and call controller action
@@ -49,6 +51,8 @@ func (uc *UController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 /*
  GET /v1/u/confirmation/:token
  GET /v1/u/change_email/:token
+ GET /v1/u/digest_unsubscribe/:token
+ GET /v1/u/invites/:token
 */
 
 func (uc *UController) processGet(w http.ResponseWriter, r *http.Request, requestID string, pathParts []string) {
@@ -58,6 +62,10 @@ func (uc *UController) processGet(w http.ResponseWriter, r *http.Request, reques
 			uc.ConfirmEmail(w, r, pathParts[3], requestID)
 		} else if pathParts[2] == "change_email" {
 			uc.ConfirmChangeEmail(w, r, pathParts[3], requestID)
+		} else if pathParts[2] == "digest_unsubscribe" {
+			uc.DigestUnsubscribe(w, r, pathParts[3], requestID)
+		} else if pathParts[2] == "invites" {
+			uc.GetInvite(w, r, pathParts[3], requestID)
 		} else {
 			common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
 			return
@@ -74,6 +82,7 @@ func (uc *UController) processGet(w http.ResponseWriter, r *http.Request, reques
 	POST /v1/u/create
 	POST /v1/u/forgot_password
 	POST /v1/u/reset_password/:token
+	POST /v1/u/invites/:token
 */
 
 func (uc *UController) processPost(w http.ResponseWriter, r *http.Request, requestID string, pathParts []string) {
@@ -91,6 +100,8 @@ func (uc *UController) processPost(w http.ResponseWriter, r *http.Request, reque
 	} else if (len(pathParts) == 4) && (pathParts[1] == "u") {
 		if pathParts[2] == "reset_password" {
 			uc.ConfirmForgotPassword(w, r, pathParts[3], requestID)
+		} else if pathParts[2] == "invites" {
+			uc.AcceptInvite(w, r, pathParts[3], requestID)
 		} else {
 			common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
 			return
@@ -121,7 +132,7 @@ func (uc *UController) Login(w http.ResponseWriter, r *http.Request, requestID s
 			common.RenderErrorJSON(w, "1100", err.Error(), 402, requestID)
 			return
 		}
-		user, err := uc.Service.Login(ctx, &form, requestID)
+		user, err := uc.Service.Login(ctx, &form, common.ClientIP(r), r.UserAgent(), requestID)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"reqid":  requestID,
@@ -181,12 +192,14 @@ func (uc *UController) CreateUser(w http.ResponseWriter, r *http.Request, reques
 		v := common.NewValidator()
 		v.IsStrLenBetMinMax("First Name", form.FirstName, userservices.FirstNameLenMin, userservices.FirstNameLenMax)
 		v.IsStrLenBetMinMax("Last Name", form.LastName, userservices.LastNameLenMin, userservices.LastNameLenMax)
-		v.IsStrLenBetMinMax("Password", form.PasswordS, userservices.PasswordLenMin, userservices.PasswordLenMax)
 		v.IsEmail("Email", form.Email)
 		if v.IsValid() {
 			common.RenderErrorJSON(w, "1110", v.Error(), 402, requestID)
 			return
 		}
+		if form.Locale == "" {
+			form.Locale = common.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+		}
 		user, err := uc.Service.CreateUser(ctx, &form, r.Host, requestID)
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -290,3 +303,95 @@ func (uc *UController) ConfirmChangeEmail(w http.ResponseWriter, r *http.Request
 		common.RenderJSON(w, "Your Account confirmed successfully")
 	}
 }
+
+// DigestUnsubscribe - Turn off the email digest from the link in a digest
+func (uc *UController) DigestUnsubscribe(w http.ResponseWriter, r *http.Request, token string, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		err := uc.Serviced.Unsubscribe(ctx, token, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 1110,
+			}).Error(err)
+			common.RenderErrorJSON(w, "1110", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, "You will not get the email digest anymore")
+	}
+}
+
+// GetInvite - the workspace and channels the invite link joins
+func (uc *UController) GetInvite(w http.ResponseWriter, r *http.Request, token string, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		invite, err := uc.Servicei.GetInviteByToken(ctx, token, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 1111,
+			}).Error(err)
+			common.RenderErrorJSON(w, "1111", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, invite)
+	}
+}
+
+// AcceptInvite - Create the user with the invite link, the role comes
+// from the invite
+func (uc *UController) AcceptInvite(w http.ResponseWriter, r *http.Request, token string, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		form := userservices.User{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&form)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 1112,
+			}).Error(err)
+			common.RenderErrorJSON(w, "1112", err.Error(), 402, requestID)
+			return
+		}
+
+		v := common.NewValidator()
+		v.IsStrLenBetMinMax("First Name", form.FirstName, userservices.FirstNameLenMin, userservices.FirstNameLenMax)
+		v.IsStrLenBetMinMax("Last Name", form.LastName, userservices.LastNameLenMin, userservices.LastNameLenMax)
+		v.IsEmail("Email", form.Email)
+		if v.IsValid() {
+			common.RenderErrorJSON(w, "1113", v.Error(), 402, requestID)
+			return
+		}
+		if form.Locale == "" {
+			form.Locale = common.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+		}
+		user, err := uc.Servicei.AcceptInvite(ctx, token, &form, r.Host, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 1114,
+			}).Error(err)
+			common.RenderErrorJSON(w, "1114", err.Error(), 402, requestID)
+			return
+		}
+		common.RenderJSON(w, user)
+	}
+}
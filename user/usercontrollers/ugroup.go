@@ -62,6 +62,7 @@ func (uc *UgroupController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
  GET  "/v1/ugroups/{id}"
  GET  "/v1/ugroups/{id}/chdn"
  GET  "/v1/ugroups/{id}/getparent"
+ GET  "/v0.1/ugroups/{id}/members?effective=true"
 */
 
 func (uc *UgroupController) processGet(w http.ResponseWriter, r *http.Request, user *common.ContextData, requestID string, pathParts []string, queryString url.Values) {
@@ -78,6 +79,9 @@ func (uc *UgroupController) processGet(w http.ResponseWriter, r *http.Request, u
 			uc.GetChildUgroups(w, r, pathParts[2], user, requestID)
 		} else if pathParts[3] == "getparent" {
 			uc.GetParent(w, r, pathParts[2], user, requestID)
+		} else if pathParts[3] == "members" {
+			effective := queryString.Get("effective") == "true"
+			uc.GetUgroupMembers(w, r, pathParts[2], effective, user, requestID)
 		} else {
 			common.RenderErrorJSON(w, "1000", "Invalid Request", 400, requestID)
 			return
@@ -423,6 +427,31 @@ func (uc *UgroupController) GetChildUgroups(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+// GetUgroupMembers - Get the members of a ugroup, with effective also
+// the members inherited through the ugroup tree
+func (uc *UgroupController) GetUgroupMembers(w http.ResponseWriter, r *http.Request, id string, effective bool, user *common.ContextData, requestID string) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		common.RenderErrorJSON(w, "1002", "Client closed connection", 402, requestID)
+		return
+	default:
+		users, err := uc.Service.GetUgroupMembers(ctx, id, effective, user.Email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"user":   user.Email,
+				"reqid":  requestID,
+				"msgnum": 2016,
+			}).Error(err)
+			common.RenderErrorJSON(w, "2016", err.Error(), 402, requestID)
+			return
+		}
+
+		common.RenderJSON(w, users)
+	}
+}
+
 // GetParent - Get Parent ugroup of child ugroup
 func (uc *UgroupController) GetParent(w http.ResponseWriter, r *http.Request, id string, user *common.ContextData, requestID string) {
 	ctx := r.Context()
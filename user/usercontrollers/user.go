@@ -239,7 +239,7 @@ func (uc *UserController) ChangePassword(w http.ResponseWriter, r *http.Request,
 			common.RenderErrorJSON(w, "1306", err.Error(), 402, requestID)
 			return
 		}
-		err = uc.Service.ChangePassword(ctx, &form, user.Email, requestID)
+		err = uc.Service.ChangePassword(ctx, &form, user.SessionID, user.Email, requestID)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"user":   user.Email,
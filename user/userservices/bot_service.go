@@ -0,0 +1,553 @@
+package userservices
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+/* error message range: 9000-9099 */
+
+// BotRole - role of the users that are bots, bots have no password
+// and cannot login
+const BotRole = "bot"
+
+// BotEmailDomain - domain of the placeholder email of bot users
+const BotEmailDomain = "bots.vilom.invalid"
+
+// ErrAccessDenied - the user may not act on the object
+var ErrAccessDenied = errors.New("Access denied")
+
+// CreateBotUser - Create a bot user in tx, the bot user is the author of
+// the messages posted by an integration, ownerID is the user who created
+// the integration
+func (u *UserService) CreateBotUser(ctx context.Context, tx *sql.Tx, botName string, ownerID uint, userEmail string, requestID string) (*User, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9000}).Error(err)
+		return nil, err
+	default:
+		var err error
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		user := User{}
+		user.UUID4, err = common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9001}).Error(err)
+			return nil, err
+		}
+		user.IDS, err = common.UUIDBytesToStr(user.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9002}).Error(err)
+			return nil, err
+		}
+		user.Email = user.IDS + "@" + BotEmailDomain
+		user.Username = botName
+		user.FirstName = botName
+		user.Role = BotRole
+		user.Active = true
+		/*  StatusDates  */
+		user.Statusc = common.Active
+		user.CreatedAt = tn
+		user.UpdatedAt = tn
+		user.CreatedDay = tnday
+		user.CreatedWeek = tnweek
+		user.CreatedMonth = tnmonth
+		user.CreatedYear = tnyear
+		user.UpdatedDay = tnday
+		user.UpdatedWeek = tnweek
+		user.UpdatedMonth = tnmonth
+		user.UpdatedYear = tnyear
+
+		res, err := tx.ExecContext(ctx, `insert into users
+	  (
+		uuid4,
+		email,
+    username,
+		first_name,
+		last_name,
+		role,
+		active,
+		bot_owner_id,
+		statusc,
+		created_at,
+		updated_at,
+		created_day,
+		created_week,
+		created_month,
+		created_year,
+		updated_day,
+		updated_week,
+		updated_month,
+		updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?,?,?);`,
+			user.UUID4,
+			user.Email,
+			user.Username,
+			user.FirstName,
+			user.LastName,
+			user.Role,
+			user.Active,
+			ownerID,
+			/*  StatusDates  */
+			user.Statusc,
+			user.CreatedAt,
+			user.UpdatedAt,
+			user.CreatedDay,
+			user.CreatedWeek,
+			user.CreatedMonth,
+			user.CreatedYear,
+			user.UpdatedDay,
+			user.UpdatedWeek,
+			user.UpdatedMonth,
+			user.UpdatedYear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9003}).Error(err)
+			return nil, err
+		}
+		uID, err := res.LastInsertId()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9004}).Error(err)
+			return nil, err
+		}
+		user.ID = uint(uID)
+		return &user, nil
+	}
+}
+
+// APIToken - APIToken view representation, only the hash of the token
+// is stored; bot tokens have no scopes, expiry or last use
+type APIToken struct {
+	ID         uint       `json:"id,omitempty"`
+	UUID4      []byte     `json:"-"`
+	IDS        string     `json:"id_s,omitempty"`
+	UserID     uint       `json:"user_id,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+
+	/* only set when the token is created */
+	Token string `json:"token,omitempty"`
+
+	common.StatusDates
+}
+
+// BotServiceIntf - interface for Bot Service
+type BotServiceIntf interface {
+	CreateBot(ctx context.Context, form *User, userEmail string, requestID string) (*User, error)
+	GetBots(ctx context.Context, userEmail string, requestID string) ([]*User, error)
+	CreateBotToken(ctx context.Context, ID string, userEmail string, requestID string) (*User, error)
+	DeleteBot(ctx context.Context, ID string, userEmail string, requestID string) error
+}
+
+// BotService - For accessing bot services
+type BotService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+}
+
+// NewBotService - Create bot service
+func NewBotService(dbOpt *common.DBService, redisOpt *common.RedisService) *BotService {
+	return &BotService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+	}
+}
+
+// CreateBot - Create a bot user with an API token, the token is returned
+// in Tokenstring and cannot be read again; the user becomes the owner of
+// the bot
+func (b *BotService) CreateBot(ctx context.Context, form *User, userEmail string, requestID string) (*User, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9005}).Error(err)
+		return nil, err
+	default:
+		userserv := &UserService{DBService: b.DBService, RedisService: b.RedisService}
+		owner, err := userserv.GetUserByEmail(ctx, userEmail, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9040}).Error(err)
+			return nil, err
+		}
+		db := b.DBService.DB
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9006}).Error(err)
+			return nil, err
+		}
+		bot, err := userserv.CreateBotUser(ctx, tx, form.FirstName, owner.ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9007}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		bot.Tokenstring, err = b.createAPIToken(ctx, tx, bot.ID, form.FirstName, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9008}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9009}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		return bot, nil
+	}
+}
+
+// GetBots - Get the active bot users
+func (b *BotService) GetBots(ctx context.Context, userEmail string, requestID string) ([]*User, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9010}).Error(err)
+		return nil, err
+	default:
+		db := b.DBService.DB
+		bots := []*User{}
+		rows, err := db.QueryContext(ctx, `select
+    id,
+		uuid4,
+		email,
+    username,
+		first_name,
+		role,
+		statusc,
+		created_at,
+		updated_at from users where role = ? and statusc = ? order by id;`, BotRole, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9011}).Error(err)
+			return nil, err
+		}
+		for rows.Next() {
+			bot := User{}
+			err = rows.Scan(
+				&bot.ID,
+				&bot.UUID4,
+				&bot.Email,
+				&bot.Username,
+				&bot.FirstName,
+				&bot.Role,
+				&bot.Statusc,
+				&bot.CreatedAt,
+				&bot.UpdatedAt)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9012}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			bot.IDS, err = common.UUIDBytesToStr(bot.UUID4)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9013}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			bots = append(bots, &bot)
+		}
+		err = rows.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9014}).Error(err)
+			return nil, err
+		}
+		err = rows.Err()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9015}).Error(err)
+			return nil, err
+		}
+		return bots, nil
+	}
+}
+
+// CreateBotToken - Replace the API tokens of a bot with a new token,
+// returned in Tokenstring
+func (b *BotService) CreateBotToken(ctx context.Context, ID string, userEmail string, requestID string) (*User, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9016}).Error(err)
+		return nil, err
+	default:
+		bot, err := b.getBot(ctx, ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9017}).Error(err)
+			return nil, err
+		}
+		db := b.DBService.DB
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9018}).Error(err)
+			return nil, err
+		}
+		hashes, err := b.revokeAPITokens(ctx, tx, bot.ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9019}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		bot.Tokenstring, err = b.createAPIToken(ctx, tx, bot.ID, bot.FirstName, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9020}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9021}).Error(err)
+			err = tx.Rollback()
+			return nil, err
+		}
+		b.clearAPITokenCache(hashes, userEmail, requestID)
+		return bot, nil
+	}
+}
+
+// DeleteBot - Delete a bot user and revoke its API tokens
+func (b *BotService) DeleteBot(ctx context.Context, ID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9022}).Error(err)
+		return err
+	default:
+		bot, err := b.getBot(ctx, ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9023}).Error(err)
+			return err
+		}
+		db := b.DBService.DB
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9024}).Error(err)
+			return err
+		}
+		hashes, err := b.revokeAPITokens(ctx, tx, bot.ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9025}).Error(err)
+			err = tx.Rollback()
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `update users set
+		  statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where id = ?;`,
+			common.Inactive,
+			tn,
+			tnday,
+			tnweek,
+			tnmonth,
+			tnyear,
+			bot.ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9026}).Error(err)
+			err = tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9027}).Error(err)
+			err = tx.Rollback()
+			return err
+		}
+		b.clearAPITokenCache(hashes, userEmail, requestID)
+		return nil
+	}
+}
+
+// getBot - Get a bot user, fails for human users; ErrAccessDenied unless
+// the user owns the bot or is a site admin
+func (b *BotService) getBot(ctx context.Context, ID string, userEmail string, requestID string) (*User, error) {
+	userserv := &UserService{DBService: b.DBService, RedisService: b.RedisService}
+	bot, err := userserv.GetUser(ctx, ID, userEmail, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9028}).Error(err)
+		return nil, err
+	}
+	if bot.Role != BotRole {
+		err = errors.New("User is not a bot")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9029}).Error(err)
+		return nil, err
+	}
+	caller, err := userserv.GetUserByEmail(ctx, userEmail, userEmail, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9041}).Error(err)
+		return nil, err
+	}
+	if caller.Role == common.SiteAdminRole {
+		return bot, nil
+	}
+	var ownerID uint
+	err = b.DBService.DB.QueryRowContext(ctx, `select bot_owner_id from users where id = ?;`, bot.ID).Scan(&ownerID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9042}).Error(err)
+		return nil, err
+	}
+	if ownerID != caller.ID {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9043}).Error(ErrAccessDenied)
+		return nil, ErrAccessDenied
+	}
+	return bot, nil
+}
+
+// createAPIToken - Create an API token for a user in tx
+func (b *BotService) createAPIToken(ctx context.Context, tx *sql.Tx, userID uint, name string, userEmail string, requestID string) (string, error) {
+	var err error
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	token, err := genAPIToken()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9030}).Error(err)
+		return "", err
+	}
+	apiToken := APIToken{}
+	apiToken.UUID4, err = common.GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9031}).Error(err)
+		return "", err
+	}
+	apiToken.UserID = userID
+	apiToken.Name = name
+	apiToken.TokenHash = common.HashAPIToken(token)
+	/*  StatusDates  */
+	apiToken.Statusc = common.Active
+	apiToken.CreatedAt = tn
+	apiToken.UpdatedAt = tn
+	apiToken.CreatedDay = tnday
+	apiToken.CreatedWeek = tnweek
+	apiToken.CreatedMonth = tnmonth
+	apiToken.CreatedYear = tnyear
+	apiToken.UpdatedDay = tnday
+	apiToken.UpdatedWeek = tnweek
+	apiToken.UpdatedMonth = tnmonth
+	apiToken.UpdatedYear = tnyear
+
+	_, err = tx.ExecContext(ctx, `insert into api_tokens
+	  (
+			uuid4,
+			user_id,
+			name,
+			token_hash,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?);`,
+		apiToken.UUID4,
+		apiToken.UserID,
+		apiToken.Name,
+		apiToken.TokenHash,
+		/*  StatusDates  */
+		apiToken.Statusc,
+		apiToken.CreatedAt,
+		apiToken.UpdatedAt,
+		apiToken.CreatedDay,
+		apiToken.CreatedWeek,
+		apiToken.CreatedMonth,
+		apiToken.CreatedYear,
+		apiToken.UpdatedDay,
+		apiToken.UpdatedWeek,
+		apiToken.UpdatedMonth,
+		apiToken.UpdatedYear)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9032}).Error(err)
+		return "", err
+	}
+	return token, nil
+}
+
+// revokeAPITokens - revoke the API tokens of a user in tx, returns the
+// hashes of the revoked tokens
+func (b *BotService) revokeAPITokens(ctx context.Context, tx *sql.Tx, userID uint, userEmail string, requestID string) ([]string, error) {
+	hashes := []string{}
+	rows, err := tx.QueryContext(ctx, `select token_hash from api_tokens where user_id = ? and statusc = ?;`, userID, common.Active)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9033}).Error(err)
+		return nil, err
+	}
+	for rows.Next() {
+		hash := ""
+		err = rows.Scan(&hash)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9034}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9035}).Error(err)
+		return nil, err
+	}
+
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	_, err = tx.ExecContext(ctx, `update api_tokens set
+		  statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where user_id = ? and statusc = ?;`,
+		common.Inactive,
+		tn,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear,
+		userID,
+		common.Active)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9036}).Error(err)
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// clearAPITokenCache - remove revoked tokens from the cache used by
+// GetAuthUserDetails
+func (b *BotService) clearAPITokenCache(hashes []string, userEmail string, requestID string) {
+	for _, hash := range hashes {
+		err := b.RedisService.RedisClient.Del(apiTokenCacheKey(hash)).Err()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 9037}).Error(err)
+		}
+	}
+}
+
+// apiTokenCacheKey - Redis key of the cached user of an API token
+func apiTokenCacheKey(hash string) string {
+	return "api_token:" + hash
+}
+
+// genAPIToken - random API token
+func genAPIToken() (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return common.APITokenPrefix + hex.EncodeToString(b), nil
+}
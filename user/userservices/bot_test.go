@@ -0,0 +1,63 @@
+package userservices
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestBotService_Owner(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+	botService := NewBotService(dbService, redisService)
+
+	uuid4, err := common.GetUUIDBytes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = dbService.DB.Exec(`insert into users (id, uuid4, email, username, first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year)
+		select 2, ?, 'ann@example.com', 'ann@example.com', first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year from users where id = 1;`, uuid4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	bot, err := botService.CreateBot(ctx, &User{FirstName: "Deploy Bot"}, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// ann does not own the bot
+	_, err = botService.CreateBotToken(ctx, bot.IDS, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("BotService.CreateBotToken() error = %v, want %v", err, ErrAccessDenied)
+	}
+	err = botService.DeleteBot(ctx, bot.IDS, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("BotService.DeleteBot() error = %v, want %v", err, ErrAccessDenied)
+	}
+
+	got, err := botService.CreateBotToken(ctx, bot.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got.Tokenstring == "" || got.Tokenstring == bot.Tokenstring {
+		t.Errorf("BotService.CreateBotToken() token = %v, want a new token", got.Tokenstring)
+	}
+	err = botService.DeleteBot(ctx, bot.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+	}
+}
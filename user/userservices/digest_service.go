@@ -0,0 +1,620 @@
+package userservices
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+/* error message range: 13100-13399 */
+
+// Digest frequencies
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+	DigestOff    = "off"
+)
+
+// DigestDefault - the frequency of the users that have not set one
+const DigestDefault = DigestDaily
+
+// The worker looks for due digests every DigestWorkerInterval, a digest
+// lists at most DigestItemsMax mentions and replies and the
+// DigestChannelsMax most active channels
+const (
+	DigestWorkerInterval = 15 * time.Minute
+	DigestItemsMax       = 10
+	DigestChannelsMax    = 5
+)
+
+// DigestPref - how often the user gets the email digest
+type DigestPref struct {
+	Frequency string `json:"frequency"`
+}
+
+// DigestItem - a mention or a reply listed in the digest
+type DigestItem struct {
+	ActorName   string
+	ChannelName string
+	Text        string
+}
+
+// DigestChannel - a channel with new messages listed in the digest
+type DigestChannel struct {
+	ChannelName string
+	NumMessages uint
+}
+
+// DigestServiceIntf - interface for Digest Service
+type DigestServiceIntf interface {
+	GetDigestPref(ctx context.Context, UserID string, userEmail string, requestID string) (*DigestPref, error)
+	UpdateDigestPref(ctx context.Context, form *DigestPref, UserID string, userEmail string, requestID string) error
+	Unsubscribe(ctx context.Context, token string, requestID string) error
+	SendDigests(ctx context.Context, userEmail string, requestID string) (int, error)
+}
+
+// DigestService - For sending the email digests of unread activity, the
+// digests go out through the email outbox
+type DigestService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+	UserOptions  *common.UserOptions
+}
+
+// NewDigestService - Create digest service
+func NewDigestService(dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions) *DigestService {
+	return &DigestService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+		UserOptions:  userOpt,
+	}
+}
+
+// digestUser - a user that gets the digest
+type digestUser struct {
+	ID        uint
+	Email     string
+	FirstName string
+	Timezone  string
+	Locale    string
+	Frequency string
+	LastDueAt sql.NullTime
+}
+
+// digestDueAt - the latest time at or before now the digest of the given
+// frequency is due, hour o'clock in loc every day or every Monday
+func digestDueAt(now time.Time, loc *time.Location, frequency string, hour int) time.Time {
+	local := now.In(loc)
+	due := time.Date(local.Year(), local.Month(), local.Day(), hour, 0, 0, 0, loc)
+	if due.After(local) {
+		due = due.AddDate(0, 0, -1)
+	}
+	if frequency == DigestWeekly {
+		due = due.AddDate(0, 0, -((int(due.Weekday()) + 6) % 7))
+	}
+	return due.UTC()
+}
+
+// digestPeriod - the activity the digest of the given frequency covers
+func digestPeriod(frequency string) time.Duration {
+	if frequency == DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// isDigestFrequency - frequency is daily, weekly or off
+func isDigestFrequency(frequency string) bool {
+	return frequency == DigestDaily || frequency == DigestWeekly || frequency == DigestOff
+}
+
+// RunDigestWorker - send the due digests every interval until ctx is done
+func (ds *DigestService) RunDigestWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := ds.SendDigests(ctx, "", common.GetRequestID())
+			if err != nil {
+				log.WithFields(log.Fields{"msgnum": 13100}).Error(err)
+			}
+		}
+	}
+}
+
+// SendDigests - queue the digests that are due, in the timezone of each
+// user, and return how many were queued
+func (ds *DigestService) SendDigests(ctx context.Context, userEmail string, requestID string) (int, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13101}).Error(err)
+		return 0, err
+	default:
+		users, err := ds.getDigestUsers(ctx, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13102}).Error(err)
+			return 0, err
+		}
+		tn, _, _, _, _ := common.GetTimeDetails()
+		sent := 0
+		for _, user := range users {
+			loc, err := time.LoadLocation(user.Timezone)
+			if err != nil {
+				loc = time.UTC
+			}
+			dueAt := digestDueAt(tn, loc, user.Frequency, ds.UserOptions.DigestHour)
+			if user.LastDueAt.Valid && !user.LastDueAt.Time.Before(dueAt) {
+				continue
+			}
+			since := dueAt.Add(-digestPeriod(user.Frequency))
+			if user.LastDueAt.Valid && user.LastDueAt.Time.After(since) {
+				since = user.LastDueAt.Time
+			}
+			ok, err := ds.sendDigest(ctx, user, dueAt, since, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13103}).Error(err)
+				continue
+			}
+			if ok {
+				sent++
+			}
+		}
+		return sent, nil
+	}
+}
+
+// getDigestUsers - the active users that have not turned the digest off,
+// with the due time of their last digest
+func (ds *DigestService) getDigestUsers(ctx context.Context, userEmail string, requestID string) ([]*digestUser, error) {
+	db := ds.DBService.DB
+	rows, err := db.QueryContext(ctx, `select
+      u.id,
+      u.email,
+      u.first_name,
+      coalesce(u.timezone, ''),
+      coalesce(u.locale, ''),
+      coalesce(p.frequency, ?),
+      (select max(d.due_at) from digests d where d.user_id = u.id) from users u
+      left join digest_prefs p on p.user_id = u.id and p.statusc = ?
+      where u.active = 1 and u.role <> ? and u.statusc = ? order by u.id;`,
+		DigestDefault, common.Active, BotRole, common.Active)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13104}).Error(err)
+		return nil, err
+	}
+
+	users := []*digestUser{}
+	for rows.Next() {
+		user := digestUser{}
+		err = rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.FirstName,
+			&user.Timezone,
+			&user.Locale,
+			&user.Frequency,
+			&user.LastDueAt)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13105}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		if user.Frequency != DigestOff {
+			users = append(users, &user)
+		}
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13106}).Error(err)
+		return nil, err
+	}
+
+	err = rows.Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13107}).Error(err)
+		return nil, err
+	}
+	return users, nil
+}
+
+// sendDigest - compose the digest of the activity since since and queue
+// it in the email outbox; the digest row is inserted in the same
+// transaction, so a digest goes out once even with several workers
+// running. Nothing is queued when there is no activity
+func (ds *DigestService) sendDigest(ctx context.Context, user *digestUser, dueAt time.Time, since time.Time, userEmail string, requestID string) (bool, error) {
+	mentions, err := ds.getDigestItems(ctx, user.ID, NotificationMention, since, userEmail, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13110}).Error(err)
+		return false, err
+	}
+	replies, err := ds.getDigestItems(ctx, user.ID, NotificationReply, since, userEmail, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13111}).Error(err)
+		return false, err
+	}
+	channels, err := ds.getDigestChannels(ctx, user.ID, since, userEmail, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13112}).Error(err)
+		return false, err
+	}
+	send := len(mentions) != 0 || len(replies) != 0 || len(channels) != 0
+
+	selector, verifier, token, err := common.GenTokenHash(requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13108}).Error(err)
+		return false, err
+	}
+	title := common.T(user.Locale, "email.digest."+user.Frequency+".subject")
+	pwd, _ := os.Getwd()
+	viewsDir := pwd + filepath.FromSlash("/common/views")
+	templateData := struct {
+		Title          string
+		Name           string
+		Mentions       []*DigestItem
+		Replies        []*DigestItem
+		Channels       []*DigestChannel
+		URL            string
+		UnsubscribeURL string
+	}{
+		Title:          title,
+		Name:           user.FirstName,
+		Mentions:       mentions,
+		Replies:        replies,
+		Channels:       channels,
+		URL:            ds.UserOptions.AppURL,
+		UnsubscribeURL: ds.UserOptions.AppURL + "/v0.1/u/digest_unsubscribe/" + token,
+	}
+	DigestEmail, DigestText, err := common.RenderEmail(viewsDir, user.Locale, "digest", templateData)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13113}).Error(err)
+		return false, err
+	}
+
+	db := ds.DBService.DB
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13109}).Error(err)
+		return false, err
+	}
+	ok, err := ds.insertDigest(ctx, tx, user, dueAt, len(mentions), len(replies), send, selector, verifier, userEmail, requestID)
+	if err != nil || !ok {
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13114}).Error(err)
+		}
+		if rerr := tx.Rollback(); rerr != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13115}).Error(rerr)
+		}
+		return false, err
+	}
+	if send {
+		email := common.Email{
+			To:       user.Email,
+			Subject:  title,
+			Body:     DigestEmail,
+			TextBody: DigestText,
+		}
+		err = common.QueueEmail(ctx, tx, email, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13140}).Error(err)
+			if rerr := tx.Rollback(); rerr != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13141}).Error(rerr)
+			}
+			return false, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13142}).Error(err)
+		return false, err
+	}
+	return send, nil
+}
+
+// insertDigest - insert the digest of the user due at dueAt, ok is false
+// when another worker has inserted it already
+func (ds *DigestService) insertDigest(ctx context.Context, tx *sql.Tx, user *digestUser, dueAt time.Time, numMentions int, numReplies int, isSent bool, selector string, verifier string, userEmail string, requestID string) (bool, error) {
+	uuid4, err := common.GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13116}).Error(err)
+		return false, err
+	}
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	tokenExpiry, _ := time.ParseDuration(ds.UserOptions.DigestTokenDuration)
+
+	res, err := tx.ExecContext(ctx, `insert into digests
+	  (
+      uuid4,
+			user_id,
+			frequency,
+			due_at,
+			num_mentions,
+			num_replies,
+			is_sent,
+			unsub_selector,
+			unsub_verifier,
+			unsub_token_expiry,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?,?,?,?,?)
+  on duplicate key update id = id;`,
+		uuid4,
+		user.ID,
+		user.Frequency,
+		dueAt,
+		numMentions,
+		numReplies,
+		isSent,
+		selector,
+		verifier,
+		tn.Add(tokenExpiry),
+		/*  StatusDates  */
+		common.Active,
+		tn,
+		tn,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13117}).Error(err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13118}).Error(err)
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// getDigestItems - the unread notifications of type ntype the user got
+// since since, newest first
+func (ds *DigestService) getDigestItems(ctx context.Context, userID uint, ntype string, since time.Time, userEmail string, requestID string) ([]*DigestItem, error) {
+	db := ds.DBService.DB
+	rows, err := db.QueryContext(ctx, `select
+      coalesce(u.first_name, ''),
+      coalesce(c.channel_name, ''),
+      coalesce(n.ntext, '') from notifications n
+      left join users u on u.id = n.actor_id
+      left join channels c on c.id = n.channel_id
+      where n.user_id = ? and n.ntype = ? and n.is_read = 0 and n.created_at > ? and n.statusc = ?
+      order by n.id desc limit ?;`,
+		userID, ntype, since, common.Active, DigestItemsMax)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13120}).Error(err)
+		return nil, err
+	}
+
+	items := []*DigestItem{}
+	for rows.Next() {
+		item := DigestItem{}
+		err = rows.Scan(
+			&item.ActorName,
+			&item.ChannelName,
+			&item.Text)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13121}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13122}).Error(err)
+		return nil, err
+	}
+
+	err = rows.Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13123}).Error(err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// getDigestChannels - the channels of the user with the most messages
+// from others since since
+func (ds *DigestService) getDigestChannels(ctx context.Context, userID uint, since time.Time, userEmail string, requestID string) ([]*DigestChannel, error) {
+	db := ds.DBService.DB
+	rows, err := db.QueryContext(ctx, `select
+      c.channel_name,
+      count(*) from messages m
+      inner join user_channels uc on uc.channel_id = m.channel_id and uc.user_id = ? and uc.statusc = ?
+      inner join channels c on c.id = m.channel_id
+      where m.user_id <> ? and m.created_at > ? and m.statusc = ?
+      group by c.id, c.channel_name order by count(*) desc, c.id limit ?;`,
+		userID, common.Active, userID, since, common.Active, DigestChannelsMax)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13124}).Error(err)
+		return nil, err
+	}
+
+	channels := []*DigestChannel{}
+	for rows.Next() {
+		channel := DigestChannel{}
+		err = rows.Scan(
+			&channel.ChannelName,
+			&channel.NumMessages)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13125}).Error(err)
+			err = rows.Close()
+			return nil, err
+		}
+		channels = append(channels, &channel)
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13126}).Error(err)
+		return nil, err
+	}
+
+	err = rows.Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13127}).Error(err)
+		return nil, err
+	}
+	return channels, nil
+}
+
+// GetDigestPref - Get how often the user gets the email digest
+func (ds *DigestService) GetDigestPref(ctx context.Context, UserID string, userEmail string, requestID string) (*DigestPref, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13128}).Error(err)
+		return nil, err
+	default:
+		userserv := &UserService{DBService: ds.DBService, RedisService: ds.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13129}).Error(err)
+			return nil, err
+		}
+		pref := DigestPref{Frequency: DigestDefault}
+		db := ds.DBService.DB
+		row := db.QueryRowContext(ctx, `select frequency from digest_prefs where user_id = ? and statusc = ?;`, user.ID, common.Active)
+		err = row.Scan(&pref.Frequency)
+		if err != nil && err != sql.ErrNoRows {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13130}).Error(err)
+			return nil, err
+		}
+		return &pref, nil
+	}
+}
+
+// UpdateDigestPref - set how often the user gets the email digest
+func (ds *DigestService) UpdateDigestPref(ctx context.Context, form *DigestPref, UserID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13131}).Error(err)
+		return err
+	default:
+		if !isDigestFrequency(form.Frequency) {
+			err := errors.New("Invalid frequency " + form.Frequency)
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13132}).Error(err)
+			return err
+		}
+		userserv := &UserService{DBService: ds.DBService, RedisService: ds.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13133}).Error(err)
+			return err
+		}
+		return ds.setDigestFrequency(ctx, user.ID, form.Frequency, userEmail, requestID)
+	}
+}
+
+// Unsubscribe - turn off the digest of the user the unsubscribe token
+// of a digest email was sent to
+func (ds *DigestService) Unsubscribe(ctx context.Context, token string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13134}).Error(err)
+		return err
+	default:
+		verifierBytes, selector, err := common.GetSelectorForPasswdRecoveryToken(token, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13135}).Error(err)
+			return err
+		}
+		var userID uint
+		var verifier string
+		var tokenExpiry time.Time
+		db := ds.DBService.DB
+		row := db.QueryRowContext(ctx, `select user_id, unsub_verifier, unsub_token_expiry from digests where unsub_selector = ? and statusc = ?;`, selector, common.Active)
+		err = row.Scan(&userID, &verifier, &tokenExpiry)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13136}).Error(err)
+			return errors.New("Invalid unsubscribe token")
+		}
+		err = common.ValidatePasswdRecoveryToken(verifierBytes, verifier, tokenExpiry, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13137}).Error(err)
+			return err
+		}
+		return ds.setDigestFrequency(ctx, userID, DigestOff, "", requestID)
+	}
+}
+
+// setDigestFrequency - insert or update the digest preference of the user
+func (ds *DigestService) setDigestFrequency(ctx context.Context, userID uint, frequency string, userEmail string, requestID string) error {
+	uuid4, err := common.GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13138}).Error(err)
+		return err
+	}
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	db := ds.DBService.DB
+	_, err = db.ExecContext(ctx, `insert into digest_prefs
+	  (
+      uuid4,
+			user_id,
+			frequency,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+  on duplicate key update
+			frequency = values(frequency),
+			statusc = values(statusc),
+			updated_at = values(updated_at),
+			updated_day = values(updated_day),
+			updated_week = values(updated_week),
+			updated_month = values(updated_month),
+			updated_year = values(updated_year);`,
+		uuid4,
+		userID,
+		frequency,
+		common.Active,
+		tn,
+		tn,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13139}).Error(err)
+		return err
+	}
+	return nil
+}
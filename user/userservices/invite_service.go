@@ -0,0 +1,876 @@
+package userservices
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+/* error message range: 13400-13699 */
+
+// Registration policies, with RegistrationDomains only the emails of the
+// allowed domains can sign up without an invite
+const (
+	RegistrationOpen    = "open"
+	RegistrationInvite  = "invite"
+	RegistrationDomains = "domains"
+)
+
+// Invite - an invite link to a workspace, the account created with it
+// gets Role and joins the workspace and the channels of the invite
+type Invite struct {
+	ID            uint      `json:"id,omitempty"`
+	UUID4         []byte    `json:"-"`
+	IDS           string    `json:"id_s,omitempty"`
+	WorkspaceID   uint      `json:"workspace_id,omitempty"`
+	WorkspaceIDS  string    `json:"workspace_id_s,omitempty"`
+	WorkspaceName string    `json:"workspace_name,omitempty"`
+	ChannelIDs    []uint    `json:"-"`
+	ChannelIDS    []string  `json:"channel_ids,omitempty"`
+	Role          string    `json:"role,omitempty"`
+	MaxUses       uint      `json:"max_uses"`
+	NumUses       uint      `json:"num_uses"`
+	ExpiresAt     time.Time `json:"expires_at,omitempty"`
+	UserID        uint      `json:"user_id,omitempty"`
+
+	/* only set when the invite is created */
+	Token string `json:"token,omitempty"`
+	URL   string `json:"url,omitempty"`
+
+	common.StatusDates
+}
+
+// InviteForm - used to create an invite; MaxUses 0 is a multi-use
+// invite without a limit, ExpiresIn is a duration like "72h" and
+// defaults to the invite_duration user option
+type InviteForm struct {
+	WorkspaceID string   `json:"workspace_id"`
+	ChannelIDs  []string `json:"channel_ids"`
+	Role        string   `json:"role"`
+	MaxUses     uint     `json:"max_uses"`
+	ExpiresIn   string   `json:"expires_in"`
+}
+
+// InviteServiceIntf - interface for Invite Service
+type InviteServiceIntf interface {
+	CreateInvite(ctx context.Context, form *InviteForm, userEmail string, requestID string) (*Invite, error)
+	GetInvites(ctx context.Context, userEmail string, requestID string) ([]*Invite, error)
+	DeleteInvite(ctx context.Context, ID string, userEmail string, requestID string) error
+	GetInviteByToken(ctx context.Context, token string, requestID string) (*Invite, error)
+	AcceptInvite(ctx context.Context, token string, form *User, hostURL string, requestID string) (*User, error)
+}
+
+// InviteService - For accessing invite services
+type InviteService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+	UserOptions  *common.UserOptions
+	Enforcer     *casbin.Enforcer
+}
+
+// NewInviteService - Create invite service
+func NewInviteService(dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions, e *casbin.Enforcer) *InviteService {
+	return &InviteService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+		UserOptions:  userOpt,
+		Enforcer:     e,
+	}
+}
+
+// isInviteRole - whether an inviter with inviterRole may grant role, only
+// the roles at or below the one of the inviter; bots are never invited
+func (is *InviteService) isInviteRole(role string, inviterRole string) bool {
+	if role == "" || role == BotRole {
+		return false
+	}
+	for _, subject := range is.Enforcer.GetAllSubjects() {
+		if subject == role {
+			ok, err := is.Enforcer.GetRoleManager().HasLink(inviterRole, role)
+			return err == nil && ok
+		}
+	}
+	return false
+}
+
+// checkWorkspaceAdmin - ErrAccessDenied unless the user is a site admin,
+// the owner of the workspace or of one of its parents, or is in a ugroup
+// granted admin on one of them
+func (is *InviteService) checkWorkspaceAdmin(ctx context.Context, workspaceID uint, user *User, userEmail string, requestID string) error {
+	if user.Role == common.SiteAdminRole {
+		return nil
+	}
+	db := is.DBService.DB
+	workspaceIDs := []uint{}
+	seen := map[uint]bool{}
+	for id := workspaceID; id != 0 && !seen[id]; {
+		seen[id] = true
+		workspaceIDs = append(workspaceIDs, id)
+		var ownerID uint
+		err := db.QueryRowContext(ctx, `select ifnull(user_id, 0) from workspaces where id = ?;`, id).Scan(&ownerID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13464}).Error(err)
+			return err
+		}
+		if ownerID == user.ID {
+			return nil
+		}
+		var parentID uint
+		err = db.QueryRowContext(ctx, `select workspace_id from workspace_chds where workspace_chd_id = ? and statusc = ? limit 1;`, id, common.Active).Scan(&parentID)
+		if err != nil && err != sql.ErrNoRows {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13465}).Error(err)
+			return err
+		}
+		id = parentID
+	}
+	ugroupserv := &UgroupService{DBService: is.DBService, RedisService: is.RedisService, UserOptions: is.UserOptions}
+	ugroupIDs, err := ugroupserv.EffectiveUgroupIDs(ctx, user.ID, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13466}).Error(err)
+		return err
+	}
+	if len(ugroupIDs) == 0 {
+		return ErrAccessDenied
+	}
+	// "admin" is the highest grant role of msgservices
+	query := `select exists (select 1 from ugroup_grants where statusc = ? and channel_id = 0 and grant_role = 'admin' and workspace_id in (` + strings.TrimSuffix(strings.Repeat("?,", len(workspaceIDs)), ",") + `) and ugroup_id in (` + strings.TrimSuffix(strings.Repeat("?,", len(ugroupIDs)), ",") + `));`
+	args := []interface{}{common.Active}
+	for _, id := range workspaceIDs {
+		args = append(args, id)
+	}
+	for _, id := range ugroupIDs {
+		args = append(args, id)
+	}
+	var isAdmin bool
+	err = db.QueryRowContext(ctx, query, args...).Scan(&isAdmin)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13467}).Error(err)
+		return err
+	}
+	if !isAdmin {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// CreateInvite - Create an invite to a workspace, the response carries
+// the invite link which is not shown again; only the admins of the
+// workspace invite, with a role at or below their own
+func (is *InviteService) CreateInvite(ctx context.Context, form *InviteForm, userEmail string, requestID string) (*Invite, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13400}).Error(err)
+		return nil, err
+	default:
+		userserv := &UserService{DBService: is.DBService, RedisService: is.RedisService}
+		user, err := userserv.GetUserByEmail(ctx, userEmail, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13403}).Error(err)
+			return nil, err
+		}
+		role := form.Role
+		if role == "" {
+			role = is.UserOptions.DefaultRole
+		}
+		if !is.isInviteRole(role, user.Role) {
+			err := errors.New("Invalid role")
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13401}).Error(err)
+			return nil, err
+		}
+		expiresIn := form.ExpiresIn
+		if expiresIn == "" {
+			expiresIn = is.UserOptions.InviteDuration
+		}
+		duration, err := time.ParseDuration(expiresIn)
+		if err != nil || duration <= 0 {
+			err = errors.New("Invalid expires_in")
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13402}).Error(err)
+			return nil, err
+		}
+
+		db := is.DBService.DB
+		invite := Invite{}
+		invite.WorkspaceIDS = form.WorkspaceID
+		workspaceUUID4, err := common.UUIDStrToBytes(form.WorkspaceID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13404}).Error(err)
+			return nil, err
+		}
+		row := db.QueryRowContext(ctx, `select id, workspace_name from workspaces where uuid4 = ? and statusc = ?;`, workspaceUUID4, common.Active)
+		err = row.Scan(&invite.WorkspaceID, &invite.WorkspaceName)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13405}).Error(err)
+			return nil, errors.New("Workspace not found")
+		}
+		err = is.checkWorkspaceAdmin(ctx, invite.WorkspaceID, user, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13468}).Error(err)
+			return nil, err
+		}
+		for _, channelIDS := range form.ChannelIDs {
+			channelUUID4, err := common.UUIDStrToBytes(channelIDS)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13406}).Error(err)
+				return nil, err
+			}
+			var channelID uint
+			row := db.QueryRowContext(ctx, `select id from channels where uuid4 = ? and workspace_id = ? and statusc = ?;`, channelUUID4, invite.WorkspaceID, common.Active)
+			err = row.Scan(&channelID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13407}).Error(err)
+				return nil, errors.New("Channel not found in the workspace")
+			}
+			invite.ChannelIDs = append(invite.ChannelIDs, channelID)
+			invite.ChannelIDS = append(invite.ChannelIDS, channelIDS)
+		}
+
+		selector, verifier, token, err := common.GenTokenHash(requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13408}).Error(err)
+			return nil, err
+		}
+		invite.UUID4, err = common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13409}).Error(err)
+			return nil, err
+		}
+		invite.IDS, err = common.UUIDBytesToStr(invite.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13410}).Error(err)
+			return nil, err
+		}
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		invite.Role = role
+		invite.MaxUses = form.MaxUses
+		invite.ExpiresAt = tn.Add(duration)
+		invite.UserID = user.ID
+		invite.Token = token
+		invite.URL = is.UserOptions.AppURL + "/v0.1/u/invites/" + token
+		/*  StatusDates  */
+		invite.Statusc = common.Active
+		invite.CreatedAt = tn
+		invite.UpdatedAt = tn
+		invite.CreatedDay = tnday
+		invite.CreatedWeek = tnweek
+		invite.CreatedMonth = tnmonth
+		invite.CreatedYear = tnyear
+		invite.UpdatedDay = tnday
+		invite.UpdatedWeek = tnweek
+		invite.UpdatedMonth = tnmonth
+		invite.UpdatedYear = tnyear
+
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13411}).Error(err)
+			return nil, err
+		}
+		err = is.insertInvite(ctx, tx, &invite, selector, verifier, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13412}).Error(err)
+			if rerr := tx.Rollback(); rerr != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13413}).Error(rerr)
+			}
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13414}).Error(err)
+			return nil, err
+		}
+		return &invite, nil
+	}
+}
+
+// insertInvite - insert the invite and its channels in tx
+func (is *InviteService) insertInvite(ctx context.Context, tx *sql.Tx, invite *Invite, selector string, verifier string, userEmail string, requestID string) error {
+	res, err := tx.ExecContext(ctx, `insert into invites
+	  (
+      uuid4,
+			workspace_id,
+			user_id,
+			role,
+			max_uses,
+			num_uses,
+			expires_at,
+			token_selector,
+			token_verifier,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?,?,?,?);`,
+		invite.UUID4,
+		invite.WorkspaceID,
+		invite.UserID,
+		invite.Role,
+		invite.MaxUses,
+		invite.NumUses,
+		invite.ExpiresAt,
+		selector,
+		verifier,
+		/*  StatusDates  */
+		invite.Statusc,
+		invite.CreatedAt,
+		invite.UpdatedAt,
+		invite.CreatedDay,
+		invite.CreatedWeek,
+		invite.CreatedMonth,
+		invite.CreatedYear,
+		invite.UpdatedDay,
+		invite.UpdatedWeek,
+		invite.UpdatedMonth,
+		invite.UpdatedYear)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13415}).Error(err)
+		return err
+	}
+	inviteID, err := res.LastInsertId()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13416}).Error(err)
+		return err
+	}
+	invite.ID = uint(inviteID)
+
+	for _, channelID := range invite.ChannelIDs {
+		uuid4, err := common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13417}).Error(err)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `insert into invite_channels
+	  (
+      uuid4,
+			invite_id,
+			channel_id,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,?,?,?,?);`,
+			uuid4,
+			invite.ID,
+			channelID,
+			/*  StatusDates  */
+			common.Active,
+			invite.CreatedAt,
+			invite.UpdatedAt,
+			invite.CreatedDay,
+			invite.CreatedWeek,
+			invite.CreatedMonth,
+			invite.CreatedYear,
+			invite.UpdatedDay,
+			invite.UpdatedWeek,
+			invite.UpdatedMonth,
+			invite.UpdatedYear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13418}).Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// GetInvites - Get the invites that have not been deleted
+func (is *InviteService) GetInvites(ctx context.Context, userEmail string, requestID string) ([]*Invite, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13419}).Error(err)
+		return nil, err
+	default:
+		db := is.DBService.DB
+		rows, err := db.QueryContext(ctx, `select
+      i.id,
+      i.uuid4,
+      i.workspace_id,
+      w.uuid4,
+      w.workspace_name,
+      i.role,
+      i.max_uses,
+      i.num_uses,
+      i.expires_at,
+      i.user_id,
+      i.statusc,
+      i.created_at,
+      i.updated_at,
+      i.created_day,
+      i.created_week,
+      i.created_month,
+      i.created_year,
+      i.updated_day,
+      i.updated_week,
+      i.updated_month,
+      i.updated_year from invites i
+      inner join workspaces w on (w.id = i.workspace_id)
+      where i.statusc = ? order by i.id desc;`, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13420}).Error(err)
+			return nil, err
+		}
+		invites := []*Invite{}
+		for rows.Next() {
+			invite := Invite{}
+			var workspaceUUID4 []byte
+			err = rows.Scan(
+				&invite.ID,
+				&invite.UUID4,
+				&invite.WorkspaceID,
+				&workspaceUUID4,
+				&invite.WorkspaceName,
+				&invite.Role,
+				&invite.MaxUses,
+				&invite.NumUses,
+				&invite.ExpiresAt,
+				&invite.UserID,
+				/*  StatusDates  */
+				&invite.Statusc,
+				&invite.CreatedAt,
+				&invite.UpdatedAt,
+				&invite.CreatedDay,
+				&invite.CreatedWeek,
+				&invite.CreatedMonth,
+				&invite.CreatedYear,
+				&invite.UpdatedDay,
+				&invite.UpdatedWeek,
+				&invite.UpdatedMonth,
+				&invite.UpdatedYear)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13421}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			invite.IDS, err = common.UUIDBytesToStr(invite.UUID4)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13422}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			invite.WorkspaceIDS, err = common.UUIDBytesToStr(workspaceUUID4)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13423}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			invites = append(invites, &invite)
+		}
+		err = rows.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13424}).Error(err)
+			return nil, err
+		}
+		err = rows.Err()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13425}).Error(err)
+			return nil, err
+		}
+		for _, invite := range invites {
+			err = is.getInviteChannels(ctx, invite, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13426}).Error(err)
+				return nil, err
+			}
+		}
+		return invites, nil
+	}
+}
+
+// getInviteChannels - set the channels the invite joins
+func (is *InviteService) getInviteChannels(ctx context.Context, invite *Invite, userEmail string, requestID string) error {
+	db := is.DBService.DB
+	rows, err := db.QueryContext(ctx, `select c.id, c.uuid4 from invite_channels ic
+      inner join channels c on (c.id = ic.channel_id)
+      where ic.invite_id = ? and ic.statusc = ? and c.statusc = ? order by ic.id;`, invite.ID, common.Active, common.Active)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13427}).Error(err)
+		return err
+	}
+	invite.ChannelIDs = []uint{}
+	invite.ChannelIDS = []string{}
+	for rows.Next() {
+		var channelID uint
+		var channelUUID4 []byte
+		err = rows.Scan(&channelID, &channelUUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13428}).Error(err)
+			err = rows.Close()
+			return err
+		}
+		channelIDS, err := common.UUIDBytesToStr(channelUUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13429}).Error(err)
+			err = rows.Close()
+			return err
+		}
+		invite.ChannelIDs = append(invite.ChannelIDs, channelID)
+		invite.ChannelIDS = append(invite.ChannelIDS, channelIDS)
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13430}).Error(err)
+		return err
+	}
+	err = rows.Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13431}).Error(err)
+		return err
+	}
+	return nil
+}
+
+// DeleteInvite - Delete the invite, its link stops working; only its
+// creator or an admin of its workspace deletes it
+func (is *InviteService) DeleteInvite(ctx context.Context, ID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13432}).Error(err)
+		return err
+	default:
+		uuid4byte, err := common.UUIDStrToBytes(ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13433}).Error(err)
+			return err
+		}
+		db := is.DBService.DB
+		var inviteID, workspaceID, creatorID uint
+		row := db.QueryRowContext(ctx, `select id, workspace_id, user_id from invites where uuid4 = ? and statusc = ?;`, uuid4byte, common.Active)
+		err = row.Scan(&inviteID, &workspaceID, &creatorID)
+		if err == sql.ErrNoRows {
+			err = errors.New("Invite not found")
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13469}).Error(err)
+			return err
+		}
+		userserv := &UserService{DBService: is.DBService, RedisService: is.RedisService}
+		user, err := userserv.GetUserByEmail(ctx, userEmail, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13470}).Error(err)
+			return err
+		}
+		if user.ID != creatorID {
+			err = is.checkWorkspaceAdmin(ctx, workspaceID, user, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13471}).Error(err)
+				return err
+			}
+		}
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		res, err := db.ExecContext(ctx, `update invites set
+		  statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where id = ? and statusc = ?;`,
+			common.Inactive, tn, tnday, tnweek, tnmonth, tnyear, inviteID, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13434}).Error(err)
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13435}).Error(err)
+			return err
+		}
+		if n == 0 {
+			err = errors.New("Invite not found")
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13436}).Error(err)
+			return err
+		}
+		return nil
+	}
+}
+
+// GetInviteByToken - the invite of the link, if it can still be used
+func (is *InviteService) GetInviteByToken(ctx context.Context, token string, requestID string) (*Invite, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13437}).Error(err)
+		return nil, err
+	default:
+		verifierBytes, selector, err := common.GetSelectorForPasswdRecoveryToken(token, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13438}).Error(err)
+			return nil, errors.New("Invalid invite")
+		}
+		invite := Invite{}
+		var verifier string
+		var workspaceUUID4 []byte
+		db := is.DBService.DB
+		row := db.QueryRowContext(ctx, `select
+      i.id,
+      i.uuid4,
+      i.workspace_id,
+      w.uuid4,
+      w.workspace_name,
+      i.role,
+      i.max_uses,
+      i.num_uses,
+      i.expires_at,
+      i.token_verifier from invites i
+      inner join workspaces w on (w.id = i.workspace_id)
+      where i.token_selector = ? and i.statusc = ? and w.statusc = ?;`, selector, common.Active, common.Active)
+		err = row.Scan(
+			&invite.ID,
+			&invite.UUID4,
+			&invite.WorkspaceID,
+			&workspaceUUID4,
+			&invite.WorkspaceName,
+			&invite.Role,
+			&invite.MaxUses,
+			&invite.NumUses,
+			&invite.ExpiresAt,
+			&verifier)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13439}).Error(err)
+			return nil, errors.New("Invalid invite")
+		}
+		err = common.ValidatePasswdRecoveryToken(verifierBytes, verifier, invite.ExpiresAt, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13440}).Error(err)
+			return nil, errors.New("Invalid invite")
+		}
+		if invite.MaxUses != 0 && invite.NumUses >= invite.MaxUses {
+			err = errors.New("Invite has been used")
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13441}).Error(err)
+			return nil, err
+		}
+		invite.IDS, err = common.UUIDBytesToStr(invite.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13442}).Error(err)
+			return nil, err
+		}
+		invite.WorkspaceIDS, err = common.UUIDBytesToStr(workspaceUUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13443}).Error(err)
+			return nil, err
+		}
+		err = is.getInviteChannels(ctx, &invite, "", requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13444}).Error(err)
+			return nil, err
+		}
+		return &invite, nil
+	}
+}
+
+// AcceptInvite - create the account with the role of the invite, and
+// join the workspace and the channels of the invite, in one transaction
+func (is *InviteService) AcceptInvite(ctx context.Context, token string, form *User, hostURL string, requestID string) (*User, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13445}).Error(err)
+		return nil, err
+	default:
+		invite, err := is.GetInviteByToken(ctx, token, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13446}).Error(err)
+			return nil, err
+		}
+		db := is.DBService.DB
+		var isPresent bool
+		row := db.QueryRowContext(ctx, `select exists (select 1 from users where email = ?)`, form.Email)
+		err = row.Scan(&isPresent)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13447}).Error(err)
+			return nil, err
+		}
+		if isPresent {
+			err = errors.New("Email Already Exists")
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13448}).Error(err)
+			return nil, err
+		}
+
+		userserv := &UserService{DBService: is.DBService, RedisService: is.RedisService, UserOptions: is.UserOptions}
+		err = userserv.checkPassword(ctx, 0, form.PasswordS, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13463}).Error(err)
+			return nil, err
+		}
+		user, err := userserv.newUser(form, invite.Role, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13449}).Error(err)
+			return nil, err
+		}
+		insertUserStmt, err := userserv.insertUserPrepare(ctx, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13450}).Error(err)
+			return nil, err
+		}
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13451}).Error(err)
+			_ = insertUserStmt.Close()
+			return nil, err
+		}
+		err = is.acceptInvite(ctx, tx, insertUserStmt, userserv, invite, user, hostURL, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13452}).Error(err)
+			if rerr := tx.Rollback(); rerr != nil {
+				log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13453}).Error(rerr)
+			}
+			_ = insertUserStmt.Close()
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13454}).Error(err)
+			_ = insertUserStmt.Close()
+			return nil, err
+		}
+		err = insertUserStmt.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13455}).Error(err)
+			return nil, err
+		}
+		return user, nil
+	}
+}
+
+// acceptInvite - use the invite, insert the user and add it to the
+// workspace and the channels of the invite in tx
+func (is *InviteService) acceptInvite(ctx context.Context, tx *sql.Tx, insertUserStmt *sql.Stmt, userserv *UserService, invite *Invite, user *User, hostURL string, requestID string) error {
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	// a concurrent accept may have used up the invite since it was read
+	res, err := tx.ExecContext(ctx, `update invites set
+		  num_uses = num_uses + 1,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where id = ? and statusc = ? and expires_at > ? and (max_uses = 0 or num_uses < max_uses);`,
+		tn, tnday, tnweek, tnmonth, tnyear, invite.ID, common.Active, tn)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13456}).Error(err)
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13457}).Error(err)
+		return err
+	}
+	if n != 1 {
+		return errors.New("Invite has been used")
+	}
+
+	err = userserv.insertUser(ctx, insertUserStmt, tx, user, hostURL, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13458}).Error(err)
+		return err
+	}
+
+	uuid4, err := common.GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13459}).Error(err)
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `insert into workspaces_users
+	  (
+      uuid4,
+			workspace_id,
+			user_id,
+			invite_id,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?);`,
+		uuid4,
+		invite.WorkspaceID,
+		user.ID,
+		invite.ID,
+		/*  StatusDates  */
+		common.Active,
+		tn,
+		tn,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13460}).Error(err)
+		return err
+	}
+
+	for _, channelID := range invite.ChannelIDs {
+		uuid4, err := common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13461}).Error(err)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `insert into user_channels
+	  (
+      uuid4,
+			channel_id,
+			user_id,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,?,?,?,?);`,
+			uuid4,
+			channelID,
+			user.ID,
+			/*  StatusDates  */
+			common.Active,
+			tn,
+			tn,
+			tnday,
+			tnweek,
+			tnmonth,
+			tnyear,
+			tnday,
+			tnweek,
+			tnmonth,
+			tnyear)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13462}).Error(err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package userservices
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestInviteService_AcceptInvite(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	authEnforcer, err := common.LoadEnforcer(dbService, roleOpt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	inviteOpt := *userOpt
+	inviteOpt.Registration = RegistrationInvite
+	inviteOpt.DefaultRole = "co_admin"
+	inviteOpt.InviteDuration = "168h"
+	userService := NewUserService(dbService, redisService, nil, nil, &inviteOpt, authEnforcer)
+	inviteService := NewInviteService(dbService, redisService, &inviteOpt, authEnforcer)
+
+	form := User{FirstName: "Ann", LastName: "Lee", Email: "ann@example.com", PasswordS: "abc1238", Role: BotRole}
+	_, err = userService.CreateUser(ctx, &form, "", requestID)
+	if err == nil {
+		t.Errorf("UserService.CreateUser() error = nil, want an invite-only error")
+		return
+	}
+
+	var workspaceUUID4, channelUUID4 []byte
+	var channelID uint
+	row := dbService.DB.QueryRow(`select w.uuid4, c.id, c.uuid4 from channels c inner join workspaces w on (w.id = c.workspace_id) order by c.id limit 1;`)
+	err = row.Scan(&workspaceUUID4, &channelID, &channelUUID4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	workspaceIDS, _ := common.UUIDBytesToStr(workspaceUUID4)
+	channelIDS, _ := common.UUIDBytesToStr(channelUUID4)
+
+	_, err = inviteService.CreateInvite(ctx, &InviteForm{WorkspaceID: workspaceIDS, Role: BotRole}, userEmail, requestID)
+	if err == nil {
+		t.Errorf("InviteService.CreateInvite() error = nil, want an invalid role error")
+		return
+	}
+	invite, err := inviteService.CreateInvite(ctx, &InviteForm{WorkspaceID: workspaceIDS, ChannelIDs: []string{channelIDS}, MaxUses: 1}, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	user, err := inviteService.AcceptInvite(ctx, invite.Token, &form, "", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if user.Role != "co_admin" {
+		t.Errorf("InviteService.AcceptInvite() role = %v, want co_admin", user.Role)
+	}
+	var numWorkspaces, numChannels int
+	err = dbService.DB.QueryRow(`select count(*) from workspaces_users where user_id = ?;`, user.ID).Scan(&numWorkspaces)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = dbService.DB.QueryRow(`select count(*) from user_channels where user_id = ? and channel_id = ?;`, user.ID, channelID).Scan(&numChannels)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if numWorkspaces != 1 || numChannels != 1 {
+		t.Errorf("InviteService.AcceptInvite() joined %v workspaces and %v channels, want 1 and 1", numWorkspaces, numChannels)
+	}
+
+	// a single-use invite cannot be used again
+	form.Email = "bob@example.com"
+	_, err = inviteService.AcceptInvite(ctx, invite.Token, &form, "", requestID)
+	if err == nil {
+		t.Errorf("InviteService.AcceptInvite() error = nil, want the invite to be used up")
+	}
+}
+
+func TestInviteService_Admin(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	authEnforcer, err := common.LoadEnforcer(dbService, roleOpt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	inviteOpt := *userOpt
+	inviteOpt.DefaultRole = "co_admin"
+	inviteOpt.InviteDuration = "168h"
+	inviteService := NewInviteService(dbService, redisService, &inviteOpt, authEnforcer)
+
+	uuid4, err := common.GetUUIDBytes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = dbService.DB.Exec(`insert into users (id, uuid4, email, username, first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year)
+		select 2, ?, 'ann@example.com', 'ann@example.com', first_name, last_name, role, active, statusc, created_at, updated_at, created_day, created_week, created_month, created_year, updated_day, updated_week, updated_month, updated_year from users where id = 1;`, uuid4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var workspaceUUID4 []byte
+	err = dbService.DB.QueryRow(`select uuid4 from workspaces where user_id = 1 order by id limit 1;`).Scan(&workspaceUUID4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	workspaceIDS, _ := common.UUIDBytesToStr(workspaceUUID4)
+
+	// a co_admin cannot invite a site admin
+	_, err = inviteService.CreateInvite(ctx, &InviteForm{WorkspaceID: workspaceIDS, Role: common.SiteAdminRole}, userEmail, requestID)
+	if err == nil {
+		t.Errorf("InviteService.CreateInvite() error = nil, want an invalid role error")
+		return
+	}
+	// ann is not an admin of the workspace
+	_, err = inviteService.CreateInvite(ctx, &InviteForm{WorkspaceID: workspaceIDS}, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("InviteService.CreateInvite() error = %v, want %v", err, ErrAccessDenied)
+		return
+	}
+	invite, err := inviteService.CreateInvite(ctx, &InviteForm{WorkspaceID: workspaceIDS}, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = inviteService.DeleteInvite(ctx, invite.IDS, "ann@example.com", requestID)
+	if err != ErrAccessDenied {
+		t.Errorf("InviteService.DeleteInvite() error = %v, want %v", err, ErrAccessDenied)
+		return
+	}
+	err = inviteService.DeleteInvite(ctx, invite.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,816 @@
+package userservices
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+/* error message range: 14600-14799 */
+
+// LDAPSyncInterval - how often the LDAP groups are mirrored when the
+// sync_interval option is not set
+const LDAPSyncInterval = time.Hour
+
+// ldapTimeout - the timeout of an LDAP operation when the timeout option
+// is not set
+const ldapTimeout = 10 * time.Second
+
+// LDAPSyncResult - what a group sync mirrored
+type LDAPSyncResult struct {
+	Groups  int `json:"groups"`
+	Users   int `json:"users"`
+	Members int `json:"members"`
+}
+
+// LDAPServiceIntf - interface for LDAP Service
+type LDAPServiceIntf interface {
+	SyncGroups(ctx context.Context, userEmail string, requestID string) (*LDAPSyncResult, error)
+}
+
+// LDAPService - For signing in with an LDAP directory and mirroring its
+// groups into ugroups
+type LDAPService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+	UserOptions  *common.UserOptions
+}
+
+// NewLDAPService - Create LDAP Service
+func NewLDAPService(dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions) *LDAPService {
+	return &LDAPService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+		UserOptions:  userOpt,
+	}
+}
+
+// ldapGroup - a directory group mirrored into a ugroup, Children and
+// Members are the normalized DNs of its nested groups and users
+type ldapGroup struct {
+	DN       string
+	Name     string
+	Desc     string
+	Levelc   uint
+	ParentDN string
+	Children []string
+	Members  []string
+	UgroupID uint
+}
+
+// dial - connect to the directory and bind as the service account
+func (ls *LDAPService) dial() (*common.LDAPConn, error) {
+	opt := ls.UserOptions.LDAP
+	timeout, err := time.ParseDuration(opt.Timeout)
+	if err != nil {
+		timeout = ldapTimeout
+	}
+	conn, err := common.DialLDAP(opt.URL, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if opt.BindDN != "" {
+		err = conn.Bind(opt.BindDN, opt.BindPassword)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// userAttrs - the attributes read from the user entries
+func (ls *LDAPService) userAttrs() []string {
+	opt := ls.UserOptions.LDAP
+	return []string{opt.EmailAttr, opt.FirstNameAttr, opt.LastNameAttr}
+}
+
+// authenticate - the entry of the user with email, after binding as it
+// with password
+func (ls *LDAPService) authenticate(email string, password string, requestID string) (*common.LDAPEntry, error) {
+	opt := ls.UserOptions.LDAP
+	conn, err := ls.dial()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14600}).Error(err)
+		return nil, err
+	}
+	defer conn.Close()
+	filter := "(&" + opt.UserFilter + "(" + opt.EmailAttr + "=" + common.LDAPEscapeFilter(email) + "))"
+	entries, err := conn.Search(opt.UserBaseDN, common.LDAPScopeSubtree, filter, ls.userAttrs())
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14601}).Error(err)
+		return nil, err
+	}
+	// an unknown or ambiguous email is a failed sign in
+	if len(entries) != 1 {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14602}).Error("LDAP user not found")
+		return nil, common.ErrLDAPInvalidCredentials
+	}
+	err = conn.Bind(entries[0].DN, password)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14603}).Error(err)
+		return nil, err
+	}
+	return entries[0], nil
+}
+
+// isLDAPUser - whether the user signs in with the directory
+func (ls *LDAPService) isLDAPUser(ctx context.Context, userID uint, requestID string) bool {
+	var isPresent bool
+	row := ls.DBService.DB.QueryRowContext(ctx, `select exists (select 1 from ldap_users where user_id = ? and statusc = ?);`, userID, common.Active)
+	err := row.Scan(&isPresent)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14604}).Error(err)
+		return false
+	}
+	return isPresent
+}
+
+// ldapLogin - the user with email signed in with the directory, the user
+// is provisioned on the first sign in
+func (ls *LDAPService) ldapLogin(ctx context.Context, email string, password string, requestID string) (*User, error) {
+	entry, err := ls.authenticate(email, password, requestID)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := ls.DBService.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14605}).Error(err)
+		return nil, err
+	}
+	userID, _, err := ls.ldapUserID(ctx, tx, entry, requestID)
+	if err == nil && userID == 0 {
+		err = errors.New("User is not active")
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14606}).Error(err)
+		_ = tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14607}).Error(err)
+		return nil, err
+	}
+	user := User{}
+	row := ls.DBService.DB.QueryRowContext(ctx, `select id, email, locale from users where id = ?;`, userID)
+	err = row.Scan(&user.ID, &user.Email, &user.Locale)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14608}).Error(err)
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ldapUserID - the ID of the active user of the directory entry, the user
+// is provisioned and linked to the entry when its email is new; 0 when
+// the user is not active; created reports a provisioned user
+func (ls *LDAPService) ldapUserID(ctx context.Context, tx *sql.Tx, entry *common.LDAPEntry, requestID string) (uint, bool, error) {
+	opt := ls.UserOptions.LDAP
+	email := entry.GetAttr(opt.EmailAttr)
+	if email == "" {
+		return 0, false, nil
+	}
+	var userID uint
+	var statusc uint
+	row := tx.QueryRowContext(ctx, `select id, statusc from users where email = ?;`, email)
+	err := row.Scan(&userID, &statusc)
+	if err != nil && err != sql.ErrNoRows {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14609}).Error(err)
+		return 0, false, err
+	}
+	if err == nil {
+		if statusc != common.Active {
+			return 0, false, nil
+		}
+		return userID, false, nil
+	}
+
+	firstName := entry.GetAttr(opt.FirstNameAttr)
+	if firstName == "" {
+		firstName = email[:strings.Index(email+"@", "@")]
+	}
+	// the local password is random, the user signs in with the directory
+	_, _, password, err := common.GenTokenHash(requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14610}).Error(err)
+		return 0, false, err
+	}
+	userserv := &UserService{DBService: ls.DBService, RedisService: ls.RedisService, UserOptions: ls.UserOptions}
+	user, err := userserv.newUser(&User{Email: email, FirstName: firstName, LastName: entry.GetAttr(opt.LastNameAttr), PasswordS: password}, ls.UserOptions.DefaultRole, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14611}).Error(err)
+		return 0, false, err
+	}
+	// the directory vouches for the email
+	user.Active = true
+	insertUserStmt, err := userserv.insertUserPrepare(ctx, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14612}).Error(err)
+		return 0, false, err
+	}
+	defer insertUserStmt.Close()
+	err = userserv.insertUser(ctx, insertUserStmt, tx, user, "", requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14613}).Error(err)
+		return 0, false, err
+	}
+
+	uuid4, err := common.GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14614}).Error(err)
+		return 0, false, err
+	}
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	_, err = tx.ExecContext(ctx, `insert into ldap_users
+	  (
+      uuid4,
+			user_id,
+			dn,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,?,?,?,?);`,
+		uuid4,
+		user.ID,
+		entry.DN,
+		/*  StatusDates  */
+		common.Active,
+		tn,
+		tn,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14615}).Error(err)
+		return 0, false, err
+	}
+	log.WithFields(log.Fields{"user": email, "reqid": requestID, "msgnum": 14616}).Info("LDAP user provisioned")
+	return user.ID, true, nil
+}
+
+// RunLDAPSyncWorker - mirror the LDAP groups every interval until ctx is
+// done
+func (ls *LDAPService) RunLDAPSyncWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := ls.SyncGroups(ctx, "", common.GetRequestID())
+			if err != nil {
+				log.WithFields(log.Fields{"msgnum": 14617}).Error(err)
+			}
+		}
+	}
+}
+
+// SyncGroups - mirror the selected directory groups, and the groups
+// nested in them, into ugroups; nested groups become children through
+// ugroup_chds and the user members become ugroups_users, users new to
+// vilom are provisioned; groups no longer selected are deactivated
+func (ls *LDAPService) SyncGroups(ctx context.Context, userEmail string, requestID string) (*LDAPSyncResult, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14618}).Error(err)
+		return nil, err
+	default:
+		groups, users, err := ls.readDirectory(requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14619}).Error(err)
+			return nil, err
+		}
+		tx, err := ls.DBService.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14620}).Error(err)
+			return nil, err
+		}
+		result, err := ls.syncGroups(ctx, tx, groups, users, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14621}).Error(err)
+			_ = tx.Rollback()
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14622}).Error(err)
+			return nil, err
+		}
+		ugroupService := &UgroupService{DBService: ls.DBService, RedisService: ls.RedisService, UserOptions: ls.UserOptions}
+		ugroupService.invalidateMembers(requestID)
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14623, "groups": result.Groups, "users": result.Users, "members": result.Members}).Info("LDAP groups synced")
+		return result, nil
+	}
+}
+
+// readDirectory - the groups to mirror, parents before their children,
+// and the user entries by normalized DN
+func (ls *LDAPService) readDirectory(requestID string) ([]*ldapGroup, map[string]*common.LDAPEntry, error) {
+	opt := ls.UserOptions.LDAP
+	conn, err := ls.dial()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14624}).Error(err)
+		return nil, nil, err
+	}
+	defer conn.Close()
+	groupEntries, err := conn.Search(opt.GroupBaseDN, common.LDAPScopeSubtree, opt.GroupFilter, []string{opt.GroupNameAttr, opt.MemberAttr, "description"})
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14625}).Error(err)
+		return nil, nil, err
+	}
+	userEntries, err := conn.Search(opt.UserBaseDN, common.LDAPScopeSubtree, "(&"+opt.UserFilter+"("+opt.EmailAttr+"=*))", ls.userAttrs())
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14626}).Error(err)
+		return nil, nil, err
+	}
+	users := map[string]*common.LDAPEntry{}
+	for _, entry := range userEntries {
+		users[common.NormalizeLDAPDN(entry.DN)] = entry
+	}
+	return ldapGroupTree(groupEntries, opt), users, nil
+}
+
+// ldapGroupTree - the selected groups and the groups nested in them, in
+// breadth first order from the groups not nested in another one; a
+// group nested in several gets the first as its parent
+func ldapGroupTree(entries []*common.LDAPEntry, opt common.LDAPOptions) []*ldapGroup {
+	byDN := map[string]*ldapGroup{}
+	dns := []string{}
+	for _, entry := range entries {
+		dn := common.NormalizeLDAPDN(entry.DN)
+		byDN[dn] = &ldapGroup{DN: entry.DN, Name: entry.GetAttr(opt.GroupNameAttr), Desc: entry.GetAttr("description")}
+		dns = append(dns, dn)
+	}
+	sort.Strings(dns)
+	for _, entry := range entries {
+		g := byDN[common.NormalizeLDAPDN(entry.DN)]
+		for _, member := range entry.GetAttrs(opt.MemberAttr) {
+			member = common.NormalizeLDAPDN(member)
+			if _, ok := byDN[member]; ok {
+				g.Children = append(g.Children, member)
+			} else {
+				g.Members = append(g.Members, member)
+			}
+		}
+	}
+
+	selected := map[string]bool{}
+	for _, name := range opt.SyncGroups {
+		selected[strings.ToLower(name)] = true
+	}
+	reach := map[string]bool{}
+	var visit func(dn string)
+	visit = func(dn string) {
+		if reach[dn] {
+			return
+		}
+		reach[dn] = true
+		for _, c := range byDN[dn].Children {
+			visit(c)
+		}
+	}
+	for _, dn := range dns {
+		if len(selected) == 0 || selected[strings.ToLower(byDN[dn].Name)] {
+			visit(dn)
+		}
+	}
+	nested := map[string]bool{}
+	for dn := range reach {
+		for _, c := range byDN[dn].Children {
+			nested[c] = true
+		}
+	}
+	// drop the nestings closing a cycle, ugroups are never their own
+	// descendants
+	const visiting, done = 1, 2
+	state := map[string]int{}
+	var breakCycles func(dn string)
+	breakCycles = func(dn string) {
+		state[dn] = visiting
+		g := byDN[dn]
+		children := []string{}
+		for _, c := range g.Children {
+			if state[c] == visiting {
+				continue
+			}
+			children = append(children, c)
+			if state[c] == 0 {
+				breakCycles(c)
+			}
+		}
+		g.Children = children
+		state[dn] = done
+	}
+	for _, dn := range dns {
+		if reach[dn] && !nested[dn] && state[dn] == 0 {
+			breakCycles(dn)
+		}
+	}
+	for _, dn := range dns {
+		if reach[dn] && state[dn] == 0 {
+			breakCycles(dn)
+		}
+	}
+
+	tree := []*ldapGroup{}
+	placed := map[string]bool{}
+	place := func(root string) {
+		placed[root] = true
+		queue := []string{root}
+		for len(queue) > 0 {
+			g := byDN[queue[0]]
+			queue = queue[1:]
+			tree = append(tree, g)
+			for _, c := range g.Children {
+				if !placed[c] {
+					placed[c] = true
+					byDN[c].ParentDN = g.DN
+					byDN[c].Levelc = g.Levelc + 1
+					queue = append(queue, c)
+				}
+			}
+		}
+	}
+	for _, dn := range dns {
+		if reach[dn] && !nested[dn] && !placed[dn] {
+			place(dn)
+		}
+	}
+	// groups only nested in a cycle become top level
+	for _, dn := range dns {
+		if reach[dn] && !placed[dn] {
+			place(dn)
+		}
+	}
+	return tree
+}
+
+// syncGroups - mirror the groups in tx
+func (ls *LDAPService) syncGroups(ctx context.Context, tx *sql.Tx, groups []*ldapGroup, users map[string]*common.LDAPEntry, requestID string) (*LDAPSyncResult, error) {
+	result := LDAPSyncResult{}
+	byDN := map[string]*ldapGroup{}
+	for _, g := range groups {
+		byDN[common.NormalizeLDAPDN(g.DN)] = g
+		parentID := uint(0)
+		if g.ParentDN != "" {
+			parentID = byDN[common.NormalizeLDAPDN(g.ParentDN)].UgroupID
+		}
+		err := ls.upsertLDAPGroup(ctx, tx, g, parentID, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14627}).Error(err)
+			return nil, err
+		}
+		result.Groups++
+	}
+	err := ls.deactivateLDAPGroups(ctx, tx, byDN, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14631}).Error(err)
+		return nil, err
+	}
+
+	ugroupService := &UgroupService{DBService: ls.DBService, RedisService: ls.RedisService, UserOptions: ls.UserOptions}
+	userIDs := map[string]uint{}
+	for _, g := range groups {
+		childIDs := []uint{}
+		for _, c := range g.Children {
+			childIDs = append(childIDs, byDN[c].UgroupID)
+		}
+		err = ls.syncChildren(ctx, tx, g.UgroupID, childIDs, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14628}).Error(err)
+			return nil, err
+		}
+		memberIDs := []uint{}
+		for _, m := range g.Members {
+			entry, ok := users[m]
+			if !ok {
+				continue
+			}
+			userID, ok := userIDs[m]
+			if !ok {
+				var created bool
+				userID, created, err = ls.ldapUserID(ctx, tx, entry, requestID)
+				if err != nil {
+					log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14629}).Error(err)
+					return nil, err
+				}
+				userIDs[m] = userID
+				if created {
+					result.Users++
+				}
+			}
+			if userID != 0 {
+				memberIDs = append(memberIDs, userID)
+			}
+		}
+		err = ugroupService.setUgroupUsers(ctx, tx, g.UgroupID, memberIDs, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14630}).Error(err)
+			return nil, err
+		}
+		result.Members += len(memberIDs)
+	}
+	return &result, nil
+}
+
+// upsertLDAPGroup - create or update the ugroup of the group and set its
+// UgroupID
+func (ls *LDAPService) upsertLDAPGroup(ctx context.Context, tx *sql.Tx, g *ldapGroup, parentID uint, requestID string) error {
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	desc := g.Desc
+	if desc == "" {
+		desc = g.DN
+	}
+	row := tx.QueryRowContext(ctx, `select ugroup_id from ldap_groups where dn = ?;`, g.DN)
+	err := row.Scan(&g.UgroupID)
+	if err != nil && err != sql.ErrNoRows {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14632}).Error(err)
+		return err
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `update ugroups set
+		  ugroup_name = ?,
+			ugroup_desc = ?,
+			levelc = ?,
+			parent_id = ?,
+			statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where id = ?;`,
+			g.Name, desc, g.Levelc, parentID, common.Active, tn, tnday, tnweek, tnmonth, tnyear, g.UgroupID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14633}).Error(err)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `update ldap_groups set
+		  synced_at = ?,
+			statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where ugroup_id = ?;`,
+			tn, common.Active, tn, tnday, tnweek, tnmonth, tnyear, g.UgroupID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14634}).Error(err)
+			return err
+		}
+		return nil
+	}
+
+	ugserv := &UgroupService{DBService: ls.DBService, RedisService: ls.RedisService, UserOptions: ls.UserOptions}
+	insertUgroupStmt, err := ugserv.insertUgroupPrepare(ctx, "", requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14635}).Error(err)
+		return err
+	}
+	defer insertUgroupStmt.Close()
+	ug := Ugroup{}
+	ug.UUID4, err = common.GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14636}).Error(err)
+		return err
+	}
+	ug.UgroupName = g.Name
+	ug.UgroupDesc = desc
+	ug.Levelc = g.Levelc
+	ug.ParentID = parentID
+	ug.NumChd = 0
+	ug.Statusc = common.Active
+	ug.CreatedAt = tn
+	ug.UpdatedAt = tn
+	ug.CreatedDay = tnday
+	ug.CreatedWeek = tnweek
+	ug.CreatedMonth = tnmonth
+	ug.CreatedYear = tnyear
+	ug.UpdatedDay = tnday
+	ug.UpdatedWeek = tnweek
+	ug.UpdatedMonth = tnmonth
+	ug.UpdatedYear = tnyear
+	err = ugserv.insertUgroup(ctx, insertUgroupStmt, tx, &ug, "", requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14637}).Error(err)
+		return err
+	}
+	g.UgroupID = ug.ID
+
+	uuid4, err := common.GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14638}).Error(err)
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `insert into ldap_groups
+	  (
+      uuid4,
+			ugroup_id,
+			dn,
+			synced_at,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?);`,
+		uuid4,
+		g.UgroupID,
+		g.DN,
+		tn,
+		/*  StatusDates  */
+		common.Active,
+		tn,
+		tn,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear,
+		tnday,
+		tnweek,
+		tnmonth,
+		tnyear)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14639}).Error(err)
+		return err
+	}
+	return nil
+}
+
+// idQuerier - a *sql.DB or a *sql.Tx
+type idQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// activeIDs - the IDs in the first column of the query rows
+func activeIDs(ctx context.Context, q idQuerier, query string, args ...interface{}) (map[uint]bool, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[uint]bool{}
+	for rows.Next() {
+		var id uint
+		err = rows.Scan(&id)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		ids[id] = true
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	return ids, rows.Err()
+}
+
+// syncChildren - make the directory groups nested in the ugroup its
+// active children, children added in vilom are kept
+func (ls *LDAPService) syncChildren(ctx context.Context, tx *sql.Tx, ugroupID uint, childIDs []uint, requestID string) error {
+	current, err := activeIDs(ctx, tx, `select c.ugroup_chd_id from ugroup_chds c inner join ldap_groups l on (c.ugroup_chd_id = l.ugroup_id) where c.ugroup_id = ? and c.statusc = ?;`, ugroupID, common.Active)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14640}).Error(err)
+		return err
+	}
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	want := map[uint]bool{}
+	for _, childID := range childIDs {
+		if want[childID] {
+			continue
+		}
+		want[childID] = true
+		if current[childID] {
+			continue
+		}
+		uuid4, err := common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14641}).Error(err)
+			return err
+		}
+		ugserv := &UgroupService{DBService: ls.DBService, RedisService: ls.RedisService, UserOptions: ls.UserOptions}
+		insertChildStmt, err := ugserv.insertChildPrepare(ctx, "", requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14642}).Error(err)
+			return err
+		}
+		err = ugserv.insertChild(ctx, insertChildStmt, tx, &UgroupChd{
+			UUID4:       uuid4,
+			UgroupID:    ugroupID,
+			UgroupChdID: childID,
+			StatusDates: common.StatusDates{
+				Statusc:      common.Active,
+				CreatedAt:    tn,
+				UpdatedAt:    tn,
+				CreatedDay:   tnday,
+				CreatedWeek:  tnweek,
+				CreatedMonth: tnmonth,
+				CreatedYear:  tnyear,
+				UpdatedDay:   tnday,
+				UpdatedWeek:  tnweek,
+				UpdatedMonth: tnmonth,
+				UpdatedYear:  tnyear,
+			},
+		}, "", requestID)
+		_ = insertChildStmt.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14643}).Error(err)
+			return err
+		}
+	}
+	for childID := range current {
+		if want[childID] {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, `update ugroup_chds set
+		  statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where ugroup_id = ? and ugroup_chd_id = ? and statusc = ?;`,
+			common.Inactive, tn, tnday, tnweek, tnmonth, tnyear, ugroupID, childID, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14644}).Error(err)
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `update ugroups set num_chd = (select count(*) from ugroup_chds where ugroup_id = ? and statusc = ?) where id = ?;`, ugroupID, common.Active, ugroupID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14645}).Error(err)
+		return err
+	}
+	return nil
+}
+
+// deactivateLDAPGroups - deactivate the ugroups of the groups mirrored
+// before that are not in synced, and unlink them from their parents
+func (ls *LDAPService) deactivateLDAPGroups(ctx context.Context, tx *sql.Tx, synced map[string]*ldapGroup, requestID string) error {
+	rows, err := tx.QueryContext(ctx, `select ugroup_id, dn from ldap_groups where statusc = ?;`, common.Active)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14650}).Error(err)
+		return err
+	}
+	stale := []uint{}
+	for rows.Next() {
+		var ugroupID uint
+		var dn string
+		err = rows.Scan(&ugroupID, &dn)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14651}).Error(err)
+			_ = rows.Close()
+			return err
+		}
+		if _, ok := synced[common.NormalizeLDAPDN(dn)]; !ok {
+			stale = append(stale, ugroupID)
+		}
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14652}).Error(err)
+		return err
+	}
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	for _, ugroupID := range stale {
+		for _, query := range []string{
+			`update ugroups set statusc = ?, updated_at = ?, updated_day = ?, updated_week = ?, updated_month = ?, updated_year = ? where id = ?;`,
+			`update ldap_groups set statusc = ?, updated_at = ?, updated_day = ?, updated_week = ?, updated_month = ?, updated_year = ? where ugroup_id = ?;`,
+			`update ugroup_chds set statusc = ?, updated_at = ?, updated_day = ?, updated_week = ?, updated_month = ?, updated_year = ? where ugroup_chd_id = ?;`,
+		} {
+			_, err = tx.ExecContext(ctx, query, common.Inactive, tn, tnday, tnweek, tnmonth, tnyear, ugroupID)
+			if err != nil {
+				log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14653}).Error(err)
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package userservices
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func ldapTestEntries(engMembers ...string) []*common.LDAPEntry {
+	return []*common.LDAPEntry{
+		{DN: "cn=vilom,ou=services,dc=example,dc=com", Attributes: map[string][]string{"userPassword": {"service"}}},
+		{DN: "uid=ann,ou=people,dc=example,dc=com", Attributes: map[string][]string{
+			"objectClass": {"inetOrgPerson"}, "mail": {"ann@example.com"}, "givenName": {"Ann"}, "sn": {"Lee"}, "userPassword": {"secret"}}},
+		{DN: "uid=bob,ou=people,dc=example,dc=com", Attributes: map[string][]string{
+			"objectClass": {"inetOrgPerson"}, "mail": {"bob@example.com"}, "givenName": {"Bob"}, "sn": {"Ray"}, "userPassword": {"secret"}}},
+		{DN: "cn=eng,ou=groups,dc=example,dc=com", Attributes: map[string][]string{
+			"objectClass": {"groupOfNames"}, "cn": {"eng"}, "member": engMembers}},
+		{DN: "cn=backend,ou=groups,dc=example,dc=com", Attributes: map[string][]string{
+			"objectClass": {"groupOfNames"}, "cn": {"backend"}, "member": {"uid=bob,ou=people,dc=example,dc=com"}}},
+		{DN: "cn=sales,ou=groups,dc=example,dc=com", Attributes: map[string][]string{
+			"objectClass": {"groupOfNames"}, "cn": {"sales"}, "member": {"uid=ann,ou=people,dc=example,dc=com"}}},
+	}
+}
+
+func TestLDAPService_LoginAndSyncGroups(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	server, err := testhelpers.NewLDAPServer(ldapTestEntries("uid=ann,ou=people,dc=example,dc=com", "cn=backend,ou=groups,dc=example,dc=com"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer server.Close()
+
+	ldapOpt := *userOpt
+	ldapOpt.LDAP = common.LDAPOptions{
+		Enabled:       true,
+		URL:           server.URL,
+		BindDN:        "cn=vilom,ou=services,dc=example,dc=com",
+		BindPassword:  "service",
+		UserBaseDN:    "ou=people,dc=example,dc=com",
+		UserFilter:    "(objectClass=inetOrgPerson)",
+		EmailAttr:     "mail",
+		FirstNameAttr: "givenName",
+		LastNameAttr:  "sn",
+		GroupBaseDN:   "ou=groups,dc=example,dc=com",
+		GroupFilter:   "(objectClass=groupOfNames)",
+		GroupNameAttr: "cn",
+		MemberAttr:    "member",
+		SyncGroups:    []string{"eng"},
+	}
+	authEnforcer, err := common.LoadEnforcer(dbService, roleOpt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	jwtOpt := &common.JWTOptions{JWTKey: []byte("test"), JWTDuration: 3600}
+	userService := NewUserService(dbService, redisService, nil, jwtOpt, &ldapOpt, authEnforcer)
+
+	// the failed sign in below must not add up to a lockout across runs
+	redisService.RedisClient.Del("login:fail:user:ann@example.com", "login:wait:user:ann@example.com")
+	_, err = userService.Login(ctx, &LoginForm{Email: "ann@example.com", Password: "wrong"}, "", "", requestID)
+	if err == nil {
+		t.Errorf("UserService.Login() error = nil, want the LDAP bind to fail")
+		return
+	}
+	user, err := userService.Login(ctx, &LoginForm{Email: "ann@example.com", Password: "secret"}, "", "", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if user.ID == 0 || user.Tokenstring == "" {
+		t.Errorf("UserService.Login() = %v, want the provisioned user signed in", user)
+		return
+	}
+	// the fixture user keeps its local password
+	_, err = userService.Login(ctx, &LoginForm{Email: "abcd145@gmail.com", Password: "abc1238"}, "", "", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ldapService := NewLDAPService(dbService, redisService, &ldapOpt)
+	result, err := ldapService.SyncGroups(ctx, "", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// eng and the backend group nested in it, bob is provisioned
+	if result.Groups != 2 || result.Users != 1 || result.Members != 2 {
+		t.Errorf("LDAPService.SyncGroups() = %v, want 2 groups, 1 new user and 2 members", result)
+		return
+	}
+	var levelc, numChd uint
+	err = dbService.DB.QueryRow(`select g.levelc, p.num_chd from ugroups g inner join ugroup_chds c on (c.ugroup_chd_id = g.id) inner join ugroups p on (c.ugroup_id = p.id) where g.ugroup_name = ? and c.statusc = ?;`, "backend", common.Active).Scan(&levelc, &numChd)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if levelc != 1 || numChd != 1 {
+		t.Errorf("backend levelc = %v, eng num_chd = %v, want 1 and 1", levelc, numChd)
+	}
+
+	// ann leaves eng and the nesting is removed
+	server.SetEntries(ldapTestEntries("uid=bob,ou=people,dc=example,dc=com"))
+	_, err = ldapService.SyncGroups(ctx, "", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var members int
+	err = dbService.DB.QueryRow(`select count(*) from ugroups_users gu inner join ugroups g on (gu.ugroup_id = g.id) inner join users u on (gu.user_id = u.id) where g.ugroup_name = ? and u.email = ? and gu.statusc = ?;`, "eng", "ann@example.com", common.Active).Scan(&members)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if members != 0 {
+		t.Errorf("ann is still a member of eng")
+	}
+	var backendStatus uint
+	err = dbService.DB.QueryRow(`select statusc from ugroups where ugroup_name = ?;`, "backend").Scan(&backendStatus)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if backendStatus != common.Inactive {
+		t.Errorf("backend statusc = %v, want the group no longer mirrored deactivated", backendStatus)
+	}
+}
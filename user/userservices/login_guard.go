@@ -0,0 +1,259 @@
+package userservices
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+/* error message range: 13800-13899 */
+
+// Failed logins are counted in Redis per account and per client IP over
+// LoginFailWindow; after LoginDelayAfter failures each further attempt on
+// the account must wait a delay that doubles up to LoginDelayMax, and
+// after LoginLockoutAfter failures the account, or the IP after
+// LoginIPLockoutAfter, is locked for LoginLockoutDuration
+const (
+	LoginFailWindow      = 15 * time.Minute
+	LoginDelayAfter      = 3
+	LoginDelayBase       = time.Second
+	LoginDelayMax        = 30 * time.Second
+	LoginLockoutAfter    = 10
+	LoginIPLockoutAfter  = 50
+	LoginLockoutDuration = 15 * time.Minute
+)
+
+// ErrLoginLocked - the account or the client IP is locked out
+var ErrLoginLocked = errors.New("Too many failed login attempts, try again later")
+
+func loginFailKey(email string) string {
+	return "login:fail:user:" + strings.ToLower(email)
+}
+
+func loginWaitKey(email string) string {
+	return "login:wait:user:" + strings.ToLower(email)
+}
+
+func loginLockKey(email string) string {
+	return "login:lock:user:" + strings.ToLower(email)
+}
+
+func loginIPFailKey(ip string) string {
+	return "login:fail:ip:" + ip
+}
+
+func loginIPLockKey(ip string) string {
+	return "login:lock:ip:" + ip
+}
+
+// loginDelay - the wait before the next attempt after fails failures
+func loginDelay(fails int64) time.Duration {
+	if fails < LoginDelayAfter {
+		return 0
+	}
+	shift := fails - LoginDelayAfter
+	if shift > 16 {
+		return LoginDelayMax
+	}
+	delay := LoginDelayBase << uint(shift)
+	if delay > LoginDelayMax {
+		return LoginDelayMax
+	}
+	return delay
+}
+
+// checkLoginAllowed - error when the account or the client IP is locked
+// out, or the account is still waiting out its delay; logins are allowed
+// when Redis is unavailable
+func (u *UserService) checkLoginAllowed(email string, ip string, requestID string) error {
+	client := u.RedisService.RedisClient
+	keys := []string{loginLockKey(email)}
+	if ip != "" {
+		keys = append(keys, loginIPLockKey(ip))
+	}
+	locked, err := client.Exists(keys...).Result()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"reqid":  requestID,
+			"msgnum": 13800,
+		}).Error(err)
+		return nil
+	}
+	if locked > 0 {
+		return ErrLoginLocked
+	}
+	wait, err := client.PTTL(loginWaitKey(email)).Result()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"reqid":  requestID,
+			"msgnum": 13801,
+		}).Error(err)
+		return nil
+	}
+	if wait > 0 {
+		seconds := int((wait + time.Second - 1) / time.Second)
+		return fmt.Errorf("Too many failed login attempts, try again in %d seconds", seconds)
+	}
+	return nil
+}
+
+// loginFailed - count a failed login for the account and the client IP,
+// and delay or lock them out; user is nil when no account has the email
+func (u *UserService) loginFailed(ctx context.Context, email string, ip string, user *User, requestID string) {
+	client := u.RedisService.RedisClient
+	pipe := client.TxPipeline()
+	fails := pipe.Incr(loginFailKey(email))
+	pipe.Expire(loginFailKey(email), LoginFailWindow)
+	var ipFails *redis.IntCmd
+	if ip != "" {
+		ipFails = pipe.Incr(loginIPFailKey(ip))
+		pipe.Expire(loginIPFailKey(ip), LoginFailWindow)
+	}
+	_, err := pipe.Exec()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"reqid":  requestID,
+			"msgnum": 13802,
+		}).Error(err)
+		return
+	}
+
+	if fails.Val() >= LoginLockoutAfter {
+		// only the attempt that sets the lock notifies the user
+		isLocked, err := client.SetNX(loginLockKey(email), ip, LoginLockoutDuration).Result()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 13803,
+			}).Error(err)
+		} else if isLocked {
+			client.Del(loginFailKey(email), loginWaitKey(email))
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 13804,
+			}).Warn("account locked out: " + email)
+			if user != nil {
+				err = u.sendLockoutEmail(ctx, user, ip, requestID)
+				if err != nil {
+					log.WithFields(log.Fields{
+						"reqid":  requestID,
+						"msgnum": 13805,
+					}).Error(err)
+				}
+			}
+		}
+	} else if delay := loginDelay(fails.Val()); delay > 0 {
+		err = client.Set(loginWaitKey(email), 1, delay).Err()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 13806,
+			}).Error(err)
+		}
+	}
+
+	if ipFails != nil && ipFails.Val() >= LoginIPLockoutAfter {
+		isLocked, err := client.SetNX(loginIPLockKey(ip), 1, LoginLockoutDuration).Result()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 13807,
+			}).Error(err)
+		} else if isLocked {
+			client.Del(loginIPFailKey(ip))
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 13808,
+			}).Warn("client IP locked out: " + ip)
+		}
+	}
+}
+
+// loginSucceeded - clear the failed logins of the account; the client
+// IP keeps its count so one valid account cannot reset it
+func (u *UserService) loginSucceeded(email string, requestID string) {
+	err := u.RedisService.RedisClient.Del(loginFailKey(email), loginWaitKey(email)).Err()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"reqid":  requestID,
+			"msgnum": 13809,
+		}).Error(err)
+	}
+}
+
+// sendLockoutEmail - queue the email telling the user the account is
+// locked out
+func (u *UserService) sendLockoutEmail(ctx context.Context, user *User, ip string, requestID string) error {
+	pwd, _ := os.Getwd()
+	viewsDir := pwd + filepath.FromSlash("/common/views")
+	subject := common.T(user.Locale, "email.account_locked.subject")
+
+	templateData := struct {
+		Title   string
+		IP      string
+		Minutes int
+	}{
+		Title:   subject,
+		IP:      ip,
+		Minutes: int(LoginLockoutDuration / time.Minute),
+	}
+
+	LockedEmail, LockedText, err := common.RenderEmail(viewsDir, user.Locale, "account_locked", templateData)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"reqid":  requestID,
+			"msgnum": 13810,
+		}).Error(err)
+		return err
+	}
+
+	email := common.Email{
+		To:       user.Email,
+		Subject:  subject,
+		Body:     LockedEmail,
+		TextBody: LockedText,
+	}
+
+	tx, err := u.DBService.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"reqid":  requestID,
+			"msgnum": 13811,
+		}).Error(err)
+		return err
+	}
+	err = common.QueueEmail(ctx, tx, email, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"reqid":  requestID,
+			"msgnum": 13812,
+		}).Error(err)
+		err = tx.Rollback()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 13812,
+			}).Error(err)
+		}
+		return errors.New("Could not queue the account locked email")
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"reqid":  requestID,
+			"msgnum": 13813,
+		}).Error(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package userservices
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/rs/xid"
+)
+
+func TestUserService_LoginLockout(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	authEnforcer, err := common.LoadEnforcer(dbService, roleOpt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	loginOpt := *userOpt
+	loginOpt.Registration = RegistrationOpen
+	loginOpt.DefaultRole = "co_admin"
+	jwtOpt := &common.JWTOptions{JWTKey: []byte("test"), JWTDuration: 3600}
+	userService := NewUserService(dbService, redisService, nil, jwtOpt, &loginOpt, authEnforcer)
+
+	// the redis counters outlive the fixtures, a fresh email and IP per run
+	id := xid.New().String()
+	email := "lock" + id + "@example.com"
+	clientIP := "198.51.100." + strconv.Itoa(rand.New(rand.NewSource(time.Now().UnixNano())).Intn(256))
+	form := User{FirstName: "Ann", LastName: "Lee", Email: email, PasswordS: "abc1238"}
+	_, err = userService.CreateUser(ctx, &form, "", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	user, err := userService.Login(ctx, &LoginForm{Email: email, Password: "abc1238"}, clientIP, "", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var signInCount uint
+	err = dbService.DB.QueryRow(`select sign_in_count from users where id = ?;`, user.ID).Scan(&signInCount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if signInCount != 1 {
+		t.Errorf("UserService.Login() sign_in_count = %v, want 1", signInCount)
+	}
+
+	for i := 0; i < LoginDelayAfter; i++ {
+		_, err = userService.Login(ctx, &LoginForm{Email: email, Password: "wrong"}, clientIP, "", requestID)
+		if err == nil {
+			t.Errorf("UserService.Login() error = nil, want a wrong password error")
+			return
+		}
+	}
+	// the right password must wait out the delay
+	_, err = userService.Login(ctx, &LoginForm{Email: email, Password: "abc1238"}, clientIP, "", requestID)
+	if err == nil {
+		t.Errorf("UserService.Login() error = nil, want a delay error")
+	}
+}
@@ -0,0 +1,607 @@
+package userservices
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+/* error message range: 12600-12899 */
+
+// Notification types
+const (
+	NotificationReply         = "reply"
+	NotificationMention       = "mention"
+	NotificationReaction      = "reaction"
+	NotificationBadge         = "badge"
+	NotificationChannelInvite = "channel_invite"
+)
+
+// NotificationTypes - all the notification types, in the order the
+// preferences are listed
+var NotificationTypes = []string{NotificationReply, NotificationMention, NotificationReaction, NotificationBadge, NotificationChannelInvite}
+
+// NtextLenMax - notification texts are cut to this many characters
+const NtextLenMax = 255
+
+// Notification - Notification view representation
+type Notification struct {
+	ID          uint   `json:"id,omitempty"`
+	UUID4       []byte `json:"-"`
+	IDS         string `json:"id_s,omitempty"`
+	UserID      uint   `json:"user_id,omitempty"`
+	Ntype       string `json:"ntype,omitempty"`
+	ActorID     uint   `json:"actor_id,omitempty"`
+	WorkspaceID uint   `json:"workspace_id,omitempty"`
+	ChannelID   uint   `json:"channel_id,omitempty"`
+	MessageID   uint   `json:"message_id,omitempty"`
+	UbadgeID    uint   `json:"ubadge_id,omitempty"`
+	Ntext       string `json:"ntext,omitempty"`
+	IsRead      bool   `json:"is_read"`
+
+	common.StatusDates
+}
+
+// NotificationCursor - used to get notifications
+type NotificationCursor struct {
+	Notifications []*Notification
+	NextCursor    string `json:"next_cursor,omitempty"`
+}
+
+// NotificationPref - whether the user gets notifications of a type
+type NotificationPref struct {
+	Ntype   string `json:"ntype"`
+	Enabled bool   `json:"enabled"`
+}
+
+// NotificationServiceIntf - interface for Notification Service
+type NotificationServiceIntf interface {
+	GetNotifications(ctx context.Context, limit string, nextCursor string, unread bool, UserID string, userEmail string, requestID string) (*NotificationCursor, error)
+	MarkNotificationRead(ctx context.Context, ID string, UserID string, userEmail string, requestID string) error
+	MarkAllNotificationsRead(ctx context.Context, UserID string, userEmail string, requestID string) error
+	GetNotificationPrefs(ctx context.Context, UserID string, userEmail string, requestID string) ([]*NotificationPref, error)
+	UpdateNotificationPrefs(ctx context.Context, form []*NotificationPref, UserID string, userEmail string, requestID string) error
+	Subscribe(ctx context.Context, UserID string, userEmail string, requestID string) (<-chan *Notification, func(), error)
+}
+
+// NotificationService - For accessing notification services
+type NotificationService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+}
+
+// NewNotificationService - Create notification service
+func NewNotificationService(dbOpt *common.DBService, redisOpt *common.RedisService) *NotificationService {
+	return &NotificationService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+	}
+}
+
+// notificationChannel - the redis channel the notifications of a user
+// are published on
+func notificationChannel(userID uint) string {
+	return "notifications:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// Notify - create the notifications, errors are logged and not returned
+// as notifications never fail the action that caused them
+func Notify(ctx context.Context, dbOpt *common.DBService, redisOpt *common.RedisService, notifications []*Notification, userEmail string, requestID string) {
+	if len(notifications) == 0 {
+		return
+	}
+	notifserv := &NotificationService{DBService: dbOpt, RedisService: redisOpt}
+	err := notifserv.CreateNotifications(ctx, notifications, userEmail, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12600}).Error(err)
+	}
+}
+
+// CreateNotifications - store the notifications the users have not
+// turned off and push them to the connected clients of the users
+func (ns *NotificationService) CreateNotifications(ctx context.Context, notifications []*Notification, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12601}).Error(err)
+		return err
+	default:
+		for _, n := range notifications {
+			if n.UserID == 0 || n.UserID == n.ActorID {
+				continue
+			}
+			enabled, err := ns.isEnabled(ctx, n.UserID, n.Ntype, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12602}).Error(err)
+				return err
+			}
+			if !enabled {
+				continue
+			}
+			err = ns.insertNotification(ctx, n, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12603}).Error(err)
+				return err
+			}
+			ns.publish(n, userEmail, requestID)
+		}
+		return nil
+	}
+}
+
+// isEnabled - whether the user gets notifications of type ntype, types
+// without a preference are enabled
+func (ns *NotificationService) isEnabled(ctx context.Context, userID uint, ntype string, userEmail string, requestID string) (bool, error) {
+	db := ns.DBService.DB
+	enabled := true
+	row := db.QueryRowContext(ctx, `select enabled from notification_prefs where user_id = ? and ntype = ? and statusc = ?;`, userID, ntype, common.Active)
+	err := row.Scan(&enabled)
+	if err != nil && err != sql.ErrNoRows {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12604}).Error(err)
+		return false, err
+	}
+	return enabled, nil
+}
+
+// insertNotification - insert the notification
+func (ns *NotificationService) insertNotification(ctx context.Context, n *Notification, userEmail string, requestID string) error {
+	var err error
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	n.UUID4, err = common.GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12605}).Error(err)
+		return err
+	}
+	if runes := []rune(n.Ntext); len(runes) > NtextLenMax {
+		n.Ntext = string(runes[:NtextLenMax])
+	}
+	n.IsRead = false
+	n.Statusc = common.Active
+	n.CreatedAt = tn
+	n.UpdatedAt = tn
+	n.CreatedDay = tnday
+	n.CreatedWeek = tnweek
+	n.CreatedMonth = tnmonth
+	n.CreatedYear = tnyear
+	n.UpdatedDay = tnday
+	n.UpdatedWeek = tnweek
+	n.UpdatedMonth = tnmonth
+	n.UpdatedYear = tnyear
+
+	db := ns.DBService.DB
+	res, err := db.ExecContext(ctx, `insert into notifications
+	  (
+      uuid4,
+			user_id,
+			ntype,
+			actor_id,
+			workspace_id,
+			channel_id,
+			message_id,
+			ubadge_id,
+			ntext,
+			is_read,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?,?,?,?,?);`,
+		n.UUID4,
+		n.UserID,
+		n.Ntype,
+		n.ActorID,
+		n.WorkspaceID,
+		n.ChannelID,
+		n.MessageID,
+		n.UbadgeID,
+		n.Ntext,
+		n.IsRead,
+		/*  StatusDates  */
+		n.Statusc,
+		n.CreatedAt,
+		n.UpdatedAt,
+		n.CreatedDay,
+		n.CreatedWeek,
+		n.CreatedMonth,
+		n.CreatedYear,
+		n.UpdatedDay,
+		n.UpdatedWeek,
+		n.UpdatedMonth,
+		n.UpdatedYear)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12606}).Error(err)
+		return err
+	}
+	uID, err := res.LastInsertId()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12607}).Error(err)
+		return err
+	}
+	n.ID = uint(uID)
+	n.IDS, err = common.UUIDBytesToStr(n.UUID4)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12608}).Error(err)
+		return err
+	}
+	return nil
+}
+
+// publish - push the notification to the connected clients of the user,
+// a client that is not connected reads it from the list later
+func (ns *NotificationService) publish(n *Notification, userEmail string, requestID string) {
+	if ns.RedisService == nil {
+		return
+	}
+	payload, err := json.Marshal(n)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12609}).Error(err)
+		return
+	}
+	err = ns.RedisService.RedisClient.Publish(notificationChannel(n.UserID), payload).Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12610}).Error(err)
+	}
+}
+
+// Subscribe - the notifications of the user as they are created, the
+// returned func stops the subscription
+func (ns *NotificationService) Subscribe(ctx context.Context, UserID string, userEmail string, requestID string) (<-chan *Notification, func(), error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12611}).Error(err)
+		return nil, nil, err
+	default:
+		userserv := &UserService{DBService: ns.DBService, RedisService: ns.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12612}).Error(err)
+			return nil, nil, err
+		}
+		pubsub := ns.RedisService.RedisClient.Subscribe(notificationChannel(user.ID))
+		_, err = pubsub.Receive()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12613}).Error(err)
+			_ = pubsub.Close()
+			return nil, nil, err
+		}
+		notifications := make(chan *Notification)
+		go func() {
+			defer close(notifications)
+			for msg := range pubsub.Channel() {
+				n := Notification{}
+				err := json.Unmarshal([]byte(msg.Payload), &n)
+				if err != nil {
+					log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12614}).Error(err)
+					continue
+				}
+				select {
+				case notifications <- &n:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return notifications, func() { _ = pubsub.Close() }, nil
+	}
+}
+
+// GetNotifications - Get the notifications of the user, newest first
+func (ns *NotificationService) GetNotifications(ctx context.Context, limit string, nextCursor string, unread bool, UserID string, userEmail string, requestID string) (*NotificationCursor, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12615}).Error(err)
+		return nil, err
+	default:
+		if limit == "" {
+			limit = ns.DBService.LimitSQLRows
+		}
+		limitn, err := strconv.ParseUint(limit, 10, 32)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12616}).Error(err)
+			return nil, errors.New("Invalid limit")
+		}
+		cursor := uint64(1<<32 - 1)
+		if nextCursor != "" {
+			cursor, err = strconv.ParseUint(common.DecodeCursor(nextCursor), 10, 32)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12617}).Error(err)
+				return nil, errors.New("Invalid cursor")
+			}
+		}
+		userserv := &UserService{DBService: ns.DBService, RedisService: ns.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12618}).Error(err)
+			return nil, err
+		}
+		query := ""
+		if unread {
+			query = " and is_read = 0"
+		}
+
+		db := ns.DBService.DB
+		rows, err := db.QueryContext(ctx, `select
+      id,
+			uuid4,
+			user_id,
+			ntype,
+			actor_id,
+			workspace_id,
+			channel_id,
+			message_id,
+			ubadge_id,
+			ntext,
+			is_read,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year from notifications where user_id = ? and statusc = ? and id <= ?`+query+` order by id desc limit ?;`,
+			user.ID, common.Active, cursor, limitn)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12619}).Error(err)
+			return nil, err
+		}
+
+		notifications := []*Notification{}
+		for rows.Next() {
+			n := Notification{}
+			err = rows.Scan(
+				&n.ID,
+				&n.UUID4,
+				&n.UserID,
+				&n.Ntype,
+				&n.ActorID,
+				&n.WorkspaceID,
+				&n.ChannelID,
+				&n.MessageID,
+				&n.UbadgeID,
+				&n.Ntext,
+				&n.IsRead,
+				/*  StatusDates  */
+				&n.Statusc,
+				&n.CreatedAt,
+				&n.UpdatedAt,
+				&n.CreatedDay,
+				&n.CreatedWeek,
+				&n.CreatedMonth,
+				&n.CreatedYear,
+				&n.UpdatedDay,
+				&n.UpdatedWeek,
+				&n.UpdatedMonth,
+				&n.UpdatedYear)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12620}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			n.IDS, err = common.UUIDBytesToStr(n.UUID4)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12621}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			notifications = append(notifications, &n)
+		}
+		err = rows.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12622}).Error(err)
+			return nil, err
+		}
+
+		err = rows.Err()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12623}).Error(err)
+			return nil, err
+		}
+		x := NotificationCursor{Notifications: notifications, NextCursor: "0"}
+		if len(notifications) != 0 {
+			x.NextCursor = common.EncodeCursor(notifications[len(notifications)-1].ID - 1)
+		}
+		return &x, nil
+	}
+}
+
+// MarkNotificationRead - mark the notification of the user as read
+func (ns *NotificationService) MarkNotificationRead(ctx context.Context, ID string, UserID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12624}).Error(err)
+		return err
+	default:
+		uuid4byte, err := common.UUIDStrToBytes(ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12625}).Error(err)
+			return err
+		}
+		return ns.markRead(ctx, " and uuid4 = ?", []interface{}{uuid4byte}, UserID, userEmail, requestID)
+	}
+}
+
+// MarkAllNotificationsRead - mark all the notifications of the user as read
+func (ns *NotificationService) MarkAllNotificationsRead(ctx context.Context, UserID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12626}).Error(err)
+		return err
+	default:
+		return ns.markRead(ctx, "", nil, UserID, userEmail, requestID)
+	}
+}
+
+// markRead - mark the unread notifications of the user that match query as read
+func (ns *NotificationService) markRead(ctx context.Context, query string, queryArgs []interface{}, UserID string, userEmail string, requestID string) error {
+	userserv := &UserService{DBService: ns.DBService, RedisService: ns.RedisService}
+	user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12627}).Error(err)
+		return err
+	}
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	args := append([]interface{}{tn, tnday, tnweek, tnmonth, tnyear, user.ID}, queryArgs...)
+	db := ns.DBService.DB
+	_, err = db.ExecContext(ctx, `update notifications set
+		  is_read = 1,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where user_id = ? and is_read = 0`+query+`;`, args...)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12628}).Error(err)
+		return err
+	}
+	return nil
+}
+
+// GetNotificationPrefs - Get the preference of the user for each notification type
+func (ns *NotificationService) GetNotificationPrefs(ctx context.Context, UserID string, userEmail string, requestID string) ([]*NotificationPref, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12629}).Error(err)
+		return nil, err
+	default:
+		userserv := &UserService{DBService: ns.DBService, RedisService: ns.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12630}).Error(err)
+			return nil, err
+		}
+		prefs := []*NotificationPref{}
+		for _, ntype := range NotificationTypes {
+			enabled, err := ns.isEnabled(ctx, user.ID, ntype, userEmail, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12631}).Error(err)
+				return nil, err
+			}
+			prefs = append(prefs, &NotificationPref{Ntype: ntype, Enabled: enabled})
+		}
+		return prefs, nil
+	}
+}
+
+// UpdateNotificationPrefs - turn notification types on or off for the user
+func (ns *NotificationService) UpdateNotificationPrefs(ctx context.Context, form []*NotificationPref, UserID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12632}).Error(err)
+		return err
+	default:
+		for _, pref := range form {
+			if !isNotificationType(pref.Ntype) {
+				err := errors.New("Invalid notification type " + pref.Ntype)
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12633}).Error(err)
+				return err
+			}
+		}
+		userserv := &UserService{DBService: ns.DBService, RedisService: ns.RedisService}
+		user, err := userserv.GetUser(ctx, UserID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12634}).Error(err)
+			return err
+		}
+		db := ns.DBService.DB
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12635}).Error(err)
+			return err
+		}
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		for _, pref := range form {
+			uuid4, err := common.GetUUIDBytes()
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12636}).Error(err)
+				_ = tx.Rollback()
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `insert into notification_prefs
+	  (
+      uuid4,
+			user_id,
+			ntype,
+			enabled,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+  on duplicate key update
+			enabled = values(enabled),
+			statusc = values(statusc),
+			updated_at = values(updated_at),
+			updated_day = values(updated_day),
+			updated_week = values(updated_week),
+			updated_month = values(updated_month),
+			updated_year = values(updated_year);`,
+				uuid4,
+				user.ID,
+				pref.Ntype,
+				pref.Enabled,
+				common.Active,
+				tn,
+				tn,
+				tnday,
+				tnweek,
+				tnmonth,
+				tnyear,
+				tnday,
+				tnweek,
+				tnmonth,
+				tnyear)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12637}).Error(err)
+				_ = tx.Rollback()
+				return err
+			}
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12638}).Error(err)
+			return err
+		}
+		return nil
+	}
+}
+
+// isNotificationType - ntype is one of NotificationTypes
+func isNotificationType(ntype string) bool {
+	for _, t := range NotificationTypes {
+		if t == ntype {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package userservices
+
+import (
+	"context"
+	"database/sql"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+/* error message range: 15100-15199 */
+
+// checkPassword - check a new password against the policy and, for an
+// existing user, against its current password and the earlier ones kept
+// in password_histories; History counts the current password
+func (u *UserService) checkPassword(ctx context.Context, userID uint, password string, requestID string) error {
+	opt := &u.UserOptions.Password
+	err := common.CheckPasswordPolicy(password, opt, requestID)
+	if err != nil {
+		return err
+	}
+	if userID == 0 || opt.History <= 0 {
+		return nil
+	}
+	rows, err := u.DBService.DB.QueryContext(ctx, `(select password from users where id = ?)
+	  union all
+	  (select password from password_histories where user_id = ? order by id desc limit ?);`, userID, userID, opt.History-1)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15100}).Error(err)
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hash []byte
+		err = rows.Scan(&hash)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15101}).Error(err)
+			return err
+		}
+		if common.ComparePassword(hash, password) == nil {
+			return common.ErrPasswordReused
+		}
+	}
+	return rows.Err()
+}
+
+// recordPasswordHistory - keep the current password of the user before it
+// is replaced, only the History-1 latest are kept
+func (u *UserService) recordPasswordHistory(ctx context.Context, tx *sql.Tx, userID uint, requestID string) error {
+	keep := u.UserOptions.Password.History - 1
+	if keep > 0 {
+		uuid4, err := common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15102}).Error(err)
+			return err
+		}
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		_, err = tx.ExecContext(ctx, `insert into password_histories
+	  (
+      uuid4,
+			user_id,
+			password,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  select ?, id, password, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? from users where id = ? and password is not null;`,
+			uuid4,
+			common.Active,
+			tn,
+			tn,
+			tnday,
+			tnweek,
+			tnmonth,
+			tnyear,
+			tnday,
+			tnweek,
+			tnmonth,
+			tnyear,
+			userID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15103}).Error(err)
+			return err
+		}
+	} else {
+		keep = 0
+	}
+	_, err := tx.ExecContext(ctx, `delete from password_histories where user_id = ? and id not in
+	  (select id from (select id from password_histories where user_id = ? order by id desc limit ?) kept);`, userID, userID, keep)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15104}).Error(err)
+		return err
+	}
+	return nil
+}
+
+// rehashPassword - hash the password again after a sign in when the
+// algorithm or its parameters changed, a failure leaves the old hash
+func (u *UserService) rehashPassword(ctx context.Context, userID uint, hash []byte, password string, requestID string) {
+	opt := &u.UserOptions.Password
+	if !common.PasswordNeedsRehash(hash, opt) {
+		return
+	}
+	newHash, err := common.HashPassword(password, opt, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15105}).Error(err)
+		return
+	}
+	// the hash is only replaced when it did not change meanwhile
+	_, err = u.DBService.DB.ExecContext(ctx, `update users set password = ? where id = ? and password = ?;`, newHash, userID, hash)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15106}).Error(err)
+		return
+	}
+	log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15107}).Info("Rehashed the password of the user")
+}
@@ -0,0 +1,76 @@
+package userservices
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestUserService_PasswordPolicyAndRehash(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	passwordOpt := *userOpt
+	passwordOpt.Password = common.PasswordOptions{MinLength: 6, History: 3, Algorithm: common.PasswordArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}
+	authEnforcer, err := common.LoadEnforcer(dbService, roleOpt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	jwtOpt := &common.JWTOptions{JWTKey: []byte("test"), JWTDuration: 3600}
+	userService := NewUserService(dbService, redisService, nil, jwtOpt, &passwordOpt, authEnforcer)
+
+	// the bcrypt hash of the fixture user moves to argon2id on sign in
+	redisService.RedisClient.Del("login:fail:user:abcd145@gmail.com", "login:wait:user:abcd145@gmail.com")
+	user, err := userService.Login(ctx, &LoginForm{Email: "abcd145@gmail.com", Password: "abc1238"}, "", "", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var hash string
+	var uuid4 []byte
+	err = dbService.DB.QueryRow(`select password, uuid4 from users where id = ?;`, user.ID).Scan(&hash, &uuid4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		t.Errorf("users password = %v, want an argon2id hash", hash)
+		return
+	}
+	_, err = userService.Login(ctx, &LoginForm{Email: "abcd145@gmail.com", Password: "abc1238"}, "", "", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	userID, err := common.UUIDBytesToStr(uuid4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = userService.ChangePassword(ctx, &PasswordForm{ID: userID, CurrentPassword: "abc1238", Password: "def4567"}, "", "abcd145@gmail.com", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = userService.ChangePassword(ctx, &PasswordForm{ID: userID, CurrentPassword: "def4567", Password: "abc1238"}, "", "abcd145@gmail.com", requestID)
+	if err != common.ErrPasswordReused {
+		t.Errorf("UserService.ChangePassword() error = %v, want the earlier password refused", err)
+		return
+	}
+	err = userService.ChangePassword(ctx, &PasswordForm{ID: userID, CurrentPassword: "def4567", Password: "abc"}, "", "abcd145@gmail.com", requestID)
+	if err == nil {
+		t.Errorf("UserService.ChangePassword() error = nil, want a too short password refused")
+	}
+}
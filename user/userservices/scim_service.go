@@ -0,0 +1,1141 @@
+package userservices
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+/* error message range: 14800-14999 */
+
+// The SCIM 2.0 schemas of the resources and messages
+const (
+	SCIMSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMSchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// SCIMMaxCount - the most resources a list returns
+const SCIMMaxCount = 100
+
+// scimActor - the user recorded in the logs of the changes made by the
+// identity provider
+const scimActor = "scim"
+
+// SCIMError - an error reported with its HTTP status and SCIM error type
+type SCIMError struct {
+	Status   int
+	SCIMType string
+	Detail   string
+}
+
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+func scimBadRequest(scimType string, detail string) error {
+	return &SCIMError{Status: http.StatusBadRequest, SCIMType: scimType, Detail: detail}
+}
+
+var errSCIMNotFound = &SCIMError{Status: http.StatusNotFound, Detail: "Resource not found"}
+
+// SCIMName - the name of a SCIM user
+type SCIMName struct {
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// SCIMValue - an item of a multi-valued attribute such as emails,
+// groups or members
+type SCIMValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMMeta - the metadata of a SCIM resource
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location,omitempty"`
+}
+
+// SCIMUser - a user as a SCIM User resource, Active is the statusc of
+// the user
+type SCIMUser struct {
+	Schemas  []string    `json:"schemas"`
+	ID       string      `json:"id,omitempty"`
+	UserName string      `json:"userName"`
+	Name     SCIMName    `json:"name"`
+	Emails   []SCIMValue `json:"emails,omitempty"`
+	Active   *bool       `json:"active,omitempty"`
+	Groups   []SCIMValue `json:"groups,omitempty"`
+	Meta     *SCIMMeta   `json:"meta,omitempty"`
+}
+
+// SCIMGroup - a ugroup as a SCIM Group resource
+type SCIMGroup struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []SCIMValue `json:"members"`
+	Meta        *SCIMMeta   `json:"meta,omitempty"`
+}
+
+// SCIMListResponse - a page of the resources matching a filter
+type SCIMListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// SCIMPatchOperation - an add, replace or remove of a PATCH request, the
+// value holds the attributes when there is no path
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// SCIMPatchOp - the body of a PATCH request
+type SCIMPatchOp struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+// The attributes users and groups can be filtered by
+var (
+	scimUserAttrs = map[string]common.SCIMAttr{
+		"id":                {Column: "uuid4", Type: common.SCIMUUID},
+		"username":          {Column: "username", Type: common.SCIMString},
+		"emails":            {Column: "email", Type: common.SCIMString},
+		"emails.value":      {Column: "email", Type: common.SCIMString},
+		"name.givenname":    {Column: "first_name", Type: common.SCIMString},
+		"name.familyname":   {Column: "last_name", Type: common.SCIMString},
+		"active":            {Column: "statusc", Type: common.SCIMBool},
+		"meta.created":      {Column: "created_at", Type: common.SCIMTime},
+		"meta.lastmodified": {Column: "updated_at", Type: common.SCIMTime},
+	}
+	scimGroupAttrs = map[string]common.SCIMAttr{
+		"id":                {Column: "uuid4", Type: common.SCIMUUID},
+		"displayname":       {Column: "ugroup_name", Type: common.SCIMString},
+		"meta.created":      {Column: "created_at", Type: common.SCIMTime},
+		"meta.lastmodified": {Column: "updated_at", Type: common.SCIMTime},
+	}
+)
+
+// scimMemberPath - a path such as members[value eq "id"] naming a member
+var scimMemberPath = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]*)"\s*\]$`)
+
+// SCIMServiceIntf - interface for SCIM Service
+type SCIMServiceIntf interface {
+	GetSCIMUsers(ctx context.Context, filter string, startIndex int, count int, requestID string) (*SCIMListResponse, error)
+	GetSCIMUser(ctx context.Context, ID string, requestID string) (*SCIMUser, error)
+	CreateSCIMUser(ctx context.Context, form *SCIMUser, requestID string) (*SCIMUser, error)
+	ReplaceSCIMUser(ctx context.Context, ID string, form *SCIMUser, requestID string) (*SCIMUser, error)
+	PatchSCIMUser(ctx context.Context, ID string, form *SCIMPatchOp, requestID string) (*SCIMUser, error)
+	DeleteSCIMUser(ctx context.Context, ID string, requestID string) error
+	GetSCIMGroups(ctx context.Context, filter string, startIndex int, count int, requestID string) (*SCIMListResponse, error)
+	GetSCIMGroup(ctx context.Context, ID string, requestID string) (*SCIMGroup, error)
+	CreateSCIMGroup(ctx context.Context, form *SCIMGroup, requestID string) (*SCIMGroup, error)
+	ReplaceSCIMGroup(ctx context.Context, ID string, form *SCIMGroup, requestID string) (*SCIMGroup, error)
+	PatchSCIMGroup(ctx context.Context, ID string, form *SCIMPatchOp, requestID string) (*SCIMGroup, error)
+	DeleteSCIMGroup(ctx context.Context, ID string, requestID string) error
+}
+
+// SCIMService - For provisioning users and ugroups from an identity
+// provider with SCIM 2.0
+type SCIMService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+	UserOptions  *common.UserOptions
+}
+
+// NewSCIMService - Create SCIM Service
+func NewSCIMService(dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions) *SCIMService {
+	return &SCIMService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+		UserOptions:  userOpt,
+	}
+}
+
+// scimPage - the offset and limit of a page, startIndex counts from 1
+func scimPage(startIndex int, count int) (int, int) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > SCIMMaxCount {
+		count = SCIMMaxCount
+	}
+	return startIndex, count
+}
+
+// GetSCIMUsers - Get the users matching the filter
+func (s *SCIMService) GetSCIMUsers(ctx context.Context, filter string, startIndex int, count int, requestID string) (*SCIMListResponse, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14800}).Error(err)
+		return nil, err
+	default:
+		cond, args, err := common.SCIMFilterSQL(filter, scimUserAttrs)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14801}).Error(err)
+			return nil, scimBadRequest("invalidFilter", err.Error())
+		}
+		startIndex, count = scimPage(startIndex, count)
+		resp := SCIMListResponse{Schemas: []string{SCIMSchemaListResponse}, StartIndex: startIndex, Resources: []interface{}{}}
+		db := s.DBService.DB
+		err = db.QueryRowContext(ctx, `select count(*) from users where `+cond+`;`, args...).Scan(&resp.TotalResults)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14802}).Error(err)
+			return nil, err
+		}
+		rows, err := db.QueryContext(ctx, `select id, uuid4, email, username, first_name, last_name, statusc, created_at, updated_at from users where `+cond+` order by id limit ? offset ?;`, append(args, count, startIndex-1)...)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14803}).Error(err)
+			return nil, err
+		}
+		users := []*SCIMUser{}
+		userIDs := []uint{}
+		for rows.Next() {
+			var userID uint
+			user, err := scanSCIMUser(rows, &userID)
+			if err != nil {
+				log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14804}).Error(err)
+				_ = rows.Close()
+				return nil, err
+			}
+			users = append(users, user)
+			userIDs = append(userIDs, userID)
+		}
+		err = rows.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14805}).Error(err)
+			return nil, err
+		}
+		if err = rows.Err(); err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14806}).Error(err)
+			return nil, err
+		}
+		for i, user := range users {
+			user.Groups, err = s.userGroups(ctx, userIDs[i])
+			if err != nil {
+				log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14807}).Error(err)
+				return nil, err
+			}
+			resp.Resources = append(resp.Resources, user)
+		}
+		resp.ItemsPerPage = len(resp.Resources)
+		return &resp, nil
+	}
+}
+
+type scimScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSCIMUser - the user of a row of id, uuid4, email, username,
+// first_name, last_name, statusc, created_at and updated_at
+func scanSCIMUser(row scimScanner, userID *uint) (*SCIMUser, error) {
+	var uuid4 []byte
+	var email string
+	var statusc uint
+	meta := SCIMMeta{ResourceType: "User"}
+	user := SCIMUser{Schemas: []string{SCIMSchemaUser}, Meta: &meta}
+	err := row.Scan(userID, &uuid4, &email, &user.UserName, &user.Name.GivenName, &user.Name.FamilyName, &statusc, &meta.Created, &meta.LastModified)
+	if err != nil {
+		return nil, err
+	}
+	user.ID, err = common.UUIDBytesToStr(uuid4)
+	if err != nil {
+		return nil, err
+	}
+	user.Emails = []SCIMValue{{Value: email, Primary: true}}
+	active := statusc == common.Active
+	user.Active = &active
+	return &user, nil
+}
+
+// userGroups - the active ugroups the user is an active member of
+func (s *SCIMService) userGroups(ctx context.Context, userID uint) ([]SCIMValue, error) {
+	rows, err := s.DBService.DB.QueryContext(ctx, `select g.uuid4, g.ugroup_name from ugroups_users gu inner join ugroups g on (gu.ugroup_id = g.id) where gu.user_id = ? and gu.statusc = ? and g.statusc = ? order by g.id;`, userID, common.Active, common.Active)
+	if err != nil {
+		return nil, err
+	}
+	return scanSCIMValues(rows)
+}
+
+// scanSCIMValues - the values of rows of uuid4 and display
+func scanSCIMValues(rows *sql.Rows) ([]SCIMValue, error) {
+	values := []SCIMValue{}
+	for rows.Next() {
+		var uuid4 []byte
+		value := SCIMValue{}
+		err := rows.Scan(&uuid4, &value.Display)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		value.Value, err = common.UUIDBytesToStr(uuid4)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	err := rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	return values, rows.Err()
+}
+
+// getSCIMUser - the user and its ID
+func (s *SCIMService) getSCIMUser(ctx context.Context, ID string, requestID string) (*SCIMUser, uint, error) {
+	uuid4byte, err := common.UUIDStrToBytes(ID)
+	if err != nil {
+		return nil, 0, errSCIMNotFound
+	}
+	var userID uint
+	row := s.DBService.DB.QueryRowContext(ctx, `select id, uuid4, email, username, first_name, last_name, statusc, created_at, updated_at from users where uuid4 = ?;`, uuid4byte)
+	user, err := scanSCIMUser(row, &userID)
+	if err == sql.ErrNoRows {
+		return nil, 0, errSCIMNotFound
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14808}).Error(err)
+		return nil, 0, err
+	}
+	user.Groups, err = s.userGroups(ctx, userID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14809}).Error(err)
+		return nil, 0, err
+	}
+	return user, userID, nil
+}
+
+// GetSCIMUser - Get the user
+func (s *SCIMService) GetSCIMUser(ctx context.Context, ID string, requestID string) (*SCIMUser, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14810}).Error(err)
+		return nil, err
+	default:
+		user, _, err := s.getSCIMUser(ctx, ID, requestID)
+		return user, err
+	}
+}
+
+// scimEmail - the primary email of the user, the userName when it has no
+// emails and is an email
+func scimEmail(user *SCIMUser) string {
+	for _, e := range user.Emails {
+		if e.Primary && e.Value != "" {
+			return e.Value
+		}
+	}
+	for _, e := range user.Emails {
+		if e.Value != "" {
+			return e.Value
+		}
+	}
+	if strings.Contains(user.UserName, "@") {
+		return user.UserName
+	}
+	return ""
+}
+
+// validateSCIMUser - the email of the user after checking the attributes
+// vilom requires
+func validateSCIMUser(user *SCIMUser) (string, error) {
+	if strings.TrimSpace(user.UserName) == "" {
+		return "", scimBadRequest("invalidValue", "userName is required")
+	}
+	email := scimEmail(user)
+	if email == "" {
+		return "", scimBadRequest("invalidValue", "An email is required")
+	}
+	v := common.NewValidator()
+	v.IsEmail("Email", email)
+	if v.IsValid() {
+		return "", scimBadRequest("invalidValue", v.Error())
+	}
+	return email, nil
+}
+
+// emailTaken - whether another user than userID has the email
+func (s *SCIMService) emailTaken(ctx context.Context, tx *sql.Tx, email string, userID uint) (bool, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, `select count(*) from users where email = ? and id <> ?;`, email, userID).Scan(&count)
+	return count > 0, err
+}
+
+// CreateSCIMUser - Provision a user, the identity provider vouches for
+// the email so no confirmation is sent
+func (s *SCIMService) CreateSCIMUser(ctx context.Context, form *SCIMUser, requestID string) (*SCIMUser, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14811}).Error(err)
+		return nil, err
+	default:
+		email, err := validateSCIMUser(form)
+		if err != nil {
+			return nil, err
+		}
+		firstName := form.Name.GivenName
+		if firstName == "" {
+			firstName = email[:strings.Index(email, "@")]
+		}
+		// the local password is random, the user signs in through the
+		// identity provider or resets it
+		_, _, password, err := common.GenTokenHash(requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14812}).Error(err)
+			return nil, err
+		}
+		userserv := &UserService{DBService: s.DBService, RedisService: s.RedisService, UserOptions: s.UserOptions}
+		user, err := userserv.newUser(&User{Email: email, FirstName: firstName, LastName: form.Name.FamilyName, PasswordS: password}, s.UserOptions.DefaultRole, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14813}).Error(err)
+			return nil, err
+		}
+		user.Username = form.UserName
+		user.Active = true
+		if form.Active != nil && !*form.Active {
+			user.Statusc = common.Inactive
+		}
+
+		insertUserStmt, err := userserv.insertUserPrepare(ctx, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14814}).Error(err)
+			return nil, err
+		}
+		defer insertUserStmt.Close()
+		tx, err := s.DBService.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14815}).Error(err)
+			return nil, err
+		}
+		taken, err := s.emailTaken(ctx, tx, email, 0)
+		if err == nil && taken {
+			err = &SCIMError{Status: http.StatusConflict, SCIMType: "uniqueness", Detail: "A user with the email already exists"}
+		}
+		if err == nil {
+			err = userserv.insertUser(ctx, insertUserStmt, tx, user, "", requestID)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14816}).Error(err)
+			_ = tx.Rollback()
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14817}).Error(err)
+			return nil, err
+		}
+		log.WithFields(log.Fields{"user": scimActor, "reqid": requestID, "msgnum": 14818}).Info("SCIM provisioned user " + user.IDS)
+		return s.GetSCIMUser(ctx, user.IDS, requestID)
+	}
+}
+
+// ReplaceSCIMUser - Replace the attributes of the user
+func (s *SCIMService) ReplaceSCIMUser(ctx context.Context, ID string, form *SCIMUser, requestID string) (*SCIMUser, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14819}).Error(err)
+		return nil, err
+	default:
+		current, userID, err := s.getSCIMUser(ctx, ID, requestID)
+		if err != nil {
+			return nil, err
+		}
+		if form.Active == nil {
+			form.Active = current.Active
+		}
+		err = s.saveSCIMUser(ctx, current, userID, form, requestID)
+		if err != nil {
+			return nil, err
+		}
+		return s.GetSCIMUser(ctx, ID, requestID)
+	}
+}
+
+// PatchSCIMUser - Apply the operations to the user
+func (s *SCIMService) PatchSCIMUser(ctx context.Context, ID string, form *SCIMPatchOp, requestID string) (*SCIMUser, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14820}).Error(err)
+		return nil, err
+	default:
+		current, userID, err := s.getSCIMUser(ctx, ID, requestID)
+		if err != nil {
+			return nil, err
+		}
+		user := *current
+		active := *current.Active
+		user.Active = &active
+		user.Emails = append([]SCIMValue{}, current.Emails...)
+		for _, op := range form.Operations {
+			err = patchSCIMUser(&user, op)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = s.saveSCIMUser(ctx, current, userID, &user, requestID)
+		if err != nil {
+			return nil, err
+		}
+		return s.GetSCIMUser(ctx, ID, requestID)
+	}
+}
+
+// scimPatchOp - the operation in lower case, the path and whether the
+// operation removes
+func scimPatchOp(op SCIMPatchOperation) (string, string, error) {
+	name := strings.ToLower(op.Op)
+	if name != "add" && name != "replace" && name != "remove" {
+		return "", "", scimBadRequest("invalidSyntax", "Unknown operation "+op.Op)
+	}
+	if name == "remove" && op.Path == "" {
+		return "", "", scimBadRequest("noTarget", "remove needs a path")
+	}
+	if name != "remove" && len(op.Value) == 0 {
+		return "", "", scimBadRequest("invalidValue", op.Op+" needs a value")
+	}
+	return name, op.Path, nil
+}
+
+// patchSCIMUser - apply the operation to the user
+func patchSCIMUser(user *SCIMUser, op SCIMPatchOperation) error {
+	name, path, err := scimPatchOp(op)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		attrs := map[string]json.RawMessage{}
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return scimBadRequest("invalidValue", "The value must be an object of attributes")
+		}
+		for attr, value := range attrs {
+			if err := setSCIMUserAttr(user, common.SCIMAttrName(attr), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if name == "remove" {
+		return setSCIMUserAttr(user, common.SCIMAttrName(path), nil)
+	}
+	return setSCIMUserAttr(user, common.SCIMAttrName(path), op.Value)
+}
+
+// setSCIMUserAttr - set the attribute of the user, a nil value removes
+// it; attributes vilom does not store are ignored
+func setSCIMUserAttr(user *SCIMUser, attr string, value json.RawMessage) error {
+	invalid := scimBadRequest("invalidValue", "Invalid value of "+attr)
+	str := func() (string, error) {
+		var s string
+		if value == nil {
+			return "", nil
+		}
+		if err := json.Unmarshal(value, &s); err != nil {
+			return "", invalid
+		}
+		return s, nil
+	}
+	switch attr {
+	case "username":
+		s, err := str()
+		if err != nil || s == "" {
+			return invalid
+		}
+		user.UserName = s
+	case "name":
+		name := SCIMName{}
+		if value != nil {
+			if err := json.Unmarshal(value, &name); err != nil {
+				return invalid
+			}
+		}
+		user.Name = name
+	case "name.givenname":
+		s, err := str()
+		if err != nil {
+			return err
+		}
+		user.Name.GivenName = s
+	case "name.familyname":
+		s, err := str()
+		if err != nil {
+			return err
+		}
+		user.Name.FamilyName = s
+	case "emails":
+		emails := []SCIMValue{}
+		if value == nil || json.Unmarshal(value, &emails) != nil {
+			return invalid
+		}
+		user.Emails = emails
+	case "emails.value":
+		s, err := str()
+		if err != nil || s == "" {
+			return invalid
+		}
+		user.Emails = []SCIMValue{{Value: s, Primary: true}}
+	case "active":
+		// some identity providers send the boolean as a string
+		var active interface{}
+		if value == nil || json.Unmarshal(value, &active) != nil {
+			return invalid
+		}
+		switch v := active.(type) {
+		case bool:
+			user.Active = &v
+		case string:
+			b := strings.EqualFold(v, "true")
+			if !b && !strings.EqualFold(v, "false") {
+				return invalid
+			}
+			user.Active = &b
+		default:
+			return invalid
+		}
+	}
+	return nil
+}
+
+// saveSCIMUser - store the attributes of the user, a deactivated user is
+// deleted with UserService and so signed out everywhere, a user whose
+// email changes is signed out too
+func (s *SCIMService) saveSCIMUser(ctx context.Context, current *SCIMUser, userID uint, user *SCIMUser, requestID string) error {
+	email, err := validateSCIMUser(user)
+	if err != nil {
+		return err
+	}
+	firstName := user.Name.GivenName
+	if firstName == "" {
+		firstName = email[:strings.Index(email, "@")]
+	}
+	// a replace without active keeps the user as it is
+	active := *current.Active
+	if user.Active != nil {
+		active = *user.Active
+	}
+	statusc := common.Inactive
+	if *current.Active {
+		statusc = common.Active
+	}
+	if active {
+		statusc = common.Active
+	}
+
+	tx, err := s.DBService.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14821}).Error(err)
+		return err
+	}
+	taken, err := s.emailTaken(ctx, tx, email, userID)
+	if err == nil && taken {
+		err = &SCIMError{Status: http.StatusConflict, SCIMType: "uniqueness", Detail: "A user with the email already exists"}
+	}
+	if err == nil {
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		_, err = tx.ExecContext(ctx, `update users set
+		  email = ?,
+			username = ?,
+			first_name = ?,
+			last_name = ?,
+			statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where id = ?;`,
+			email, user.UserName, firstName, user.Name.FamilyName, statusc, tn, tnday, tnweek, tnmonth, tnyear, userID)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14822}).Error(err)
+		_ = tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14823}).Error(err)
+		return err
+	}
+	log.WithFields(log.Fields{"user": scimActor, "reqid": requestID, "msgnum": 14824}).Info("SCIM updated user " + current.ID)
+
+	if !active && *current.Active {
+		return s.deactivateSCIMUser(ctx, current.ID, requestID)
+	}
+	if email != scimEmail(current) {
+		sessserv := &SessionService{DBService: s.DBService, RedisService: s.RedisService}
+		err = sessserv.ForceLogout(ctx, current.ID, scimActor, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14825}).Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// deactivateSCIMUser - set the statusc of the user inactive and sign it
+// out everywhere
+func (s *SCIMService) deactivateSCIMUser(ctx context.Context, ID string, requestID string) error {
+	userserv := &UserService{DBService: s.DBService, RedisService: s.RedisService, UserOptions: s.UserOptions}
+	err := userserv.DeleteUser(ctx, ID, scimActor, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14826}).Error(err)
+		return err
+	}
+	log.WithFields(log.Fields{"user": scimActor, "reqid": requestID, "msgnum": 14827}).Info("SCIM deactivated user " + ID)
+	return nil
+}
+
+// DeleteSCIMUser - Deactivate the user, vilom keeps the users that wrote
+// messages so a deleted user stays with active false
+func (s *SCIMService) DeleteSCIMUser(ctx context.Context, ID string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14828}).Error(err)
+		return err
+	default:
+		_, _, err := s.getSCIMUser(ctx, ID, requestID)
+		if err != nil {
+			return err
+		}
+		return s.deactivateSCIMUser(ctx, ID, requestID)
+	}
+}
+
+// GetSCIMGroups - Get the active ugroups matching the filter
+func (s *SCIMService) GetSCIMGroups(ctx context.Context, filter string, startIndex int, count int, requestID string) (*SCIMListResponse, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14840}).Error(err)
+		return nil, err
+	default:
+		cond, args, err := common.SCIMFilterSQL(filter, scimGroupAttrs)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14841}).Error(err)
+			return nil, scimBadRequest("invalidFilter", err.Error())
+		}
+		args = append([]interface{}{common.Active}, args...)
+		startIndex, count = scimPage(startIndex, count)
+		resp := SCIMListResponse{Schemas: []string{SCIMSchemaListResponse}, StartIndex: startIndex, Resources: []interface{}{}}
+		db := s.DBService.DB
+		err = db.QueryRowContext(ctx, `select count(*) from ugroups where statusc = ? and `+cond+`;`, args...).Scan(&resp.TotalResults)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14842}).Error(err)
+			return nil, err
+		}
+		rows, err := db.QueryContext(ctx, `select id, uuid4, ugroup_name, created_at, updated_at from ugroups where statusc = ? and `+cond+` order by id limit ? offset ?;`, append(args, count, startIndex-1)...)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14843}).Error(err)
+			return nil, err
+		}
+		groups := []*SCIMGroup{}
+		groupIDs := []uint{}
+		for rows.Next() {
+			var groupID uint
+			group, err := scanSCIMGroup(rows, &groupID)
+			if err != nil {
+				log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14844}).Error(err)
+				_ = rows.Close()
+				return nil, err
+			}
+			groups = append(groups, group)
+			groupIDs = append(groupIDs, groupID)
+		}
+		err = rows.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14845}).Error(err)
+			return nil, err
+		}
+		if err = rows.Err(); err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14846}).Error(err)
+			return nil, err
+		}
+		for i, group := range groups {
+			group.Members, err = s.groupMembers(ctx, groupIDs[i])
+			if err != nil {
+				log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14847}).Error(err)
+				return nil, err
+			}
+			resp.Resources = append(resp.Resources, group)
+		}
+		resp.ItemsPerPage = len(resp.Resources)
+		return &resp, nil
+	}
+}
+
+// scanSCIMGroup - the group of a row of id, uuid4, ugroup_name,
+// created_at and updated_at
+func scanSCIMGroup(row scimScanner, groupID *uint) (*SCIMGroup, error) {
+	var uuid4 []byte
+	meta := SCIMMeta{ResourceType: "Group"}
+	group := SCIMGroup{Schemas: []string{SCIMSchemaGroup}, Meta: &meta}
+	err := row.Scan(groupID, &uuid4, &group.DisplayName, &meta.Created, &meta.LastModified)
+	if err != nil {
+		return nil, err
+	}
+	group.ID, err = common.UUIDBytesToStr(uuid4)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// groupMembers - the active members of the ugroup
+func (s *SCIMService) groupMembers(ctx context.Context, groupID uint) ([]SCIMValue, error) {
+	rows, err := s.DBService.DB.QueryContext(ctx, `select u.uuid4, u.email from ugroups_users gu inner join users u on (gu.user_id = u.id) where gu.ugroup_id = ? and gu.statusc = ? order by u.id;`, groupID, common.Active)
+	if err != nil {
+		return nil, err
+	}
+	return scanSCIMValues(rows)
+}
+
+// getSCIMGroup - the active ugroup and its ID
+func (s *SCIMService) getSCIMGroup(ctx context.Context, ID string, requestID string) (*SCIMGroup, uint, error) {
+	uuid4byte, err := common.UUIDStrToBytes(ID)
+	if err != nil {
+		return nil, 0, errSCIMNotFound
+	}
+	var groupID uint
+	row := s.DBService.DB.QueryRowContext(ctx, `select id, uuid4, ugroup_name, created_at, updated_at from ugroups where uuid4 = ? and statusc = ?;`, uuid4byte, common.Active)
+	group, err := scanSCIMGroup(row, &groupID)
+	if err == sql.ErrNoRows {
+		return nil, 0, errSCIMNotFound
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14848}).Error(err)
+		return nil, 0, err
+	}
+	group.Members, err = s.groupMembers(ctx, groupID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14849}).Error(err)
+		return nil, 0, err
+	}
+	return group, groupID, nil
+}
+
+// GetSCIMGroup - Get the ugroup
+func (s *SCIMService) GetSCIMGroup(ctx context.Context, ID string, requestID string) (*SCIMGroup, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14850}).Error(err)
+		return nil, err
+	default:
+		group, _, err := s.getSCIMGroup(ctx, ID, requestID)
+		return group, err
+	}
+}
+
+// validateSCIMGroup - check the attributes vilom requires
+func validateSCIMGroup(group *SCIMGroup) error {
+	name := strings.TrimSpace(group.DisplayName)
+	if len(name) < UgroupNameLenMin || len(name) > UgroupNameLenMax {
+		return scimBadRequest("invalidValue", "displayName must have 1 to 50 characters")
+	}
+	return nil
+}
+
+// memberIDs - the IDs of the member users
+func (s *SCIMService) memberIDs(ctx context.Context, tx *sql.Tx, members []SCIMValue) ([]uint, error) {
+	userIDs := []uint{}
+	for _, m := range members {
+		uuid4byte, err := common.UUIDStrToBytes(m.Value)
+		if err != nil {
+			return nil, scimBadRequest("invalidValue", "Unknown member "+m.Value)
+		}
+		var userID uint
+		err = tx.QueryRowContext(ctx, `select id from users where uuid4 = ?;`, uuid4byte).Scan(&userID)
+		if err == sql.ErrNoRows {
+			return nil, scimBadRequest("invalidValue", "Unknown member "+m.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
+}
+
+// CreateSCIMGroup - Create a top level ugroup with the members
+func (s *SCIMService) CreateSCIMGroup(ctx context.Context, form *SCIMGroup, requestID string) (*SCIMGroup, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14851}).Error(err)
+		return nil, err
+	default:
+		err := validateSCIMGroup(form)
+		if err != nil {
+			return nil, err
+		}
+		ugroupService := &UgroupService{DBService: s.DBService, RedisService: s.RedisService, UserOptions: s.UserOptions}
+		insertUgroupStmt, err := ugroupService.insertUgroupPrepare(ctx, scimActor, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14852}).Error(err)
+			return nil, err
+		}
+		defer insertUgroupStmt.Close()
+
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		ug := Ugroup{}
+		ug.UUID4, err = common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14853}).Error(err)
+			return nil, err
+		}
+		ug.UgroupName = strings.TrimSpace(form.DisplayName)
+		ug.UgroupDesc = ug.UgroupName
+		ug.Statusc = common.Active
+		ug.CreatedAt = tn
+		ug.UpdatedAt = tn
+		ug.CreatedDay = tnday
+		ug.CreatedWeek = tnweek
+		ug.CreatedMonth = tnmonth
+		ug.CreatedYear = tnyear
+		ug.UpdatedDay = tnday
+		ug.UpdatedWeek = tnweek
+		ug.UpdatedMonth = tnmonth
+		ug.UpdatedYear = tnyear
+
+		tx, err := s.DBService.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14854}).Error(err)
+			return nil, err
+		}
+		userIDs, err := s.memberIDs(ctx, tx, form.Members)
+		if err == nil {
+			err = ugroupService.insertUgroup(ctx, insertUgroupStmt, tx, &ug, scimActor, requestID)
+		}
+		if err == nil {
+			err = ugroupService.setUgroupUsers(ctx, tx, ug.ID, userIDs, requestID)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14855}).Error(err)
+			_ = tx.Rollback()
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14856}).Error(err)
+			return nil, err
+		}
+		ugroupService.invalidateMembers(requestID)
+		log.WithFields(log.Fields{"user": scimActor, "reqid": requestID, "msgnum": 14857}).Info("SCIM created group " + ug.IDS)
+		return s.GetSCIMGroup(ctx, ug.IDS, requestID)
+	}
+}
+
+// ReplaceSCIMGroup - Replace the name and members of the ugroup
+func (s *SCIMService) ReplaceSCIMGroup(ctx context.Context, ID string, form *SCIMGroup, requestID string) (*SCIMGroup, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14858}).Error(err)
+		return nil, err
+	default:
+		_, groupID, err := s.getSCIMGroup(ctx, ID, requestID)
+		if err != nil {
+			return nil, err
+		}
+		err = s.saveSCIMGroup(ctx, ID, groupID, form, requestID)
+		if err != nil {
+			return nil, err
+		}
+		return s.GetSCIMGroup(ctx, ID, requestID)
+	}
+}
+
+// PatchSCIMGroup - Apply the operations to the ugroup
+func (s *SCIMService) PatchSCIMGroup(ctx context.Context, ID string, form *SCIMPatchOp, requestID string) (*SCIMGroup, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14859}).Error(err)
+		return nil, err
+	default:
+		group, groupID, err := s.getSCIMGroup(ctx, ID, requestID)
+		if err != nil {
+			return nil, err
+		}
+		for _, op := range form.Operations {
+			err = patchSCIMGroup(group, op)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = s.saveSCIMGroup(ctx, ID, groupID, group, requestID)
+		if err != nil {
+			return nil, err
+		}
+		return s.GetSCIMGroup(ctx, ID, requestID)
+	}
+}
+
+// patchSCIMGroup - apply the operation to the group, members are added
+// and removed by their value
+func patchSCIMGroup(group *SCIMGroup, op SCIMPatchOperation) error {
+	name, path, err := scimPatchOp(op)
+	if err != nil {
+		return err
+	}
+	if m := scimMemberPath.FindStringSubmatch(path); m != nil {
+		if name != "remove" {
+			return scimBadRequest("invalidPath", "Only remove can name a member")
+		}
+		group.Members = withoutSCIMMembers(group.Members, []SCIMValue{{Value: m[1]}})
+		return nil
+	}
+	attrs := map[string]json.RawMessage{}
+	if path == "" {
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return scimBadRequest("invalidValue", "The value must be an object of attributes")
+		}
+	} else {
+		attrs[path] = op.Value
+	}
+	for attr, value := range attrs {
+		switch common.SCIMAttrName(attr) {
+		case "displayname":
+			if name == "remove" || json.Unmarshal(value, &group.DisplayName) != nil {
+				return scimBadRequest("invalidValue", "Invalid value of displayName")
+			}
+		case "members":
+			members := []SCIMValue{}
+			if len(value) != 0 {
+				if err := json.Unmarshal(value, &members); err != nil {
+					return scimBadRequest("invalidValue", "Invalid value of members")
+				}
+			}
+			switch name {
+			case "add":
+				group.Members = append(withoutSCIMMembers(group.Members, members), members...)
+			case "replace":
+				group.Members = members
+			case "remove":
+				// a remove without a value removes all the members
+				if len(value) == 0 {
+					group.Members = []SCIMValue{}
+				} else {
+					group.Members = withoutSCIMMembers(group.Members, members)
+				}
+			}
+		default:
+			if path != "" {
+				return scimBadRequest("invalidPath", "Unknown attribute "+path)
+			}
+		}
+	}
+	return nil
+}
+
+// withoutSCIMMembers - the members not in removed
+func withoutSCIMMembers(members []SCIMValue, removed []SCIMValue) []SCIMValue {
+	drop := map[string]bool{}
+	for _, m := range removed {
+		drop[strings.ToLower(m.Value)] = true
+	}
+	kept := []SCIMValue{}
+	for _, m := range members {
+		if !drop[strings.ToLower(m.Value)] {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// saveSCIMGroup - store the name and members of the ugroup
+func (s *SCIMService) saveSCIMGroup(ctx context.Context, ID string, groupID uint, group *SCIMGroup, requestID string) error {
+	err := validateSCIMGroup(group)
+	if err != nil {
+		return err
+	}
+	tx, err := s.DBService.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14860}).Error(err)
+		return err
+	}
+	userIDs, err := s.memberIDs(ctx, tx, group.Members)
+	if err == nil {
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		_, err = tx.ExecContext(ctx, `update ugroups set
+		  ugroup_name = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where id = ?;`,
+			strings.TrimSpace(group.DisplayName), tn, tnday, tnweek, tnmonth, tnyear, groupID)
+	}
+	ugroupService := &UgroupService{DBService: s.DBService, RedisService: s.RedisService, UserOptions: s.UserOptions}
+	if err == nil {
+		err = ugroupService.setUgroupUsers(ctx, tx, groupID, userIDs, requestID)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14861}).Error(err)
+		_ = tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14862}).Error(err)
+		return err
+	}
+	ugroupService.invalidateMembers(requestID)
+	log.WithFields(log.Fields{"user": scimActor, "reqid": requestID, "msgnum": 14863}).Info("SCIM updated group " + ID)
+	return nil
+}
+
+// DeleteSCIMGroup - Delete the ugroup
+func (s *SCIMService) DeleteSCIMGroup(ctx context.Context, ID string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14864}).Error(err)
+		return err
+	default:
+		_, _, err := s.getSCIMGroup(ctx, ID, requestID)
+		if err != nil {
+			return err
+		}
+		ugroupService := &UgroupService{DBService: s.DBService, RedisService: s.RedisService, UserOptions: s.UserOptions}
+		err = ugroupService.DeleteUgroup(ctx, ID, scimActor, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14865}).Error(err)
+			return err
+		}
+		log.WithFields(log.Fields{"user": scimActor, "reqid": requestID, "msgnum": 14866}).Info("SCIM deleted group " + ID)
+		return nil
+	}
+}
@@ -0,0 +1,119 @@
+package userservices
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestSCIMService_UsersAndGroups(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	requestID := "bks1m1g91jau4nkks2f0"
+	scimService := NewSCIMService(dbService, redisService, userOpt)
+
+	user, err := scimService.CreateSCIMUser(ctx, &SCIMUser{
+		UserName: "ann",
+		Name:     SCIMName{GivenName: "Ann", FamilyName: "Lee"},
+		Emails:   []SCIMValue{{Value: "ann@example.com", Primary: true}},
+	}, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !*user.Active || user.UserName != "ann" {
+		t.Errorf("SCIMService.CreateSCIMUser() = %v, want ann active", user)
+		return
+	}
+	_, err = scimService.CreateSCIMUser(ctx, &SCIMUser{UserName: "ann@example.com"}, requestID)
+	if scimErr, ok := err.(*SCIMError); !ok || scimErr.Status != 409 {
+		t.Errorf("SCIMService.CreateSCIMUser() error = %v, want a uniqueness conflict", err)
+		return
+	}
+
+	list, err := scimService.GetSCIMUsers(ctx, `userName eq "ann" and emails[value ew "@example.com"]`, 1, 10, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if list.TotalResults != 1 || list.Resources[0].(*SCIMUser).ID != user.ID {
+		t.Errorf("SCIMService.GetSCIMUsers() = %v, want ann", list)
+		return
+	}
+
+	group, err := scimService.CreateSCIMGroup(ctx, &SCIMGroup{
+		DisplayName: "eng",
+		Members:     []SCIMValue{{Value: user.ID}},
+	}, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(group.Members) != 1 || group.Members[0].Display != "ann@example.com" {
+		t.Errorf("SCIMService.CreateSCIMGroup() = %v, want ann a member", group)
+		return
+	}
+	group, err = scimService.PatchSCIMGroup(ctx, group.ID, &SCIMPatchOp{Operations: []SCIMPatchOperation{
+		{Op: "replace", Path: "displayName", Value: json.RawMessage(`"engineering"`)},
+		{Op: "remove", Path: `members[value eq "` + user.ID + `"]`},
+	}}, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if group.DisplayName != "engineering" || len(group.Members) != 0 {
+		t.Errorf("SCIMService.PatchSCIMGroup() = %v, want engineering without members", group)
+		return
+	}
+
+	// deactivation as Azure AD sends it, without a path and as a string
+	user, err = scimService.PatchSCIMUser(ctx, user.ID, &SCIMPatchOp{Operations: []SCIMPatchOperation{
+		{Op: "Replace", Value: json.RawMessage(`{"active": "False", "name.familyName": "Ray"}`)},
+	}}, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if *user.Active || user.Name.FamilyName != "Ray" {
+		t.Errorf("SCIMService.PatchSCIMUser() = %v, want ann inactive", user)
+		return
+	}
+	var statusc uint
+	err = dbService.DB.QueryRow(`select statusc from users where email = ?;`, "ann@example.com").Scan(&statusc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if statusc != common.Inactive {
+		t.Errorf("users statusc = %v, want the user deactivated", statusc)
+		return
+	}
+	// a replace without active keeps the user deactivated
+	user, err = scimService.ReplaceSCIMUser(ctx, user.ID, &SCIMUser{
+		UserName: "ann",
+		Name:     SCIMName{GivenName: "Ann", FamilyName: "Lee"},
+		Emails:   []SCIMValue{{Value: "ann@example.com", Primary: true}},
+	}, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if *user.Active {
+		t.Errorf("SCIMService.ReplaceSCIMUser() = %v, want ann still inactive", user)
+		return
+	}
+
+	_, err = scimService.GetSCIMUsers(ctx, `password eq "x"`, 1, 10, requestID)
+	if scimErr, ok := err.(*SCIMError); !ok || scimErr.SCIMType != "invalidFilter" {
+		t.Errorf("SCIMService.GetSCIMUsers() error = %v, want an invalid filter", err)
+	}
+}
@@ -0,0 +1,485 @@
+package userservices
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+/* error message range: 13900-14099 */
+
+// SessionCacheDuration - how long GetAuthUserDetails caches a session,
+// revoking a session clears its cache entry; SessionSeenInterval - how
+// often the last_seen_at of a session in use is updated
+const (
+	SessionCacheDuration = 10 * time.Minute
+	SessionSeenInterval  = 5 * time.Minute
+)
+
+// Session - a device the user is signed in on, created by Login
+type Session struct {
+	ID         uint      `json:"id,omitempty"`
+	UUID4      []byte    `json:"-"`
+	IDS        string    `json:"id_s,omitempty"`
+	UserID     uint      `json:"user_id,omitempty"`
+	Device     string    `json:"device,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+	LastSeenAt time.Time `json:"last_seen_at,omitempty"`
+	Current    bool      `json:"current"`
+
+	common.StatusDates
+}
+
+// SessionForm - used to revoke a session, or to force-logout a user
+type SessionForm struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+}
+
+// SessionServiceIntf - interface for Session Service
+type SessionServiceIntf interface {
+	GetSessions(ctx context.Context, sessionID string, userEmail string, requestID string) ([]*Session, error)
+	RevokeSession(ctx context.Context, ID string, userEmail string, requestID string) error
+	RevokeOtherSessions(ctx context.Context, sessionID string, userEmail string, requestID string) error
+	ForceLogout(ctx context.Context, userID string, userEmail string, requestID string) error
+}
+
+// SessionService - For accessing session services
+type SessionService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+}
+
+// NewSessionService - Create session service
+func NewSessionService(dbOpt *common.DBService, redisOpt *common.RedisService) *SessionService {
+	return &SessionService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+	}
+}
+
+func sessionCacheKey(sessionID string) string {
+	return "session:" + sessionID
+}
+
+func clientCertCacheKey(email string) string {
+	return "client_cert:" + email
+}
+
+func legacyTokenCacheKey(email string) string {
+	return "legacy_token:" + email
+}
+
+func sessionSeenKey(sessionID string) string {
+	return "session:seen:" + sessionID
+}
+
+// createSession - Create the session of a login
+func (ss *SessionService) createSession(ctx context.Context, session *Session, requestID string) error {
+	var err error
+	session.UUID4, err = common.GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13900}).Error(err)
+		return err
+	}
+	session.IDS, err = common.UUIDBytesToStr(session.UUID4)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13901}).Error(err)
+		return err
+	}
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	session.LastSeenAt = tn
+	session.Statusc = common.Active
+	session.CreatedAt = tn
+	session.UpdatedAt = tn
+	session.CreatedDay = tnday
+	session.CreatedWeek = tnweek
+	session.CreatedMonth = tnmonth
+	session.CreatedYear = tnyear
+	session.UpdatedDay = tnday
+	session.UpdatedWeek = tnweek
+	session.UpdatedMonth = tnmonth
+	session.UpdatedYear = tnyear
+
+	db := ss.DBService.DB
+	res, err := db.ExecContext(ctx, `insert into sessions
+	  (
+      uuid4,
+			user_id,
+			device,
+			user_agent,
+			ip,
+			expires_at,
+			last_seen_at,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?,?);`,
+		session.UUID4,
+		session.UserID,
+		session.Device,
+		session.UserAgent,
+		session.IP,
+		session.ExpiresAt,
+		session.LastSeenAt,
+		/*  StatusDates  */
+		session.Statusc,
+		session.CreatedAt,
+		session.UpdatedAt,
+		session.CreatedDay,
+		session.CreatedWeek,
+		session.CreatedMonth,
+		session.CreatedYear,
+		session.UpdatedDay,
+		session.UpdatedWeek,
+		session.UpdatedMonth,
+		session.UpdatedYear)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13902}).Error(err)
+		return err
+	}
+	sessionID, err := res.LastInsertId()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13903}).Error(err)
+		return err
+	}
+	session.ID = uint(sessionID)
+	return nil
+}
+
+// touchSession - update the last_seen_at of the session, at most once
+// every SessionSeenInterval
+func (ss *SessionService) touchSession(sessionID string, requestID string) {
+	isDue, err := ss.RedisService.RedisClient.SetNX(sessionSeenKey(sessionID), 1, SessionSeenInterval).Result()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13904}).Error(err)
+		return
+	}
+	if !isDue {
+		return
+	}
+	uuid4byte, err := common.UUIDStrToBytes(sessionID)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13905}).Error(err)
+		return
+	}
+	tn, _, _, _, _ := common.GetTimeDetails()
+	_, err = ss.DBService.DB.Exec(`update sessions set last_seen_at = ? where uuid4 = ?;`, tn, uuid4byte)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 13906}).Error(err)
+	}
+}
+
+// GetSessions - Get the active sessions of the user, sessionID is the
+// session of the request which is marked current
+func (ss *SessionService) GetSessions(ctx context.Context, sessionID string, userEmail string, requestID string) ([]*Session, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13907}).Error(err)
+		return nil, err
+	default:
+		tn, _, _, _, _ := common.GetTimeDetails()
+		db := ss.DBService.DB
+		rows, err := db.QueryContext(ctx, `select
+      s.id,
+      s.uuid4,
+      s.user_id,
+      s.device,
+      s.user_agent,
+      s.ip,
+      s.expires_at,
+      s.last_seen_at,
+      s.statusc,
+      s.created_at,
+      s.updated_at,
+      s.created_day,
+      s.created_week,
+      s.created_month,
+      s.created_year,
+      s.updated_day,
+      s.updated_week,
+      s.updated_month,
+      s.updated_year from sessions s
+      inner join users u on (u.id = s.user_id)
+      where u.email = ? and s.statusc = ? and s.expires_at > ? order by s.last_seen_at desc;`, userEmail, common.Active, tn)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13908}).Error(err)
+			return nil, err
+		}
+		sessions := []*Session{}
+		for rows.Next() {
+			session := Session{}
+			err = rows.Scan(
+				&session.ID,
+				&session.UUID4,
+				&session.UserID,
+				&session.Device,
+				&session.UserAgent,
+				&session.IP,
+				&session.ExpiresAt,
+				&session.LastSeenAt,
+				/*  StatusDates  */
+				&session.Statusc,
+				&session.CreatedAt,
+				&session.UpdatedAt,
+				&session.CreatedDay,
+				&session.CreatedWeek,
+				&session.CreatedMonth,
+				&session.CreatedYear,
+				&session.UpdatedDay,
+				&session.UpdatedWeek,
+				&session.UpdatedMonth,
+				&session.UpdatedYear)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13909}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			session.IDS, err = common.UUIDBytesToStr(session.UUID4)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13910}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			session.Current = session.IDS == sessionID
+			sessions = append(sessions, &session)
+		}
+		err = rows.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13911}).Error(err)
+			return nil, err
+		}
+		err = rows.Err()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13912}).Error(err)
+			return nil, err
+		}
+		return sessions, nil
+	}
+}
+
+// RevokeSession - Revoke a session of the user, its token stops working
+func (ss *SessionService) RevokeSession(ctx context.Context, ID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13913}).Error(err)
+		return err
+	default:
+		uuid4byte, err := common.UUIDStrToBytes(ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13914}).Error(err)
+			return err
+		}
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		db := ss.DBService.DB
+		res, err := db.ExecContext(ctx, `update sessions s
+		  inner join users u on (u.id = s.user_id) set
+		  s.statusc = ?,
+			s.updated_at = ?,
+			s.updated_day = ?,
+			s.updated_week = ?,
+			s.updated_month = ?,
+			s.updated_year = ? where s.uuid4 = ? and u.email = ? and s.statusc = ?;`,
+			common.Inactive, tn, tnday, tnweek, tnmonth, tnyear, uuid4byte, userEmail, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13915}).Error(err)
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13916}).Error(err)
+			return err
+		}
+		if n == 0 {
+			err = errors.New("Session not found")
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13917}).Error(err)
+			return err
+		}
+		err = ss.RedisService.RedisClient.Del(sessionCacheKey(ID)).Err()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13918}).Error(err)
+			return err
+		}
+		return nil
+	}
+}
+
+// RevokeOtherSessions - Revoke the sessions of the user except sessionID,
+// the session of the request
+func (ss *SessionService) RevokeOtherSessions(ctx context.Context, sessionID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13919}).Error(err)
+		return err
+	default:
+		var userID uint
+		row := ss.DBService.DB.QueryRowContext(ctx, `select id from users where email = ?;`, userEmail)
+		err := row.Scan(&userID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13920}).Error(err)
+			return err
+		}
+		return ss.revokeUserSessions(ctx, userID, sessionID, userEmail, requestID)
+	}
+}
+
+// ForceLogout - Revoke all the sessions of the user userID, used by
+// site admins to sign a user out everywhere
+func (ss *SessionService) ForceLogout(ctx context.Context, userID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13921}).Error(err)
+		return err
+	default:
+		var role string
+		row := ss.DBService.DB.QueryRowContext(ctx, `select role from users where email = ? and statusc = ?;`, userEmail, common.Active)
+		err := row.Scan(&role)
+		if err == nil && role != common.SiteAdminRole {
+			err = errors.New("Only site admins can sign other users out")
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13933}).Error(err)
+			return err
+		}
+		return ss.signOutUser(ctx, userID, userEmail, requestID)
+	}
+}
+
+// signOutUser - Revoke all the sessions and API tokens of the user userID
+// and clear the cached logins of the user
+func (ss *SessionService) signOutUser(ctx context.Context, userID string, userEmail string, requestID string) error {
+	uuid4byte, err := common.UUIDStrToBytes(userID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13922}).Error(err)
+		return err
+	}
+	var ID uint
+	var email string
+	row := ss.DBService.DB.QueryRowContext(ctx, `select id, email from users where uuid4 = ?;`, uuid4byte)
+	err = row.Scan(&ID, &email)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13923}).Error(err)
+		return err
+	}
+	// a client certificate mapped to the user is looked up again
+	err = ss.RedisService.RedisClient.Del(clientCertCacheKey(email)).Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13932}).Error(err)
+		return err
+	}
+	tokenserv := &TokenService{DBService: ss.DBService, RedisService: ss.RedisService}
+	err = tokenserv.revokeUserTokens(ctx, ID, userEmail, requestID)
+	if err != nil {
+		return err
+	}
+	return ss.revokeUserSessions(ctx, ID, "", userEmail, requestID)
+}
+
+// revokeUserSessions - Revoke the active sessions of the user userID
+// except keepSessionID, and clear them from the cache; the tokens issued
+// before sessions were recorded stop working too
+func (ss *SessionService) revokeUserSessions(ctx context.Context, userID uint, keepSessionID string, userEmail string, requestID string) error {
+	db := ss.DBService.DB
+	var email string
+	err := db.QueryRowContext(ctx, `select email from users where id = ?;`, userID).Scan(&email)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13934}).Error(err)
+		return err
+	}
+	tn, _, _, _, _ := common.GetTimeDetails()
+	_, err = db.ExecContext(ctx, `update users set tokens_valid_after = ? where id = ?;`, tn, userID)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13935}).Error(err)
+		return err
+	}
+	err = ss.RedisService.RedisClient.Del(legacyTokenCacheKey(email)).Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13936}).Error(err)
+		return err
+	}
+	rows, err := db.QueryContext(ctx, `select uuid4 from sessions where user_id = ? and statusc = ?;`, userID, common.Active)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13924}).Error(err)
+		return err
+	}
+	sessionIDs := []string{}
+	for rows.Next() {
+		var uuid4 []byte
+		err = rows.Scan(&uuid4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13925}).Error(err)
+			err = rows.Close()
+			return err
+		}
+		sessionIDS, err := common.UUIDBytesToStr(uuid4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13926}).Error(err)
+			err = rows.Close()
+			return err
+		}
+		if sessionIDS != keepSessionID {
+			sessionIDs = append(sessionIDs, sessionIDS)
+		}
+	}
+	err = rows.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13927}).Error(err)
+		return err
+	}
+	err = rows.Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13928}).Error(err)
+		return err
+	}
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	keys := []string{}
+	for _, sessionID := range sessionIDs {
+		uuid4byte, err := common.UUIDStrToBytes(sessionID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13929}).Error(err)
+			return err
+		}
+		_, err = db.ExecContext(ctx, `update sessions set
+		  statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where uuid4 = ?;`,
+			common.Inactive, tn, tnday, tnweek, tnmonth, tnyear, uuid4byte)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13930}).Error(err)
+			return err
+		}
+		keys = append(keys, sessionCacheKey(sessionID))
+	}
+	err = ss.RedisService.RedisClient.Del(keys...).Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 13931}).Error(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package userservices
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestSessionService_RevokeOtherSessions(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	authEnforcer, err := common.LoadEnforcer(dbService, roleOpt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	jwtOpt := &common.JWTOptions{JWTKey: []byte("test"), JWTDuration: 3600}
+	userService := NewUserService(dbService, redisService, nil, jwtOpt, userOpt, authEnforcer)
+	sessionService := NewSessionService(dbService, redisService)
+
+	for _, device := range []string{"laptop", "phone"} {
+		_, err = userService.Login(ctx, &LoginForm{Email: userEmail, Password: "abc1238", Device: device}, "", "Mozilla/5.0", requestID)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	sessions, err := sessionService.GetSessions(ctx, "", userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(sessions) != 2 {
+		t.Errorf("SessionService.GetSessions() got %v sessions, want 2", len(sessions))
+		return
+	}
+
+	current := sessions[0].IDS
+	err = sessionService.RevokeOtherSessions(ctx, current, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	sessions, err = sessionService.GetSessions(ctx, current, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("SessionService.GetSessions() = %v, want only the current session", sessions)
+		return
+	}
+
+	err = sessionService.RevokeSession(ctx, current, "abcd146@gmail.com", requestID)
+	if err == nil {
+		t.Errorf("SessionService.RevokeSession() error = nil, want another user's session not found")
+	}
+	err = sessionService.RevokeSession(ctx, current, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSessionService_ForceLogout(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	userID := "29ea215b-8fb3-4453-b413-81a661e44495"
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	authEnforcer, err := common.LoadEnforcer(dbService, roleOpt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	jwtOpt := &common.JWTOptions{JWTKey: []byte("test"), JWTDuration: 3600}
+	userService := NewUserService(dbService, redisService, nil, jwtOpt, userOpt, authEnforcer)
+	sessionService := NewSessionService(dbService, redisService)
+
+	_, err = userService.Login(ctx, &LoginForm{Email: userEmail, Password: "abc1238", Device: "laptop"}, "", "Mozilla/5.0", requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// co_admin, the default role of the users, cannot sign users out
+	err = sessionService.ForceLogout(ctx, userID, userEmail, requestID)
+	if err == nil {
+		t.Errorf("SessionService.ForceLogout() error = nil, want a non-admin caller refused")
+		return
+	}
+	sessions, err := sessionService.GetSessions(ctx, "", userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(sessions) != 1 {
+		t.Errorf("SessionService.GetSessions() got %v sessions, want the session kept", len(sessions))
+		return
+	}
+
+	_, err = dbService.DB.Exec(`update users set role = ? where email = ?;`, common.SiteAdminRole, userEmail)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = sessionService.ForceLogout(ctx, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	sessions, err = sessionService.GetSessions(ctx, "", userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(sessions) != 0 {
+		t.Errorf("SessionService.GetSessions() = %v, want no sessions", sessions)
+	}
+}
+
+func TestSessionService_ForceLogoutLegacyToken(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	userID := "29ea215b-8fb3-4453-b413-81a661e44495"
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+
+	authEnforcer, err := common.LoadEnforcer(dbService, roleOpt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	jwtOpt := &common.JWTOptions{JWTKey: []byte("test"), JWTDuration: 3600}
+	userService := NewUserService(dbService, redisService, nil, jwtOpt, userOpt, authEnforcer)
+	sessionService := NewSessionService(dbService, redisService)
+	_, err = dbService.DB.Exec(`update users set role = ? where email = ?;`, common.SiteAdminRole, userEmail)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// a token issued before sessions were recorded has no session and no iat
+	req := httptest.NewRequest("GET", "/v0.1/users/me/sessions", nil)
+	req = req.WithContext(context.WithValue(req.Context(), common.KeyEmailToken, common.ContextStruct{Email: userEmail, TokenString: "legacy"}))
+	_, _, err = userService.GetAuthUserDetails(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = sessionService.ForceLogout(ctx, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, _, err = userService.GetAuthUserDetails(req)
+	if err == nil {
+		t.Errorf("UserService.GetAuthUserDetails() error = nil, want the token refused after a force logout")
+	}
+}
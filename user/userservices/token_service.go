@@ -0,0 +1,410 @@
+package userservices
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+/* error message range: 14300-14499 */
+
+// APITokenSeenInterval - how often the last_used_at of a token in use is
+// updated
+const APITokenSeenInterval = 5 * time.Minute
+
+// TokenForm - used to create a personal access token, ExpiresIn is a
+// duration like "720h", the token does not expire when it is empty
+type TokenForm struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn string   `json:"expires_in"`
+}
+
+// TokenServiceIntf - interface for Token Service
+type TokenServiceIntf interface {
+	CreateToken(ctx context.Context, form *TokenForm, callerScopes []string, userEmail string, requestID string) (*APIToken, error)
+	GetTokens(ctx context.Context, userEmail string, requestID string) ([]*APIToken, error)
+	RevokeToken(ctx context.Context, ID string, userEmail string, requestID string) error
+}
+
+// TokenService - For accessing personal access token services
+type TokenService struct {
+	DBService    *common.DBService
+	RedisService *common.RedisService
+}
+
+// NewTokenService - Create token service
+func NewTokenService(dbOpt *common.DBService, redisOpt *common.RedisService) *TokenService {
+	return &TokenService{
+		DBService:    dbOpt,
+		RedisService: redisOpt,
+	}
+}
+
+func apiTokenSeenKey(hash string) string {
+	return "api_token:seen:" + hash
+}
+
+// touchAPIToken - update the last_used_at of the token, at most once
+// every APITokenSeenInterval
+func (ts *TokenService) touchAPIToken(hash string, requestID string) {
+	isDue, err := ts.RedisService.RedisClient.SetNX(apiTokenSeenKey(hash), 1, APITokenSeenInterval).Result()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14300}).Error(err)
+		return
+	}
+	if !isDue {
+		return
+	}
+	tn, _, _, _, _ := common.GetTimeDetails()
+	_, err = ts.DBService.DB.Exec(`update api_tokens set last_used_at = ? where token_hash = ?;`, tn, hash)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 14301}).Error(err)
+	}
+}
+
+// CreateToken - Create a personal access token for the user, the
+// response carries the token which is not shown again; callerScopes are
+// the scopes of the token making the request, the new token cannot have
+// more, a request without a scoped token is limited by its role only
+func (ts *TokenService) CreateToken(ctx context.Context, form *TokenForm, callerScopes []string, userEmail string, requestID string) (*APIToken, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14302}).Error(err)
+		return nil, err
+	default:
+		if strings.TrimSpace(form.Name) == "" {
+			err := errors.New("Missing name")
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14303}).Error(err)
+			return nil, err
+		}
+		if len(form.Scopes) == 0 {
+			err := errors.New("Missing scopes")
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14304}).Error(err)
+			return nil, err
+		}
+		for _, scope := range form.Scopes {
+			if !common.IsScope(scope) {
+				err := errors.New("Invalid scope " + scope)
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14305}).Error(err)
+				return nil, err
+			}
+			if len(callerScopes) > 0 && !common.HasScope(callerScopes, scope) {
+				err := errors.New("Scope " + scope + " is not granted to the token of the request")
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14325}).Error(err)
+				return nil, err
+			}
+		}
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		var expiresAt sql.NullTime
+		if form.ExpiresIn != "" {
+			duration, err := time.ParseDuration(form.ExpiresIn)
+			if err != nil || duration <= 0 {
+				err = errors.New("Invalid expires_in")
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14306}).Error(err)
+				return nil, err
+			}
+			expiresAt = sql.NullTime{Time: tn.Add(duration), Valid: true}
+		}
+
+		db := ts.DBService.DB
+		apiToken := APIToken{}
+		row := db.QueryRowContext(ctx, `select id from users where email = ? and statusc = ?;`, userEmail, common.Active)
+		err := row.Scan(&apiToken.UserID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14307}).Error(err)
+			return nil, err
+		}
+		apiToken.Token, err = genAPIToken()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14308}).Error(err)
+			return nil, err
+		}
+		apiToken.UUID4, err = common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14309}).Error(err)
+			return nil, err
+		}
+		apiToken.IDS, err = common.UUIDBytesToStr(apiToken.UUID4)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14310}).Error(err)
+			return nil, err
+		}
+		apiToken.Name = form.Name
+		apiToken.TokenHash = common.HashAPIToken(apiToken.Token)
+		apiToken.Scopes = form.Scopes
+		if expiresAt.Valid {
+			apiToken.ExpiresAt = &expiresAt.Time
+		}
+		/*  StatusDates  */
+		apiToken.Statusc = common.Active
+		apiToken.CreatedAt = tn
+		apiToken.UpdatedAt = tn
+		apiToken.CreatedDay = tnday
+		apiToken.CreatedWeek = tnweek
+		apiToken.CreatedMonth = tnmonth
+		apiToken.CreatedYear = tnyear
+		apiToken.UpdatedDay = tnday
+		apiToken.UpdatedWeek = tnweek
+		apiToken.UpdatedMonth = tnmonth
+		apiToken.UpdatedYear = tnyear
+
+		res, err := db.ExecContext(ctx, `insert into api_tokens
+	  (
+			uuid4,
+			user_id,
+			name,
+			token_hash,
+			scopes,
+			expires_at,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,
+					?,?,?,?,?,?,?);`,
+			apiToken.UUID4,
+			apiToken.UserID,
+			apiToken.Name,
+			apiToken.TokenHash,
+			strings.Join(apiToken.Scopes, ","),
+			expiresAt,
+			/*  StatusDates  */
+			apiToken.Statusc,
+			apiToken.CreatedAt,
+			apiToken.UpdatedAt,
+			apiToken.CreatedDay,
+			apiToken.CreatedWeek,
+			apiToken.CreatedMonth,
+			apiToken.CreatedYear,
+			apiToken.UpdatedDay,
+			apiToken.UpdatedWeek,
+			apiToken.UpdatedMonth,
+			apiToken.UpdatedYear)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14311}).Error(err)
+			return nil, err
+		}
+		tokenID, err := res.LastInsertId()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14312}).Error(err)
+			return nil, err
+		}
+		apiToken.ID = uint(tokenID)
+		return &apiToken, nil
+	}
+}
+
+// GetTokens - Get the personal access tokens of the user that have not
+// been revoked
+func (ts *TokenService) GetTokens(ctx context.Context, userEmail string, requestID string) ([]*APIToken, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14313}).Error(err)
+		return nil, err
+	default:
+		db := ts.DBService.DB
+		rows, err := db.QueryContext(ctx, `select
+      t.id,
+      t.uuid4,
+      t.user_id,
+      t.name,
+      t.scopes,
+      t.expires_at,
+      t.last_used_at,
+      t.statusc,
+      t.created_at,
+      t.updated_at,
+      t.created_day,
+      t.created_week,
+      t.created_month,
+      t.created_year,
+      t.updated_day,
+      t.updated_week,
+      t.updated_month,
+      t.updated_year from api_tokens t
+      inner join users u on (u.id = t.user_id)
+      where u.email = ? and t.statusc = ? order by t.id desc;`, userEmail, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14314}).Error(err)
+			return nil, err
+		}
+		apiTokens := []*APIToken{}
+		for rows.Next() {
+			apiToken := APIToken{}
+			var scopes string
+			var expiresAt, lastUsedAt sql.NullTime
+			err = rows.Scan(
+				&apiToken.ID,
+				&apiToken.UUID4,
+				&apiToken.UserID,
+				&apiToken.Name,
+				&scopes,
+				&expiresAt,
+				&lastUsedAt,
+				/*  StatusDates  */
+				&apiToken.Statusc,
+				&apiToken.CreatedAt,
+				&apiToken.UpdatedAt,
+				&apiToken.CreatedDay,
+				&apiToken.CreatedWeek,
+				&apiToken.CreatedMonth,
+				&apiToken.CreatedYear,
+				&apiToken.UpdatedDay,
+				&apiToken.UpdatedWeek,
+				&apiToken.UpdatedMonth,
+				&apiToken.UpdatedYear)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14315}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			apiToken.IDS, err = common.UUIDBytesToStr(apiToken.UUID4)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14316}).Error(err)
+				err = rows.Close()
+				return nil, err
+			}
+			if scopes != "" {
+				apiToken.Scopes = strings.Split(scopes, ",")
+			}
+			if expiresAt.Valid {
+				apiToken.ExpiresAt = &expiresAt.Time
+			}
+			if lastUsedAt.Valid {
+				apiToken.LastUsedAt = &lastUsedAt.Time
+			}
+			apiTokens = append(apiTokens, &apiToken)
+		}
+		err = rows.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14317}).Error(err)
+			return nil, err
+		}
+		err = rows.Err()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14318}).Error(err)
+			return nil, err
+		}
+		return apiTokens, nil
+	}
+}
+
+// RevokeToken - Revoke a personal access token of the user, it stops
+// working at once
+func (ts *TokenService) RevokeToken(ctx context.Context, ID string, userEmail string, requestID string) error {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14319}).Error(err)
+		return err
+	default:
+		uuid4byte, err := common.UUIDStrToBytes(ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14320}).Error(err)
+			return err
+		}
+		db := ts.DBService.DB
+		var hash string
+		row := db.QueryRowContext(ctx, `select t.token_hash from api_tokens t
+      inner join users u on (u.id = t.user_id)
+      where t.uuid4 = ? and u.email = ? and t.statusc = ?;`, uuid4byte, userEmail, common.Active)
+		err = row.Scan(&hash)
+		if err == sql.ErrNoRows {
+			err = errors.New("Token not found")
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14321}).Error(err)
+			return err
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14322}).Error(err)
+			return err
+		}
+		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+		_, err = db.ExecContext(ctx, `update api_tokens set
+		  statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where token_hash = ?;`,
+			common.Inactive, tn, tnday, tnweek, tnmonth, tnyear, hash)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14323}).Error(err)
+			return err
+		}
+		err = ts.RedisService.RedisClient.Del(apiTokenCacheKey(hash)).Err()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14324}).Error(err)
+			return err
+		}
+		return nil
+	}
+}
+
+// revokeUserTokens - Revoke the active API tokens of the user userID and
+// clear them from the cache, used when the user is signed out everywhere
+func (ts *TokenService) revokeUserTokens(ctx context.Context, userID uint, userEmail string, requestID string) error {
+	db := ts.DBService.DB
+	rows, err := db.QueryContext(ctx, `select token_hash from api_tokens where user_id = ? and statusc = ?;`, userID, common.Active)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14326}).Error(err)
+		return err
+	}
+	keys := []string{}
+	for rows.Next() {
+		var hash string
+		err = rows.Scan(&hash)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14327}).Error(err)
+			_ = rows.Close()
+			return err
+		}
+		keys = append(keys, apiTokenCacheKey(hash))
+	}
+	err = rows.Close()
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14328}).Error(err)
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	_, err = db.ExecContext(ctx, `update api_tokens set
+		  statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where user_id = ? and statusc = ?;`,
+		common.Inactive, tn, tnday, tnweek, tnmonth, tnyear, userID, common.Active)
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14329}).Error(err)
+		return err
+	}
+	err = ts.RedisService.RedisClient.Del(keys...).Err()
+	if err != nil {
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 14330}).Error(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package userservices
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestTokenService_CreateToken(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+	tokenService := NewTokenService(dbService, redisService)
+
+	_, err = tokenService.CreateToken(ctx, &TokenForm{Name: "ci", Scopes: []string{"delete:everything"}}, nil, userEmail, requestID)
+	if err == nil {
+		t.Errorf("TokenService.CreateToken() error = nil, want an invalid scope error")
+		return
+	}
+	apiToken, err := tokenService.CreateToken(ctx, &TokenForm{Name: "ci", Scopes: []string{"read:messages"}, ExpiresIn: "720h"}, nil, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if apiToken.Token == "" || apiToken.ExpiresAt == nil {
+		t.Errorf("TokenService.CreateToken() = %v, want the token and its expiry", apiToken)
+		return
+	}
+
+	apiTokens, err := tokenService.GetTokens(ctx, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(apiTokens) != 1 || apiTokens[0].Token != "" || len(apiTokens[0].Scopes) != 1 {
+		t.Errorf("TokenService.GetTokens() = %v, want the token without its secret", apiTokens)
+		return
+	}
+
+	err = tokenService.RevokeToken(ctx, apiToken.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	apiTokens, err = tokenService.GetTokens(ctx, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(apiTokens) != 0 {
+		t.Errorf("TokenService.GetTokens() got %v tokens, want 0", len(apiTokens))
+	}
+}
+
+func TestTokenService_CreateTokenScopes(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+	tokenService := NewTokenService(dbService, redisService)
+
+	// a token which may only manage tokens cannot make a wider one
+	callerScopes := []string{"write:tokens"}
+	_, err = tokenService.CreateToken(ctx, &TokenForm{Name: "wide", Scopes: []string{"admin:workspace"}}, callerScopes, userEmail, requestID)
+	if err == nil {
+		t.Errorf("TokenService.CreateToken() error = nil, want a scope the caller lacks refused")
+		return
+	}
+	_, err = tokenService.CreateToken(ctx, &TokenForm{Name: "wide", Scopes: []string{"read:tokens", "write:messages"}}, callerScopes, userEmail, requestID)
+	if err == nil {
+		t.Errorf("TokenService.CreateToken() error = nil, want a scope the caller lacks refused")
+		return
+	}
+	_, err = tokenService.CreateToken(ctx, &TokenForm{Name: "narrow", Scopes: []string{"read:tokens"}}, callerScopes, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSessionService_ForceLogoutTokens(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	userID := "29ea215b-8fb3-4453-b413-81a661e44495"
+	userEmail := "abcd145@gmail.com"
+	requestID := "bks1m1g91jau4nkks2f0"
+	tokenService := NewTokenService(dbService, redisService)
+	sessionService := NewSessionService(dbService, redisService)
+
+	apiToken, err := tokenService.CreateToken(ctx, &TokenForm{Name: "ci", Scopes: []string{"read:messages"}}, nil, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// a cached login of the token is dropped with it
+	cacheKey := apiTokenCacheKey(apiToken.TokenHash)
+	err = redisService.RedisClient.Set(cacheKey, "{}", SessionCacheDuration).Err()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = sessionService.signOutUser(ctx, userID, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	apiTokens, err := tokenService.GetTokens(ctx, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(apiTokens) != 0 {
+		t.Errorf("TokenService.GetTokens() got %v tokens, want the tokens revoked", len(apiTokens))
+	}
+	n, err := redisService.RedisClient.Exists(cacheKey).Result()
+	if err != nil || n != 0 {
+		t.Errorf("the cached login of the token was not dropped, %v %v", n, err)
+	}
+}
@@ -308,6 +308,14 @@ func (u *UbadgeService) AddUserToGroup(ctx context.Context, form *UbadgeUser, ID
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 3316}).Error(err)
 			return err
 		}
+
+		userserv := &UserService{DBService: u.DBService, RedisService: u.RedisService}
+		actor, err := userserv.GetUserByEmail(ctx, userEmail, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 12639}).Error(err)
+			return nil
+		}
+		Notify(ctx, u.DBService, u.RedisService, []*Notification{{UserID: form.UserID, Ntype: NotificationBadge, ActorID: actor.ID, UbadgeID: ubadge.ID, Ntext: ubadge.UbadgeName}}, userEmail, requestID)
 		return nil
 	}
 }
@@ -0,0 +1,282 @@
+package userservices
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudfresco/vilom/common"
+)
+
+/* error message range: 15200-15299 */
+
+// The directions membership is inherited through the ugroup tree, with up
+// the members of a ugroup count as members of all its ancestors, with down
+// the members of a ugroup count as members of all its descendants
+const (
+	UgroupInheritUp   = "up"
+	UgroupInheritDown = "down"
+)
+
+// UgroupMembersCacheDuration - how long resolved memberships are cached,
+// any change to the tree or to the memberships makes them stale at once
+const UgroupMembersCacheDuration = 10 * time.Minute
+
+// ugroupGenKey - the generation of the ugroup tree and memberships, it is
+// part of every cache key so that incrementing it drops the cache
+const ugroupGenKey = "ugroup:gen"
+
+func ugroupMembersCacheKey(gen string, inherit string, ugroupID uint) string {
+	return fmt.Sprintf("ugroup:members:%s:%s:%d", gen, inherit, ugroupID)
+}
+
+func userUgroupsCacheKey(gen string, inherit string, userID uint) string {
+	return fmt.Sprintf("ugroup:user:%s:%s:%d", gen, inherit, userID)
+}
+
+// inheritance - the configured inheritance direction, up when not set
+func (u *UgroupService) inheritance() string {
+	if u.UserOptions != nil && u.UserOptions.UgroupInheritance == UgroupInheritDown {
+		return UgroupInheritDown
+	}
+	return UgroupInheritUp
+}
+
+// invalidateMembers - drop the cached memberships after the tree or the
+// memberships changed, it is called once the change is committed
+func (u *UgroupService) invalidateMembers(requestID string) {
+	if u.RedisService == nil {
+		return
+	}
+	err := u.RedisService.RedisClient.Incr(ugroupGenKey).Err()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15200}).Error(err)
+	}
+}
+
+// cachedIDs - the ids cached under the key made by keyFn for the current
+// generation, or load them and cache them; without Redis they are loaded
+func (u *UgroupService) cachedIDs(keyFn func(gen string) string, load func() ([]uint, error), requestID string) ([]uint, error) {
+	if u.RedisService == nil {
+		return load()
+	}
+	client := u.RedisService.RedisClient
+	gen, err := client.Get(ugroupGenKey).Result()
+	if err == redis.Nil {
+		gen, err = "0", nil
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15201}).Error(err)
+		return load()
+	}
+	key := keyFn(gen)
+	resp, err := client.Get(key).Result()
+	if err == nil {
+		ids := []uint{}
+		err = json.Unmarshal([]byte(resp), &ids)
+		if err == nil {
+			return ids, nil
+		}
+	}
+	if err != redis.Nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15202}).Error(err)
+	}
+	ids, err := load()
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(ids)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15203}).Error(err)
+		return ids, nil
+	}
+	err = client.Set(key, value, UgroupMembersCacheDuration).Err()
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15204}).Error(err)
+	}
+	return ids, nil
+}
+
+// inClause - the placeholders and arguments of an in (...) condition
+func inClause(ids []uint) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", len(ids)), ","), args
+}
+
+// sortedIDs - the ids of the set in ascending order
+func sortedIDs(set map[uint]bool) []uint {
+	ids := make([]uint, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// relatedUgroups - the active ugroups walked to from ugroupIDs through
+// ugroup_chds, the ancestors or the descendants, ugroupIDs included
+func (u *UgroupService) relatedUgroups(ctx context.Context, ugroupIDs []uint, ancestors bool, requestID string) ([]uint, error) {
+	query := `select c.ugroup_chd_id from ugroup_chds c inner join ugroups g on (c.ugroup_chd_id = g.id) where c.ugroup_id in (%s) and c.statusc = ? and g.statusc = ?;`
+	if ancestors {
+		query = `select c.ugroup_id from ugroup_chds c inner join ugroups g on (c.ugroup_id = g.id) where c.ugroup_chd_id in (%s) and c.statusc = ? and g.statusc = ?;`
+	}
+	seen := map[uint]bool{}
+	result := []uint{}
+	for _, id := range ugroupIDs {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	next := result
+	for len(next) > 0 {
+		in, args := inClause(next)
+		rows, err := u.DBService.DB.QueryContext(ctx, fmt.Sprintf(query, in), append(args, common.Active, common.Active)...)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15205}).Error(err)
+			return nil, err
+		}
+		next = nil
+		for rows.Next() {
+			var id uint
+			err = rows.Scan(&id)
+			if err != nil {
+				rows.Close()
+				log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15206}).Error(err)
+				return nil, err
+			}
+			// a cycle in ugroup_chds does not loop forever
+			if !seen[id] {
+				seen[id] = true
+				next = append(next, id)
+			}
+		}
+		err = rows.Close()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15207}).Error(err)
+			return nil, err
+		}
+		result = append(result, next...)
+	}
+	return result, nil
+}
+
+// effectiveMemberIDs - the users who are members of the ugroup directly or
+// through the ugroups it inherits members from
+func (u *UgroupService) effectiveMemberIDs(ctx context.Context, ugroupID uint, requestID string) ([]uint, error) {
+	inherit := u.inheritance()
+	return u.cachedIDs(func(gen string) string {
+		return ugroupMembersCacheKey(gen, inherit, ugroupID)
+	}, func() ([]uint, error) {
+		// with up the members come from the descendants, with down from the
+		// ancestors
+		ugroupIDs, err := u.relatedUgroups(ctx, []uint{ugroupID}, inherit == UgroupInheritDown, requestID)
+		if err != nil {
+			return nil, err
+		}
+		in, args := inClause(ugroupIDs)
+		ids, err := activeIDs(ctx, u.DBService.DB, `select distinct user_id from ugroups_users where ugroup_id in (`+in+`) and statusc = ?;`, append(args, common.Active)...)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15208}).Error(err)
+			return nil, err
+		}
+		return sortedIDs(ids), nil
+	}, requestID)
+}
+
+// EffectiveUgroupIDs - the ugroups the user is a member of directly or by
+// inheritance through the ugroup tree
+func (u *UgroupService) EffectiveUgroupIDs(ctx context.Context, userID uint, requestID string) ([]uint, error) {
+	inherit := u.inheritance()
+	return u.cachedIDs(func(gen string) string {
+		return userUgroupsCacheKey(gen, inherit, userID)
+	}, func() ([]uint, error) {
+		direct, err := activeIDs(ctx, u.DBService.DB, `select gu.ugroup_id from ugroups_users gu inner join ugroups g on (gu.ugroup_id = g.id) where gu.user_id = ? and gu.statusc = ? and g.statusc = ?;`, userID, common.Active, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 15209}).Error(err)
+			return nil, err
+		}
+		if len(direct) == 0 {
+			return []uint{}, nil
+		}
+		ugroupIDs, err := u.relatedUgroups(ctx, sortedIDs(direct), inherit == UgroupInheritUp, requestID)
+		if err != nil {
+			return nil, err
+		}
+		ids := map[uint]bool{}
+		for _, id := range ugroupIDs {
+			ids[id] = true
+		}
+		return sortedIDs(ids), nil
+	}, requestID)
+}
+
+// GetUgroupMembers - Get the active members of a ugroup, with effective
+// also the members inherited through the ugroup tree
+func (u *UgroupService) GetUgroupMembers(ctx context.Context, ID string, effective bool, userEmail string, requestID string) ([]*User, error) {
+	select {
+	case <-ctx.Done():
+		err := errors.New("Client closed connection")
+		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15210}).Error(err)
+		return nil, err
+	default:
+		ug, err := u.GetUgroupByID(ctx, ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15211}).Error(err)
+			return nil, err
+		}
+		var userIDs []uint
+		if effective {
+			userIDs, err = u.effectiveMemberIDs(ctx, ug.ID, requestID)
+		} else {
+			var ids map[uint]bool
+			ids, err = activeIDs(ctx, u.DBService.DB, `select user_id from ugroups_users where ugroup_id = ? and statusc = ?;`, ug.ID, common.Active)
+			userIDs = sortedIDs(ids)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15212}).Error(err)
+			return nil, err
+		}
+		users := []*User{}
+		if len(userIDs) == 0 {
+			return users, nil
+		}
+		in, args := inClause(userIDs)
+		rows, err := u.DBService.DB.QueryContext(ctx, `select id, uuid4, email, first_name, last_name, role, statusc from users where id in (`+in+`) and statusc = ? order by id;`, append(args, common.Active)...)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15213}).Error(err)
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			user := User{}
+			err = rows.Scan(&user.ID, &user.UUID4, &user.Email, &user.FirstName, &user.LastName, &user.Role, &user.Statusc)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15214}).Error(err)
+				return nil, err
+			}
+			user.IDS, err = common.UUIDBytesToStr(user.UUID4)
+			if err != nil {
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15215}).Error(err)
+				return nil, err
+			}
+			users = append(users, &user)
+		}
+		err = rows.Err()
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 15216}).Error(err)
+			return nil, err
+		}
+		return users, nil
+	}
+}
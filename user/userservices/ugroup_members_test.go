@@ -0,0 +1,112 @@
+package userservices
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cloudfresco/vilom/testhelpers"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func memberIDs(users []*User) []uint {
+	ids := []uint{}
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	return ids
+}
+
+func TestUgroupService_GetUgroupMembers(t *testing.T) {
+	var err error
+	err = testhelpers.LoadSQL(dbService)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+	requestID := "bks1m1g91jau4nkks2f0"
+	userEmail := "abcd145@gmail.com"
+
+	upOpt := *userOpt
+	upOpt.UgroupInheritance = UgroupInheritUp
+	ugroupService := NewUgroupService(dbService, redisService, &upOpt)
+
+	// ugroup1 is the parent of subugroup1 in the fixtures
+	parent, err := ugroupService.GetUgroupByIDuint(ctx, 1, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	child, err := ugroupService.GetUgroupByIDuint(ctx, 2, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = ugroupService.AddUserToGroup(ctx, &UgroupUser{UserID: 1}, child.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	users, err := ugroupService.GetUgroupMembers(ctx, parent.IDS, false, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(users) != 0 {
+		t.Errorf("UgroupService.GetUgroupMembers() = %v, want no direct members", memberIDs(users))
+		return
+	}
+	users, err = ugroupService.GetUgroupMembers(ctx, parent.IDS, true, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(memberIDs(users), []uint{1}) {
+		t.Errorf("UgroupService.GetUgroupMembers() = %v, want the member of the child", memberIDs(users))
+		return
+	}
+	ugroupIDs, err := ugroupService.EffectiveUgroupIDs(ctx, 1, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(ugroupIDs, []uint{1, 2}) {
+		t.Errorf("UgroupService.EffectiveUgroupIDs() = %v, want the child and its parent", ugroupIDs)
+		return
+	}
+
+	// the cached members are dropped when the membership changes
+	err = ugroupService.DeleteUserFromGroup(ctx, &UgroupUser{UserID: 1}, child.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	users, err = ugroupService.GetUgroupMembers(ctx, parent.IDS, true, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(users) != 0 {
+		t.Errorf("UgroupService.GetUgroupMembers() = %v, want no members after the removal", memberIDs(users))
+		return
+	}
+
+	downOpt := *userOpt
+	downOpt.UgroupInheritance = UgroupInheritDown
+	ugroupService = NewUgroupService(dbService, redisService, &downOpt)
+	err = ugroupService.AddUserToGroup(ctx, &UgroupUser{UserID: 1}, parent.IDS, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	users, err = ugroupService.GetUgroupMembers(ctx, child.IDS, true, userEmail, requestID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(memberIDs(users), []uint{1}) {
+		t.Errorf("UgroupService.GetUgroupMembers() = %v, want the member of the parent", memberIDs(users))
+	}
+}
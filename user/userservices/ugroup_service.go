@@ -74,19 +74,22 @@ type UgroupServiceIntf interface {
 	UpdateUgroup(ctx context.Context, ID string, form *Ugroup, UserID string, userEmail string, requestID string) error
 	DeleteUgroup(ctx context.Context, ID string, userEmail string, requestID string) error
 	DeleteUserFromGroup(ctx context.Context, form *UgroupUser, ID string, userEmail string, requestID string) error
+	GetUgroupMembers(ctx context.Context, ID string, effective bool, userEmail string, requestID string) ([]*User, error)
 }
 
 // UgroupService - For accessing Ugroup services
 type UgroupService struct {
 	DBService    *common.DBService
 	RedisService *common.RedisService
+	UserOptions  *common.UserOptions
 }
 
 // NewUgroupService - Create Ugroup Service
-func NewUgroupService(dbOpt *common.DBService, redisOpt *common.RedisService) *UgroupService {
+func NewUgroupService(dbOpt *common.DBService, redisOpt *common.RedisService, userOpt *common.UserOptions) *UgroupService {
 	return &UgroupService{
 		DBService:    dbOpt,
 		RedisService: redisOpt,
+		UserOptions:  userOpt,
 	}
 }
 
@@ -304,6 +307,7 @@ func (u *UgroupService) CreateChild(ctx context.Context, form *Ugroup, userEmail
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 2321}).Error(err)
 			return nil, err
 		}
+		u.invalidateMembers(requestID)
 
 		err = u.createChildPrepareStmtsClose(ctx, insertUgroupStmt, insertChildStmt, updateNumChildrenStmt, userEmail, requestID)
 		if err != nil {
@@ -589,7 +593,8 @@ func (u *UgroupService) AddUserToGroup(ctx context.Context, form *UgroupUser, ID
 			return err
 		}
 
-		if ug.NumChd > 0 {
+		// with up the members of a parent come from its children
+		if ug.NumChd > 0 && u.inheritance() == UgroupInheritUp {
 			err = errors.New("Cannot add user to group")
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 2324}).Error(err)
 			return err
@@ -651,6 +656,7 @@ func (u *UgroupService) AddUserToGroup(ctx context.Context, form *UgroupUser, ID
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 2327}).Error(err)
 			return err
 		}
+		u.invalidateMembers(requestID)
 
 		err = insertUgroupUserStmt.Close()
 		if err != nil {
@@ -1536,6 +1542,7 @@ func (u *UgroupService) DeleteUgroup(ctx context.Context, ID string, userEmail s
 			err = tx.Rollback()
 			return err
 		}
+		u.invalidateMembers(requestID)
 
 		err = stmt.Close()
 		if err != nil {
@@ -1555,8 +1562,13 @@ func (u *UgroupService) DeleteUserFromGroup(ctx context.Context, form *UgroupUse
 		log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 2360}).Error(err)
 		return err
 	default:
+		uuid4byte, err := common.UUIDStrToBytes(ID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 2409}).Error(err)
+			return err
+		}
 		db := u.DBService.DB
-		stmt, err := db.PrepareContext(ctx, `delete from ugroups_users where user_id= ? and ugroup_id = ?;`)
+		stmt, err := db.PrepareContext(ctx, `delete from ugroups_users where user_id= ? and ugroup_id = (select id from ugroups where uuid4 = ?);`)
 		if err != nil {
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 2362}).Error(err)
 			return err
@@ -1566,7 +1578,7 @@ func (u *UgroupService) DeleteUserFromGroup(ctx context.Context, form *UgroupUse
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 2361}).Error(err)
 			return err
 		}
-		_, err = tx.StmtContext(ctx, stmt).Exec(form.UserID, ID)
+		_, err = tx.StmtContext(ctx, stmt).Exec(form.UserID, uuid4byte)
 		if err != nil {
 			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 2363}).Error(err)
 			err = tx.Rollback()
@@ -1589,6 +1601,7 @@ func (u *UgroupService) DeleteUserFromGroup(ctx context.Context, form *UgroupUse
 			err = tx.Rollback()
 			return err
 		}
+		u.invalidateMembers(requestID)
 
 		err = stmt.Close()
 		if err != nil {
@@ -1599,3 +1612,83 @@ func (u *UgroupService) DeleteUserFromGroup(ctx context.Context, form *UgroupUse
 		return nil
 	}
 }
+
+// setUgroupUsers - make the users the active members of the ugroup, the
+// other members are deactivated
+func (u *UgroupService) setUgroupUsers(ctx context.Context, tx *sql.Tx, ugroupID uint, userIDs []uint, requestID string) error {
+	current, err := activeIDs(ctx, tx, `select user_id from ugroups_users where ugroup_id = ? and statusc = ?;`, ugroupID, common.Active)
+	if err != nil {
+		log.WithFields(log.Fields{"reqid": requestID, "msgnum": 2405}).Error(err)
+		return err
+	}
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	want := map[uint]bool{}
+	for _, userID := range userIDs {
+		if want[userID] {
+			continue
+		}
+		want[userID] = true
+		if current[userID] {
+			continue
+		}
+		uuid4, err := common.GetUUIDBytes()
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 2406}).Error(err)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `insert into ugroups_users
+	  (
+      uuid4,
+			ugroup_id,
+			user_id,
+			statusc,
+			created_at,
+			updated_at,
+			created_day,
+			created_week,
+			created_month,
+			created_year,
+			updated_day,
+			updated_week,
+			updated_month,
+			updated_year)
+  values (?,?,?,?,?,?,?,?,?,?,?,?,?,?);`,
+			uuid4,
+			ugroupID,
+			userID,
+			/*  StatusDates  */
+			common.Active,
+			tn,
+			tn,
+			tnday,
+			tnweek,
+			tnmonth,
+			tnyear,
+			tnday,
+			tnweek,
+			tnmonth,
+			tnyear)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 2407}).Error(err)
+			return err
+		}
+	}
+	for userID := range current {
+		if want[userID] {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, `update ugroups_users set
+		  statusc = ?,
+			updated_at = ?,
+			updated_day = ?,
+			updated_week = ?,
+			updated_month = ?,
+			updated_year = ? where ugroup_id = ? and user_id = ? and statusc = ?;`,
+			common.Inactive, tn, tnday, tnweek, tnmonth, tnyear, ugroupID, userID, common.Active)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 2408}).Error(err)
+			return err
+		}
+	}
+	return nil
+}
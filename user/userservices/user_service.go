@@ -8,12 +8,12 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/casbin/casbin/v2"
 	"github.com/dgrijalva/jwt-go"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/cloudfresco/vilom/common"
 )
@@ -26,8 +26,8 @@ const (
 	FirstNameLenMax = 100
 	LastNameLenMin  = 1
 	LastNameLenMax  = 100
-	PasswordLenMin  = 6
-	PasswordLenMax  = 50
+	PasswordLenMin  = common.PasswordMinLength
+	PasswordLenMax  = common.PasswordMaxLength
 )
 
 // User - User view representation
@@ -68,6 +68,7 @@ type User struct {
 	PasswordConfirmedAt time.Time `json:"password_confirmed_at,omitempty"`
 
 	Timezone        string    `json:"timezone,omitempty"`
+	Locale          string    `json:"locale,omitempty"`
 	SignInCount     uint      `json:"sign_in_count,omitempty"`
 	CurrentSignInAt time.Time `json:"current_sign_in_at,omitempty"`
 	LastSignInAt    time.Time `json:"last_sign_in_at,omitempty"`
@@ -84,6 +85,7 @@ type User struct {
 type LoginForm struct {
 	Email    string `json:"email" valid:"email,required"`
 	Password string `json:"password"`
+	Device   string `json:"device"`
 }
 
 // UserEmailForm - user email form
@@ -112,7 +114,7 @@ type ForgotPasswordForm struct {
 
 // UserServiceIntf - interface for User Service
 type UserServiceIntf interface {
-	Login(ctx context.Context, form *LoginForm, requestID string) (*User, error)
+	Login(ctx context.Context, form *LoginForm, clientIP string, userAgent string, requestID string) (*User, error)
 	CreateUser(ctx context.Context, form *User, hostURL string, requestID string) (*User, error)
 	GetUsers(ctx context.Context, limit string, nextCursor string, userEmail string, requestID string) (*UserCursor, error)
 	GetUserByEmail(ctx context.Context, Email string, userEmail string, requestID string) (*User, error)
@@ -122,7 +124,7 @@ type UserServiceIntf interface {
 	ConfirmEmail(ctx context.Context, token string, requestID string) error
 	ForgotPassword(ctx context.Context, form *ForgotPasswordForm, hostURL string, requestID string) error
 	ConfirmForgotPassword(ctx context.Context, form *PasswordForm, token string, requestID string) error
-	ChangePassword(ctx context.Context, form *PasswordForm, userEmail string, requestID string) error
+	ChangePassword(ctx context.Context, form *PasswordForm, sessionID string, userEmail string, requestID string) error
 	ChangeEmail(ctx context.Context, form *ChangeEmailForm, hostURL string, userEmail string, requestID string) error
 	ConfirmChangeEmail(ctx context.Context, token string, requestID string) error
 	GetAuthUserDetails(r *http.Request) (*common.ContextData, string, error)
@@ -132,14 +134,14 @@ type UserServiceIntf interface {
 type UserService struct {
 	DBService     *common.DBService
 	RedisService  *common.RedisService
-	MailerService *common.MailerService
+	MailerService common.MailerIntf
 	JWTOptions    *common.JWTOptions
 	UserOptions   *common.UserOptions
 	Enforcer      *casbin.Enforcer
 }
 
 // NewUserService - Create User Service
-func NewUserService(dbOpt *common.DBService, redisOpt *common.RedisService, mailerOpt *common.MailerService, jwtOptions *common.JWTOptions, userOpt *common.UserOptions, e *casbin.Enforcer) *UserService {
+func NewUserService(dbOpt *common.DBService, redisOpt *common.RedisService, mailerOpt common.MailerIntf, jwtOptions *common.JWTOptions, userOpt *common.UserOptions, e *casbin.Enforcer) *UserService {
 	return &UserService{
 		DBService:     dbOpt,
 		RedisService:  redisOpt,
@@ -156,6 +158,7 @@ type Roles []string
 // CustomClaims - used to type holds the token claims
 type CustomClaims struct {
 	EmailAddr string
+	SessionID string
 	jwt.StandardClaims
 }
 
@@ -166,7 +169,7 @@ type UserCursor struct {
 }
 
 // Login - used for Login user
-func (u *UserService) Login(ctx context.Context, form *LoginForm, requestID string) (*User, error) {
+func (u *UserService) Login(ctx context.Context, form *LoginForm, clientIP string, userAgent string, requestID string) (*User, error) {
 	select {
 	case <-ctx.Done():
 		err := errors.New("Client closed connection")
@@ -176,15 +179,24 @@ func (u *UserService) Login(ctx context.Context, form *LoginForm, requestID stri
 		}).Error(err)
 		return nil, err
 	default:
+		err := u.checkLoginAllowed(form.Email, clientIP, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 1703,
+			}).Error(err)
+			return nil, err
+		}
 		db := u.DBService.DB
 		user := User{}
-		row := db.QueryRowContext(ctx, `select id, email, password from users where email = ? and statusc = ?;`, form.Email, common.Active)
-		err := row.Scan(
+		row := db.QueryRowContext(ctx, `select id, email, password, locale from users where email = ? and statusc = ?;`, form.Email, common.Active)
+		err = row.Scan(
 			&user.ID,
 			&user.Email,
-			&user.Password)
+			&user.Password,
+			&user.Locale)
 
-		if err != nil {
+		if err != nil && err != sql.ErrNoRows {
 			log.WithFields(log.Fields{
 				"reqid":  requestID,
 				"msgnum": 1514,
@@ -192,16 +204,81 @@ func (u *UserService) Login(ctx context.Context, form *LoginForm, requestID stri
 			return nil, err
 		}
 
-		err = bcrypt.CompareHashAndPassword(user.Password, []byte(form.Password))
+		// new users and the users provisioned from the directory sign in
+		// with LDAP, the other users with their local password
+		ldapserv := &LDAPService{DBService: u.DBService, RedisService: u.RedisService, UserOptions: u.UserOptions}
+		if u.UserOptions.LDAP.Enabled && (err == sql.ErrNoRows || ldapserv.isLDAPUser(ctx, user.ID, requestID)) {
+			ldapUser, err := ldapserv.ldapLogin(ctx, form.Email, form.Password, requestID)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"reqid":  requestID,
+					"msgnum": 1712,
+				}).Error(err)
+				if err == common.ErrLDAPInvalidCredentials {
+					if user.ID == 0 {
+						u.loginFailed(ctx, form.Email, clientIP, nil, requestID)
+					} else {
+						u.loginFailed(ctx, form.Email, clientIP, &user, requestID)
+					}
+				}
+				return nil, err
+			}
+			user = *ldapUser
+		} else {
+			if err != nil {
+				log.WithFields(log.Fields{
+					"reqid":  requestID,
+					"msgnum": 1514,
+				}).Error(err)
+				u.loginFailed(ctx, form.Email, clientIP, nil, requestID)
+				return nil, err
+			}
+
+			err = common.ComparePassword(user.Password, form.Password)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"reqid":  requestID,
+					"msgnum": 1515,
+				}).Error(err)
+				u.loginFailed(ctx, form.Email, clientIP, &user, requestID)
+				return nil, err
+			}
+			u.rehashPassword(ctx, user.ID, user.Password, form.Password, requestID)
+		}
+		u.loginSucceeded(form.Email, requestID)
+
+		tn := time.Now().UTC()
+		// last_sign_in_at is set first, mysql assigns left to right
+		_, err = db.ExecContext(ctx, `update users set
+		  last_sign_in_at = current_sign_in_at,
+		  current_sign_in_at = ?,
+		  sign_in_count = coalesce(sign_in_count, 0) + 1 where id = ?;`, tn, user.ID)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"reqid":  requestID,
-				"msgnum": 1515,
+				"msgnum": 1702,
 			}).Error(err)
 			return nil, err
 		}
+
 		tokenDuration := time.Duration(u.JWTOptions.JWTDuration)
-		tokenStr, err := u.createJWT(form.Email, tokenDuration, requestID)
+		sessserv := &SessionService{DBService: u.DBService, RedisService: u.RedisService}
+		session := Session{
+			UserID:    user.ID,
+			Device:    form.Device,
+			UserAgent: userAgent,
+			IP:        clientIP,
+			ExpiresAt: tn.Add(time.Hour * tokenDuration),
+		}
+		err = sessserv.createSession(ctx, &session, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 1704,
+			}).Error(err)
+			return nil, err
+		}
+		tokenStr, err := u.createJWT(form.Email, session.IDS, tokenDuration, requestID)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"reqid":  requestID,
@@ -255,81 +332,35 @@ func (u *UserService) CreateUser(ctx context.Context, form *User, hostURL string
 			return nil, err
 		}
 
-		password1, err := common.HashPassword(form.PasswordS, requestID)
+		err = u.checkRegistration(form.Email)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"reqid":  requestID,
-				"msgnum": 1522,
+				"msgnum": 1700,
 			}).Error(err)
 
 			return nil, err
 		}
 
-		selector, verifier, token, err := common.GenTokenHash(requestID)
+		err = u.checkPassword(ctx, 0, form.PasswordS, requestID)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"reqid":  requestID,
-				"msgnum": 1523,
+				"msgnum": 1713,
 			}).Error(err)
 
 			return nil, err
 		}
 
-		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
-		tokenExpiry, _ := time.ParseDuration(u.UserOptions.ConfirmTokenDuration)
-
-		user := User{}
-		user.UUID4, err = common.GetUUIDBytes()
+		user, err := u.newUser(form, u.UserOptions.DefaultRole, requestID)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"reqid":  requestID,
-				"msgnum": 1524,
+				"msgnum": 1701,
 			}).Error(err)
 
 			return nil, err
 		}
-		user.AuthToken = ""
-		user.Email = form.Email
-		user.Username = form.Email
-		user.FirstName = form.FirstName
-		user.LastName = form.LastName
-		user.Password = password1
-		user.Role = form.Role
-		user.Active = false
-		user.EmailConfirmationToken = token
-		user.EmailSelector = selector
-		user.EmailVerifier = verifier
-		user.EmailTokenSentAt = tn
-		user.EmailTokenExpiry = tn.Add(tokenExpiry)
-		user.EmailConfirmedAt = tn
-		user.NewEmail = ""
-		user.NewEmailResetToken = ""
-		user.NewEmailSelector = ""
-		user.NewEmailVerifier = ""
-		user.NewEmailTokenSentAt = tn
-		user.NewEmailTokenExpiry = tn
-		user.NewEmailConfirmedAt = tn
-		user.PasswordResetToken = ""
-		user.PasswordSelector = ""
-		user.PasswordVerifier = ""
-		user.PasswordTokenSentAt = tn
-		user.PasswordTokenExpiry = tn
-		user.PasswordConfirmedAt = tn
-		user.Timezone = "Asia/Kolkata"
-		user.SignInCount = 0
-		user.CurrentSignInAt = tn
-		user.LastSignInAt = tn
-		user.Statusc = common.Active
-		user.CreatedAt = tn
-		user.UpdatedAt = tn
-		user.CreatedDay = tnday
-		user.CreatedWeek = tnweek
-		user.CreatedMonth = tnmonth
-		user.CreatedYear = tnyear
-		user.UpdatedDay = tnday
-		user.UpdatedWeek = tnweek
-		user.UpdatedMonth = tnmonth
-		user.UpdatedYear = tnyear
 
 		insertUserStmt, err := u.insertUserPrepare(ctx, requestID)
 		if err != nil {
@@ -349,7 +380,7 @@ func (u *UserService) CreateUser(ctx context.Context, form *User, hostURL string
 
 			return nil, err
 		}
-		err = u.insertUser(ctx, insertUserStmt, tx, &user, hostURL, requestID)
+		err = u.insertUser(ctx, insertUserStmt, tx, user, hostURL, requestID)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"reqid":  requestID,
@@ -383,24 +414,128 @@ func (u *UserService) CreateUser(ctx context.Context, form *User, hostURL string
 			"reqid":  requestID,
 			"msgnum": 1526,
 		}).Error(err)
-		return &user, nil
+		return user, nil
+	}
+}
+
+// checkRegistration - whether the registration policy lets email sign up
+// without an invite
+func (u *UserService) checkRegistration(email string) error {
+	switch u.UserOptions.Registration {
+	case RegistrationInvite:
+		return errors.New("Registration is by invitation only")
+	case RegistrationDomains:
+		i := strings.LastIndex(email, "@")
+		domain := strings.ToLower(email[i+1:])
+		for _, allowed := range u.UserOptions.AllowedDomains {
+			if domain == strings.ToLower(allowed) {
+				return nil
+			}
+		}
+		return errors.New("Registration is not open to this email domain")
+	}
+	return nil
+}
+
+// newUser - the user to insert for the signup form, with the given role;
+// the role is never taken from the form
+func (u *UserService) newUser(form *User, role string, requestID string) (*User, error) {
+	password1, err := common.HashPassword(form.PasswordS, &u.UserOptions.Password, requestID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"reqid":  requestID,
+			"msgnum": 1522,
+		}).Error(err)
+
+		return nil, err
+	}
+
+	selector, verifier, token, err := common.GenTokenHash(requestID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"reqid":  requestID,
+			"msgnum": 1523,
+		}).Error(err)
+
+		return nil, err
+	}
+
+	tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
+	tokenExpiry, _ := time.ParseDuration(u.UserOptions.ConfirmTokenDuration)
+
+	user := User{}
+	user.UUID4, err = common.GetUUIDBytes()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"reqid":  requestID,
+			"msgnum": 1524,
+		}).Error(err)
+
+		return nil, err
+	}
+	user.AuthToken = ""
+	user.Email = form.Email
+	user.Username = form.Email
+	user.FirstName = form.FirstName
+	user.LastName = form.LastName
+	user.Password = password1
+	user.Role = role
+	user.Active = false
+	user.EmailConfirmationToken = token
+	user.EmailSelector = selector
+	user.EmailVerifier = verifier
+	user.EmailTokenSentAt = tn
+	user.EmailTokenExpiry = tn.Add(tokenExpiry)
+	user.EmailConfirmedAt = tn
+	user.NewEmail = ""
+	user.NewEmailResetToken = ""
+	user.NewEmailSelector = ""
+	user.NewEmailVerifier = ""
+	user.NewEmailTokenSentAt = tn
+	user.NewEmailTokenExpiry = tn
+	user.NewEmailConfirmedAt = tn
+	user.PasswordResetToken = ""
+	user.PasswordSelector = ""
+	user.PasswordVerifier = ""
+	user.PasswordTokenSentAt = tn
+	user.PasswordTokenExpiry = tn
+	user.PasswordConfirmedAt = tn
+	user.Timezone = "Asia/Kolkata"
+	user.Locale = common.MatchLocale(form.Locale)
+	if user.Locale == "" {
+		user.Locale = common.DefaultLocale
 	}
+	user.SignInCount = 0
+	user.CurrentSignInAt = tn
+	user.LastSignInAt = tn
+	user.Statusc = common.Active
+	user.CreatedAt = tn
+	user.UpdatedAt = tn
+	user.CreatedDay = tnday
+	user.CreatedWeek = tnweek
+	user.CreatedMonth = tnmonth
+	user.CreatedYear = tnyear
+	user.UpdatedDay = tnday
+	user.UpdatedWeek = tnweek
+	user.UpdatedMonth = tnmonth
+	user.UpdatedYear = tnyear
+	return &user, nil
 }
 
 // createJWT - Create jwt token
-func (u *UserService) createJWT(emailAddr string, tokenDuration time.Duration, requestID string) (string, error) {
+func (u *UserService) createJWT(emailAddr string, sessionID string, tokenDuration time.Duration, requestID string) (string, error) {
 	tn, _, _, _, _ := common.GetTimeDetails()
 	claims := CustomClaims{
 		EmailAddr: emailAddr,
+		SessionID: sessionID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: tn.Add(time.Hour * tokenDuration).Unix(),
+			IssuedAt:  tn.Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign token with key
-	tokenString, err := token.SignedString(u.JWTOptions.JWTKey)
+	// Sign token with the signing key
+	tokenString, err := common.SignJWT(u.JWTOptions, claims)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"reqid":  requestID,
@@ -457,6 +592,7 @@ func (u *UserService) insertUserPrepare(ctx context.Context, requestID string) (
 		password_token_expiry,
 		password_confirmed_at,
 		timezone,
+		locale,
 		sign_in_count,
 		current_sign_in_at,
 		last_sign_in_at,
@@ -475,7 +611,7 @@ func (u *UserService) insertUserPrepare(ctx context.Context, requestID string) (
 					?,?,?,?,?,?,?,?,?,?,
 					?,?,?,?,?,?,?,?,?,?,
 					?,?,?,?,?,?,?,?,?,?,
-          ?,?,?);`)
+          ?,?,?,?);`)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"reqid":  requestID,
@@ -530,6 +666,7 @@ func (u *UserService) insertUser(ctx context.Context, stmt *sql.Stmt, tx *sql.Tx
 			user.PasswordTokenExpiry,
 			user.PasswordConfirmedAt,
 			user.Timezone,
+			user.Locale,
 			user.SignInCount,
 			user.CurrentSignInAt,
 			user.LastSignInAt,
@@ -568,18 +705,18 @@ func (u *UserService) insertUser(ctx context.Context, stmt *sql.Stmt, tx *sql.Tx
 		}
 		user.IDS = uuid4Str
 
-		hostURL := ""
 		if hostURL != "" {
 			pwd, _ := os.Getwd()
-			viewpath := pwd + filepath.FromSlash("/common/views/confirmation.html")
+			viewsDir := pwd + filepath.FromSlash("/common/views")
+			subject := common.T(user.Locale, "email.confirmation.subject")
 			templateData := struct {
 				Title string
 				URL   string
 			}{
-				Title: "Confirmation",
+				Title: subject,
 				URL:   "http://" + hostURL + "/u/confirmation/" + user.EmailConfirmationToken,
 			}
-			ConfirmationEmail, err := common.ParseTemplate(viewpath, templateData)
+			ConfirmationEmail, ConfirmationText, err := common.RenderEmail(viewsDir, user.Locale, "confirmation", templateData)
 			if err != nil {
 				log.WithFields(log.Fields{
 					"reqid":  requestID,
@@ -590,12 +727,13 @@ func (u *UserService) insertUser(ctx context.Context, stmt *sql.Stmt, tx *sql.Tx
 			}
 
 			email := common.Email{
-				To:      user.Email,
-				Subject: "Confirmation",
-				Body:    ConfirmationEmail,
+				To:       user.Email,
+				Subject:  subject,
+				Body:     ConfirmationEmail,
+				TextBody: ConfirmationText,
 			}
 
-			err = u.MailerService.SendMail(email)
+			err = common.QueueEmail(ctx, tx, email, requestID)
 			if err != nil {
 				log.WithFields(log.Fields{
 					"reqid":  requestID,
@@ -719,6 +857,7 @@ func (u *UserService) GetUserByEmail(ctx context.Context, Email string, userEmai
 		last_name,
 		role,
 		active,
+		locale,
 		statusc,
 		created_at,
 		updated_at,
@@ -740,6 +879,7 @@ func (u *UserService) GetUserByEmail(ctx context.Context, Email string, userEmai
 			&user.LastName,
 			&user.Role,
 			&user.Active,
+			&user.Locale,
 			/*  StatusDates  */
 			&user.Statusc,
 			&user.CreatedAt,
@@ -798,6 +938,7 @@ func (u *UserService) GetUser(ctx context.Context, ID string, userEmail string,
 		last_name,
 		role,
 		active,
+		locale,
 		statusc,
 		created_at,
 		updated_at,
@@ -819,6 +960,7 @@ func (u *UserService) GetUser(ctx context.Context, ID string, userEmail string,
 			&user.LastName,
 			&user.Role,
 			&user.Active,
+			&user.Locale,
 			/*  StatusDates  */
 			&user.Statusc,
 			&user.CreatedAt,
@@ -863,11 +1005,22 @@ func (u *UserService) UpdateUser(ctx context.Context, ID string, form *User, Use
 			return err
 		}
 
+		locale := user.Locale
+		if form.Locale != "" {
+			locale = common.MatchLocale(form.Locale)
+			if locale == "" {
+				err = errors.New("Unsupported locale")
+				log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 1596}).Error(err)
+				return err
+			}
+		}
+
 		db := u.DBService.DB
 		tn, tnday, tnweek, tnmonth, tnyear := common.GetTimeDetails()
 		stmt, err := db.PrepareContext(ctx, `update users set 
 		  first_name = ?,
       last_name = ?,
+      locale = ?,
 			updated_at = ?, 
 			updated_day = ?, 
 			updated_week = ?, 
@@ -891,6 +1044,7 @@ func (u *UserService) UpdateUser(ctx context.Context, ID string, form *User, Use
 		_, err = tx.StmtContext(ctx, stmt).Exec(
 			form.FirstName,
 			form.LastName,
+			locale,
 			tn,
 			tnday,
 			tnweek,
@@ -996,6 +1150,14 @@ func (u *UserService) DeleteUser(ctx context.Context, ID string, userEmail strin
 			return err
 		}
 
+		// a deleted user is signed out everywhere
+		sessserv := &SessionService{DBService: u.DBService, RedisService: u.RedisService}
+		err = sessserv.signOutUser(ctx, ID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 1707}).Error(err)
+			return err
+		}
+
 		return nil
 	}
 }
@@ -1183,6 +1345,36 @@ func (u *UserService) ForgotPassword(ctx context.Context, form *ForgotPasswordFo
 		UpdatedMonth := tnmonth
 		UpdatedYear := tnyear
 
+		pwd, _ := os.Getwd()
+		viewsDir := pwd + filepath.FromSlash("/common/views")
+		subject := common.T(user.Locale, "email.reset_password.subject")
+
+		templateData := struct {
+			Title string
+			URL   string
+		}{
+			Title: subject,
+			URL:   "http://" + hostURL + "/u/reset_password/" + token,
+		}
+
+		ResetPasswordEmail, ResetPasswordText, err := common.RenderEmail(viewsDir, user.Locale, "reset_password", templateData)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 1549,
+			}).Error(err)
+
+			return err
+		}
+
+		recipient := user.Email
+		email := common.Email{
+			To:       recipient,
+			Subject:  subject,
+			Body:     ResetPasswordEmail,
+			TextBody: ResetPasswordText,
+		}
+
 		stmt, err := db.PrepareContext(ctx, `update users set 
 		    password_reset_token = ?,
 				password_selector = ?,
@@ -1247,17 +1439,31 @@ func (u *UserService) ForgotPassword(ctx context.Context, form *ForgotPasswordFo
 			return err
 		}
 
-		err = tx.Commit()
+		err = common.QueueEmail(ctx, tx, email, requestID)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"reqid":  requestID,
-				"msgnum": 1548,
+				"msgnum": 1550,
 			}).Error(err)
-
-			return err
+			err = tx.Rollback()
+			if err != nil {
+				log.WithFields(log.Fields{
+					"reqid":  requestID,
+					"msgnum": 1550,
+				}).Error(err)
+			}
+			err = stmt.Close()
+			if err != nil {
+				log.WithFields(log.Fields{
+					"reqid":  requestID,
+					"msgnum": 1550,
+				}).Error(err)
+				return err
+			}
+			return errors.New("Could not queue the reset password email")
 		}
 
-		err = stmt.Close()
+		err = tx.Commit()
 		if err != nil {
 			log.WithFields(log.Fields{
 				"reqid":  requestID,
@@ -1267,43 +1473,16 @@ func (u *UserService) ForgotPassword(ctx context.Context, form *ForgotPasswordFo
 			return err
 		}
 
-		pwd, _ := os.Getwd()
-		viewpath := pwd + filepath.FromSlash("/common/views/reset_password.html")
-
-		templateData := struct {
-			Title string
-			URL   string
-		}{
-			Title: "Reset Password",
-			URL:   "http://" + hostURL + "/u/reset_password/" + token,
-		}
-
-		ResetPasswordEmail, err := common.ParseTemplate(viewpath, templateData)
+		err = stmt.Close()
 		if err != nil {
 			log.WithFields(log.Fields{
 				"reqid":  requestID,
-				"msgnum": 1549,
+				"msgnum": 1548,
 			}).Error(err)
 
 			return err
 		}
 
-		recipient := user.Email
-		email := common.Email{
-			To:      recipient,
-			Subject: "Reset Passowrd",
-			Body:    ResetPasswordEmail,
-		}
-
-		err = u.MailerService.SendMail(email)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"reqid":  requestID,
-				"msgnum": 1550,
-			}).Error(err)
-			return err
-		}
-
 		return nil
 	}
 }
@@ -1316,15 +1495,6 @@ func (u *UserService) ConfirmForgotPassword(ctx context.Context, form *PasswordF
 		return err
 	default:
 		db := u.DBService.DB
-		password1, err := common.HashPassword(form.Password, requestID)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"reqid":  requestID,
-				"msgnum": 1551,
-			}).Error(err)
-
-		}
-
 		verifierBytes, selector, err := common.GetSelectorForPasswdRecoveryToken(token, requestID)
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -1362,11 +1532,29 @@ func (u *UserService) ConfirmForgotPassword(ctx context.Context, form *PasswordF
 			return err
 		}
 
+		err = u.checkPassword(ctx, user.ID, form.Password, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 1714,
+			}).Error(err)
+			return err
+		}
+
+		password1, err := common.HashPassword(form.Password, &u.UserOptions.Password, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 1551,
+			}).Error(err)
+			return err
+		}
+
 		stmt, err := db.PrepareContext(ctx, `update users set 
 		    password_reset_token = ?,
 				password_selector = ?,
 				password_verifier = ?,
-        password_confirmed_at = ?
+        password_confirmed_at = ?,
 		    password = ?,
 		    statusc = ?,
         active = ?,
@@ -1399,6 +1587,17 @@ func (u *UserService) ConfirmForgotPassword(ctx context.Context, form *PasswordF
 			return err
 		}
 
+		err = u.recordPasswordHistory(ctx, tx, user.ID, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"reqid":  requestID,
+				"msgnum": 1715,
+			}).Error(err)
+			_ = tx.Rollback()
+			_ = stmt.Close()
+			return err
+		}
+
 		_, err = tx.StmtContext(ctx, stmt).Exec(
 			"",
 			"",
@@ -1454,12 +1653,19 @@ func (u *UserService) ConfirmForgotPassword(ctx context.Context, form *PasswordF
 			return err
 		}
 
+		sessserv := &SessionService{DBService: u.DBService, RedisService: u.RedisService}
+		err = sessserv.revokeUserSessions(ctx, user.ID, "", "", requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"reqid": requestID, "msgnum": 1709}).Error(err)
+			return err
+		}
+
 		return nil
 	}
 }
 
 // ChangePassword - used to update password
-func (u *UserService) ChangePassword(ctx context.Context, form *PasswordForm, userEmail string, requestID string) error {
+func (u *UserService) ChangePassword(ctx context.Context, form *PasswordForm, sessionID string, userEmail string, requestID string) error {
 	select {
 	case <-ctx.Done():
 		err := errors.New("Client closed connection")
@@ -1491,8 +1697,7 @@ func (u *UserService) ChangePassword(ctx context.Context, form *PasswordForm, us
 			return err
 		}
 
-		err = bcrypt.CompareHashAndPassword(user.Password,
-			[]byte(form.CurrentPassword))
+		err = common.ComparePassword(user.Password, form.CurrentPassword)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"user":   userEmail,
@@ -1509,13 +1714,24 @@ func (u *UserService) ChangePassword(ctx context.Context, form *PasswordForm, us
 		UpdatedMonth := tnmonth
 		UpdatedYear := tnyear
 
-		password1, err := common.HashPassword(form.Password, requestID)
+		err = u.checkPassword(ctx, user.ID, form.Password, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"user":   userEmail,
+				"reqid":  requestID,
+				"msgnum": 1716,
+			}).Error(err)
+			return err
+		}
+
+		password1, err := common.HashPassword(form.Password, &u.UserOptions.Password, requestID)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"user":   userEmail,
 				"reqid":  requestID,
 				"msgnum": 1564,
 			}).Error(err)
+			return err
 		}
 		stmt, err := db.PrepareContext(ctx, `update users set 
 		    password = ?,
@@ -1541,6 +1757,17 @@ func (u *UserService) ChangePassword(ctx context.Context, form *PasswordForm, us
 			}).Error(err)
 			return err
 		}
+		err = u.recordPasswordHistory(ctx, tx, user.ID, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"user":   userEmail,
+				"reqid":  requestID,
+				"msgnum": 1717,
+			}).Error(err)
+			_ = tx.Rollback()
+			_ = stmt.Close()
+			return err
+		}
 		_, err = tx.StmtContext(ctx, stmt).Exec(
 			password1,
 			tn,
@@ -1592,6 +1819,14 @@ func (u *UserService) ChangePassword(ctx context.Context, form *PasswordForm, us
 			return err
 		}
 
+		// the other devices must sign in with the new password
+		sessserv := &SessionService{DBService: u.DBService, RedisService: u.RedisService}
+		err = sessserv.revokeUserSessions(ctx, user.ID, sessionID, userEmail, requestID)
+		if err != nil {
+			log.WithFields(log.Fields{"user": userEmail, "reqid": requestID, "msgnum": 1708}).Error(err)
+			return err
+		}
+
 		return nil
 	}
 }
@@ -1638,6 +1873,36 @@ func (u *UserService) ChangeEmail(ctx context.Context, form *ChangeEmailForm, ho
 		UpdatedMonth := tnmonth
 		UpdatedYear := tnyear
 
+		pwd, _ := os.Getwd()
+		viewsDir := pwd + filepath.FromSlash("/common/views")
+		subject := common.T(user.Locale, "email.change_email.subject")
+
+		templateData := struct {
+			Title string
+			URL   string
+		}{
+			Title: subject,
+			URL:   "http://" + hostURL + "/users/change_email/" + token,
+		}
+
+		ChangeEmail, ChangeEmailText, err := common.RenderEmail(viewsDir, user.Locale, "change_email", templateData)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"user":   userEmail,
+				"reqid":  requestID,
+				"msgnum": 1574,
+			}).Error(err)
+			return err
+		}
+
+		recipient := form.NewEmail
+		email := common.Email{
+			To:       recipient,
+			Subject:  subject,
+			Body:     ChangeEmail,
+			TextBody: ChangeEmailText,
+		}
+
 		stmt, err := db.PrepareContext(ctx, `update users set 
         new_email = ?,
 		    new_email_reset_token = ?,
@@ -1706,60 +1971,47 @@ func (u *UserService) ChangeEmail(ctx context.Context, form *ChangeEmailForm, ho
 			return err
 		}
 
-		err = tx.Commit()
-		if err != nil {
-			log.WithFields(log.Fields{
-				"reqid":  requestID,
-				"msgnum": 1572,
-			}).Error(err)
-
-			return err
-		}
-
-		err = stmt.Close()
+		err = common.QueueEmail(ctx, tx, email, requestID)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"user":   userEmail,
 				"reqid":  requestID,
-				"msgnum": 1573,
+				"msgnum": 1575,
 			}).Error(err)
-			return err
-		}
-
-		pwd, _ := os.Getwd()
-		viewpath := pwd + filepath.FromSlash("/common/views/change_email.html")
-
-		templateData := struct {
-			Title string
-			URL   string
-		}{
-			Title: "Change Email",
-			URL:   "http://" + hostURL + "/users/change_email/" + token,
+			err = tx.Rollback()
+			if err != nil {
+				log.WithFields(log.Fields{
+					"reqid":  requestID,
+					"msgnum": 1575,
+				}).Error(err)
+			}
+			err = stmt.Close()
+			if err != nil {
+				log.WithFields(log.Fields{
+					"reqid":  requestID,
+					"msgnum": 1575,
+				}).Error(err)
+				return err
+			}
+			return errors.New("Could not queue the change email confirmation")
 		}
 
-		ChangeEmail, err := common.ParseTemplate(viewpath, templateData)
+		err = tx.Commit()
 		if err != nil {
 			log.WithFields(log.Fields{
-				"user":   userEmail,
 				"reqid":  requestID,
-				"msgnum": 1574,
+				"msgnum": 1572,
 			}).Error(err)
-			return err
-		}
 
-		recipient := form.NewEmail
-		email := common.Email{
-			To:      recipient,
-			Subject: "Change Email",
-			Body:    ChangeEmail,
+			return err
 		}
 
-		err = u.MailerService.SendMail(email)
+		err = stmt.Close()
 		if err != nil {
 			log.WithFields(log.Fields{
 				"user":   userEmail,
 				"reqid":  requestID,
-				"msgnum": 1575,
+				"msgnum": 1573,
 			}).Error(err)
 			return err
 		}
@@ -1924,9 +2176,35 @@ func (u *UserService) ConfirmChangeEmail(ctx context.Context, token string, requ
 // If the auth token has not been stored in Redis, we run a query
 // to get the details of the user from the db, and store then in Redis
 // for future requests to use
+// Bots and personal access tokens send an API token instead of a JWT,
+// the user is found by the hash of the token in api_tokens, and a token
+// with scopes is limited to them on top of the role
+// With client_cert mode cert, a request without a token is made as the
+// user its client certificate maps to
+// A JWT is checked against its session; a JWT issued before sessions were
+// recorded has none and is accepted until it expires or the sessions of
+// its user are revoked
 func (u *UserService) GetAuthUserDetails(r *http.Request) (*common.ContextData, string, error) {
 	data := r.Context().Value(common.KeyEmailToken).(common.ContextStruct)
-	resp, err := u.RedisService.Get(data.TokenString)
+	var cacheKey string
+	var cacheDuration time.Duration
+	if data.APIToken {
+		cacheKey = apiTokenCacheKey(common.HashAPIToken(data.TokenString))
+		cacheDuration = SessionCacheDuration
+	} else if data.SessionID != "" {
+		cacheKey = sessionCacheKey(data.SessionID)
+		cacheDuration = SessionCacheDuration
+	} else if data.TokenString == "" && data.ClientCert != "" {
+		// authenticated by the mapped client certificate only
+		cacheKey = clientCertCacheKey(data.ClientCert)
+		cacheDuration = SessionCacheDuration
+	} else {
+		// tokens issued before sessions were recorded are accepted until
+		// they expire, as long as their user is active
+		cacheKey = legacyTokenCacheKey(data.Email)
+		cacheDuration = SessionCacheDuration
+	}
+	resp, err := u.RedisService.Get(cacheKey)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"msgnum": 268,
@@ -1936,8 +2214,38 @@ func (u *UserService) GetAuthUserDetails(r *http.Request) (*common.ContextData,
 	if resp == "" {
 		user := User{}
 		db := u.DBService.DB
-		row := db.QueryRow(`select id, uuid4, email, role from users where email = ?;`, data.Email)
-		err = row.Scan(&user.ID, &user.UUID4, &user.Email, &user.Role)
+		var scopes string
+		var expiresAt sql.NullTime
+		tn, _, _, _, _ := common.GetTimeDetails()
+		if data.APIToken {
+			row := db.QueryRow(`select u.id, u.uuid4, u.email, u.role, t.scopes, t.expires_at from api_tokens t inner join users u on (t.user_id = u.id) where t.token_hash = ? and t.statusc = ? and (t.expires_at is null or t.expires_at > ?) and u.statusc = ?;`, common.HashAPIToken(data.TokenString), common.Active, tn, common.Active)
+			err = row.Scan(&user.ID, &user.UUID4, &user.Email, &user.Role, &scopes, &expiresAt)
+		} else if data.TokenString == "" {
+			row := db.QueryRow(`select id, uuid4, email, role from users where email = ? and statusc = ?;`, data.ClientCert, common.Active)
+			err = row.Scan(&user.ID, &user.UUID4, &user.Email, &user.Role)
+		} else if data.SessionID == "" {
+			var validAfter sql.NullTime
+			row := db.QueryRow(`select id, uuid4, email, role, tokens_valid_after from users where email = ? and statusc = ?;`, data.Email, common.Active)
+			err = row.Scan(&user.ID, &user.UUID4, &user.Email, &user.Role, &validAfter)
+			if err == nil && validAfter.Valid && data.IssuedAt <= validAfter.Time.Unix() {
+				log.WithFields(log.Fields{
+					"user":   data.Email,
+					"msgnum": 1718,
+				}).Error("Token issued before the sessions were revoked")
+				return nil, "", errors.New("Session expired")
+			}
+		} else {
+			var sessionUUID4 []byte
+			sessionUUID4, err = common.UUIDStrToBytes(data.SessionID)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"msgnum": 1706,
+				}).Error(err)
+				return nil, "", errors.New("Session expired")
+			}
+			row := db.QueryRow(`select u.id, u.uuid4, u.email, u.role from sessions s inner join users u on (s.user_id = u.id) where s.uuid4 = ? and s.statusc = ? and s.expires_at > ? and u.email = ? and u.statusc = ?;`, sessionUUID4, common.Active, tn, data.Email, common.Active)
+			err = row.Scan(&user.ID, &user.UUID4, &user.Email, &user.Role)
+		}
 		if user.ID == 0 {
 			log.WithFields(log.Fields{
 				"msgnum": 261,
@@ -1964,6 +2272,13 @@ func (u *UserService) GetAuthUserDetails(r *http.Request) (*common.ContextData,
 			roles = append(roles, user.Role)
 		}
 		v.Roles = roles
+		if scopes != "" {
+			v.Scopes = strings.Split(scopes, ",")
+		}
+		// an expiring token is not cached past its expiry
+		if expiresAt.Valid && expiresAt.Time.Sub(tn) < cacheDuration {
+			cacheDuration = expiresAt.Time.Sub(tn)
+		}
 		usr, err := json.Marshal(v)
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -1971,7 +2286,7 @@ func (u *UserService) GetAuthUserDetails(r *http.Request) (*common.ContextData,
 			}).Error(err)
 			return nil, "", errors.New("User not found")
 		}
-		err = u.RedisService.Set(data.TokenString, usr, 0)
+		err = u.RedisService.RedisClient.Set(cacheKey, usr, cacheDuration).Err()
 		if err != nil {
 			log.WithFields(log.Fields{
 				"msgnum": 265,
@@ -1986,6 +2301,16 @@ func (u *UserService) GetAuthUserDetails(r *http.Request) (*common.ContextData,
 			}).Error(err)
 		}
 	}
+	// with client_cert mode both, the token and the certificate must be
+	// of the same user
+	if data.ClientCert != "" && v.Email != data.ClientCert {
+		err = errors.New("The client certificate does not match the token")
+		log.WithFields(log.Fields{
+			"user":   v.Email,
+			"msgnum": 1711,
+		}).Error(err)
+		return nil, "", err
+	}
 	err = u.CheckRoles(r, v.Roles)
 	if err != nil {
 		log.WithFields(log.Fields{
@@ -1993,7 +2318,24 @@ func (u *UserService) GetAuthUserDetails(r *http.Request) (*common.ContextData,
 		}).Error(err)
 		return nil, "", err
 	}
-	return &v, common.GetRequestID(), nil
+	if !common.CheckScopes(r, v.Scopes) {
+		err = errors.New("The token scopes do not allow this request")
+		log.WithFields(log.Fields{
+			"msgnum": 1710,
+		}).Error(err)
+		return nil, "", err
+	}
+	requestID := common.GetRequestID()
+	if data.APIToken {
+		tokserv := &TokenService{DBService: u.DBService, RedisService: u.RedisService}
+		tokserv.touchAPIToken(common.HashAPIToken(data.TokenString), requestID)
+	}
+	if data.SessionID != "" {
+		v.SessionID = data.SessionID
+		sessserv := &SessionService{DBService: u.DBService, RedisService: u.RedisService}
+		sessserv.touchSession(data.SessionID, requestID)
+	}
+	return &v, requestID, nil
 }
 
 // CheckRoles - used for checking roles
@@ -0,0 +1,27 @@
+package userservices
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/cloudfresco/vilom/common"
+	"github.com/cloudfresco/vilom/testhelpers"
+)
+
+var dbService *common.DBService
+var redisService *common.RedisService
+var userOpt *common.UserOptions
+var roleOpt *common.RoleOptions
+
+func TestMain(m *testing.M) {
+	var err error
+
+	dbService, redisService, _, userOpt, roleOpt, err = testhelpers.InitTest()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(m.Run())
+
+}